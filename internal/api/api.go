@@ -0,0 +1,126 @@
+// Package api holds the conventions shared by every route of the versioned
+// REST API: the error envelope and pagination.
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// V1Prefix is the path prefix of the versioned API
+const V1Prefix = "/api/v1"
+
+// Error codes in the error envelope
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeUnavailable      = "unavailable"
+	CodeConnectionFailed = "connection_failed"
+	CodeCLINotFound      = "cli_not_found"
+	CodeRemoteFailed     = "remote_command_failed"
+	CodeInternal         = "internal"
+)
+
+// statuses is the HTTP status each error code is returned with
+var statuses = map[string]int{
+	CodeInvalidRequest:   http.StatusBadRequest,
+	CodeUnauthorized:     http.StatusUnauthorized,
+	CodeForbidden:        http.StatusForbidden,
+	CodeNotFound:         http.StatusNotFound,
+	CodeConflict:         http.StatusConflict,
+	CodeUnavailable:      http.StatusServiceUnavailable,
+	CodeConnectionFailed: http.StatusBadGateway,
+	CodeCLINotFound:      http.StatusUnprocessableEntity,
+	CodeRemoteFailed:     http.StatusBadGateway,
+	CodeInternal:         http.StatusInternalServerError,
+}
+
+// Status is the HTTP status for an error code; unknown codes are 500
+func Status(code string) int {
+	if status, ok := statuses[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Pagination limits
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 500
+)
+
+// Error describes why a request failed. Code is stable and meant for
+// programs; Message is for people. Details, when set, is what the
+// operation produced before it failed, such as a remote command's output.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+}
+
+// ErrorResponse is the body of every versioned API error
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+// Abort ends the request with an error envelope
+func Abort(c *gin.Context, status int, code, message string) {
+	AbortWithDetails(c, status, code, message, nil)
+}
+
+// AbortWithDetails ends the request with an error envelope carrying details
+func AbortWithDetails(c *gin.Context, status int, code, message string, details any) {
+	c.AbortWithStatusJSON(status, ErrorResponse{Error: Error{Code: code, Message: message, Details: details}})
+}
+
+// Versioned reports whether the request is for the versioned API, whose
+// errors use the envelope even when raised by middleware
+func Versioned(c *gin.Context) bool {
+	return strings.HasPrefix(c.Request.URL.Path, V1Prefix+"/")
+}
+
+// Page is one page of a list. Total counts the items across all pages.
+type Page[T any] struct {
+	Items  []T `json:"items"`
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// PageParams reads the limit and offset query parameters
+func PageParams(c *gin.Context) (limit, offset int, err error) {
+	limit, offset = DefaultPageLimit, 0
+	if value := c.Query("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > MaxPageLimit {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", MaxPageLimit)
+		}
+	}
+	if value := c.Query("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset must be a non-negative integer")
+		}
+	}
+	return limit, offset, nil
+}
+
+// Paginate returns the page of items selected by limit and offset
+func Paginate[T any](items []T, limit, offset int) Page[T] {
+	page := Page[T]{Items: []T{}, Total: len(items), Limit: limit, Offset: offset}
+	if offset < len(items) {
+		end := offset + limit
+		if end > len(items) {
+			end = len(items)
+		}
+		page.Items = items[offset:end]
+	}
+	return page
+}
@@ -0,0 +1,291 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionCheckLicenseCLI = "check-license-cli"
+	ActionDownloadSysinfo = "download-sysinfo"
+	ActionUploadLicense   = "upload-license"
+	ActionPreflight       = "preflight"
+	ActionServerPut       = "server-put"
+	ActionServerDelete    = "server-delete"
+	ActionWebhookCreate   = "webhook-create"
+	ActionWebhookDelete   = "webhook-delete"
+	ActionSubscribe       = "subscribe"
+	ActionUnsubscribe     = "unsubscribe"
+	ActionChatRouteCreate = "chat-route-create"
+	ActionChatRouteDelete = "chat-route-delete"
+	ActionRolloutCreate   = "rollout-create"
+	ActionRolloutCancel   = "rollout-cancel"
+	ActionRolloutResume   = "rollout-resume"
+	ActionRolloutAbort    = "rollout-abort"
+	ActionConnect         = "connect"
+	ActionExec            = "exec"
+)
+
+// Outcomes recorded in the audit log
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// genesisHash is the previous-hash value of the first record in a log
+const genesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// Record is a single entry in the audit log
+type Record struct {
+	Seq           uint64    `json:"seq"`
+	Time          time.Time `json:"time"`
+	Actor         string    `json:"actor"`
+	Action        string    `json:"action"`
+	Host          string    `json:"host,omitempty"`
+	Server        string    `json:"server,omitempty"`
+	RemoteUser    string    `json:"remote_user,omitempty"`
+	LicenseFile   string    `json:"license_file,omitempty"`
+	LicenseSHA256 string    `json:"license_sha256,omitempty"`
+	LicenseExpiry string    `json:"license_expiry,omitempty"`
+	SysinfoSHA256 string    `json:"sysinfo_sha256,omitempty"`
+	Command       string    `json:"command,omitempty"`
+	Outcome       string    `json:"outcome"`
+	ExitStatus    int       `json:"exit_status"`
+	DurationMS    int64     `json:"duration_ms"`
+	Error         string    `json:"error,omitempty"`
+	PrevHash      string    `json:"prev_hash"`
+	Hash          string    `json:"hash"`
+}
+
+// Filter selects records from the audit log. Zero values match everything.
+type Filter struct {
+	Actor   string
+	Action  string
+	Host    string
+	Outcome string
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+}
+
+// Log is an append-only, hash-chained audit log backed by a JSON-lines file
+type Log struct {
+	mu       sync.Mutex
+	path     string
+	lastSeq  uint64
+	lastHash string
+}
+
+// Open opens the audit log at path, creating it if needed. New records are
+// chained onto the last existing entry; use Verify to check the chain.
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %v", err)
+	}
+
+	l := &Log{path: path, lastHash: genesisHash}
+
+	records, err := l.readAll()
+	if err != nil {
+		return nil, err
+	}
+	if n := len(records); n > 0 {
+		l.lastSeq = records[n-1].Seq
+		l.lastHash = records[n-1].Hash
+	}
+
+	return l, nil
+}
+
+// Path returns the location of the audit log file
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Append chains rec onto the log and writes it to disk. A nil Log discards
+// the record, which keeps callers free of nil checks when auditing is off.
+func (l *Log) Append(rec Record) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rec.Seq = l.lastSeq + 1
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	rec.Time = rec.Time.UTC()
+	rec.PrevHash = l.lastHash
+	hash, err := hashRecord(rec)
+	if err != nil {
+		return err
+	}
+	rec.Hash = hash
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %v", err)
+	}
+
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit record: %v", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync audit log: %v", err)
+	}
+
+	l.lastSeq = rec.Seq
+	l.lastHash = rec.Hash
+	return nil
+}
+
+// Query returns the records matching f in log order
+func (l *Log) Query(f Filter) ([]Record, error) {
+	if l == nil {
+		return []Record{}, nil
+	}
+
+	l.mu.Lock()
+	records, err := l.readAll()
+	l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []Record{}
+	for _, rec := range records {
+		if f.matches(rec) {
+			matched = append(matched, rec)
+		}
+	}
+
+	// Keep the most recent records when a limit is set
+	if f.Limit > 0 && len(matched) > f.Limit {
+		matched = matched[len(matched)-f.Limit:]
+	}
+
+	return matched, nil
+}
+
+// Verify re-reads the whole log and checks every hash link. It returns the
+// number of verified records.
+func (l *Log) Verify() (int, error) {
+	if l == nil {
+		return 0, nil
+	}
+
+	l.mu.Lock()
+	records, err := l.readAll()
+	l.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := verifyChain(records); err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
+
+func (l *Log) readAll() ([]Record, error) {
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %v", err)
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("malformed audit record on line %d: %v", line, err)
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %v", err)
+	}
+
+	return records, nil
+}
+
+func (f Filter) matches(rec Record) bool {
+	if f.Actor != "" && rec.Actor != f.Actor {
+		return false
+	}
+	if f.Action != "" && rec.Action != f.Action {
+		return false
+	}
+	if f.Host != "" && rec.Host != f.Host {
+		return false
+	}
+	if f.Outcome != "" && rec.Outcome != f.Outcome {
+		return false
+	}
+	if !f.Since.IsZero() && rec.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && rec.Time.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// hashRecord computes the chain hash of rec, covering every field except Hash
+func hashRecord(rec Record) (string, error) {
+	rec.Hash = ""
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode audit record: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func verifyChain(records []Record) error {
+	prev := genesisHash
+	var seq uint64
+	for _, rec := range records {
+		if rec.Seq != seq+1 {
+			return fmt.Errorf("record %d: expected sequence %d", rec.Seq, seq+1)
+		}
+		if rec.PrevHash != prev {
+			return fmt.Errorf("record %d: previous hash does not match", rec.Seq)
+		}
+		hash, err := hashRecord(rec)
+		if err != nil {
+			return err
+		}
+		if rec.Hash != hash {
+			return fmt.Errorf("record %d: content hash does not match", rec.Seq)
+		}
+		prev = rec.Hash
+		seq = rec.Seq
+	}
+	return nil
+}
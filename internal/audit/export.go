@@ -0,0 +1,52 @@
+package audit
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// csvHeader lists the exported columns in order
+var csvHeader = []string{
+	"seq", "time", "actor", "action", "host", "remote_user", "license_file",
+	"license_sha256", "command", "outcome", "exit_status", "duration_ms", "error",
+	"server", "sysinfo_sha256", "license_expiry", "prev_hash", "hash",
+}
+
+// WriteCSV writes records as CSV with a header row
+func WriteCSV(w io.Writer, records []Record) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, rec := range records {
+		row := []string{
+			strconv.FormatUint(rec.Seq, 10),
+			rec.Time.Format(time.RFC3339Nano),
+			rec.Actor,
+			rec.Action,
+			rec.Host,
+			rec.RemoteUser,
+			rec.LicenseFile,
+			rec.LicenseSHA256,
+			rec.Command,
+			rec.Outcome,
+			strconv.Itoa(rec.ExitStatus),
+			strconv.FormatInt(rec.DurationMS, 10),
+			rec.Error,
+			rec.Server,
+			rec.SysinfoSHA256,
+			rec.LicenseExpiry,
+			rec.PrevHash,
+			rec.Hash,
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,470 @@
+// Package chat posts job outcomes and license expiry alerts to chat
+// channels through Slack, Mattermost and Microsoft Teams incoming webhooks.
+// Each route names a channel's webhook and chooses, by event and by server
+// tag, which messages it receives.
+package chat
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message formats
+const (
+	FormatSlack      = "slack"
+	FormatMattermost = "mattermost"
+	FormatTeams      = "teams"
+)
+
+// Formats lists the supported incoming webhook formats
+var Formats = []string{FormatSlack, FormatMattermost, FormatTeams}
+
+// Events a route can receive, named as the matching webhook events
+const (
+	EventJobCompleted    = "job.completed"
+	EventJobFailed       = "job.failed"
+	EventLicenseExpiring = "license.expiring"
+)
+
+// Events lists the events a route can subscribe to
+var Events = []string{EventJobCompleted, EventJobFailed, EventLicenseExpiring}
+
+// Severities, shown as the message color
+const (
+	SeverityGood    = "good"
+	SeverityWarning = "warning"
+	SeverityDanger  = "danger"
+)
+
+// Defaults for Options
+const (
+	DefaultMaxAttempts = 3
+	DefaultBackoff     = 5 * time.Second
+	DefaultTimeout     = 10 * time.Second
+)
+
+// queueSize bounds how many posts may wait to be sent before further
+// messages are dropped
+const queueSize = 256
+
+// maxRetryAfter caps how long a rate-limited post waits before retrying
+const maxRetryAfter = time.Minute
+
+var (
+	// ErrNotFound is returned for an unknown route ID
+	ErrNotFound = errors.New("chat route not found")
+	// ErrPostFailed wraps errors from the incoming webhook or reaching it
+	ErrPostFailed = errors.New("chat message could not be posted")
+)
+
+// Field is a labelled value shown with a message
+type Field struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Message is a notification about one host
+type Message struct {
+	Event    string
+	Severity string
+	Title    string
+	Text     string
+	Fields   []Field
+	// Tags are the server's inventory tags, which routes match against
+	Tags []string
+}
+
+// Route sends messages to one channel's incoming webhook. Empty Events
+// receives every event; empty Tags receives messages about every server.
+type Route struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Format string   `json:"format"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Tags routes messages about servers with any of these tags
+	Tags      []string  `json:"tags"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Matches reports whether the route receives msg
+func (r Route) Matches(msg Message) bool {
+	if len(r.Events) > 0 && !contains(r.Events, msg.Event) {
+		return false
+	}
+	if len(r.Tags) == 0 {
+		return true
+	}
+	for _, tag := range msg.Tags {
+		if contains(r.Tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted returns the route with its URL reduced to the scheme and host
+func (r Route) Redacted() Route {
+	r.URL = redact(r.URL)
+	return r
+}
+
+// Options configure a Notifier; zero values take the defaults
+type Options struct {
+	// MaxAttempts is how many times a post is tried before it is dropped
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled for each
+	// further retry
+	Backoff time.Duration
+	// Timeout bounds each attempt
+	Timeout time.Duration
+	// Client sends posts; the default transport is used when nil
+	Client *http.Client
+}
+
+// post is a formatted message waiting to be sent to a route
+type post struct {
+	route Route
+	event string
+	body  []byte
+}
+
+// Notifier holds the chat routes and posts messages to them. Routes are
+// persisted as a JSON file readable only by its owner, since incoming
+// webhook URLs are credentials.
+type Notifier struct {
+	mu     sync.Mutex
+	path   string
+	opts   Options
+	routes map[string]*Route
+	queue  chan post
+}
+
+// Open loads the routes at path, which need not exist yet
+func Open(path string, opts Options) (*Notifier, error) {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultBackoff
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create chat routes directory: %v", err)
+	}
+
+	n := &Notifier{path: path, opts: opts, routes: make(map[string]*Route), queue: make(chan post, queueSize)}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read chat routes: %v", err)
+	}
+	if len(data) > 0 {
+		var saved []*Route
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return nil, fmt.Errorf("failed to parse chat routes %s: %v", path, err)
+		}
+		for _, r := range saved {
+			n.routes[r.ID] = r
+		}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.save(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Path returns the location of the routes file
+func (n *Notifier) Path() string {
+	return n.path
+}
+
+// Create adds a route posting to an incoming webhook in format
+func (n *Notifier) Create(name, format, rawURL string, events, tags []string) (Route, error) {
+	if name == "" {
+		return Route{}, fmt.Errorf("name must not be empty")
+	}
+	if !contains(Formats, format) {
+		return Route{}, fmt.Errorf("unknown format %q, use one of %s", format, strings.Join(Formats, ", "))
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Route{}, fmt.Errorf("url must be an absolute http or https URL")
+	}
+	for _, event := range events {
+		if !contains(Events, event) {
+			return Route{}, fmt.Errorf("unknown event %q, use one of %s", event, strings.Join(Events, ", "))
+		}
+	}
+	for _, tag := range tags {
+		if strings.TrimSpace(tag) == "" {
+			return Route{}, fmt.Errorf("tags must not be empty")
+		}
+	}
+
+	r := &Route{
+		ID:        newID(),
+		Name:      name,
+		Format:    format,
+		URL:       rawURL,
+		Events:    append([]string{}, events...),
+		Tags:      append([]string{}, tags...),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.routes[r.ID] = r
+	if err := n.save(); err != nil {
+		delete(n.routes, r.ID)
+		return Route{}, err
+	}
+	return *r, nil
+}
+
+// List returns every route, oldest first
+func (n *Notifier) List() []Route {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	list := make([]Route, 0, len(n.routes))
+	for _, r := range n.routes {
+		list = append(list, *r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
+
+// Get returns the route with the given ID
+func (n *Notifier) Get(id string) (Route, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	r, ok := n.routes[id]
+	if !ok {
+		return Route{}, ErrNotFound
+	}
+	return *r, nil
+}
+
+// Delete removes a route
+func (n *Notifier) Delete(id string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	r, ok := n.routes[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(n.routes, id)
+	if err := n.save(); err != nil {
+		n.routes[id] = r
+		return err
+	}
+	return nil
+}
+
+// Publish queues msg for every route that matches it; Run sends them. A
+// nil Notifier discards the message, which keeps callers free of nil
+// checks when chat notifications are off.
+func (n *Notifier) Publish(msg Message) {
+	if n == nil {
+		return
+	}
+
+	for _, r := range n.List() {
+		if !r.Matches(msg) {
+			continue
+		}
+		body, err := Format(r.Format, msg)
+		if err != nil {
+			slog.Error("formatting chat message", "route_id", r.ID, "error", err)
+			continue
+		}
+		select {
+		case n.queue <- post{route: r, event: msg.Event, body: body}:
+		default:
+			slog.Warn("chat queue is full, dropping message", "route_id", r.ID, "event", msg.Event)
+		}
+	}
+}
+
+// Test posts a test message to the route and waits for the result
+func (n *Notifier) Test(ctx context.Context, id string) error {
+	r, err := n.Get(id)
+	if err != nil {
+		return err
+	}
+	body, err := Format(r.Format, Message{
+		Severity: SeverityGood,
+		Title:    "License Manager test message",
+		Text:     "Notifications for route " + r.Name + " will be posted here.",
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := n.send(ctx, r, body); err != nil {
+		return fmt.Errorf("%w: %v", ErrPostFailed, err)
+	}
+	return nil
+}
+
+// Run sends queued messages until stop is closed, retrying failed posts
+// with exponential backoff. Messages still queued at stop are dropped.
+func (n *Notifier) Run(stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case p := <-n.queue:
+			n.deliver(ctx, p)
+		}
+	}
+}
+
+// deliver sends a post, retrying until it succeeds, MaxAttempts is reached
+// or ctx is cancelled
+func (n *Notifier) deliver(ctx context.Context, p post) {
+	delay := n.opts.Backoff
+	for attempt := 1; ; attempt++ {
+		retryAfter, err := n.send(ctx, p.route, p.body)
+		if err == nil {
+			return
+		}
+		if attempt >= n.opts.MaxAttempts || ctx.Err() != nil {
+			slog.Warn("chat message failed", "route_id", p.route.ID, "event", p.event, "attempts", attempt, "error", err)
+			return
+		}
+
+		wait := delay
+		if retryAfter > 0 {
+			wait = min(retryAfter, maxRetryAfter)
+		}
+		delay *= 2
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// send posts body to the route's webhook. When the webhook is rate
+// limited, it also returns how long it asked to wait.
+func (n *Notifier) send(ctx context.Context, r Route, body []byte) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, n.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "license-manager-chat")
+
+	resp, err := n.opts.Client.Do(req)
+	if err != nil {
+		// The URL is a credential; keep it out of errors and logs
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return 0, fmt.Errorf("posting to %s failed: %v", redact(r.URL), err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return 0, nil
+	}
+	var retryAfter time.Duration
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+	return retryAfter, fmt.Errorf("%s answered %s", redact(r.URL), resp.Status)
+}
+
+// redact drops the path and query of an incoming webhook URL, which hold
+// its token
+func redact(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "(invalid URL)"
+	}
+	return u.Scheme + "://" + u.Host + "/..."
+}
+
+// save writes the routes atomically. Callers must hold n.mu.
+func (n *Notifier) save() error {
+	list := make([]*Route, 0, len(n.routes))
+	for _, r := range n.routes {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode chat routes: %v", err)
+	}
+
+	tmp := n.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write chat routes: %v", err)
+	}
+	if err := os.Rename(tmp, n.path); err != nil {
+		return fmt.Errorf("failed to replace chat routes: %v", err)
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic("crypto/rand failed: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,103 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// colors are the Slack and Mattermost attachment colors per severity
+var colors = map[string]string{
+	SeverityGood:    "#2eb886",
+	SeverityWarning: "#daa038",
+	SeverityDanger:  "#a30200",
+}
+
+// teamsColors are the Adaptive Card text colors per severity
+var teamsColors = map[string]string{
+	SeverityGood:    "Good",
+	SeverityWarning: "Warning",
+	SeverityDanger:  "Attention",
+}
+
+// Format renders msg as the JSON body of an incoming webhook in format
+func Format(format string, msg Message) ([]byte, error) {
+	switch format {
+	case FormatSlack, FormatMattermost:
+		return json.Marshal(slackPayload(format, msg))
+	case FormatTeams:
+		return json.Marshal(teamsPayload(msg))
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// slackPayload is a message with one attachment, which Slack and
+// Mattermost both render. Mattermost also takes the sender's name.
+func slackPayload(format string, msg Message) map[string]any {
+	fields := make([]map[string]any, len(msg.Fields))
+	for i, f := range msg.Fields {
+		fields[i] = map[string]any{"title": f.Name, "value": slackEscape(f.Value), "short": true}
+	}
+	attachment := map[string]any{
+		"fallback": slackEscape(msg.Title),
+		"color":    colors[msg.Severity],
+		"title":    slackEscape(msg.Title),
+		"text":     slackEscape(msg.Text),
+		"fields":   fields,
+		"footer":   "License Manager",
+	}
+	payload := map[string]any{
+		"text":        slackEscape(msg.Title),
+		"attachments": []any{attachment},
+	}
+	if format == FormatMattermost {
+		payload["username"] = "License Manager"
+	}
+	return payload
+}
+
+// slackEscape escapes the characters Slack's message formatting treats as
+// control characters
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// teamsPayload is an Adaptive Card message, as accepted by Teams incoming
+// webhooks and workflows
+func teamsPayload(msg Message) map[string]any {
+	facts := make([]map[string]any, len(msg.Fields))
+	for i, f := range msg.Fields {
+		facts[i] = map[string]any{"title": f.Name, "value": f.Value}
+	}
+	body := []any{
+		map[string]any{
+			"type":   "TextBlock",
+			"text":   msg.Title,
+			"weight": "Bolder",
+			"size":   "Medium",
+			"color":  teamsColors[msg.Severity],
+			"wrap":   true,
+		},
+	}
+	if msg.Text != "" {
+		body = append(body, map[string]any{"type": "TextBlock", "text": msg.Text, "wrap": true})
+	}
+	if len(facts) > 0 {
+		body = append(body, map[string]any{"type": "FactSet", "facts": facts})
+	}
+	return map[string]any{
+		"type": "message",
+		"attachments": []any{
+			map[string]any{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]any{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.4",
+					"body":    body,
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,695 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"license-manager/internal/certs"
+	"license-manager/internal/chat"
+	"license-manager/internal/expiry"
+	"license-manager/internal/logging"
+	"license-manager/internal/middleware"
+	"license-manager/internal/notify"
+	"license-manager/internal/rollouts"
+	"license-manager/internal/services"
+	"license-manager/internal/tracing"
+	"license-manager/internal/webhooks"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secret values in PrintConfig output
+const redacted = "[REDACTED]"
+
+// Config is the complete application configuration. Values are resolved in
+// order of increasing precedence: defaults, YAML file, environment variables
+// and command-line flags. Fields tagged secret:"true" are redacted when the
+// configuration is printed.
+type Config struct {
+	Server   ServerConfig   `yaml:"server"`
+	TLS      TLSConfig      `yaml:"tls"`
+	Storage  StorageConfig  `yaml:"storage"`
+	SSH      SSHConfig      `yaml:"ssh"`
+	Log      LogConfig      `yaml:"log"`
+	Metrics  MetricsConfig  `yaml:"metrics"`
+	Tracing  TracingConfig  `yaml:"tracing"`
+	CORS     CORSConfig     `yaml:"cors"`
+	Security SecurityConfig `yaml:"security"`
+	Webhooks WebhooksConfig `yaml:"webhooks"`
+	Email    EmailConfig    `yaml:"email"`
+	Chat     ChatConfig     `yaml:"chat"`
+	Rollouts RolloutsConfig `yaml:"rollouts"`
+}
+
+type ServerConfig struct {
+	ListenAddr          string        `yaml:"listen_addr" env:"LISTEN_ADDR"`
+	TemplatesGlob       string        `yaml:"templates_glob" env:"TEMPLATES_GLOB"`
+	StaticDir           string        `yaml:"static_dir" env:"STATIC_DIR"`
+	ShutdownGracePeriod time.Duration `yaml:"shutdown_grace_period" env:"SHUTDOWN_GRACE_PERIOD"`
+	// GRPCListenAddr serves the gRPC API, which requires an API token on
+	// every call; empty disables it
+	GRPCListenAddr string `yaml:"grpc_listen_addr" env:"GRPC_LISTEN_ADDR"`
+}
+
+type TLSConfig struct {
+	CertFile       string        `yaml:"cert_file" env:"TLS_CERT_FILE"`
+	KeyFile        string        `yaml:"key_file" env:"TLS_KEY_FILE"`
+	ClientCAFile   string        `yaml:"client_ca_file" env:"TLS_CLIENT_CA_FILE"`
+	ClientAuth     string        `yaml:"client_auth" env:"TLS_CLIENT_AUTH"`
+	ReloadInterval time.Duration `yaml:"reload_interval" env:"TLS_RELOAD_INTERVAL"`
+}
+
+type StorageConfig struct {
+	UploadDir       string `yaml:"upload_dir" env:"UPLOAD_DIR"`
+	AuditLogPath    string `yaml:"audit_log_path" env:"AUDIT_LOG_PATH"`
+	JobsStatePath   string `yaml:"jobs_state_path" env:"JOBS_STATE_PATH"`
+	InventoryPath   string `yaml:"inventory_path" env:"INVENTORY_PATH"`
+	WebhooksPath    string `yaml:"webhooks_path" env:"WEBHOOKS_PATH"`
+	SubscribersPath string `yaml:"subscribers_path" env:"SUBSCRIBERS_PATH"`
+	ChatRoutesPath  string `yaml:"chat_routes_path" env:"CHAT_ROUTES_PATH"`
+	RolloutsPath    string `yaml:"rollouts_path" env:"ROLLOUTS_PATH"`
+	ExpiryPath      string `yaml:"expiry_path" env:"EXPIRY_PATH"`
+}
+
+type SSHConfig struct {
+	Timeout         time.Duration `yaml:"timeout" env:"SSH_TIMEOUT"`
+	CommandTimeout  time.Duration `yaml:"command_timeout" env:"SSH_COMMAND_TIMEOUT"`
+	TransferTimeout time.Duration `yaml:"transfer_timeout" env:"SSH_TRANSFER_TIMEOUT"`
+	RemoteTempDir   string        `yaml:"remote_temp_dir" env:"REMOTE_TEMP_DIR"`
+	// PoolIdleTTL is how long an unused connection is kept; 0 disables pooling
+	PoolIdleTTL        time.Duration `yaml:"pool_idle_ttl" env:"SSH_POOL_IDLE_TTL"`
+	KeepaliveInterval  time.Duration `yaml:"keepalive_interval" env:"SSH_KEEPALIVE_INTERVAL"`
+	MaxSessionsPerHost int           `yaml:"max_sessions_per_host" env:"SSH_MAX_SESSIONS_PER_HOST"`
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL"`
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+}
+
+type MetricsConfig struct {
+	Enabled bool `yaml:"enabled" env:"METRICS_ENABLED"`
+}
+
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER"`
+	Endpoint    string  `yaml:"endpoint" env:"TRACING_OTLP_ENDPOINT"`
+	Insecure    bool    `yaml:"insecure" env:"TRACING_OTLP_INSECURE"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+	ServiceName string  `yaml:"service_name" env:"TRACING_SERVICE_NAME"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	AllowedMethods   []string      `yaml:"allowed_methods" env:"CORS_ALLOWED_METHODS"`
+	AllowedHeaders   []string      `yaml:"allowed_headers" env:"CORS_ALLOWED_HEADERS"`
+	AllowCredentials bool          `yaml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+	MaxAge           time.Duration `yaml:"max_age" env:"CORS_MAX_AGE"`
+}
+
+type SecurityConfig struct {
+	// AdminTokens are bearer tokens accepted on admin-only endpoints; with
+	// none configured those endpoints are disabled
+	AdminTokens []string `yaml:"admin_tokens" env:"ADMIN_TOKENS" secret:"true"`
+	// APITokens are "name:secret" bearer tokens for scripted clients such as
+	// lmctl; the name identifies the client in the audit log
+	APITokens             []string      `yaml:"api_tokens" env:"API_TOKENS" secret:"true"`
+	CSRFDisabled          bool          `yaml:"csrf_disabled" env:"CSRF_DISABLED"`
+	ContentSecurityPolicy string        `yaml:"content_security_policy" env:"CONTENT_SECURITY_POLICY"`
+	HSTSMaxAge            time.Duration `yaml:"hsts_max_age" env:"HSTS_MAX_AGE"`
+}
+
+type WebhooksConfig struct {
+	// MaxAttempts is how many times a delivery is tried before it fails
+	MaxAttempts       int           `yaml:"max_attempts" env:"WEBHOOK_MAX_ATTEMPTS"`
+	RetryBackoff      time.Duration `yaml:"retry_backoff" env:"WEBHOOK_RETRY_BACKOFF"`
+	MaxRetryBackoff   time.Duration `yaml:"max_retry_backoff" env:"WEBHOOK_MAX_RETRY_BACKOFF"`
+	Timeout           time.Duration `yaml:"timeout" env:"WEBHOOK_TIMEOUT"`
+	ExpiryWarningDays int           `yaml:"expiry_warning_days" env:"EXPIRY_WARNING_DAYS"`
+	// ExpiryCheckInterval is how often imported licenses are checked for
+	// entering the warning period
+	ExpiryCheckInterval time.Duration `yaml:"expiry_check_interval" env:"EXPIRY_CHECK_INTERVAL"`
+}
+
+type EmailConfig struct {
+	// SMTPHost enables email digests; empty disables them
+	SMTPHost     string `yaml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     int    `yaml:"smtp_port" env:"SMTP_PORT"`
+	SMTPUsername string `yaml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" env:"SMTP_PASSWORD" secret:"true"`
+	// SMTPSecurity is starttls, tls or none
+	SMTPSecurity string        `yaml:"smtp_security" env:"SMTP_SECURITY"`
+	From         string        `yaml:"from" env:"EMAIL_FROM"`
+	Timeout      time.Duration `yaml:"timeout" env:"SMTP_TIMEOUT"`
+}
+
+type ChatConfig struct {
+	// MaxAttempts is how many times a post is tried before it is dropped
+	MaxAttempts  int           `yaml:"max_attempts" env:"CHAT_MAX_ATTEMPTS"`
+	RetryBackoff time.Duration `yaml:"retry_backoff" env:"CHAT_RETRY_BACKOFF"`
+	Timeout      time.Duration `yaml:"timeout" env:"CHAT_TIMEOUT"`
+}
+
+type RolloutsConfig struct {
+	// CheckInterval is how often maintenance windows are checked for opening
+	CheckInterval time.Duration `yaml:"check_interval" env:"ROLLOUT_CHECK_INTERVAL"`
+}
+
+// Default returns the configuration used when nothing is overridden
+func Default() *Config {
+	cors := middleware.DefaultCORSConfig()
+	security := middleware.DefaultSecurityHeadersConfig()
+
+	return &Config{
+		Server: ServerConfig{
+			ListenAddr:          ":8080",
+			TemplatesGlob:       "templates/*",
+			StaticDir:           "./static",
+			ShutdownGracePeriod: 25 * time.Second,
+		},
+		TLS: TLSConfig{
+			ClientAuth:     certs.ClientAuthNone,
+			ReloadInterval: 30 * time.Second,
+		},
+		Storage: StorageConfig{
+			UploadDir:       "uploads",
+			AuditLogPath:    "data/audit.log",
+			JobsStatePath:   "data/jobs.json",
+			InventoryPath:   "data/servers.json",
+			WebhooksPath:    "data/webhooks.json",
+			SubscribersPath: "data/subscribers.json",
+			ChatRoutesPath:  "data/chat.json",
+			RolloutsPath:    "data/rollouts.json",
+			ExpiryPath:      "data/expiry.json",
+		},
+		SSH: SSHConfig{
+			Timeout:         services.DefaultTimeout,
+			CommandTimeout:  services.DefaultCommandTimeout,
+			TransferTimeout: services.DefaultTransferTimeout,
+			RemoteTempDir:   "/tmp/",
+
+			PoolIdleTTL:        services.DefaultPoolIdleTTL,
+			KeepaliveInterval:  services.DefaultKeepaliveInterval,
+			MaxSessionsPerHost: services.DefaultMaxSessionsPerHost,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: logging.FormatJSON,
+		},
+		Metrics: MetricsConfig{
+			Enabled: true,
+		},
+		Tracing: TracingConfig{
+			Exporter:    tracing.ExporterNone,
+			SampleRatio: 1,
+			ServiceName: "license-manager",
+		},
+		CORS: CORSConfig{
+			AllowedMethods: cors.AllowedMethods,
+			AllowedHeaders: cors.AllowedHeaders,
+			MaxAge:         cors.MaxAge,
+		},
+		Security: SecurityConfig{
+			ContentSecurityPolicy: security.ContentSecurityPolicy,
+			HSTSMaxAge:            security.HSTSMaxAge,
+		},
+		Webhooks: WebhooksConfig{
+			MaxAttempts:         webhooks.DefaultMaxAttempts,
+			RetryBackoff:        webhooks.DefaultBackoff,
+			MaxRetryBackoff:     webhooks.DefaultMaxBackoff,
+			Timeout:             webhooks.DefaultTimeout,
+			ExpiryWarningDays:   30,
+			ExpiryCheckInterval: expiry.DefaultInterval,
+		},
+		Email: EmailConfig{
+			SMTPPort:     notify.DefaultPort,
+			SMTPSecurity: notify.SecurityStartTLS,
+			From:         "License Manager <license-manager@localhost>",
+			Timeout:      notify.DefaultTimeout,
+		},
+		Chat: ChatConfig{
+			MaxAttempts:  chat.DefaultMaxAttempts,
+			RetryBackoff: chat.DefaultBackoff,
+			Timeout:      chat.DefaultTimeout,
+		},
+		Rollouts: RolloutsConfig{
+			CheckInterval: rollouts.DefaultInterval,
+		},
+	}
+}
+
+// Options are the command-line settings that control loading
+type Options struct {
+	ConfigFile  string
+	PrintConfig bool
+}
+
+// Load resolves the configuration from the YAML file, environment and the
+// command-line args (without the program name), then validates it
+func Load(args []string) (*Config, Options, error) {
+	cfg, opts, err := Parse(args)
+	if err != nil {
+		return nil, opts, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, opts, err
+	}
+	return cfg, opts, nil
+}
+
+// Parse resolves the configuration like Load without validating it, so an
+// invalid configuration can still be printed
+func Parse(args []string) (*Config, Options, error) {
+	var opts Options
+	cfg := Default()
+
+	fs := flag.NewFlagSet("license-manager", flag.ContinueOnError)
+	fs.StringVar(&opts.ConfigFile, "config", os.Getenv("CONFIG_FILE"), "path to a YAML configuration file")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the effective configuration with secrets redacted and exit")
+	listenAddr := fs.String("listen", "", "address to listen on, e.g. :8080")
+	grpcListenAddr := fs.String("grpc-listen", "", "address to serve the gRPC API on, e.g. :9090")
+	uploadDir := fs.String("upload-dir", "", "directory for temporary license uploads")
+	remoteTempDir := fs.String("remote-temp-dir", "", "remote directory license files are copied to")
+	sshTimeout := fs.Duration("ssh-timeout", 0, "SSH connection timeout")
+	templatesGlob := fs.String("templates", "", "glob matching the HTML templates")
+	staticDir := fs.String("static-dir", "", "directory served at /static")
+	logLevel := fs.String("log-level", "", "log level: debug, info, warn or error")
+	if err := fs.Parse(args); err != nil {
+		return nil, opts, err
+	}
+
+	if opts.ConfigFile != "" {
+		if err := cfg.loadFile(opts.ConfigFile); err != nil {
+			return nil, opts, err
+		}
+	}
+
+	if err := applyEnv(reflect.ValueOf(cfg).Elem()); err != nil {
+		return nil, opts, err
+	}
+
+	// Flags only override values that were given explicitly
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "listen":
+			cfg.Server.ListenAddr = *listenAddr
+		case "grpc-listen":
+			cfg.Server.GRPCListenAddr = *grpcListenAddr
+		case "upload-dir":
+			cfg.Storage.UploadDir = *uploadDir
+		case "remote-temp-dir":
+			cfg.SSH.RemoteTempDir = *remoteTempDir
+		case "ssh-timeout":
+			cfg.SSH.Timeout = *sshTimeout
+		case "templates":
+			cfg.Server.TemplatesGlob = *templatesGlob
+		case "static-dir":
+			cfg.Server.StaticDir = *staticDir
+		case "log-level":
+			cfg.Log.Level = *logLevel
+		}
+	})
+	return cfg, opts, nil
+}
+
+func (c *Config) loadFile(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	dec := yaml.NewDecoder(strings.NewReader(string(data)))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to parse config file %s: %v", file, err)
+	}
+	return nil
+}
+
+// Validate reports the first invalid setting
+func (c *Config) Validate() error {
+	if c.Server.ListenAddr == "" {
+		return fmt.Errorf("server.listen_addr must not be empty")
+	}
+	if err := c.ValidatePaths(); err != nil {
+		return err
+	}
+	if c.Server.ShutdownGracePeriod < 0 {
+		return fmt.Errorf("server.shutdown_grace_period must not be negative")
+	}
+	if c.Storage.UploadDir == "" {
+		return fmt.Errorf("storage.upload_dir must not be empty")
+	}
+	if c.Storage.AuditLogPath == "" {
+		return fmt.Errorf("storage.audit_log_path must not be empty")
+	}
+	if c.Storage.JobsStatePath == "" {
+		return fmt.Errorf("storage.jobs_state_path must not be empty")
+	}
+	if c.Storage.InventoryPath == "" {
+		return fmt.Errorf("storage.inventory_path must not be empty")
+	}
+	if c.Storage.WebhooksPath == "" {
+		return fmt.Errorf("storage.webhooks_path must not be empty")
+	}
+	if c.Storage.SubscribersPath == "" {
+		return fmt.Errorf("storage.subscribers_path must not be empty")
+	}
+	if c.Storage.ChatRoutesPath == "" {
+		return fmt.Errorf("storage.chat_routes_path must not be empty")
+	}
+	if c.Storage.RolloutsPath == "" {
+		return fmt.Errorf("storage.rollouts_path must not be empty")
+	}
+	if c.Storage.ExpiryPath == "" {
+		return fmt.Errorf("storage.expiry_path must not be empty")
+	}
+	if _, err := middleware.ParseAPITokens(c.Security.APITokens); err != nil {
+		return fmt.Errorf("security.api_tokens: %v", err)
+	}
+	if c.Server.GRPCListenAddr != "" {
+		if c.Server.GRPCListenAddr == c.Server.ListenAddr {
+			return fmt.Errorf("server.grpc_listen_addr must differ from server.listen_addr")
+		}
+		if len(c.Security.APITokens) == 0 {
+			return fmt.Errorf("server.grpc_listen_addr requires security.api_tokens")
+		}
+	}
+	if c.SSH.Timeout <= 0 {
+		return fmt.Errorf("ssh.timeout must be positive")
+	}
+	if c.SSH.CommandTimeout <= 0 {
+		return fmt.Errorf("ssh.command_timeout must be positive")
+	}
+	if c.SSH.TransferTimeout <= 0 {
+		return fmt.Errorf("ssh.transfer_timeout must be positive")
+	}
+	if c.SSH.PoolIdleTTL < 0 {
+		return fmt.Errorf("ssh.pool_idle_ttl must not be negative")
+	}
+	if c.SSH.KeepaliveInterval <= 0 {
+		return fmt.Errorf("ssh.keepalive_interval must be positive")
+	}
+	if c.SSH.MaxSessionsPerHost < 1 {
+		return fmt.Errorf("ssh.max_sessions_per_host must be at least 1")
+	}
+	if !path.IsAbs(c.SSH.RemoteTempDir) {
+		return fmt.Errorf("ssh.remote_temp_dir %q must be an absolute path", c.SSH.RemoteTempDir)
+	}
+	if _, err := c.Logging(); err != nil {
+		return fmt.Errorf("log: %v", err)
+	}
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		return fmt.Errorf("tracing.exporter %q must be none, stdout or otlp", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("tracing.sample_ratio must be between 0 and 1")
+	}
+	if err := c.Certs().Validate(); err != nil {
+		return fmt.Errorf("tls: %v", err)
+	}
+	if c.TLS.ReloadInterval <= 0 {
+		return fmt.Errorf("tls.reload_interval must be positive")
+	}
+	if err := c.CORSMiddleware().Validate(); err != nil {
+		return fmt.Errorf("cors: %v", err)
+	}
+	if c.Webhooks.MaxAttempts < 1 {
+		return fmt.Errorf("webhooks.max_attempts must be at least 1")
+	}
+	if c.Webhooks.RetryBackoff <= 0 || c.Webhooks.MaxRetryBackoff < c.Webhooks.RetryBackoff {
+		return fmt.Errorf("webhooks.retry_backoff must be positive and no more than webhooks.max_retry_backoff")
+	}
+	if c.Webhooks.Timeout <= 0 {
+		return fmt.Errorf("webhooks.timeout must be positive")
+	}
+	if c.Webhooks.ExpiryWarningDays < 0 {
+		return fmt.Errorf("webhooks.expiry_warning_days must not be negative")
+	}
+	if c.Webhooks.ExpiryCheckInterval <= 0 {
+		return fmt.Errorf("webhooks.expiry_check_interval must be positive")
+	}
+	if c.Email.Timeout <= 0 {
+		return fmt.Errorf("email.timeout must be positive")
+	}
+	if c.EmailEnabled() {
+		if err := c.NotifyOptions().Validate(); err != nil {
+			return fmt.Errorf("email: %v", err)
+		}
+	}
+	if c.Chat.MaxAttempts < 1 {
+		return fmt.Errorf("chat.max_attempts must be at least 1")
+	}
+	if c.Chat.RetryBackoff <= 0 {
+		return fmt.Errorf("chat.retry_backoff must be positive")
+	}
+	if c.Chat.Timeout <= 0 {
+		return fmt.Errorf("chat.timeout must be positive")
+	}
+	if c.Rollouts.CheckInterval <= 0 {
+		return fmt.Errorf("rollouts.check_interval must be positive")
+	}
+	return nil
+}
+
+// Certs returns the TLS settings for the certificate reloader
+func (c *Config) Certs() certs.Config {
+	return certs.Config{
+		CertFile:     c.TLS.CertFile,
+		KeyFile:      c.TLS.KeyFile,
+		ClientCAFile: c.TLS.ClientCAFile,
+		ClientAuth:   c.TLS.ClientAuth,
+	}
+}
+
+// CORSMiddleware returns the settings for middleware.CORS
+func (c *Config) CORSMiddleware() middleware.CORSConfig {
+	return middleware.CORSConfig{
+		AllowedOrigins:   c.CORS.AllowedOrigins,
+		AllowedMethods:   c.CORS.AllowedMethods,
+		AllowedHeaders:   c.CORS.AllowedHeaders,
+		AllowCredentials: c.CORS.AllowCredentials,
+		MaxAge:           c.CORS.MaxAge,
+	}
+}
+
+// ValidatePaths checks that the templates and static files are present. It
+// is part of Validate and also used by the readiness probe.
+func (c *Config) ValidatePaths() error {
+	if matches, err := filepath.Glob(c.Server.TemplatesGlob); err != nil || len(matches) == 0 {
+		return fmt.Errorf("server.templates_glob %q matches no files", c.Server.TemplatesGlob)
+	}
+	if info, err := os.Stat(c.Server.StaticDir); err != nil || !info.IsDir() {
+		return fmt.Errorf("server.static_dir %q is not a directory", c.Server.StaticDir)
+	}
+	return nil
+}
+
+// Logging returns the settings for logging.New
+func (c *Config) Logging() (logging.Options, error) {
+	level, err := logging.ParseLevel(c.Log.Level)
+	if err != nil {
+		return logging.Options{}, err
+	}
+	if c.Log.Format != logging.FormatJSON && c.Log.Format != logging.FormatText {
+		return logging.Options{}, fmt.Errorf("unknown format %q, use json or text", c.Log.Format)
+	}
+	return logging.Options{Level: level, Format: c.Log.Format}, nil
+}
+
+// TracingOptions returns the settings for tracing.Setup
+func (c *Config) TracingOptions() tracing.Options {
+	return tracing.Options{
+		Exporter:    c.Tracing.Exporter,
+		Endpoint:    c.Tracing.Endpoint,
+		Insecure:    c.Tracing.Insecure,
+		SampleRatio: c.Tracing.SampleRatio,
+		ServiceName: c.Tracing.ServiceName,
+	}
+}
+
+// SSHPool returns the settings for services.NewPool
+func (c *Config) SSHPool() services.PoolConfig {
+	return services.PoolConfig{
+		IdleTTL:            c.SSH.PoolIdleTTL,
+		KeepaliveInterval:  c.SSH.KeepaliveInterval,
+		MaxSessionsPerHost: c.SSH.MaxSessionsPerHost,
+	}
+}
+
+// WebhookOptions returns the settings for webhooks.Open
+func (c *Config) WebhookOptions() webhooks.Options {
+	return webhooks.Options{
+		MaxAttempts: c.Webhooks.MaxAttempts,
+		Backoff:     c.Webhooks.RetryBackoff,
+		MaxBackoff:  c.Webhooks.MaxRetryBackoff,
+		Timeout:     c.Webhooks.Timeout,
+	}
+}
+
+// ExpiryOptions returns the settings for expiry.Open
+func (c *Config) ExpiryOptions() expiry.Options {
+	return expiry.Options{
+		Interval:    c.Webhooks.ExpiryCheckInterval,
+		WarningDays: c.Webhooks.ExpiryWarningDays,
+	}
+}
+
+// ChatOptions returns the settings for chat.Open
+func (c *Config) ChatOptions() chat.Options {
+	return chat.Options{
+		MaxAttempts: c.Chat.MaxAttempts,
+		Backoff:     c.Chat.RetryBackoff,
+		Timeout:     c.Chat.Timeout,
+	}
+}
+
+// RolloutOptions returns the settings for rollouts.Open
+func (c *Config) RolloutOptions() rollouts.Options {
+	return rollouts.Options{Interval: c.Rollouts.CheckInterval}
+}
+
+// EmailEnabled reports whether email digests are configured
+func (c *Config) EmailEnabled() bool {
+	return c.Email.SMTPHost != ""
+}
+
+// NotifyOptions returns the settings for notify.Open
+func (c *Config) NotifyOptions() notify.Options {
+	return notify.Options{
+		Host:     c.Email.SMTPHost,
+		Port:     c.Email.SMTPPort,
+		Username: c.Email.SMTPUsername,
+		Password: c.Email.SMTPPassword,
+		Security: c.Email.SMTPSecurity,
+		From:     c.Email.From,
+		Timeout:  c.Email.Timeout,
+	}
+}
+
+// APITokens returns the tokens for middleware.APIAuth. The entries are
+// checked by Validate.
+func (c *Config) APITokens() []middleware.APIToken {
+	tokens, _ := middleware.ParseAPITokens(c.Security.APITokens)
+	return tokens
+}
+
+// SecurityHeadersMiddleware returns the settings for middleware.SecurityHeaders
+func (c *Config) SecurityHeadersMiddleware() middleware.SecurityHeadersConfig {
+	return middleware.SecurityHeadersConfig{
+		ContentSecurityPolicy: c.Security.ContentSecurityPolicy,
+		HSTSMaxAge:            c.Security.HSTSMaxAge,
+	}
+}
+
+// PrintConfig writes the configuration as YAML with secrets redacted
+func (c *Config) PrintConfig(w io.Writer) error {
+	cp := *c
+	redact(reflect.ValueOf(&cp).Elem())
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&cp); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// applyEnv sets every field with an env tag from its environment variable
+func applyEnv(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, value := t.Field(i), v.Field(i)
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Duration(0)) {
+			if err := applyEnv(value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := field.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		raw, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setValue(value, raw); err != nil {
+			return fmt.Errorf("invalid %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func setValue(v reflect.Value, raw string) error {
+	switch {
+	case v.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// redact blanks every non-empty field tagged secret:"true"
+func redact(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, value := t.Field(i), v.Field(i)
+		switch {
+		case field.Type.Kind() == reflect.Struct:
+			redact(value)
+		case field.Tag.Get("secret") == "true" && value.Kind() == reflect.String && value.String() != "":
+			value.SetString(redacted)
+		case field.Tag.Get("secret") == "true" && value.Kind() == reflect.Slice && value.Len() > 0:
+			masked := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+			for j := 0; j < value.Len(); j++ {
+				masked.Index(j).SetString(redacted)
+			}
+			value.Set(masked)
+		}
+	}
+}
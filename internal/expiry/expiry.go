@@ -0,0 +1,223 @@
+// Package expiry reports each imported license once as it enters the
+// expiry warning period. A license already within the period when it is
+// imported is reported at import; one that gets there later is found by a
+// periodic check. The licenses reported are kept in a JSON file so a
+// restart does not report them again.
+package expiry
+
+import (
+	"encoding/json"
+	"fmt"
+	"license-manager/internal/notify"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultInterval is how often licenses are checked for expiry
+	DefaultInterval = time.Hour
+	// retention is how long a reported license is remembered after it stops
+	// being its host's latest import
+	retention = 24 * time.Hour
+)
+
+// Source lists the licenses expiring within days of now; the
+// notify.Source that builds digests is one
+type Source interface {
+	ExpiringLicenses(now time.Time, days int) ([]notify.ExpiringLicense, error)
+}
+
+// Options configure a Watcher; a zero Interval takes the default
+type Options struct {
+	Interval time.Duration
+	// WarningDays is how many days before expiry a license is reported
+	WarningDays int
+}
+
+// reported is a license already reported at a warning threshold
+type reported struct {
+	Key string `json:"key"`
+	// Host and Expires are kept for operators reading the file
+	Host       string    `json:"host"`
+	Expires    string    `json:"expires"`
+	ReportedAt time.Time `json:"reported_at"`
+	// SeenAt is when the license was last among the expiring licenses
+	SeenAt time.Time `json:"seen_at"`
+}
+
+// Watcher reports each license once per warning threshold
+type Watcher struct {
+	path   string
+	opts   Options
+	source Source
+	report func(notify.ExpiringLicense)
+
+	mu       sync.Mutex
+	reported map[string]*reported
+}
+
+// Open loads the reported licenses from path, creating the file if needed.
+// report is called for each license the periodic check finds newly within
+// the warning period.
+func Open(path string, opts Options, source Source, report func(notify.ExpiringLicense)) (*Watcher, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create expiry state directory: %v", err)
+	}
+
+	w := &Watcher{path: path, opts: opts, source: source, report: report, reported: make(map[string]*reported)}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read expiry state: %v", err)
+	}
+	if len(data) > 0 {
+		var saved []*reported
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return nil, fmt.Errorf("failed to parse expiry state %s: %v", path, err)
+		}
+		for _, r := range saved {
+			w.reported[r.Key] = r
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.save(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Path returns the location of the expiry state file
+func (w *Watcher) Path() string {
+	return w.path
+}
+
+// WarningDays returns the warning threshold licenses are reported at
+func (w *Watcher) WarningDays() int {
+	return w.opts.WarningDays
+}
+
+// Claim records l as reported and returns whether it had not been yet, so
+// an import can report a license already within the warning period without
+// the periodic check reporting it again. A nil Watcher claims everything.
+func (w *Watcher) Claim(l notify.ExpiringLicense, now time.Time) bool {
+	if w == nil {
+		return true
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	key := w.key(l)
+	if _, ok := w.reported[key]; ok {
+		return false
+	}
+	w.reported[key] = &reported{Key: key, Host: l.Host, Expires: l.Expires, ReportedAt: now, SeenAt: now}
+	if err := w.save(); err != nil {
+		slog.Error("saving expiry state", "error", err)
+	}
+	return true
+}
+
+// Check reports the licenses within the warning period at now that have
+// not been reported at this threshold yet
+func (w *Watcher) Check(now time.Time) error {
+	list, err := w.source.ExpiringLicenses(now, w.opts.WarningDays)
+	if err != nil {
+		return err
+	}
+
+	var due []notify.ExpiringLicense
+	w.mu.Lock()
+	for _, l := range list {
+		key := w.key(l)
+		if r, ok := w.reported[key]; ok {
+			r.SeenAt = now
+			continue
+		}
+		w.reported[key] = &reported{Key: key, Host: l.Host, Expires: l.Expires, ReportedAt: now, SeenAt: now}
+		due = append(due, l)
+	}
+	// Forget licenses that have been replaced on their host for a while;
+	// the delay covers an import claimed before its audit record is written
+	for key, r := range w.reported {
+		if now.Sub(r.SeenAt) > retention {
+			delete(w.reported, key)
+		}
+	}
+	err = w.save()
+	w.mu.Unlock()
+
+	for _, l := range due {
+		w.report(l)
+	}
+	return err
+}
+
+// Run checks for expiring licenses at start and then every interval until
+// stop is closed
+func (w *Watcher) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+
+	w.check(time.Now())
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			w.check(now)
+		}
+	}
+}
+
+func (w *Watcher) check(now time.Time) {
+	if err := w.Check(now); err != nil {
+		slog.Error("checking license expiry", "error", err)
+	}
+}
+
+// key identifies a license on a host at the configured threshold, so
+// lowering or raising the threshold reports licenses again
+func (w *Watcher) key(l notify.ExpiringLicense) string {
+	id := l.LicenseSHA256
+	if id == "" {
+		id = l.License
+	}
+	return fmt.Sprintf("%s|%s|%s|%d", l.Host, id, l.Expires, w.opts.WarningDays)
+}
+
+func (w *Watcher) save() error {
+	list := make([]*reported, 0, len(w.reported))
+	for _, r := range w.reported {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].ReportedAt.Equal(list[j].ReportedAt) {
+			return list[i].ReportedAt.Before(list[j].ReportedAt)
+		}
+		return list[i].Key < list[j].Key
+	})
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode expiry state: %v", err)
+	}
+
+	tmp := w.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write expiry state: %v", err)
+	}
+	if err := os.Rename(tmp, w.path); err != nil {
+		return fmt.Errorf("failed to replace expiry state: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package grpcserver
+
+import (
+	"context"
+	"license-manager/internal/api"
+	"license-manager/internal/handlers"
+	pb "license-manager/pkg/pb/licensemanager/v1"
+)
+
+type inventoryService struct {
+	pb.UnimplementedInventoryServiceServer
+}
+
+func (*inventoryService) ListServers(ctx context.Context, req *pb.ListServersRequest) (*pb.ListServersResponse, error) {
+	limit, offset, err := pageParams(req.Limit, req.Offset)
+	if err != nil {
+		return nil, err
+	}
+	page := api.Paginate(handlers.ListInventory(req.Tag), limit, offset)
+	resp := &pb.ListServersResponse{Total: int32(page.Total)}
+	for _, server := range page.Items {
+		resp.Servers = append(resp.Servers, serverProto(server))
+	}
+	return resp, nil
+}
+
+func (*inventoryService) GetServer(ctx context.Context, req *pb.GetServerRequest) (*pb.GetServerResponse, error) {
+	server, err := handlers.GetServer(req.Name)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.GetServerResponse{Server: serverProto(server)}, nil
+}
+
+func (*inventoryService) PutServer(ctx context.Context, req *pb.PutServerRequest) (*pb.PutServerResponse, error) {
+	server, created, err := handlers.SaveServer(ctx, actor(ctx), handlers.ServerRequest{
+		Name:           req.Name,
+		Host:           req.Host,
+		Port:           req.Port,
+		Username:       req.Username,
+		Password:       req.Password,
+		Become:         req.Become,
+		BecomeUser:     req.BecomeUser,
+		BecomePassword: req.BecomePassword,
+		Tags:           req.Tags,
+	}, req.CreateOnly)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.PutServerResponse{Server: serverProto(server), Created: created}, nil
+}
+
+func (*inventoryService) DeleteServer(ctx context.Context, req *pb.DeleteServerRequest) (*pb.DeleteServerResponse, error) {
+	if err := handlers.DeleteInventoryServer(ctx, actor(ctx), req.Name); err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.DeleteServerResponse{}, nil
+}
+
+// pageParams applies the versioned API's page limits; a zero limit is the
+// default
+func pageParams(limit, offset int32) (int, int, error) {
+	if limit == 0 {
+		limit = api.DefaultPageLimit
+	}
+	if limit < 1 || limit > api.MaxPageLimit {
+		return 0, 0, errorStatus(api.CodeInvalidRequest, "limit must be between 1 and 500")
+	}
+	if offset < 0 {
+		return 0, 0, errorStatus(api.CodeInvalidRequest, "offset must be a non-negative integer")
+	}
+	return int(limit), int(offset), nil
+}
+
+func serverProto(server handlers.ServerInfo) *pb.Server {
+	return &pb.Server{
+		Name:              server.Name,
+		Host:              server.Host,
+		Port:              server.Port,
+		Username:          server.Username,
+		Become:            server.Become,
+		BecomeUser:        server.BecomeUser,
+		Tags:              server.Tags,
+		HasPassword:       server.HasPassword,
+		HasBecomePassword: server.HasBecomePassword,
+	}
+}
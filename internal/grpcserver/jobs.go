@@ -0,0 +1,206 @@
+package grpcserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"license-manager/internal/api"
+	"license-manager/internal/audit"
+	"license-manager/internal/handlers"
+	"license-manager/internal/jobs"
+	"license-manager/internal/services"
+	pb "license-manager/pkg/pb/licensemanager/v1"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// watchPollInterval is how often WatchJob rereads its job, in case an
+// update was dropped because the stream fell behind
+const watchPollInterval = time.Second
+
+var jobStatuses = map[string]pb.JobStatus{
+	jobs.StatusRunning:     pb.JobStatus_JOB_STATUS_RUNNING,
+	jobs.StatusSucceeded:   pb.JobStatus_JOB_STATUS_SUCCEEDED,
+	jobs.StatusFailed:      pb.JobStatus_JOB_STATUS_FAILED,
+	jobs.StatusInterrupted: pb.JobStatus_JOB_STATUS_INTERRUPTED,
+}
+
+type jobService struct {
+	pb.UnimplementedJobServiceServer
+	closing <-chan struct{}
+}
+
+func (*jobService) SubmitJob(ctx context.Context, req *pb.SubmitJobRequest) (*pb.SubmitJobResponse, error) {
+	var kind string
+	var run func(op *handlers.Operation) error
+	switch operation := req.Operation.(type) {
+	case *pb.SubmitJobRequest_Check:
+		kind = audit.ActionCheckLicenseCLI
+		run = func(op *handlers.Operation) error {
+			result, err := op.Check()
+			if err == nil && !result.CLIFound {
+				err = errors.New("license2_cli not found on server")
+			}
+			return err
+		}
+	case *pb.SubmitJobRequest_Preflight:
+		kind = audit.ActionPreflight
+		run = func(op *handlers.Operation) error {
+			if op.Preflight().Report.Status == services.PreflightFail {
+				return errors.New("preflight checks failed")
+			}
+			return nil
+		}
+	case *pb.SubmitJobRequest_ImportLicense:
+		license := operation.ImportLicense
+		if license.Filename == "" {
+			return nil, errorStatus(api.CodeInvalidRequest, "import_license.filename is required")
+		}
+		kind = audit.ActionUploadLicense
+		run = func(op *handlers.Operation) error {
+			_, err := op.ImportLicense(license.Filename, bytes.NewReader(license.Content))
+			return err
+		}
+	default:
+		return nil, errorStatus(api.CodeInvalidRequest, "an operation is required")
+	}
+
+	// The job outlives the call
+	op, err := handlers.StartOperation(context.WithoutCancel(ctx), actor(ctx), kind, req.Server)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	job, err := handlers.GetJob(op.JobID())
+	if err != nil {
+		err = errors.New("jobs are not tracked by this server")
+		op.End(err)
+		return nil, errorStatus(api.CodeUnavailable, err.Error())
+	}
+	go func() {
+		op.End(run(op))
+	}()
+	return &pb.SubmitJobResponse{Job: jobProto(job)}, nil
+}
+
+func (*jobService) GetJob(ctx context.Context, req *pb.GetJobRequest) (*pb.GetJobResponse, error) {
+	job, err := handlers.GetJob(req.Id)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.GetJobResponse{Job: jobProto(job)}, nil
+}
+
+func (*jobService) ListJobs(ctx context.Context, req *pb.ListJobsRequest) (*pb.ListJobsResponse, error) {
+	limit, offset, err := pageParams(req.Limit, req.Offset)
+	if err != nil {
+		return nil, err
+	}
+	statusFilter := ""
+	if req.Status != pb.JobStatus_JOB_STATUS_UNSPECIFIED {
+		for name, value := range jobStatuses {
+			if value == req.Status {
+				statusFilter = name
+			}
+		}
+		if statusFilter == "" {
+			return nil, errorStatus(api.CodeInvalidRequest, "unknown job status "+req.Status.String())
+		}
+	}
+
+	page := api.Paginate(handlers.ListJobs(statusFilter), limit, offset)
+	resp := &pb.ListJobsResponse{Total: int32(page.Total)}
+	for i := range page.Items {
+		resp.Jobs = append(resp.Jobs, jobProto(&page.Items[i]))
+	}
+	return resp, nil
+}
+
+func (s *jobService) WatchJob(req *pb.WatchJobRequest, stream pb.JobService_WatchJobServer) error {
+	// Subscribe first so that no update after the initial read is missed
+	updates, unsubscribe := handlers.SubscribeJobs()
+	defer unsubscribe()
+
+	job, err := handlers.GetJob(req.Id)
+	if err != nil {
+		return toStatus(err)
+	}
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	var sent *jobs.Job
+	for {
+		if sent == nil || job.Status != sent.Status || job.Step != sent.Step || job.License != sent.License {
+			if err := stream.Send(&pb.WatchJobResponse{Job: jobProto(job)}); err != nil {
+				return err
+			}
+			sent = job
+		}
+		if job.Status != jobs.StatusRunning {
+			return nil
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case <-s.closing:
+			return errorStatus(api.CodeUnavailable, "Server is shutting down")
+		case update := <-updates:
+			if update.ID == job.ID {
+				job = &update
+			}
+		case <-ticker.C:
+			if latest, err := handlers.GetJob(req.Id); err == nil {
+				job = latest
+			}
+		}
+	}
+}
+
+func (s *jobService) WatchJobs(req *pb.WatchJobsRequest, stream pb.JobService_WatchJobsServer) error {
+	updates, unsubscribe := handlers.SubscribeJobs()
+	defer unsubscribe()
+	// Clients can wait for the headers to know that no later update will
+	// be missed
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case <-s.closing:
+			return errorStatus(api.CodeUnavailable, "Server is shutting down")
+		case job := <-updates:
+			if (req.Kind != "" && job.Kind != req.Kind) ||
+				(req.Host != "" && job.Host != req.Host) ||
+				(req.Actor != "" && job.Actor != req.Actor) {
+				continue
+			}
+			if err := stream.Send(&pb.WatchJobsResponse{Job: jobProto(&job)}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func jobProto(job *jobs.Job) *pb.Job {
+	msg := &pb.Job{
+		Id:        job.ID,
+		Kind:      job.Kind,
+		Host:      job.Host,
+		Actor:     job.Actor,
+		License:   job.License,
+		Status:    jobStatuses[job.Status],
+		Step:      job.Step,
+		Error:     job.Error,
+		StartedAt: timestamppb.New(job.StartedAt),
+	}
+	if job.FinishedAt != nil {
+		msg.FinishedAt = timestamppb.New(*job.FinishedAt)
+	}
+	return msg
+}
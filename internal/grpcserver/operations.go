@@ -0,0 +1,122 @@
+package grpcserver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"license-manager/internal/audit"
+	"license-manager/internal/handlers"
+	pb "license-manager/pkg/pb/licensemanager/v1"
+)
+
+// chunkSize bounds the data in each DownloadSysinfo message
+const chunkSize = 64 << 10
+
+type operationService struct {
+	pb.UnimplementedOperationServiceServer
+}
+
+func (*operationService) CheckServer(ctx context.Context, req *pb.CheckServerRequest) (*pb.CheckServerResponse, error) {
+	op, err := handlers.StartOperation(ctx, actor(ctx), audit.ActionCheckLicenseCLI, req.Server)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	result, err := op.Check()
+	op.End(err)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.CheckServerResponse{Server: result.Server, JobId: result.JobID, CliFound: result.CLIFound}, nil
+}
+
+func (*operationService) Preflight(ctx context.Context, req *pb.PreflightRequest) (*pb.PreflightResponse, error) {
+	op, err := handlers.StartOperation(ctx, actor(ctx), audit.ActionPreflight, req.Server)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	result := op.Preflight()
+	op.End(nil)
+
+	resp := &pb.PreflightResponse{
+		Server:     result.Server,
+		JobId:      result.JobID,
+		Host:       result.Report.Host,
+		Status:     result.Report.Status,
+		DurationMs: result.Report.DurationMS,
+	}
+	for _, check := range result.Report.Checks {
+		resp.Checks = append(resp.Checks, &pb.PreflightCheck{Name: check.Name, Status: check.Status, Message: check.Message})
+	}
+	return resp, nil
+}
+
+func (*operationService) ImportLicense(ctx context.Context, req *pb.ImportLicenseRequest) (*pb.ImportLicenseResponse, error) {
+	op, err := handlers.StartOperation(ctx, actor(ctx), audit.ActionUploadLicense, req.Server)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	result, err := op.ImportLicense(req.Filename, bytes.NewReader(req.Content))
+	op.End(err)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.ImportLicenseResponse{
+		Server:        result.Server,
+		JobId:         result.JobID,
+		License:       result.License,
+		LicenseSha256: result.LicenseSHA256,
+		Import:        commandOutputProto(result.Import),
+		Check:         commandOutputProto(result.Check),
+		CheckError:    result.CheckError,
+	}, nil
+}
+
+func (*operationService) DownloadSysinfo(req *pb.DownloadSysinfoRequest, stream pb.OperationService_DownloadSysinfoServer) error {
+	ctx := stream.Context()
+	op, err := handlers.StartOperation(ctx, actor(ctx), audit.ActionDownloadSysinfo, req.Server)
+	if err != nil {
+		return toStatus(err)
+	}
+	w := &chunkWriter{stream: stream}
+	err = op.DownloadSysinfo(func(filename string) io.Writer {
+		w.err = stream.Send(&pb.DownloadSysinfoResponse{Filename: filename, JobId: op.JobID()})
+		return w
+	})
+	op.End(err)
+	if err != nil {
+		return toStatus(err)
+	}
+	return nil
+}
+
+// chunkWriter sends what is written to it as DownloadSysinfo messages
+type chunkWriter struct {
+	stream pb.OperationService_DownloadSysinfoServer
+	err    error
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	written := 0
+	for w.err == nil && written < len(p) {
+		n := min(len(p)-written, chunkSize)
+		w.err = w.stream.Send(&pb.DownloadSysinfoResponse{Data: p[written : written+n]})
+		if w.err == nil {
+			written += n
+		}
+	}
+	return written, w.err
+}
+
+func commandOutputProto(output *handlers.CommandOutput) *pb.CommandOutput {
+	if output == nil {
+		return nil
+	}
+	return &pb.CommandOutput{
+		Command:    output.Command,
+		Stdout:     output.Stdout,
+		Stderr:     output.Stderr,
+		ExitStatus: int32(output.ExitStatus),
+		Signal:     output.Signal,
+		DurationMs: output.DurationMS,
+	}
+}
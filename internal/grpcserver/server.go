@@ -0,0 +1,190 @@
+// Package grpcserver serves the gRPC API defined in proto/licensemanager/v1.
+// It runs inventory changes and operations through the same functions as
+// the versioned HTTP API, so they are tracked as jobs and audited alike.
+package grpcserver
+
+import (
+	"context"
+	"license-manager/internal/api"
+	"license-manager/internal/handlers"
+	"license-manager/internal/logging"
+	"license-manager/internal/middleware"
+	pb "license-manager/pkg/pb/licensemanager/v1"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorDomain is the domain of the ErrorInfo detail attached to errors,
+// whose reason is the api error code
+const ErrorDomain = "license-manager"
+
+// Server is the gRPC API server
+type Server struct {
+	grpc   *grpc.Server
+	tokens []middleware.APIToken
+	// closing is closed by Shutdown to end open watch streams
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// New returns a server that accepts calls made with one of tokens. opts
+// are passed to grpc.NewServer, e.g. for TLS credentials.
+func New(tokens []middleware.APIToken, opts ...grpc.ServerOption) *Server {
+	s := &Server{tokens: tokens, closing: make(chan struct{})}
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(s.unaryInterceptor),
+		grpc.ChainStreamInterceptor(s.streamInterceptor),
+	)
+	s.grpc = grpc.NewServer(opts...)
+	pb.RegisterInventoryServiceServer(s.grpc, &inventoryService{})
+	pb.RegisterOperationServiceServer(s.grpc, &operationService{})
+	pb.RegisterJobServiceServer(s.grpc, &jobService{closing: s.closing})
+	return s
+}
+
+// Serve accepts connections on lis until Shutdown
+func (s *Server) Serve(lis net.Listener) error {
+	return s.grpc.Serve(lis)
+}
+
+// Shutdown ends watch streams and waits for other calls to finish. Calls
+// still running when ctx is done are cancelled.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closeOnce.Do(func() { close(s.closing) })
+	stopped := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.grpc.Stop()
+		return ctx.Err()
+	}
+}
+
+type actorKey struct{}
+
+// actor is who the call is made as, "token:" and the API token's name, as
+// for HTTP requests
+func actor(ctx context.Context) string {
+	name, _ := ctx.Value(actorKey{}).(string)
+	return name
+}
+
+// authenticate checks the call's bearer token and returns a context that
+// carries its actor and a logger
+func (s *Server) authenticate(ctx context.Context, method string) (context.Context, error) {
+	ctx = logging.WithContext(ctx, logging.FromContext(ctx).With("rpc", method))
+	var header string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			header = values[0]
+		}
+	}
+	name, ok := middleware.MatchAPIToken(s.tokens, header)
+	if !ok {
+		return ctx, errorStatus(api.CodeUnauthorized, "A valid API token is required")
+	}
+	return context.WithValue(ctx, actorKey{}, "token:"+name), nil
+}
+
+func (s *Server) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	started := time.Now()
+	ctx, err := s.authenticate(ctx, info.FullMethod)
+	var resp any
+	if err == nil {
+		resp, err = handler(ctx, req)
+	}
+	logCall(ctx, started, err)
+	return resp, err
+}
+
+func (s *Server) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	started := time.Now()
+	ctx, err := s.authenticate(ss.Context(), info.FullMethod)
+	if err == nil {
+		err = handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+	logCall(ctx, started, err)
+	return err
+}
+
+// authenticatedStream replaces the stream's context with the authenticated
+// one
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// logCall logs a completed call like logging.Middleware logs requests
+func logCall(ctx context.Context, started time.Time, err error) {
+	code := status.Code(err)
+	level := slog.LevelInfo
+	switch code {
+	case codes.OK, codes.Canceled:
+	case codes.Internal, codes.Unknown, codes.DataLoss:
+		level = slog.LevelError
+	default:
+		level = slog.LevelWarn
+	}
+	logging.FromContext(ctx).Log(ctx, level, "rpc completed", "actor", actor(ctx), "code", code.String(), "duration_ms", time.Since(started).Milliseconds())
+}
+
+// grpcCodes is the gRPC code for each api error code
+var grpcCodes = map[string]codes.Code{
+	api.CodeInvalidRequest:   codes.InvalidArgument,
+	api.CodeUnauthorized:     codes.Unauthenticated,
+	api.CodeForbidden:        codes.PermissionDenied,
+	api.CodeNotFound:         codes.NotFound,
+	api.CodeConflict:         codes.AlreadyExists,
+	api.CodeUnavailable:      codes.Unavailable,
+	api.CodeConnectionFailed: codes.Unavailable,
+	api.CodeCLINotFound:      codes.FailedPrecondition,
+	api.CodeRemoteFailed:     codes.Aborted,
+	api.CodeInternal:         codes.Internal,
+}
+
+// errorStatus is the status for an api error code. The code itself is
+// attached as the reason of an ErrorInfo detail.
+func errorStatus(code, message string) error {
+	grpcCode, ok := grpcCodes[code]
+	if !ok {
+		grpcCode = codes.Internal
+	}
+	st := status.New(grpcCode, message)
+	if detailed, err := st.WithDetails(&errdetails.ErrorInfo{Reason: code, Domain: ErrorDomain}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// toStatus converts an error from the handlers package
+func toStatus(err error) error {
+	return errorStatus(handlers.ErrorCode(err), err.Error())
+}
+
+// ErrorCode returns the api error code of an error returned by the server,
+// "" when it has none
+func ErrorCode(err error) string {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Domain == ErrorDomain {
+			return info.Reason
+		}
+	}
+	return ""
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"license-manager/internal/audit"
+	"license-manager/internal/jobs"
+	"license-manager/internal/logging"
+	"license-manager/internal/middleware"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// jobManager tracks in-flight remote operations so shutdown can drain them.
+// It stays nil (and tracking disabled) until SetJobManager is called.
+var jobManager *jobs.Manager
+
+// SetJobManager sets the job manager used by all handlers
+func SetJobManager(m *jobs.Manager) {
+	jobManager = m
+}
+
+type JobsResponse struct {
+	Jobs  []jobs.Job `json:"jobs"`
+	Count int        `json:"count"`
+}
+
+// action tracks one remote operation requested through a handler: its job
+// and the handler-level audit record
+type action struct {
+	rec     audit.Record
+	jobID   string
+	started time.Time
+	logger  *slog.Logger
+	span    trace.Span
+}
+
+// actor identifies who made the request: the API token's name for scripted
+// clients, the subject of a verified client certificate when mTLS is in use,
+// otherwise the client IP
+func actor(c *gin.Context) string {
+	if name := middleware.APITokenName(c); name != "" {
+		return "token:" + name
+	}
+	if tlsState := c.Request.TLS; tlsState != nil && len(tlsState.VerifiedChains) > 0 {
+		return "cert:" + tlsState.VerifiedChains[0][0].Subject.CommonName
+	}
+	return c.ClientIP()
+}
+
+// startAction registers the operation as a job. It returns nil, after
+// responding with 503, when the server is shutting down.
+func startAction(c *gin.Context, kind string, config ServerConfig) *action {
+	a, err := beginAction(c, kind, config)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"error":   "Server is shutting down, please retry shortly",
+		})
+		return nil
+	}
+	return a
+}
+
+// beginAction is startAction for handlers that write their own errors: it
+// returns jobs.ErrShuttingDown without responding
+func beginAction(c *gin.Context, kind string, config ServerConfig) (*action, error) {
+	a, ctx, err := newAction(c.Request.Context(), actor(c), kind, config)
+	if err != nil {
+		return nil, err
+	}
+	c.Request = c.Request.WithContext(ctx)
+	return a, nil
+}
+
+// newAction registers an operation by actor as a job. The returned context
+// carries a logger with the job and host, so that everything logged for the
+// operation, including by SSHService, carries them.
+func newAction(ctx context.Context, actor, kind string, config ServerConfig) (*action, context.Context, error) {
+	a := &action{
+		rec: audit.Record{
+			Actor:      actor,
+			Action:     kind,
+			Host:       net.JoinHostPort(config.Host, config.Port),
+			Server:     config.Server,
+			RemoteUser: config.Username,
+		},
+		started: time.Now(),
+	}
+
+	if jobManager != nil {
+		job, err := jobManager.Start(kind, a.rec.Host, a.rec.Actor)
+		if errors.Is(err, jobs.ErrShuttingDown) {
+			return nil, ctx, err
+		}
+		if err != nil {
+			logging.FromContext(ctx).Error("starting job", "error", err)
+		} else {
+			a.jobID = job.ID
+		}
+	}
+
+	args := []any{"action", kind, "host", a.rec.Host, "actor", a.rec.Actor}
+	if a.jobID != "" {
+		args = append(args, "job_id", a.jobID)
+	}
+	a.logger = logging.FromContext(ctx).With(args...)
+	a.logger.Info("job started")
+
+	a.span = trace.SpanFromContext(ctx)
+	a.span.SetAttributes(
+		attribute.String("job.kind", kind),
+		attribute.String("job.id", a.jobID),
+		attribute.String("server.address", config.Host),
+		attribute.String("server.port", config.Port),
+	)
+
+	return a, logging.WithContext(ctx, a.logger), nil
+}
+
+// setLicense records the license file being imported
+func (a *action) setLicense(name, sha256 string) {
+	a.rec.LicenseFile = name
+	a.rec.LicenseSHA256 = sha256
+	if jobManager != nil && a.jobID != "" {
+		jobManager.SetLicense(a.jobID, name)
+	}
+}
+
+// step records how far the operation has progressed
+func (a *action) step(name string) {
+	a.span.AddEvent("step", trace.WithAttributes(attribute.String("job.step", name)))
+	if jobManager != nil && a.jobID != "" {
+		jobManager.SetStep(a.jobID, name)
+	}
+}
+
+// finish completes the job and writes the audit record, deriving the
+// outcome from the response status
+func (a *action) finish(c *gin.Context) {
+	var err error
+	if status := c.Writer.Status(); status >= http.StatusBadRequest {
+		err = errors.New("HTTP " + strconv.Itoa(status) + " " + http.StatusText(status))
+	}
+	a.end(err)
+}
+
+// end completes the job and writes the audit record; a nil err is success
+func (a *action) end(err error) {
+	a.rec.Time = a.started
+	a.rec.DurationMS = time.Since(a.started).Milliseconds()
+	a.rec.Outcome = audit.OutcomeSuccess
+	if err != nil {
+		a.rec.Outcome = audit.OutcomeFailure
+		a.rec.ExitStatus = -1
+		a.rec.Error = err.Error()
+	}
+
+	if jobManager != nil && a.jobID != "" {
+		jobManager.Finish(a.jobID, err)
+	}
+	if err := auditLog.Append(a.rec); err != nil {
+		a.logger.Error("writing audit record", "error", err)
+	}
+	a.publishJob()
+	a.logger.Info("job finished", "outcome", a.rec.Outcome, "duration_ms", a.rec.DurationMS)
+}
+
+// JobsHandler lists tracked jobs, optionally filtered by ?status=
+func JobsHandler(c *gin.Context) {
+	list := []jobs.Job{}
+	if jobManager != nil {
+		list = jobManager.List(c.Query("status"))
+	}
+
+	c.JSON(http.StatusOK, JobsResponse{
+		Jobs:  list,
+		Count: len(list),
+	})
+}
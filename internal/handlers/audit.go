@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"license-manager/internal/audit"
+	"license-manager/internal/logging"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditLog receives a record for every handler action and remote command.
+// It stays nil (and auditing disabled) until SetAuditLog is called.
+var auditLog *audit.Log
+
+// SetAuditLog sets the audit log used by all handlers
+func SetAuditLog(l *audit.Log) {
+	auditLog = l
+}
+
+type AuditResponse struct {
+	Records []audit.Record `json:"records"`
+	Count   int            `json:"count"`
+	Error   string         `json:"error,omitempty"`
+}
+
+type AuditVerifyResponse struct {
+	Valid   bool   `json:"valid"`
+	Records int    `json:"records"`
+	Error   string `json:"error,omitempty"`
+}
+
+// AuditHandler lists audit records. Records can be filtered with the actor,
+// action, host, outcome, since, until and limit query parameters, and
+// exported with format=csv or format=json.
+func AuditHandler(c *gin.Context) {
+	filter := audit.Filter{
+		Actor:   c.Query("actor"),
+		Action:  c.Query("action"),
+		Host:    c.Query("host"),
+		Outcome: c.Query("outcome"),
+	}
+
+	for param, dst := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, AuditResponse{
+				Records: []audit.Record{},
+				Error:   "Invalid " + param + " time, expected RFC 3339: " + err.Error(),
+			})
+			return
+		}
+		*dst = t
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			c.JSON(http.StatusBadRequest, AuditResponse{
+				Records: []audit.Record{},
+				Error:   "Invalid limit: " + value,
+			})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	records, err := auditLog.Query(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, AuditResponse{
+			Records: []audit.Record{},
+			Error:   "Failed to read audit log: " + err.Error(),
+		})
+		return
+	}
+
+	filename := "audit_" + time.Now().UTC().Format("20060102T150405Z")
+	switch c.Query("format") {
+	case "csv":
+		c.Header("Content-Disposition", "attachment; filename=\""+filename+".csv\"")
+		c.Header("Content-Type", "text/csv")
+		c.Status(http.StatusOK)
+		if err := audit.WriteCSV(c.Writer, records); err != nil {
+			logging.FromContext(c.Request.Context()).Error("exporting audit log", "error", err)
+		}
+		return
+	case "json":
+		c.Header("Content-Disposition", "attachment; filename=\""+filename+".json\"")
+	}
+
+	c.JSON(http.StatusOK, AuditResponse{
+		Records: records,
+		Count:   len(records),
+	})
+}
+
+// AuditVerifyHandler checks the hash chain of the audit log
+func AuditVerifyHandler(c *gin.Context) {
+	count, err := auditLog.Verify()
+	if err != nil {
+		c.JSON(http.StatusConflict, AuditVerifyResponse{
+			Valid: false,
+			Error: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, AuditVerifyResponse{
+		Valid:   true,
+		Records: count,
+	})
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"license-manager/internal/api"
+	"license-manager/internal/audit"
+	"license-manager/internal/chat"
+	"license-manager/internal/logging"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// chatNotifier posts job outcomes and expiry alerts to chat channels. It
+// stays nil (and chat notifications disabled) until SetChat is called.
+var chatNotifier *chat.Notifier
+
+// SetChat sets the notifier that messages are posted through
+func SetChat(n *chat.Notifier) {
+	chatNotifier = n
+}
+
+// ChatRouteRequest adds a chat route
+type ChatRouteRequest struct {
+	Name string `json:"name"`
+	// Format is slack, mattermost or teams
+	Format string `json:"format"`
+	// URL is the channel's incoming webhook
+	URL string `json:"url"`
+	// Events to post; none posts every event
+	Events []string `json:"events,omitempty"`
+	// Tags limits the route to servers with any of these tags
+	Tags []string `json:"tags,omitempty"`
+}
+
+// serverTags returns the inventory tags of the action's server, which
+// route its chat messages
+func (a *action) serverTags() []string {
+	return inventoryTags(a.rec.Server)
+}
+
+// inventoryTags returns the tags of the named inventory server, if any
+func inventoryTags(name string) []string {
+	if name == "" || serverInventory == nil {
+		return nil
+	}
+	server, err := serverInventory.Get(name)
+	if err != nil {
+		return nil
+	}
+	return server.Tags
+}
+
+// hostLabel names a host by its inventory server, if any, and address
+func hostLabel(server, host string) string {
+	if server == "" {
+		return host
+	}
+	return server + " (" + host + ")"
+}
+
+// jobMessage is the chat message for a finished job
+func jobMessage(event string, job JobEvent, tags []string) chat.Message {
+	msg := chat.Message{
+		Event:    event,
+		Severity: chat.SeverityGood,
+		Title:    fmt.Sprintf("%s %s on %s", job.Kind, job.Status, hostLabel(job.Server, job.Host)),
+		Text:     job.Error,
+		Tags:     tags,
+	}
+	if event == chat.EventJobFailed {
+		msg.Severity = chat.SeverityDanger
+	}
+	msg.Fields = append(msg.Fields, chat.Field{Name: "Actor", Value: job.Actor})
+	if job.License != "" {
+		msg.Fields = append(msg.Fields, chat.Field{Name: "License", Value: job.License})
+	}
+	msg.Fields = append(msg.Fields, chat.Field{Name: "Duration", Value: (time.Duration(job.DurationMS) * time.Millisecond).String()})
+	if job.JobID != "" {
+		msg.Fields = append(msg.Fields, chat.Field{Name: "Job", Value: job.JobID})
+	}
+	return msg
+}
+
+// expiryMessage is the chat message for a license imported within the
+// expiry warning period
+func expiryMessage(event LicenseEvent, expires string, tags []string) chat.Message {
+	days := *event.DaysRemaining
+	msg := chat.Message{
+		Event:    chat.EventLicenseExpiring,
+		Severity: chat.SeverityWarning,
+		Title:    fmt.Sprintf("License on %s expires in %d days", hostLabel(event.Server, event.Host), days),
+		Text:     fmt.Sprintf("%s is within the %d-day expiry warning period.", event.License, event.WarningDays),
+		Fields: []chat.Field{
+			{Name: "License", Value: event.License},
+			{Name: "Expires", Value: expires},
+		},
+		Tags: tags,
+	}
+	if days <= 0 {
+		msg.Severity = chat.SeverityDanger
+		msg.Title = fmt.Sprintf("License on %s has expired", hostLabel(event.Server, event.Host))
+	}
+	return msg
+}
+
+// chatError responds with the envelope for an error from the notifier
+func chatError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, chat.ErrNotFound):
+		api.Abort(c, http.StatusNotFound, api.CodeNotFound, "Chat route "+c.Param("id")+" not found")
+	case errors.Is(err, chat.ErrPostFailed):
+		api.Abort(c, http.StatusBadGateway, api.CodeConnectionFailed, err.Error())
+	default:
+		api.Abort(c, http.StatusInternalServerError, api.CodeInternal, err.Error())
+	}
+}
+
+// requireChat responds with 503 and returns false when chat notifications
+// are not configured
+func requireChat(c *gin.Context) bool {
+	if chatNotifier == nil {
+		api.Abort(c, http.StatusServiceUnavailable, api.CodeUnavailable, "Chat notifications are not configured")
+		return false
+	}
+	return true
+}
+
+// recordChatRouteChange writes an audit record for a chat route being
+// added or removed. Only the webhook's host is recorded, since its URL is
+// a credential.
+func recordChatRouteChange(c *gin.Context, action string, r chat.Route) {
+	host := ""
+	if u, err := url.Parse(r.URL); err == nil {
+		host = u.Host
+	}
+	rec := audit.Record{
+		Time:    time.Now(),
+		Actor:   actor(c),
+		Action:  action,
+		Host:    host,
+		Command: r.Format + " route " + r.Name,
+		Outcome: audit.OutcomeSuccess,
+	}
+	if err := auditLog.Append(rec); err != nil {
+		logging.FromContext(c.Request.Context()).Error("writing audit record", "error", err)
+	}
+}
+
+func v1ListChatRoutes(c *gin.Context) {
+	limit, offset, err := api.PageParams(c)
+	if err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+	list := []chat.Route{}
+	if chatNotifier != nil {
+		for _, r := range chatNotifier.List() {
+			list = append(list, r.Redacted())
+		}
+	}
+	c.JSON(http.StatusOK, api.Paginate(list, limit, offset))
+}
+
+func v1CreateChatRoute(c *gin.Context) {
+	if !requireChat(c) {
+		return
+	}
+	var req ChatRouteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request data: "+err.Error())
+		return
+	}
+	r, err := chatNotifier.Create(req.Name, req.Format, req.URL, req.Events, req.Tags)
+	if err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+	recordChatRouteChange(c, audit.ActionChatRouteCreate, r)
+	c.JSON(http.StatusCreated, r.Redacted())
+}
+
+func v1GetChatRoute(c *gin.Context) {
+	if !requireChat(c) {
+		return
+	}
+	r, err := chatNotifier.Get(c.Param("id"))
+	if err != nil {
+		chatError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, r.Redacted())
+}
+
+func v1DeleteChatRoute(c *gin.Context) {
+	if !requireChat(c) {
+		return
+	}
+	r, err := chatNotifier.Get(c.Param("id"))
+	if err == nil {
+		err = chatNotifier.Delete(r.ID)
+	}
+	if err != nil {
+		chatError(c, err)
+		return
+	}
+	recordChatRouteChange(c, audit.ActionChatRouteDelete, r)
+	c.Status(http.StatusNoContent)
+}
+
+func v1TestChatRoute(c *gin.Context) {
+	if !requireChat(c) {
+		return
+	}
+	if err := chatNotifier.Test(c.Request.Context(), c.Param("id")); err != nil {
+		chatError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"errors"
+	"license-manager/internal/audit"
+	"license-manager/internal/expiry"
+	"license-manager/internal/jobs"
+	"license-manager/internal/metrics"
+	"license-manager/internal/notify"
+	"license-manager/internal/services"
+	"license-manager/internal/webhooks"
+	"time"
+)
+
+// webhookDispatcher receives the events of every action. It stays nil (and
+// webhooks disabled) until SetWebhooks is called.
+var webhookDispatcher *webhooks.Dispatcher
+
+// SetWebhooks sets the dispatcher that events are published to
+func SetWebhooks(d *webhooks.Dispatcher) {
+	webhookDispatcher = d
+}
+
+// expiryWatcher remembers which licenses were reported as expiring. While
+// it is nil (until SetExpiry is called) imports report expiring licenses
+// every time and no periodic check runs.
+var expiryWatcher *expiry.Watcher
+
+// SetExpiry sets the watcher that reports each expiring license once
+func SetExpiry(w *expiry.Watcher) {
+	expiryWatcher = w
+}
+
+// ReportExpiring publishes license.expiring for a license the periodic
+// expiry check found within the warning period, and posts it to chat
+func ReportExpiring(l notify.ExpiringLicense) {
+	days := l.DaysRemaining
+	event := LicenseEvent{
+		Server:        l.Server,
+		Host:          l.Host,
+		License:       l.License,
+		LicenseSHA256: l.LicenseSHA256,
+		DaysRemaining: &days,
+		WarningDays:   settings.ExpiryWarningDays,
+	}
+	webhookDispatcher.Publish(webhooks.EventLicenseExpiring, event)
+	chatNotifier.Publish(expiryMessage(event, l.Expires, inventoryTags(l.Server)))
+}
+
+// JobEvent is the data of job.completed and job.failed events
+type JobEvent struct {
+	JobID      string    `json:"job_id,omitempty"`
+	Kind       string    `json:"kind"`
+	Server     string    `json:"server,omitempty"`
+	Host       string    `json:"host"`
+	Actor      string    `json:"actor"`
+	License    string    `json:"license,omitempty"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMS int64     `json:"duration_ms"`
+}
+
+// LicenseEvent is the data of license.imported and license.expiring
+// events. DaysRemaining is set when license2_cli check stated it.
+type LicenseEvent struct {
+	JobID         string `json:"job_id,omitempty"`
+	Server        string `json:"server,omitempty"`
+	Host          string `json:"host"`
+	License       string `json:"license"`
+	LicenseSHA256 string `json:"license_sha256"`
+	DaysRemaining *int   `json:"days_remaining,omitempty"`
+	// WarningDays is the expiry warning threshold, on license.expiring
+	WarningDays int `json:"warning_days,omitempty"`
+}
+
+// DriftEvent is the data of fingerprint.drift events: a host's sysinfo
+// file differs from the one last downloaded from it
+type DriftEvent struct {
+	JobID          string    `json:"job_id,omitempty"`
+	Server         string    `json:"server,omitempty"`
+	Host           string    `json:"host"`
+	SysinfoSHA256  string    `json:"sysinfo_sha256"`
+	PreviousSHA256 string    `json:"previous_sha256"`
+	PreviousTime   time.Time `json:"previous_time"`
+}
+
+// UnreachableEvent is the data of host.unreachable events
+type UnreachableEvent struct {
+	JobID  string `json:"job_id,omitempty"`
+	Kind   string `json:"kind"`
+	Server string `json:"server,omitempty"`
+	Host   string `json:"host"`
+	Error  string `json:"error"`
+}
+
+// publishJob reports the finished action as job.completed or job.failed, to
+// webhooks and chat
+func (a *action) publishJob() {
+	event, status := webhooks.EventJobCompleted, jobs.StatusSucceeded
+	if a.rec.Outcome != audit.OutcomeSuccess {
+		event, status = webhooks.EventJobFailed, jobs.StatusFailed
+	}
+	job := JobEvent{
+		JobID:      a.jobID,
+		Kind:       a.rec.Action,
+		Server:     a.rec.Server,
+		Host:       a.rec.Host,
+		Actor:      a.rec.Actor,
+		License:    a.rec.LicenseFile,
+		Status:     status,
+		Error:      a.rec.Error,
+		StartedAt:  a.started.UTC(),
+		DurationMS: a.rec.DurationMS,
+	}
+	webhookDispatcher.Publish(event, job)
+	chatNotifier.Publish(jobMessage(event, job, a.serverTags()))
+}
+
+// unreachable reports that the host could not be connected to
+func (a *action) unreachable(err error) {
+	webhookDispatcher.Publish(webhooks.EventHostUnreachable, UnreachableEvent{
+		JobID:  a.jobID,
+		Kind:   a.rec.Action,
+		Server: a.rec.Server,
+		Host:   a.rec.Host,
+		Error:  err.Error(),
+	})
+}
+
+// preflighted reports the host as unreachable when the preflight could not
+// connect to it
+func (a *action) preflighted(report *services.PreflightReport) {
+	for _, check := range report.Checks {
+		if check.Name == services.CheckSSH && check.Status == services.PreflightFail {
+			a.unreachable(errors.New(check.Message))
+		}
+	}
+}
+
+// licenseImported reports the imported license. When the output of the
+// verifying license2_cli check states the days remaining, they are recorded
+// as a metric, the expiry date is recorded in the audit log for digests and
+// a license within the warning period is reported as expiring, unless it
+// already was.
+func (a *action) licenseImported(checkOutput string) {
+	event := LicenseEvent{
+		JobID:         a.jobID,
+		Server:        a.rec.Server,
+		Host:          a.rec.Host,
+		License:       a.rec.LicenseFile,
+		LicenseSHA256: a.rec.LicenseSHA256,
+	}
+	now := time.Now()
+	days, ok := services.ParseDaysRemaining(checkOutput, now)
+	if ok {
+		metrics.SetLicenseDaysRemaining(a.rec.Host, days)
+		a.rec.LicenseExpiry = now.UTC().AddDate(0, 0, int(days)).Format(expiryDateLayout)
+		remaining := int(days)
+		event.DaysRemaining = &remaining
+	}
+	webhookDispatcher.Publish(webhooks.EventLicenseImported, event)
+
+	if ok && days <= float64(settings.ExpiryWarningDays) && expiryWatcher.Claim(notify.ExpiringLicense{
+		Host:          a.rec.Host,
+		License:       a.rec.LicenseFile,
+		LicenseSHA256: a.rec.LicenseSHA256,
+		Expires:       a.rec.LicenseExpiry,
+	}, now) {
+		event.WarningDays = settings.ExpiryWarningDays
+		webhookDispatcher.Publish(webhooks.EventLicenseExpiring, event)
+		chatNotifier.Publish(expiryMessage(event, a.rec.LicenseExpiry, a.serverTags()))
+	}
+}
+
+// sysinfoDownloaded records the downloaded sysinfo file's SHA-256 and
+// reports drift when the last successful download from the same host
+// produced a different file. Drift is only detected with an audit log.
+func (a *action) sysinfoDownloaded(sha256 string) {
+	a.rec.SysinfoSHA256 = sha256
+
+	previous, err := auditLog.Query(audit.Filter{
+		Action:  audit.ActionDownloadSysinfo,
+		Host:    a.rec.Host,
+		Outcome: audit.OutcomeSuccess,
+	})
+	if err != nil {
+		a.logger.Error("reading previous sysinfo downloads", "error", err)
+		return
+	}
+	for i := len(previous) - 1; i >= 0; i-- {
+		rec := previous[i]
+		if rec.SysinfoSHA256 == "" {
+			continue
+		}
+		if rec.SysinfoSHA256 != sha256 {
+			a.logger.Warn("sysinfo fingerprint changed", "previous_sha256", rec.SysinfoSHA256, "sysinfo_sha256", sha256)
+			webhookDispatcher.Publish(webhooks.EventFingerprintDrift, DriftEvent{
+				JobID:          a.jobID,
+				Server:         a.rec.Server,
+				Host:           a.rec.Host,
+				SysinfoSHA256:  sha256,
+				PreviousSHA256: rec.SysinfoSHA256,
+				PreviousTime:   rec.Time,
+			})
+		}
+		return
+	}
+}
@@ -1,21 +1,171 @@
 package handlers
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"license-manager/internal/api"
+	"license-manager/internal/audit"
+	"license-manager/internal/logging"
+	"license-manager/internal/middleware"
 	"license-manager/internal/services"
-	"log"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// Settings holds the handler options that come from the application config
+type Settings struct {
+	UploadDir          string
+	RemoteTempDir      string
+	SSHTimeout         time.Duration
+	SSHCommandTimeout  time.Duration
+	SSHTransferTimeout time.Duration
+	// ExpiryWarningDays is how many days before expiry an imported license
+	// is reported as expiring
+	ExpiryWarningDays int
+}
+
+// DefaultExpiryWarningDays is the default Settings.ExpiryWarningDays
+const DefaultExpiryWarningDays = 30
+
+// settings is used by all handlers; Configure replaces the defaults
+var settings = Settings{
+	UploadDir:          "uploads",
+	RemoteTempDir:      "/tmp/",
+	SSHTimeout:         services.DefaultTimeout,
+	SSHCommandTimeout:  services.DefaultCommandTimeout,
+	SSHTransferTimeout: services.DefaultTransferTimeout,
+	ExpiryWarningDays:  DefaultExpiryWarningDays,
+}
+
+// sshPool, when set, supplies authenticated clients shared across requests
+var sshPool *services.Pool
+
+// Configure sets the options used by all handlers
+func Configure(s Settings) {
+	settings = s
+}
+
+// SetSSHPool makes handlers borrow SSH clients from pool instead of dialing
+// for every request
+func SetSSHPool(pool *services.Pool) {
+	sshPool = pool
+}
+
+// newSSHService returns a service for the server in config, audited as the
+// request's actor and backed by the pool when one is set
+func newSSHService(c *gin.Context, config ServerConfig) *services.SSHService {
+	return sshServiceFor(c.Request.Context(), actor(c), config)
+}
+
+// sshServiceFor is newSSHService outside of a gin request
+func sshServiceFor(ctx context.Context, actor string, config ServerConfig) *services.SSHService {
+	sshService := services.NewSSHService(&services.SSHConfig{
+		Host:            config.Host,
+		Port:            config.Port,
+		Username:        config.Username,
+		Password:        config.Password,
+		Timeout:         settings.SSHTimeout,
+		CommandTimeout:  settings.SSHCommandTimeout,
+		TransferTimeout: settings.SSHTransferTimeout,
+		Escalation:      config.escalation(),
+	})
+	sshService.SetAudit(auditLog, actor)
+	sshService.SetLogger(logging.FromContext(ctx))
+	if sshPool != nil {
+		sshService.SetPool(sshPool)
+	}
+	return sshService
+}
+
+// ServerConfig identifies the server to operate on, either by the name of
+// an inventory entry or by its connection settings
 type ServerConfig struct {
-	Host     string `json:"host" binding:"required"`
-	Port     string `json:"port" binding:"required"`
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	// Server names an inventory entry, which supplies the other fields
+	Server   string `json:"server,omitempty"`
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Become runs license2_cli through "sudo" or "su"; empty runs it as
+	// Username
+	Become         string `json:"become,omitempty"`
+	BecomeUser     string `json:"become_user,omitempty"`
+	BecomePassword string `json:"become_password,omitempty"`
+}
+
+func (config ServerConfig) escalation() services.Escalation {
+	return services.Escalation{
+		Method:   config.Become,
+		User:     config.BecomeUser,
+		Password: config.BecomePassword,
+	}
+}
+
+// errAuthRequired is returned for browser requests that name an inventory
+// server: its stored credentials need an API token or client certificate
+var errAuthRequired = errors.New("an API token or client certificate is required to use inventory servers")
+
+// bindServerConfig reads a JSON server config and resolves it
+func bindServerConfig(c *gin.Context, config *ServerConfig) error {
+	if err := c.ShouldBindJSON(config); err != nil {
+		return err
+	}
+	return resolveRequestConfig(c, config)
+}
+
+// resolveRequestConfig is resolveServerConfig for a request, which may only
+// name an inventory server when it is authenticated
+func resolveRequestConfig(c *gin.Context, config *ServerConfig) error {
+	if config.Server != "" && !middleware.Authenticated(c) {
+		return errAuthRequired
+	}
+	return resolveServerConfig(config)
+}
+
+// configErrorStatus is the response status for an error from
+// resolveRequestConfig
+func configErrorStatus(err error) int {
+	if errors.Is(err, errAuthRequired) {
+		return http.StatusUnauthorized
+	}
+	return http.StatusBadRequest
+}
+
+// resolveServerConfig fills in the settings of a named inventory server and
+// checks that the config is complete
+func resolveServerConfig(config *ServerConfig) error {
+	if config.Server != "" {
+		if serverInventory == nil {
+			return fmt.Errorf("no server inventory is configured")
+		}
+		server, err := serverInventory.Get(config.Server)
+		if err != nil {
+			return err
+		}
+		*config = ServerConfig{
+			Server:         server.Name,
+			Host:           server.Host,
+			Port:           server.Port,
+			Username:       server.Username,
+			Password:       server.Password,
+			Become:         server.Become,
+			BecomeUser:     server.BecomeUser,
+			BecomePassword: server.BecomePassword,
+		}
+	}
+
+	if config.Host == "" || config.Port == "" || config.Username == "" || config.Password == "" {
+		return fmt.Errorf("host, port, username and password are required")
+	}
+	return config.escalation().Validate()
 }
 
 type CheckLicenseCLIResponse struct {
@@ -23,6 +173,12 @@ type CheckLicenseCLIResponse struct {
 	Error  string `json:"error,omitempty"`
 }
 
+type PreflightResponse struct {
+	Success bool                      `json:"success"`
+	Report  *services.PreflightReport `json:"report,omitempty"`
+	Error   string                    `json:"error,omitempty"`
+}
+
 type DownloadSysinfoResponse struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
@@ -30,39 +186,80 @@ type DownloadSysinfoResponse struct {
 }
 
 type UploadLicenseResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-	Error   string `json:"error,omitempty"`
+	Success bool           `json:"success"`
+	Message string         `json:"message"`
+	Error   string         `json:"error,omitempty"`
+	Import  *CommandOutput `json:"import,omitempty"`
+	Check   *CommandOutput `json:"check,omitempty"`
+}
+
+// CommandOutput reports the result of a remote command
+type CommandOutput struct {
+	Command    string `json:"command"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	ExitStatus int    `json:"exit_status"`
+	Signal     string `json:"signal,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// commandOutput converts result for a response; nil when the command never
+// started
+func commandOutput(result *services.CommandResult) *CommandOutput {
+	if result == nil {
+		return nil
+	}
+	return &CommandOutput{
+		Command:    result.Command,
+		Stdout:     result.Stdout,
+		Stderr:     result.Stderr,
+		ExitStatus: result.ExitStatus,
+		Signal:     result.Signal,
+		DurationMS: result.Duration.Milliseconds(),
+	}
+}
+
+// Output is the command's stdout and stderr, as CommandResult.Output
+func (o *CommandOutput) Output() string {
+	if o == nil {
+		return ""
+	}
+	result := services.CommandResult{Stdout: o.Stdout, Stderr: o.Stderr}
+	return result.Output()
 }
 
 func IndexHandler(c *gin.Context) {
 	c.HTML(http.StatusOK, "index.html", gin.H{
-		"title": "License Manager",
+		"title":     "License Manager",
+		"csrfToken": middleware.CSRFToken(c),
 	})
 }
 
 func CheckLicenseCLIHandler(c *gin.Context) {
 	var config ServerConfig
-	if err := c.ShouldBindJSON(&config); err != nil {
-		c.JSON(http.StatusBadRequest, CheckLicenseCLIResponse{
+	if err := bindServerConfig(c, &config); err != nil {
+		c.JSON(configErrorStatus(err), CheckLicenseCLIResponse{
 			Exists: false,
 			Error:  "Invalid request data: " + err.Error(),
 		})
 		return
 	}
 
-	sshConfig := &services.SSHConfig{
-		Host:     config.Host,
-		Port:     config.Port,
-		Username: config.Username,
-		Password: config.Password,
+	action := startAction(c, audit.ActionCheckLicenseCLI, config)
+	if action == nil {
+		return
 	}
+	defer action.finish(c)
 
-	sshService := services.NewSSHService(sshConfig)
+	sshService := newSSHService(c, config)
 	defer sshService.Close()
 
+	// Remote work stops when the client disconnects
+	ctx := c.Request.Context()
+
 	// Connect to server
-	if err := sshService.Connect(); err != nil {
+	if err := sshService.Connect(ctx); err != nil {
+		action.unreachable(err)
 		c.JSON(http.StatusInternalServerError, CheckLicenseCLIResponse{
 			Exists: false,
 			Error:  "Failed to connect to server: " + err.Error(),
@@ -71,7 +268,7 @@ func CheckLicenseCLIHandler(c *gin.Context) {
 	}
 
 	// Check if license2_cli exists
-	exists, err := sshService.CheckLicenseCLI()
+	exists, err := sshService.CheckLicenseCLI(ctx)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, CheckLicenseCLIResponse{
 			Exists: false,
@@ -85,28 +282,63 @@ func CheckLicenseCLIHandler(c *gin.Context) {
 	})
 }
 
+// PreflightHandler checks a host before a license is uploaded to it and
+// reports each check as pass, warn or fail. Success is false when any check
+// fails.
+func PreflightHandler(c *gin.Context) {
+	var config ServerConfig
+	if err := bindServerConfig(c, &config); err != nil {
+		c.JSON(configErrorStatus(err), PreflightResponse{
+			Success: false,
+			Error:   "Invalid request data: " + err.Error(),
+		})
+		return
+	}
+
+	action := startAction(c, audit.ActionPreflight, config)
+	if action == nil {
+		return
+	}
+	defer action.finish(c)
+
+	sshService := newSSHService(c, config)
+	defer sshService.Close()
+
+	// Remote work stops when the client disconnects
+	report := sshService.Preflight(c.Request.Context(), settings.RemoteTempDir)
+	action.preflighted(report)
+
+	c.JSON(http.StatusOK, PreflightResponse{
+		Success: report.Status != services.PreflightFail,
+		Report:  report,
+	})
+}
+
 func DownloadSysinfoHandler(c *gin.Context) {
 	var config ServerConfig
-	if err := c.ShouldBindJSON(&config); err != nil {
-		c.JSON(http.StatusBadRequest, DownloadSysinfoResponse{
+	if err := bindServerConfig(c, &config); err != nil {
+		c.JSON(configErrorStatus(err), DownloadSysinfoResponse{
 			Success: false,
 			Error:   "Invalid request data: " + err.Error(),
 		})
 		return
 	}
 
-	sshConfig := &services.SSHConfig{
-		Host:     config.Host,
-		Port:     config.Port,
-		Username: config.Username,
-		Password: config.Password,
+	action := startAction(c, audit.ActionDownloadSysinfo, config)
+	if action == nil {
+		return
 	}
+	defer action.finish(c)
 
-	sshService := services.NewSSHService(sshConfig)
+	sshService := newSSHService(c, config)
 	defer sshService.Close()
 
+	// Remote work stops when the client disconnects
+	ctx := c.Request.Context()
+
 	// Connect to server
-	if err := sshService.Connect(); err != nil {
+	if err := sshService.Connect(ctx); err != nil {
+		action.unreachable(err)
 		c.JSON(http.StatusInternalServerError, DownloadSysinfoResponse{
 			Success: false,
 			Error:   "Failed to connect to server: " + err.Error(),
@@ -115,7 +347,7 @@ func DownloadSysinfoHandler(c *gin.Context) {
 	}
 
 	// Check if license2_cli exists first
-	exists, err := sshService.CheckLicenseCLI()
+	exists, err := sshService.CheckLicenseCLI(ctx)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, DownloadSysinfoResponse{
 			Success: false,
@@ -133,9 +365,10 @@ func DownloadSysinfoHandler(c *gin.Context) {
 	}
 
 	// Generate sysinfo file
-	sysinfoFile, err := sshService.GenerateSysinfoFile()
+	action.step("generate-sysinfo")
+	sysinfoFile, err := sshService.GenerateSysinfoFile(ctx)
 	if err != nil {
-		log.Printf("Error generating sysinfo file: %v", err)
+		logging.FromContext(ctx).Error("generating sysinfo file", "error", err)
 		c.JSON(http.StatusInternalServerError, DownloadSysinfoResponse{
 			Success: false,
 			Error:   "Failed to generate sysinfo file: " + err.Error(),
@@ -143,8 +376,33 @@ func DownloadSysinfoHandler(c *gin.Context) {
 		return
 	}
 
+	downloadFilename := sysinfoDownloadName(sysinfoFile, config.Host)
+
+	// Stream file directly to browser
+	action.step("download")
+	h := sha256.New()
+	err = sshService.StreamFile(ctx, sysinfoFile, func() io.Writer {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", downloadFilename))
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Content-Transfer-Encoding", "binary")
+		return io.MultiWriter(c.Writer, h)
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("streaming sysinfo file", "error", err)
+		c.JSON(http.StatusInternalServerError, DownloadSysinfoResponse{
+			Success: false,
+			Error:   "Failed to download sysinfo file: " + err.Error(),
+		})
+		return
+	}
+	action.sysinfoDownloaded(hex.EncodeToString(h.Sum(nil)))
+}
+
+// sysinfoDownloadName names a downloaded sysinfo file after the host it
+// came from, appending the last octet of its IP address
+func sysinfoDownloadName(sysinfoFile, host string) string {
 	// Extract IP address from host (remove port if present)
-	hostIP := config.Host
+	hostIP := host
 	if strings.Contains(hostIP, ":") {
 		hostIP = strings.Split(hostIP, ":")[0]
 	}
@@ -159,36 +417,38 @@ func DownloadSysinfoHandler(c *gin.Context) {
 	// Create filename with last octet appended (preserve original extension)
 	originalExt := filepath.Ext(sysinfoFile)
 	baseName := strings.TrimSuffix(sysinfoFile, originalExt)
-	downloadFilename := baseName + originalExt + "_" + lastOctet
-
-	// Stream file directly to browser
-	if err := sshService.StreamFileToResponse(c, sysinfoFile, downloadFilename); err != nil {
-		log.Printf("Error streaming file: %v", err)
-		c.JSON(http.StatusInternalServerError, DownloadSysinfoResponse{
-			Success: false,
-			Error:   "Failed to download sysinfo file: " + err.Error(),
-		})
-		return
-	}
+	return baseName + originalExt + "_" + lastOctet
 }
 
 func UploadLicenseHandler(c *gin.Context) {
 	// Get server config from form data
 	config := ServerConfig{
+		Server:   c.PostForm("server"),
 		Host:     c.PostForm("host"),
 		Port:     c.PostForm("port"),
 		Username: c.PostForm("username"),
 		Password: c.PostForm("password"),
+
+		Become:         c.PostForm("become"),
+		BecomeUser:     c.PostForm("become_user"),
+		BecomePassword: c.PostForm("become_password"),
 	}
 
-	if config.Host == "" || config.Port == "" || config.Username == "" || config.Password == "" {
-		c.JSON(http.StatusBadRequest, UploadLicenseResponse{
+	if err := resolveRequestConfig(c, &config); err != nil {
+		c.JSON(configErrorStatus(err), UploadLicenseResponse{
 			Success: false,
-			Error:   "Missing server configuration",
+			Error:   "Invalid server configuration: " + err.Error(),
 		})
 		return
 	}
 
+	action := startAction(c, audit.ActionUploadLicense, config)
+	if action == nil {
+		return
+	}
+	op := newOperation(c.Request.Context(), action, config)
+	defer op.finish(c)
+
 	// Get uploaded file
 	file, err := c.FormFile("license_file")
 	if err != nil {
@@ -198,102 +458,45 @@ func UploadLicenseHandler(c *gin.Context) {
 		})
 		return
 	}
-
-	// Create uploads directory if it doesn't exist
-	uploadsDir := "uploads"
-	if err := os.MkdirAll(uploadsDir, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, UploadLicenseResponse{
-			Success: false,
-			Error:   "Failed to create uploads directory: " + err.Error(),
-		})
-		return
-	}
-
-	// Save uploaded file temporarily
-	tempFile := filepath.Join(uploadsDir, file.Filename)
-	if err := c.SaveUploadedFile(file, tempFile); err != nil {
-		c.JSON(http.StatusInternalServerError, UploadLicenseResponse{
-			Success: false,
-			Error:   "Failed to save uploaded file: " + err.Error(),
-		})
-		return
-	}
-	defer os.Remove(tempFile) // Clean up temp file
-
-	sshConfig := &services.SSHConfig{
-		Host:     config.Host,
-		Port:     config.Port,
-		Username: config.Username,
-		Password: config.Password,
-	}
-
-	sshService := services.NewSSHService(sshConfig)
-	defer sshService.Close()
-
-	// Connect to server
-	if err := sshService.Connect(); err != nil {
-		c.JSON(http.StatusInternalServerError, UploadLicenseResponse{
-			Success: false,
-			Error:   "Failed to connect to server: " + err.Error(),
-		})
-		return
-	}
-
-	// Check if license2_cli exists first
-	exists, err := sshService.CheckLicenseCLI()
+	license, err := file.Open()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, UploadLicenseResponse{
-			Success: false,
-			Error:   "Failed to check license2_cli: " + err.Error(),
-		})
-		return
-	}
-
-	if !exists {
 		c.JSON(http.StatusBadRequest, UploadLicenseResponse{
 			Success: false,
-			Error:   "license2_cli not found on server",
-		})
-		return
-	}
-
-	// Upload license file to server
-	remoteFile := "/tmp/" + file.Filename
-	if err := sshService.UploadFile(tempFile, remoteFile); err != nil {
-		c.JSON(http.StatusInternalServerError, UploadLicenseResponse{
-			Success: false,
-			Error:   "Failed to upload license file: " + err.Error(),
+			Error:   "Failed to read uploaded file: " + err.Error(),
 		})
 		return
 	}
+	defer license.Close()
 
-	// Execute license2_cli import command
-	importCmd := "license2_cli import -l " + remoteFile
-	output, err := sshService.ExecuteCommand(importCmd)
+	result, err := op.ImportLicense(file.Filename, license)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, UploadLicenseResponse{
-			Success: false,
-			Error:   "Failed to import license: " + err.Error(),
-		})
+		status := http.StatusInternalServerError
+		if code := ErrorCode(err); code == api.CodeInvalidRequest || code == api.CodeCLINotFound {
+			status = http.StatusBadRequest
+		}
+		response := UploadLicenseResponse{Success: false, Error: err.Error()}
+		if result != nil {
+			response.Import = result.Import
+		}
+		c.JSON(status, response)
 		return
 	}
 
-	// Clean up remote file
-	sshService.ExecuteCommand("rm -f " + remoteFile)
-
-	// Execute license2_cli check to verify the license
-	checkCmd := "license2_cli check"
-	checkOutput, err := sshService.ExecuteCommand(checkCmd)
-	if err != nil {
+	importOutput := "\n\nImport Output:\n```\n" + result.Import.Output() + "\n```"
+	if result.CheckError != "" {
 		c.JSON(http.StatusOK, UploadLicenseResponse{
 			Success: true,
-			Message: "License imported successfully, but check command failed: " + err.Error() + "\n\nImport Output:\n```\n" + output + "\n```",
+			Message: "License imported successfully, but check command failed: " + result.CheckError + importOutput,
+			Import:  result.Import,
+			Check:   result.Check,
 		})
 		return
 	}
 
 	c.JSON(http.StatusOK, UploadLicenseResponse{
 		Success: true,
-		Message: "License imported successfully!\n\nImport Output:\n```\n" + output + "\n```\n\nLicense Check Output:\n```\n" + checkOutput + "\n```",
+		Message: "License imported successfully!" + importOutput + "\n\nLicense Check Output:\n```\n" + result.Check.Output() + "\n```",
+		Import:  result.Import,
+		Check:   result.Check,
 	})
 }
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"license-manager/internal/jobs"
+	"license-manager/internal/rollouts"
+	"license-manager/internal/services"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readinessTimeout bounds all readiness checks together
+const readinessTimeout = 2 * time.Second
+
+// Check results
+const (
+	CheckOK   = "ok"
+	CheckFail = "fail"
+)
+
+// ReadinessCheck is one dependency checked by /readyz
+type ReadinessCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// readinessChecks run on every /readyz request; SetReadinessChecks sets them
+var readinessChecks []ReadinessCheck
+
+// buildVersion is reported by /debug/diagnostics
+var buildVersion = "dev"
+
+// startedAt is when the process started, for uptime
+var startedAt = time.Now()
+
+// SetReadinessChecks sets the checks run by ReadyzHandler
+func SetReadinessChecks(checks ...ReadinessCheck) {
+	readinessChecks = checks
+}
+
+// SetBuildVersion sets the version reported by DiagnosticsHandler
+func SetBuildVersion(version string) {
+	buildVersion = version
+}
+
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ReadinessResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+type DiagnosticsJobs struct {
+	Running     int  `json:"running"`
+	Interrupted int  `json:"interrupted"`
+	Draining    bool `json:"draining"`
+}
+
+// DiagnosticsRollouts counts the rollouts the scheduler still acts on
+type DiagnosticsRollouts struct {
+	// Held rollouts halted after a wave and wait to be resumed or aborted
+	Held      int `json:"held"`
+	Scheduled int `json:"scheduled"`
+	Running   int `json:"running"`
+	// NextWindowAt is the earliest window a scheduled rollout runs in
+	NextWindowAt *time.Time `json:"next_window_at,omitempty"`
+}
+
+type DiagnosticsResponse struct {
+	Version    string               `json:"version"`
+	Revision   string               `json:"revision,omitempty"`
+	GoVersion  string               `json:"go_version"`
+	StartedAt  time.Time            `json:"started_at"`
+	Uptime     string               `json:"uptime"`
+	Goroutines int                  `json:"goroutines"`
+	SSHPool    *services.PoolStats  `json:"ssh_pool,omitempty"`
+	Jobs       DiagnosticsJobs      `json:"jobs"`
+	Rollouts   *DiagnosticsRollouts `json:"rollouts,omitempty"`
+	Readiness  ReadinessResponse    `json:"readiness"`
+}
+
+// HealthzHandler is the liveness probe: it answers as long as the process
+// can serve requests
+func HealthzHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+// ReadyzHandler is the readiness probe: it runs every readiness check and
+// responds 503 if any fails or the server is shutting down
+func ReadyzHandler(c *gin.Context) {
+	readiness := checkReadiness(c.Request.Context())
+	status := http.StatusOK
+	if readiness.Status != "ready" {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, readiness)
+}
+
+// DiagnosticsHandler reports build, pool, job and rollout scheduler state
+// for operators. It must be mounted behind middleware.AdminAuth.
+func DiagnosticsHandler(c *gin.Context) {
+	response := DiagnosticsResponse{
+		Version:    buildVersion,
+		GoVersion:  runtime.Version(),
+		StartedAt:  startedAt.UTC(),
+		Uptime:     time.Since(startedAt).Round(time.Second).String(),
+		Goroutines: runtime.NumGoroutine(),
+		Readiness:  checkReadiness(c.Request.Context()),
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				response.Revision = setting.Value
+			}
+		}
+	}
+	if sshPool != nil {
+		stats := sshPool.Stats()
+		response.SSHPool = &stats
+	}
+	if jobManager != nil {
+		response.Jobs = DiagnosticsJobs{
+			Running:     jobManager.Running(),
+			Interrupted: len(jobManager.List(jobs.StatusInterrupted)),
+			Draining:    jobManager.Draining(),
+		}
+	}
+
+	if rolloutScheduler != nil {
+		response.Rollouts = rolloutDiagnostics(rolloutScheduler.List(""))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func rolloutDiagnostics(list []rollouts.Rollout) *DiagnosticsRollouts {
+	d := &DiagnosticsRollouts{}
+	for _, r := range list {
+		switch r.Status {
+		case rollouts.StatusHalted:
+			d.Held++
+		case rollouts.StatusScheduled:
+			d.Scheduled++
+			if r.NextWindowAt != nil && (d.NextWindowAt == nil || r.NextWindowAt.Before(*d.NextWindowAt)) {
+				d.NextWindowAt = r.NextWindowAt
+			}
+		case rollouts.StatusRunning:
+			d.Running++
+		}
+	}
+	return d
+}
+
+// FileWritable returns a readiness check that the state file at path can
+// be saved: its directory accepts new files, which the atomic replace
+// needs, and the file, if it exists, can be opened for writing
+func FileWritable(path string) func(ctx context.Context) error {
+	dirWritable := DirWritable(filepath.Dir(path))
+	return func(ctx context.Context) error {
+		if err := dirWritable(ctx); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s is not writable: %v", path, err)
+		}
+		return f.Close()
+	}
+}
+
+// DirWritable returns a readiness check that dir exists (or can be created)
+// and accepts new files
+func DirWritable(dir string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		f, err := os.CreateTemp(dir, ".readyz-*")
+		if err != nil {
+			return fmt.Errorf("%s is not writable: %v", dir, err)
+		}
+		f.Close()
+		if err := ctx.Err(); err != nil {
+			os.Remove(f.Name())
+			return err
+		}
+		return os.Remove(f.Name())
+	}
+}
+
+func checkReadiness(ctx context.Context) ReadinessResponse {
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	response := ReadinessResponse{Status: "ready", Checks: make(map[string]CheckResult)}
+	fail := func(name string, err error) {
+		response.Status = "not ready"
+		response.Checks[name] = CheckResult{Status: CheckFail, Error: err.Error()}
+	}
+
+	// Stop receiving traffic as soon as shutdown starts draining
+	if jobManager != nil && jobManager.Draining() {
+		fail("shutdown", fmt.Errorf("server is shutting down"))
+	}
+
+	// Each check runs in its own goroutine, so one stuck in a system call,
+	// as on a hung filesystem, fails at the deadline instead of stalling
+	// the probe
+	results := make([]chan error, len(readinessChecks))
+	for i, check := range readinessChecks {
+		results[i] = make(chan error, 1)
+		go func(check ReadinessCheck, result chan<- error) {
+			result <- check.Check(ctx)
+		}(check, results[i])
+	}
+	for i, check := range readinessChecks {
+		var err error
+		select {
+		case err = <-results[i]:
+		case <-ctx.Done():
+			select {
+			case err = <-results[i]:
+			default:
+				err = fmt.Errorf("check did not finish: %v", ctx.Err())
+			}
+		}
+		if err != nil {
+			fail(check.Name, err)
+			continue
+		}
+		response.Checks[check.Name] = CheckResult{Status: CheckOK}
+	}
+	return response
+}
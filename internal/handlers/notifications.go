@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"errors"
+	"license-manager/internal/api"
+	"license-manager/internal/audit"
+	"license-manager/internal/jobs"
+	"license-manager/internal/logging"
+	"license-manager/internal/notify"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// expiryDateLayout is how license expiry dates are recorded
+const expiryDateLayout = "2006-01-02"
+
+// notifier emails digests to subscribers. It stays nil (and email
+// notifications disabled) until SetNotifier is called.
+var notifier *notify.Notifier
+
+// SetNotifier sets the notifier that manages digest subscriptions
+func SetNotifier(n *notify.Notifier) {
+	notifier = n
+}
+
+// SubscriberRequest subscribes an email address to digests, or replaces a
+// subscription
+type SubscriberRequest struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+	notify.Preferences
+}
+
+// DigestSource returns the notify.Source that builds digests from the
+// audit log and job list
+func DigestSource() notify.Source {
+	return digestSource{}
+}
+
+type digestSource struct{}
+
+// ExpiringLicenses reports, for each host, the license of its latest
+// successful import when it expires within days. Imports whose check did
+// not state an expiry are skipped.
+func (digestSource) ExpiringLicenses(now time.Time, days int) ([]notify.ExpiringLicense, error) {
+	imports, err := auditLog.Query(audit.Filter{Action: audit.ActionUploadLicense, Outcome: audit.OutcomeSuccess})
+	if err != nil {
+		return nil, err
+	}
+	latest := make(map[string]audit.Record)
+	for _, rec := range imports {
+		latest[rec.Host] = rec
+	}
+
+	list := []notify.ExpiringLicense{}
+	for _, rec := range latest {
+		expires, err := time.ParseInLocation(expiryDateLayout, rec.LicenseExpiry, time.UTC)
+		if err != nil {
+			continue
+		}
+		// The license is valid through the end of its expiry day
+		remaining := int(math.Floor(expires.AddDate(0, 0, 1).Sub(now).Hours() / 24))
+		if remaining > days {
+			continue
+		}
+		list = append(list, notify.ExpiringLicense{
+			Server:        rec.Server,
+			Host:          rec.Host,
+			License:       rec.LicenseFile,
+			LicenseSHA256: rec.LicenseSHA256,
+			Expires:       rec.LicenseExpiry,
+			DaysRemaining: remaining,
+			ImportedAt:    rec.Time,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].DaysRemaining != list[j].DaysRemaining {
+			return list[i].DaysRemaining < list[j].DaysRemaining
+		}
+		return list[i].Host < list[j].Host
+	})
+	return list, nil
+}
+
+// FailedJobs reports the jobs that failed or were interrupted in
+// (since, until], oldest first
+func (digestSource) FailedJobs(since, until time.Time) ([]notify.FailedJob, error) {
+	list := []notify.FailedJob{}
+	if jobManager == nil {
+		return list, nil
+	}
+	for _, status := range []string{jobs.StatusFailed, jobs.StatusInterrupted} {
+		for _, job := range jobManager.List(status) {
+			if job.FinishedAt == nil || !job.FinishedAt.After(since) || job.FinishedAt.After(until) {
+				continue
+			}
+			list = append(list, notify.FailedJob{
+				ID:         job.ID,
+				Kind:       job.Kind,
+				Host:       job.Host,
+				Actor:      job.Actor,
+				License:    job.License,
+				Status:     job.Status,
+				Error:      job.Error,
+				FinishedAt: *job.FinishedAt,
+			})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].FinishedAt.Before(list[j].FinishedAt)
+	})
+	return list, nil
+}
+
+// notifyError responds with the envelope for an error from the notifier
+func notifyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, notify.ErrNotFound):
+		api.Abort(c, http.StatusNotFound, api.CodeNotFound, "Subscriber "+c.Param("id")+" not found")
+	case errors.Is(err, notify.ErrSendFailed):
+		api.Abort(c, http.StatusBadGateway, api.CodeConnectionFailed, err.Error())
+	default:
+		api.Abort(c, http.StatusInternalServerError, api.CodeInternal, err.Error())
+	}
+}
+
+// requireNotifier responds with 503 and returns false when email
+// notifications are not configured
+func requireNotifier(c *gin.Context) bool {
+	if notifier == nil {
+		api.Abort(c, http.StatusServiceUnavailable, api.CodeUnavailable, "Email notifications are not configured")
+		return false
+	}
+	return true
+}
+
+// recordSubscription writes an audit record for an address being
+// subscribed or unsubscribed, since digests report on every host
+func recordSubscription(c *gin.Context, action string, s notify.Subscriber) {
+	rec := audit.Record{
+		Time:    time.Now(),
+		Actor:   actor(c),
+		Action:  action,
+		Command: s.Email,
+		Outcome: audit.OutcomeSuccess,
+	}
+	if err := auditLog.Append(rec); err != nil {
+		logging.FromContext(c.Request.Context()).Error("writing audit record", "error", err)
+	}
+}
+
+func v1ListSubscribers(c *gin.Context) {
+	limit, offset, err := api.PageParams(c)
+	if err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+	list := []notify.Subscriber{}
+	if notifier != nil {
+		list = notifier.List()
+	}
+	c.JSON(http.StatusOK, api.Paginate(list, limit, offset))
+}
+
+func v1CreateSubscriber(c *gin.Context) {
+	if !requireNotifier(c) {
+		return
+	}
+	var req SubscriberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request data: "+err.Error())
+		return
+	}
+	s, err := notifier.Create(req.Email, req.Name, req.Preferences)
+	if err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+	recordSubscription(c, audit.ActionSubscribe, s)
+	c.JSON(http.StatusCreated, s)
+}
+
+func v1GetSubscriber(c *gin.Context) {
+	if !requireNotifier(c) {
+		return
+	}
+	s, err := notifier.Get(c.Param("id"))
+	if err != nil {
+		notifyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+func v1UpdateSubscriber(c *gin.Context) {
+	if !requireNotifier(c) {
+		return
+	}
+	var req SubscriberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request data: "+err.Error())
+		return
+	}
+	s, err := notifier.Update(c.Param("id"), req.Email, req.Name, req.Preferences)
+	if errors.Is(err, notify.ErrNotFound) {
+		notifyError(c, err)
+		return
+	}
+	if err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+func v1DeleteSubscriber(c *gin.Context) {
+	if !requireNotifier(c) {
+		return
+	}
+	s, err := notifier.Get(c.Param("id"))
+	if err == nil {
+		err = notifier.Delete(s.ID)
+	}
+	if err != nil {
+		notifyError(c, err)
+		return
+	}
+	recordSubscription(c, audit.ActionUnsubscribe, s)
+	c.Status(http.StatusNoContent)
+}
+
+func v1PreviewDigest(c *gin.Context) {
+	if !requireNotifier(c) {
+		return
+	}
+	digest, err := notifier.Digest(c.Param("id"), time.Now())
+	if err != nil {
+		notifyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, digest)
+}
+
+func v1SendDigest(c *gin.Context) {
+	if !requireNotifier(c) {
+		return
+	}
+	digest, err := notifier.Send(c.Param("id"), time.Now())
+	if err != nil {
+		notifyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, digest)
+}
@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"license-manager/internal/api"
+	"license-manager/internal/audit"
+	"license-manager/internal/inventory"
+	"license-manager/internal/jobs"
+	"license-manager/internal/services"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The versioned HTTP API and the gRPC API share the functions in this file,
+// so both track, audit and report operations the same way. They take the
+// caller's context and actor instead of a gin request.
+
+// OperationError is why a request failed. Code is one of the api error
+// codes, which each API maps to its own status.
+type OperationError struct {
+	Code    string
+	Message string
+}
+
+func (e *OperationError) Error() string {
+	return e.Message
+}
+
+func operationError(code, message string) *OperationError {
+	return &OperationError{Code: code, Message: message}
+}
+
+// ErrorCode returns the api error code of err, api.CodeInternal when it is
+// not an OperationError
+func ErrorCode(err error) string {
+	var opErr *OperationError
+	if errors.As(err, &opErr) {
+		return opErr.Code
+	}
+	return api.CodeInternal
+}
+
+// ListInventory returns the inventory servers with tag, or every server
+// when tag is empty, in name order
+func ListInventory(tag string) []ServerInfo {
+	list := []ServerInfo{}
+	if serverInventory != nil {
+		for _, server := range serverInventory.List() {
+			if tag == "" || hasTag(server, tag) {
+				list = append(list, serverInfo(server))
+			}
+		}
+	}
+	return list
+}
+
+// GetServer returns the named inventory server
+func GetServer(name string) (ServerInfo, error) {
+	server, err := inventoryServer(name)
+	if err != nil {
+		return ServerInfo{}, err
+	}
+	return serverInfo(server), nil
+}
+
+// inventoryServer is GetServer with the server's credentials
+func inventoryServer(name string) (inventory.Server, error) {
+	if serverInventory == nil {
+		return inventory.Server{}, operationError(api.CodeNotFound, "No server inventory is configured")
+	}
+	server, err := serverInventory.Get(name)
+	if err != nil {
+		return inventory.Server{}, operationError(api.CodeNotFound, "Server "+name+" not found")
+	}
+	return server, nil
+}
+
+// SaveServer stores the server described by req on behalf of actor and
+// reports whether it was created. With create set, an existing server is a
+// conflict rather than being replaced.
+func SaveServer(ctx context.Context, actor string, req ServerRequest, create bool) (ServerInfo, bool, error) {
+	if serverInventory == nil {
+		return ServerInfo{}, false, operationError(api.CodeUnavailable, "No server inventory is configured")
+	}
+	if req.Name == "" {
+		return ServerInfo{}, false, operationError(api.CodeInvalidRequest, "name is required")
+	}
+
+	_, err := serverInventory.Get(req.Name)
+	created := errors.Is(err, inventory.ErrNotFound)
+	if create && !created {
+		return ServerInfo{}, false, operationError(api.CodeConflict, "Server "+req.Name+" already exists")
+	}
+
+	server := inventory.Server{
+		Name:           req.Name,
+		Host:           req.Host,
+		Port:           req.Port,
+		Username:       req.Username,
+		Password:       req.Password,
+		Become:         req.Become,
+		BecomeUser:     req.BecomeUser,
+		BecomePassword: req.BecomePassword,
+		Tags:           req.Tags,
+	}
+	if server.Port == "" {
+		server.Port = "22"
+	}
+	if err := serverInventory.Put(server); err != nil {
+		return ServerInfo{}, false, operationError(api.CodeInvalidRequest, err.Error())
+	}
+	auditInventoryChange(ctx, actor, audit.ActionServerPut, server)
+	return serverInfo(server), created, nil
+}
+
+// DeleteInventoryServer removes the named server on behalf of actor
+func DeleteInventoryServer(ctx context.Context, actor, name string) error {
+	server, err := inventoryServer(name)
+	if err != nil {
+		return err
+	}
+	if err := serverInventory.Delete(server.Name); err != nil {
+		return operationError(api.CodeInternal, err.Error())
+	}
+	auditInventoryChange(ctx, actor, audit.ActionServerDelete, server)
+	return nil
+}
+
+// ListJobs returns the tracked jobs with status, or every job when status
+// is empty, newest first
+func ListJobs(status string) []jobs.Job {
+	if jobManager == nil {
+		return []jobs.Job{}
+	}
+	return jobManager.List(status)
+}
+
+// GetJob returns the job with the given ID
+func GetJob(id string) (*jobs.Job, error) {
+	if jobManager != nil {
+		if job, ok := jobManager.Get(id); ok {
+			return job, nil
+		}
+	}
+	return nil, operationError(api.CodeNotFound, "Job "+id+" not found")
+}
+
+// SubscribeJobs follows every job as it starts, changes step and finishes;
+// see jobs.Manager.Subscribe. Without a job manager nothing is ever sent.
+func SubscribeJobs() (<-chan jobs.Job, func()) {
+	if jobManager == nil {
+		return nil, func() {}
+	}
+	return jobManager.Subscribe()
+}
+
+// Operation is one remote operation on an inventory server, tracked as a
+// job from StartOperation until End
+type Operation struct {
+	ctx    context.Context
+	action *action
+	config ServerConfig
+	ssh    *services.SSHService
+}
+
+// StartOperation starts an operation of kind, one of the audit actions, on
+// the named inventory server on behalf of actor. It fails with
+// api.CodeUnavailable while the server is shutting down.
+func StartOperation(ctx context.Context, actor, kind, server string) (*Operation, error) {
+	if _, err := inventoryServer(server); err != nil {
+		return nil, err
+	}
+	config := ServerConfig{Server: server}
+	if err := resolveServerConfig(&config); err != nil {
+		return nil, operationError(api.CodeInvalidRequest, err.Error())
+	}
+
+	a, ctx, err := newAction(ctx, actor, kind, config)
+	if err != nil {
+		return nil, operationError(api.CodeUnavailable, "Server is shutting down, please retry shortly")
+	}
+	return newOperation(ctx, a, config), nil
+}
+
+// newOperation runs an operation as the already started action a on the
+// server described by config
+func newOperation(ctx context.Context, a *action, config ServerConfig) *Operation {
+	return &Operation{ctx: ctx, action: a, config: config, ssh: sshServiceFor(ctx, a.rec.Actor, config)}
+}
+
+// Context is the operation's context, whose logger carries the job and host
+func (op *Operation) Context() context.Context {
+	return op.ctx
+}
+
+// JobID is the operation's job, empty when jobs are not tracked
+func (op *Operation) JobID() string {
+	return op.action.jobID
+}
+
+// End closes the operation's connection, completes its job and writes the
+// audit record; a nil err is success
+func (op *Operation) End(err error) {
+	op.ssh.Close()
+	op.action.end(err)
+}
+
+// finish is End for the legacy handlers, deriving the outcome from the
+// response status
+func (op *Operation) finish(c *gin.Context) {
+	op.ssh.Close()
+	op.action.finish(c)
+}
+
+// connect connects and reports whether license2_cli is installed. With
+// requireCLI set, a missing license2_cli is an error.
+func (op *Operation) connect(requireCLI bool) (bool, error) {
+	if err := op.ssh.Connect(op.ctx); err != nil {
+		op.action.unreachable(err)
+		return false, operationError(api.CodeConnectionFailed, "Failed to connect to server: "+err.Error())
+	}
+	found, err := op.ssh.CheckLicenseCLI(op.ctx)
+	if err != nil {
+		return false, operationError(api.CodeRemoteFailed, "Failed to check license2_cli: "+err.Error())
+	}
+	if requireCLI && !found {
+		return false, operationError(api.CodeCLINotFound, "license2_cli not found on server")
+	}
+	return found, nil
+}
+
+// Check reports whether license2_cli is installed
+func (op *Operation) Check() (*ServerCheck, error) {
+	found, err := op.connect(false)
+	if err != nil {
+		return nil, err
+	}
+	return &ServerCheck{Server: op.config.Server, JobID: op.JobID(), CLIFound: found}, nil
+}
+
+// Preflight runs the preflight checks; failed checks are reported, not
+// returned as an error
+func (op *Operation) Preflight() *ServerPreflight {
+	report := op.ssh.Preflight(op.ctx, settings.RemoteTempDir)
+	op.action.preflighted(report)
+	return &ServerPreflight{Server: op.config.Server, JobID: op.JobID(), Report: *report}
+}
+
+// DownloadSysinfo generates a sysinfo file and streams it to the writer
+// returned by start, which is given the file's download name. An error
+// after start was called means the download was cut short.
+func (op *Operation) DownloadSysinfo(start func(filename string) io.Writer) error {
+	if _, err := op.connect(true); err != nil {
+		return err
+	}
+
+	op.action.step("generate-sysinfo")
+	sysinfoFile, err := op.ssh.GenerateSysinfoFile(op.ctx)
+	if err != nil {
+		return operationError(api.CodeRemoteFailed, "Failed to generate sysinfo file: "+err.Error())
+	}
+
+	op.action.step("download")
+	filename := sysinfoDownloadName(sysinfoFile, op.config.Host)
+	h := sha256.New()
+	err = op.ssh.StreamFile(op.ctx, sysinfoFile, func() io.Writer { return io.MultiWriter(start(filename), h) })
+	if err != nil {
+		return operationError(api.CodeRemoteFailed, "Failed to download sysinfo file: "+err.Error())
+	}
+	op.action.sysinfoDownloaded(hex.EncodeToString(h.Sum(nil)))
+	return nil
+}
+
+// ImportLicense uploads the license file and imports it with license2_cli,
+// then runs license2_cli check to verify it. A failed import quotes
+// license2_cli's reason, and the result returned with the error carries the
+// import command's output.
+func (op *Operation) ImportLicense(filename string, license io.Reader) (*LicenseImport, error) {
+	name := filepath.Base(filename)
+	if name == "." || name == string(filepath.Separator) {
+		return nil, operationError(api.CodeInvalidRequest, "A license file name is required")
+	}
+
+	if err := os.MkdirAll(settings.UploadDir, 0755); err != nil {
+		return nil, operationError(api.CodeInternal, "Failed to create uploads directory: "+err.Error())
+	}
+	tempFile, licenseHash, err := saveLicense(license)
+	if err != nil {
+		return nil, operationError(api.CodeInternal, "Failed to save uploaded file: "+err.Error())
+	}
+	defer os.Remove(tempFile)
+	op.action.setLicense(name, licenseHash)
+
+	if _, err := op.connect(true); err != nil {
+		return nil, err
+	}
+
+	op.action.step("upload")
+	remoteFile := path.Join(settings.RemoteTempDir, name)
+	if err := op.ssh.UploadFile(op.ctx, tempFile, remoteFile); err != nil {
+		return nil, operationError(api.CodeRemoteFailed, "Failed to upload license file: "+err.Error())
+	}
+
+	op.action.step("import")
+	imported, err := op.ssh.ExecuteCommand(op.ctx, "license2_cli import -l "+services.ShellQuote(remoteFile))
+	op.ssh.ExecuteCommand(op.ctx, "rm -f "+services.ShellQuote(remoteFile))
+	result := &LicenseImport{
+		Server:        op.config.Server,
+		JobID:         op.JobID(),
+		License:       name,
+		LicenseSHA256: licenseHash,
+		Import:        commandOutput(imported),
+	}
+	if err != nil {
+		// The error quotes license2_cli's own message when it rejected the file
+		return result, operationError(api.CodeRemoteFailed, "Failed to import license: "+err.Error())
+	}
+
+	op.action.step("verify")
+	checked, err := op.ssh.ExecuteCommand(op.ctx, "license2_cli check")
+	result.Check = commandOutput(checked)
+	if err != nil {
+		result.CheckError = err.Error()
+		op.action.licenseImported("")
+	} else {
+		op.action.licenseImported(checked.Stdout)
+	}
+	return result, nil
+}
+
+// saveLicense copies license to a new file in the upload directory and
+// returns its path and SHA-256
+func saveLicense(license io.Reader) (string, string, error) {
+	f, err := os.CreateTemp(settings.UploadDir, "license-*")
+	if err != nil {
+		return "", "", err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), license)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", "", fmt.Errorf("writing %s: %v", f.Name(), err)
+	}
+	return f.Name(), hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"license-manager/internal/api"
+	"license-manager/internal/audit"
+	"license-manager/internal/logging"
+	"license-manager/internal/rollouts"
+	"license-manager/internal/webhooks"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxRolloutLicense bounds the license file a rollout holds until its
+// window opens
+const maxRolloutLicense = 1 << 20
+
+// rolloutScheduler holds license imports for their maintenance windows. It
+// stays nil (and scheduling disabled) until SetRollouts is called.
+var rolloutScheduler *rollouts.Scheduler
+
+// SetRollouts sets the scheduler that rollouts are held in
+func SetRollouts(s *rollouts.Scheduler) {
+	rolloutScheduler = s
+}
+
+// RolloutMissedEvent is the data of rollout.missed events: the window
+// closed before the listed servers were reached
+type RolloutMissedEvent struct {
+	RolloutID string    `json:"rollout_id"`
+	Name      string    `json:"name,omitempty"`
+	License   string    `json:"license"`
+	Window    time.Time `json:"window"`
+	Repeat    string    `json:"repeat,omitempty"`
+	Servers   []string  `json:"servers"`
+}
+
+// RolloutHaltedEvent is the data of rollout.halted events: a staged
+// rollout stopped after a wave because too many imports failed, and waits
+// to be resumed or aborted
+type RolloutHaltedEvent struct {
+	RolloutID string   `json:"rollout_id"`
+	Name      string   `json:"name,omitempty"`
+	License   string   `json:"license"`
+	Reason    string   `json:"reason"`
+	Failed    []string `json:"failed"`
+	Remaining []string `json:"remaining"`
+}
+
+// RolloutRunner imports rollout licenses on inventory servers as the
+// rollout's creator, tracked and audited like any other import
+func RolloutRunner() rollouts.Runner {
+	return rolloutRunner{}
+}
+
+type rolloutRunner struct{}
+
+func (rolloutRunner) Import(ctx context.Context, r rollouts.Rollout, server string, license []byte) (string, error) {
+	op, err := StartOperation(ctx, r.Actor, audit.ActionUploadLicense, server)
+	if ErrorCode(err) == api.CodeUnavailable {
+		return "", rollouts.ErrUnavailable
+	}
+	if err != nil {
+		return "", err
+	}
+	result, err := op.ImportLicense(r.License, bytes.NewReader(license))
+	op.End(err)
+	if err == nil && result.CheckError != "" {
+		// The import ran but the license did not verify, which counts
+		// against a staged rollout's failure threshold
+		err = errors.New("license check after import failed: " + result.CheckError)
+	}
+	return op.JobID(), err
+}
+
+func (rolloutRunner) Missed(r rollouts.Rollout, window time.Time, servers []string) {
+	webhookDispatcher.Publish(webhooks.EventRolloutMissed, RolloutMissedEvent{
+		RolloutID: r.ID,
+		Name:      r.Name,
+		License:   r.License,
+		Window:    window,
+		Repeat:    r.Repeat,
+		Servers:   servers,
+	})
+}
+
+func (rolloutRunner) Halted(r rollouts.Rollout) {
+	event := RolloutHaltedEvent{
+		RolloutID: r.ID,
+		Name:      r.Name,
+		License:   r.License,
+		Reason:    r.HaltReason,
+		Failed:    []string{},
+		Remaining: []string{},
+	}
+	for _, t := range r.Targets {
+		switch t.Status {
+		case rollouts.TargetFailed:
+			event.Failed = append(event.Failed, t.Server)
+		case rollouts.TargetPending, rollouts.TargetMissed:
+			event.Remaining = append(event.Remaining, t.Server)
+		}
+	}
+	webhookDispatcher.Publish(webhooks.EventRolloutHalted, event)
+}
+
+// requireRollouts responds with 503 and returns false when rollouts are
+// not configured
+func requireRollouts(c *gin.Context) bool {
+	if rolloutScheduler == nil {
+		api.Abort(c, http.StatusServiceUnavailable, api.CodeUnavailable, "Rollouts are not configured")
+		return false
+	}
+	return true
+}
+
+// rolloutError responds with the envelope for an error from the scheduler
+func rolloutError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, rollouts.ErrNotFound):
+		api.Abort(c, http.StatusNotFound, api.CodeNotFound, "Rollout "+c.Param("id")+" not found")
+	case errors.Is(err, rollouts.ErrStarted):
+		api.Abort(c, http.StatusConflict, api.CodeConflict, "Rollout "+c.Param("id")+" cannot be cancelled: "+err.Error())
+	case errors.Is(err, rollouts.ErrNotHalted), errors.Is(err, rollouts.ErrWindowClosed):
+		api.Abort(c, http.StatusConflict, api.CodeConflict, "Rollout "+c.Param("id")+" cannot be resumed: "+err.Error())
+	case errors.Is(err, rollouts.ErrFinished):
+		api.Abort(c, http.StatusConflict, api.CodeConflict, "Rollout "+c.Param("id")+" cannot be aborted: "+err.Error())
+	default:
+		api.Abort(c, http.StatusInternalServerError, api.CodeInternal, err.Error())
+	}
+}
+
+// recordRolloutChange writes an audit record for a rollout being
+// scheduled, cancelled, resumed or aborted
+func recordRolloutChange(c *gin.Context, action string, r rollouts.Rollout) {
+	servers := make([]string, len(r.Targets))
+	for i, t := range r.Targets {
+		servers[i] = t.Server
+	}
+	rec := audit.Record{
+		Time:          time.Now(),
+		Actor:         actor(c),
+		Action:        action,
+		Command:       "rollout " + r.ID + " at " + r.StartAt.Format(time.RFC3339) + " to " + strings.Join(servers, ","),
+		LicenseFile:   r.License,
+		LicenseSHA256: r.LicenseSHA256,
+		Outcome:       audit.OutcomeSuccess,
+	}
+	if err := auditLog.Append(rec); err != nil {
+		logging.FromContext(c.Request.Context()).Error("writing audit record", "error", err)
+	}
+}
+
+// rolloutServers returns the servers named in the comma-separated list and
+// those with tag, checking each is in the inventory
+func rolloutServers(list, tag string) ([]string, error) {
+	var servers []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			servers = append(servers, name)
+		}
+	}
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if _, err := inventoryServer(name); err != nil {
+			return nil, err
+		}
+		add(name)
+	}
+	if tag != "" {
+		tagged := ListInventory(tag)
+		if len(tagged) == 0 {
+			return nil, operationError(api.CodeInvalidRequest, "No servers are tagged "+tag)
+		}
+		for _, server := range tagged {
+			add(server.Name)
+		}
+	}
+	if len(servers) == 0 {
+		return nil, operationError(api.CodeInvalidRequest, "servers or tag is required")
+	}
+	return servers, nil
+}
+
+func v1ListRollouts(c *gin.Context) {
+	limit, offset, err := api.PageParams(c)
+	if err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+	list := []rollouts.Rollout{}
+	if rolloutScheduler != nil {
+		list = rolloutScheduler.List(c.Query("status"))
+	}
+	c.JSON(http.StatusOK, api.Paginate(list, limit, offset))
+}
+
+func v1CreateRollout(c *gin.Context) {
+	if !requireRollouts(c) {
+		return
+	}
+	file, err := c.FormFile("license_file")
+	if err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, "No license file uploaded: "+err.Error())
+		return
+	}
+	if file.Size > maxRolloutLicense {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, "The license file is larger than 1 MiB")
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, "Failed to read uploaded file: "+err.Error())
+		return
+	}
+	license, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, "Failed to read uploaded file: "+err.Error())
+		return
+	}
+
+	var schedule rollouts.Schedule
+	if schedule.StartAt, err = time.Parse(time.RFC3339, c.PostForm("start_at")); err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, "start_at must be an RFC 3339 time, such as 2026-01-31T02:00:00Z")
+		return
+	}
+	if minutes := c.PostForm("window_minutes"); minutes != "" {
+		if schedule.WindowMinutes, err = strconv.Atoi(minutes); err != nil || schedule.WindowMinutes <= 0 {
+			api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, "window_minutes must be a positive integer")
+			return
+		}
+	}
+	schedule.Repeat = c.PostForm("repeat")
+
+	var strategy rollouts.Strategy
+	for _, field := range []struct {
+		name string
+		into *int
+	}{
+		{"canary", &strategy.Canary},
+		{"wave_size", &strategy.WaveSize},
+		{"max_failure_percent", &strategy.MaxFailurePercent},
+	} {
+		if value := c.PostForm(field.name); value != "" {
+			if *field.into, err = strconv.Atoi(value); err != nil {
+				api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, field.name+" must be an integer")
+				return
+			}
+		}
+	}
+
+	servers, err := rolloutServers(c.PostForm("servers"), c.PostForm("tag"))
+	if err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+	name := filepath.Base(file.Filename)
+	if name == "." || name == string(filepath.Separator) {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, "A license file name is required")
+		return
+	}
+	r, err := rolloutScheduler.Create(c.PostForm("name"), actor(c), name, license, servers, schedule, strategy)
+	if err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+	recordRolloutChange(c, audit.ActionRolloutCreate, r)
+	c.JSON(http.StatusCreated, r)
+}
+
+func v1GetRollout(c *gin.Context) {
+	if !requireRollouts(c) {
+		return
+	}
+	r, err := rolloutScheduler.Get(c.Param("id"))
+	if err != nil {
+		rolloutError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+func v1CancelRollout(c *gin.Context) {
+	if !requireRollouts(c) {
+		return
+	}
+	r, err := rolloutScheduler.Cancel(c.Param("id"))
+	if err != nil {
+		rolloutError(c, err)
+		return
+	}
+	recordRolloutChange(c, audit.ActionRolloutCancel, r)
+	c.JSON(http.StatusOK, r)
+}
+
+func v1ResumeRollout(c *gin.Context) {
+	if !requireRollouts(c) {
+		return
+	}
+	r, err := rolloutScheduler.Resume(c.Param("id"))
+	if err != nil {
+		rolloutError(c, err)
+		return
+	}
+	recordRolloutChange(c, audit.ActionRolloutResume, r)
+	c.JSON(http.StatusOK, r)
+}
+
+func v1AbortRollout(c *gin.Context) {
+	if !requireRollouts(c) {
+		return
+	}
+	r, err := rolloutScheduler.Abort(c.Param("id"))
+	if err != nil {
+		rolloutError(c, err)
+		return
+	}
+	recordRolloutChange(c, audit.ActionRolloutAbort, r)
+	c.JSON(http.StatusOK, r)
+}
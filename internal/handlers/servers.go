@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"license-manager/internal/audit"
+	"license-manager/internal/inventory"
+	"license-manager/internal/logging"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serverInventory holds named servers that requests can refer to instead
+// of sending credentials. It stays nil (and /api/servers empty) until
+// SetInventory is called.
+var serverInventory *inventory.Store
+
+// SetInventory sets the server inventory used by all handlers
+func SetInventory(s *inventory.Store) {
+	serverInventory = s
+}
+
+// ServerInfo describes an inventory server without its passwords
+type ServerInfo struct {
+	Name              string   `json:"name"`
+	Host              string   `json:"host"`
+	Port              string   `json:"port"`
+	Username          string   `json:"username"`
+	Become            string   `json:"become,omitempty"`
+	BecomeUser        string   `json:"become_user,omitempty"`
+	Tags              []string `json:"tags,omitempty"`
+	HasPassword       bool     `json:"has_password"`
+	HasBecomePassword bool     `json:"has_become_password"`
+}
+
+func serverInfo(server inventory.Server) ServerInfo {
+	return ServerInfo{
+		Name:              server.Name,
+		Host:              server.Host,
+		Port:              server.Port,
+		Username:          server.Username,
+		Become:            server.Become,
+		BecomeUser:        server.BecomeUser,
+		Tags:              server.Tags,
+		HasPassword:       server.Password != "",
+		HasBecomePassword: server.BecomePassword != "",
+	}
+}
+
+type ServersResponse struct {
+	Servers []ServerInfo `json:"servers"`
+	Count   int          `json:"count"`
+}
+
+type ServerResponse struct {
+	Success bool        `json:"success"`
+	Server  *ServerInfo `json:"server,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// ListServersHandler lists the inventory; passwords are never returned
+func ListServersHandler(c *gin.Context) {
+	list := []ServerInfo{}
+	if serverInventory != nil {
+		for _, server := range serverInventory.List() {
+			list = append(list, serverInfo(server))
+		}
+	}
+
+	c.JSON(http.StatusOK, ServersResponse{
+		Servers: list,
+		Count:   len(list),
+	})
+}
+
+// PutServerHandler adds a server to the inventory, or replaces the server
+// with the same name. It responds 201 for a new server.
+func PutServerHandler(c *gin.Context) {
+	if serverInventory == nil {
+		c.JSON(http.StatusServiceUnavailable, ServerResponse{
+			Success: false,
+			Error:   "No server inventory is configured",
+		})
+		return
+	}
+
+	var server inventory.Server
+	if err := c.ShouldBindJSON(&server); err != nil {
+		c.JSON(http.StatusBadRequest, ServerResponse{
+			Success: false,
+			Error:   "Invalid request data: " + err.Error(),
+		})
+		return
+	}
+	if server.Port == "" {
+		server.Port = "22"
+	}
+
+	_, err := serverInventory.Get(server.Name)
+	created := errors.Is(err, inventory.ErrNotFound)
+
+	if err := serverInventory.Put(server); err != nil {
+		c.JSON(http.StatusBadRequest, ServerResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	recordInventoryChange(c, audit.ActionServerPut, server)
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	info := serverInfo(server)
+	c.JSON(status, ServerResponse{
+		Success: true,
+		Server:  &info,
+	})
+}
+
+// DeleteServerHandler removes a server from the inventory
+func DeleteServerHandler(c *gin.Context) {
+	if serverInventory == nil {
+		c.JSON(http.StatusNotFound, ServerResponse{
+			Success: false,
+			Error:   "No server inventory is configured",
+		})
+		return
+	}
+
+	server, err := serverInventory.Get(c.Param("name"))
+	if err == nil {
+		err = serverInventory.Delete(server.Name)
+	}
+	if errors.Is(err, inventory.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ServerResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ServerResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	recordInventoryChange(c, audit.ActionServerDelete, server)
+
+	info := serverInfo(server)
+	c.JSON(http.StatusOK, ServerResponse{
+		Success: true,
+		Server:  &info,
+	})
+}
+
+// recordInventoryChange writes an audit record for an inventory change
+func recordInventoryChange(c *gin.Context, action string, server inventory.Server) {
+	auditInventoryChange(c.Request.Context(), actor(c), action, server)
+}
+
+// auditInventoryChange is recordInventoryChange outside of a gin request
+func auditInventoryChange(ctx context.Context, actor, action string, server inventory.Server) {
+	rec := audit.Record{
+		Time:       time.Now(),
+		Actor:      actor,
+		Action:     action,
+		Host:       net.JoinHostPort(server.Host, server.Port),
+		Server:     server.Name,
+		RemoteUser: server.Username,
+		Outcome:    audit.OutcomeSuccess,
+	}
+	if err := auditLog.Append(rec); err != nil {
+		logging.FromContext(ctx).Error("writing audit record", "error", err)
+	}
+}
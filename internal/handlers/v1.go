@@ -0,0 +1,663 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"license-manager/internal/api"
+	"license-manager/internal/audit"
+	"license-manager/internal/chat"
+	"license-manager/internal/inventory"
+	"license-manager/internal/jobs"
+	"license-manager/internal/logging"
+	"license-manager/internal/middleware"
+	"license-manager/internal/notify"
+	"license-manager/internal/openapi"
+	"license-manager/internal/rollouts"
+	"license-manager/internal/services"
+	"license-manager/internal/webhooks"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The versioned API acts on inventory servers by name; credentials never
+// travel with operation requests. Every error uses the api.ErrorResponse
+// envelope and every list is paginated.
+
+// ServerRequest creates or replaces an inventory server
+type ServerRequest struct {
+	// Name is required when creating; PUT takes it from the path
+	Name           string   `json:"name,omitempty"`
+	Host           string   `json:"host"`
+	Port           string   `json:"port,omitempty"`
+	Username       string   `json:"username"`
+	Password       string   `json:"password"`
+	Become         string   `json:"become,omitempty"`
+	BecomeUser     string   `json:"become_user,omitempty"`
+	BecomePassword string   `json:"become_password,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+}
+
+// Identity is who a request is made as
+type Identity struct {
+	// Actor is how requests are recorded in the audit log and job list
+	Actor string `json:"actor"`
+	// Token is the name of the API token used, if any
+	Token string `json:"token,omitempty"`
+}
+
+// ServerCheck reports whether license2_cli is installed on a server
+type ServerCheck struct {
+	Server   string `json:"server"`
+	JobID    string `json:"job_id,omitempty"`
+	CLIFound bool   `json:"cli_found"`
+}
+
+// ServerPreflight is the preflight report for a server
+type ServerPreflight struct {
+	Server string                   `json:"server"`
+	JobID  string                   `json:"job_id,omitempty"`
+	Report services.PreflightReport `json:"report"`
+}
+
+// LicenseImport reports a license imported on a server. CheckError is set
+// when the import succeeded but the verifying license2_cli check did not.
+type LicenseImport struct {
+	Server        string         `json:"server"`
+	JobID         string         `json:"job_id,omitempty"`
+	License       string         `json:"license"`
+	LicenseSHA256 string         `json:"license_sha256"`
+	Import        *CommandOutput `json:"import"`
+	Check         *CommandOutput `json:"check,omitempty"`
+	CheckError    string         `json:"check_error,omitempty"`
+}
+
+var pageParams = []openapi.Param{
+	{Name: "limit", Type: "integer", Description: "Items per page, 1 to 500 (default 50)"},
+	{Name: "offset", Type: "integer", Description: "Items to skip"},
+}
+
+// errorResponses documents the envelope for each status
+func errorResponses(statuses ...int) []openapi.Response {
+	responses := make([]openapi.Response, len(statuses))
+	for i, status := range statuses {
+		responses[i] = openapi.Response{Status: status, Body: api.ErrorResponse{}}
+	}
+	return responses
+}
+
+func responses(ok []openapi.Response, errorStatuses ...int) []openapi.Response {
+	errorStatuses = append(errorStatuses, http.StatusUnauthorized)
+	return append(ok, errorResponses(errorStatuses...)...)
+}
+
+// V1Operations is the route table of the versioned API, relative to
+// api.V1Prefix. It both registers the routes and generates the OpenAPI
+// document.
+func V1Operations() []openapi.Operation {
+	return []openapi.Operation{
+		{
+			Method: http.MethodGet, Path: "/whoami", ID: "whoami", Tags: []string{"auth"},
+			Summary:     "Identify the caller",
+			Description: "Checks the caller's API token or client certificate and shows the actor its requests are recorded as.",
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, Body: Identity{}},
+			}),
+			Handler: v1WhoAmI,
+		},
+		{
+			Method: http.MethodGet, Path: "/servers", ID: "listServers", Tags: []string{"servers"},
+			Summary: "List inventory servers",
+			Query:   append([]openapi.Param{{Name: "tag", Type: "string", Description: "Only servers with this tag"}}, pageParams...),
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, Body: api.Page[ServerInfo]{}},
+			}, http.StatusBadRequest),
+			Handler: v1ListServers,
+		},
+		{
+			Method: http.MethodPost, Path: "/servers", ID: "createServer", Tags: []string{"servers"},
+			Summary: "Add a server to the inventory",
+			Request: ServerRequest{},
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusCreated, Body: ServerInfo{}},
+			}, http.StatusBadRequest, http.StatusConflict, http.StatusServiceUnavailable),
+			Handler: v1CreateServer,
+		},
+		{
+			Method: http.MethodGet, Path: "/servers/:name", ID: "getServer", Tags: []string{"servers"},
+			Summary: "Get an inventory server",
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, Body: ServerInfo{}},
+			}, http.StatusNotFound),
+			Handler: v1GetServer,
+		},
+		{
+			Method: http.MethodPut, Path: "/servers/:name", ID: "putServer", Tags: []string{"servers"},
+			Summary: "Create or replace an inventory server",
+			Request: ServerRequest{},
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, Body: ServerInfo{}, Description: "Replaced"},
+				{Status: http.StatusCreated, Body: ServerInfo{}, Description: "Created"},
+			}, http.StatusBadRequest, http.StatusServiceUnavailable),
+			Handler: v1PutServer,
+		},
+		{
+			Method: http.MethodDelete, Path: "/servers/:name", ID: "deleteServer", Tags: []string{"servers"},
+			Summary: "Remove a server from the inventory",
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusNoContent},
+			}, http.StatusNotFound),
+			Handler: v1DeleteServer,
+		},
+		{
+			Method: http.MethodPost, Path: "/servers/:name/check", ID: "checkServer", Tags: []string{"operations"},
+			Summary: "Check that license2_cli is installed",
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, Body: ServerCheck{}},
+			}, http.StatusNotFound, http.StatusBadGateway, http.StatusServiceUnavailable),
+			Handler: v1CheckServer,
+		},
+		{
+			Method: http.MethodPost, Path: "/servers/:name/preflight", ID: "preflightServer", Tags: []string{"operations"},
+			Summary:     "Run the preflight checks",
+			Description: "Reports each check as pass, warn or fail; failed checks do not fail the request.",
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, Body: ServerPreflight{}},
+			}, http.StatusNotFound, http.StatusServiceUnavailable),
+			Handler: v1PreflightServer,
+		},
+		{
+			Method: http.MethodPost, Path: "/servers/:name/sysinfo", ID: "downloadSysinfo", Tags: []string{"sysinfo"},
+			Summary: "Generate and download a sysinfo file",
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, ContentType: openapi.Binary, Description: "The sysinfo file"},
+			}, http.StatusNotFound, http.StatusUnprocessableEntity, http.StatusBadGateway, http.StatusServiceUnavailable),
+			Handler: v1DownloadSysinfo,
+		},
+		{
+			Method: http.MethodPost, Path: "/servers/:name/licenses", ID: "importLicense", Tags: []string{"licenses"},
+			Summary:     "Import a license file",
+			Description: "When license2_cli rejects the file, the error's details are the import result, with the import command's output.",
+			Form:        []openapi.FormField{{Name: "license_file", File: true, Required: true}},
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, Body: LicenseImport{}},
+			}, http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity, http.StatusBadGateway, http.StatusServiceUnavailable),
+			Handler: v1ImportLicense,
+		},
+		{
+			Method: http.MethodGet, Path: "/jobs", ID: "listJobs", Tags: []string{"jobs"},
+			Summary: "List jobs, newest first",
+			Query:   append([]openapi.Param{{Name: "status", Type: "string", Description: "running, succeeded, failed or interrupted"}}, pageParams...),
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, Body: api.Page[jobs.Job]{}},
+			}, http.StatusBadRequest),
+			Handler: v1ListJobs,
+		},
+		{
+			Method: http.MethodGet, Path: "/jobs/:id", ID: "getJob", Tags: []string{"jobs"},
+			Summary: "Get a job",
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, Body: jobs.Job{}},
+			}, http.StatusNotFound),
+			Handler: v1GetJob,
+		},
+		{
+			Method: http.MethodGet, Path: "/webhooks", ID: "listWebhooks", Tags: []string{"webhooks"},
+			Summary: "List webhooks",
+			Query:   pageParams,
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, Body: api.Page[WebhookInfo]{}},
+			}, http.StatusBadRequest),
+			Handler: v1ListWebhooks,
+		},
+		{
+			Method: http.MethodPost, Path: "/webhooks", ID: "createWebhook", Tags: []string{"webhooks"},
+			Summary:     "Register a webhook",
+			Description: "Events are POSTed to the URL as JSON signed with the returned secret. Without events the webhook receives every event.",
+			Request:     WebhookRequest{},
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusCreated, Body: WebhookCreated{}},
+			}, http.StatusBadRequest, http.StatusServiceUnavailable),
+			Handler: v1CreateWebhook,
+		},
+		{
+			Method: http.MethodGet, Path: "/webhooks/:id", ID: "getWebhook", Tags: []string{"webhooks"},
+			Summary: "Get a webhook",
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, Body: WebhookInfo{}},
+			}, http.StatusNotFound, http.StatusServiceUnavailable),
+			Handler: v1GetWebhook,
+		},
+		{
+			Method: http.MethodDelete, Path: "/webhooks/:id", ID: "deleteWebhook", Tags: []string{"webhooks"},
+			Summary: "Remove a webhook and its deliveries",
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusNoContent},
+			}, http.StatusNotFound, http.StatusServiceUnavailable),
+			Handler: v1DeleteWebhook,
+		},
+		{
+			Method: http.MethodPost, Path: "/webhooks/:id/ping", ID: "pingWebhook", Tags: []string{"webhooks"},
+			Summary: "Send a ping event",
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusAccepted, Body: webhooks.Delivery{}, Description: "The queued delivery"},
+			}, http.StatusNotFound, http.StatusServiceUnavailable),
+			Handler: v1PingWebhook,
+		},
+		{
+			Method: http.MethodGet, Path: "/webhooks/:id/deliveries", ID: "listDeliveries", Tags: []string{"webhooks"},
+			Summary: "List a webhook's deliveries, newest first",
+			Query:   append([]openapi.Param{{Name: "status", Type: "string", Description: "pending, succeeded or failed"}}, pageParams...),
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, Body: api.Page[webhooks.Delivery]{}},
+			}, http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable),
+			Handler: v1ListDeliveries,
+		},
+		{
+			Method: http.MethodPost, Path: "/webhooks/:id/deliveries/:delivery/redeliver", ID: "redeliver", Tags: []string{"webhooks"},
+			Summary:     "Send a delivery again",
+			Description: "Queues a new delivery of the same payload, with a new delivery ID and signature.",
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusAccepted, Body: webhooks.Delivery{}, Description: "The queued delivery"},
+			}, http.StatusNotFound, http.StatusServiceUnavailable),
+			Handler: v1Redeliver,
+		},
+		{
+			Method: http.MethodGet, Path: "/notifications/subscribers", ID: "listSubscribers", Tags: []string{"notifications"},
+			Summary: "List email digest subscribers",
+			Query:   pageParams,
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, Body: api.Page[notify.Subscriber]{}},
+			}, http.StatusBadRequest),
+			Handler: v1ListSubscribers,
+		},
+		{
+			Method: http.MethodPost, Path: "/notifications/subscribers", ID: "createSubscriber", Tags: []string{"notifications"},
+			Summary:     "Subscribe an email address to digests",
+			Description: "Digests list the licenses expiring within expiry_days, the jobs that failed since the previous digest, or both. They are sent daily or weekly at hour (UTC); empty digests are skipped.",
+			Request:     SubscriberRequest{},
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusCreated, Body: notify.Subscriber{}},
+			}, http.StatusBadRequest, http.StatusServiceUnavailable),
+			Handler: v1CreateSubscriber,
+		},
+		{
+			Method: http.MethodGet, Path: "/notifications/subscribers/:id", ID: "getSubscriber", Tags: []string{"notifications"},
+			Summary: "Get a subscriber",
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, Body: notify.Subscriber{}},
+			}, http.StatusNotFound, http.StatusServiceUnavailable),
+			Handler: v1GetSubscriber,
+		},
+		{
+			Method: http.MethodPut, Path: "/notifications/subscribers/:id", ID: "updateSubscriber", Tags: []string{"notifications"},
+			Summary: "Change a subscriber's address or preferences",
+			Request: SubscriberRequest{},
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, Body: notify.Subscriber{}},
+			}, http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable),
+			Handler: v1UpdateSubscriber,
+		},
+		{
+			Method: http.MethodDelete, Path: "/notifications/subscribers/:id", ID: "deleteSubscriber", Tags: []string{"notifications"},
+			Summary: "Unsubscribe",
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusNoContent},
+			}, http.StatusNotFound, http.StatusServiceUnavailable),
+			Handler: v1DeleteSubscriber,
+		},
+		{
+			Method: http.MethodGet, Path: "/notifications/subscribers/:id/digest", ID: "previewDigest", Tags: []string{"notifications"},
+			Summary: "Show what the subscriber's digest would report now",
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, Body: notify.Digest{}},
+			}, http.StatusNotFound, http.StatusServiceUnavailable),
+			Handler: v1PreviewDigest,
+		},
+		{
+			Method: http.MethodPost, Path: "/notifications/subscribers/:id/send", ID: "sendDigest", Tags: []string{"notifications"},
+			Summary:     "Email the subscriber's digest now",
+			Description: "Sends even an empty digest, for testing the SMTP settings. The scheduled digests are unaffected.",
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, Body: notify.Digest{}, Description: "The digest sent"},
+			}, http.StatusNotFound, http.StatusBadGateway, http.StatusServiceUnavailable),
+			Handler: v1SendDigest,
+		},
+		{
+			Method: http.MethodGet, Path: "/chat/routes", ID: "listChatRoutes", Tags: []string{"chat"},
+			Summary: "List chat routes",
+			Query:   pageParams,
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, Body: api.Page[chat.Route]{}},
+			}, http.StatusBadRequest),
+			Handler: v1ListChatRoutes,
+		},
+		{
+			Method: http.MethodPost, Path: "/chat/routes", ID: "createChatRoute", Tags: []string{"chat"},
+			Summary:     "Post events to a Slack, Mattermost or Teams channel",
+			Description: "Job outcomes and expiry alerts are posted to the channel's incoming webhook URL. Without events the route posts every event; with tags only events for servers with one of the tags. Responses show only the webhook's host, since its URL is a credential.",
+			Request:     ChatRouteRequest{},
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusCreated, Body: chat.Route{}},
+			}, http.StatusBadRequest, http.StatusServiceUnavailable),
+			Handler: v1CreateChatRoute,
+		},
+		{
+			Method: http.MethodGet, Path: "/chat/routes/:id", ID: "getChatRoute", Tags: []string{"chat"},
+			Summary: "Get a chat route",
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, Body: chat.Route{}},
+			}, http.StatusNotFound, http.StatusServiceUnavailable),
+			Handler: v1GetChatRoute,
+		},
+		{
+			Method: http.MethodDelete, Path: "/chat/routes/:id", ID: "deleteChatRoute", Tags: []string{"chat"},
+			Summary: "Remove a chat route",
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusNoContent},
+			}, http.StatusNotFound, http.StatusServiceUnavailable),
+			Handler: v1DeleteChatRoute,
+		},
+		{
+			Method: http.MethodPost, Path: "/chat/routes/:id/test", ID: "testChatRoute", Tags: []string{"chat"},
+			Summary:     "Post a test message to the route's channel",
+			Description: "Posts once, without retrying, and reports whether the channel accepted the message.",
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusNoContent, Description: "Posted"},
+			}, http.StatusNotFound, http.StatusBadGateway, http.StatusServiceUnavailable),
+			Handler: v1TestChatRoute,
+		},
+		{
+			Method: http.MethodGet, Path: "/rollouts", ID: "listRollouts", Tags: []string{"rollouts"},
+			Summary: "List scheduled license rollouts, newest first",
+			Query:   append([]openapi.Param{{Name: "status", Type: "string", Description: "scheduled, running, halted, completed, cancelled or aborted"}}, pageParams...),
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, Body: api.Page[rollouts.Rollout]{}},
+			}, http.StatusBadRequest),
+			Handler: v1ListRollouts,
+		},
+		{
+			Method: http.MethodPost, Path: "/rollouts", ID: "createRollout", Tags: []string{"rollouts"},
+			Summary:     "Schedule a license import for a maintenance window",
+			Description: "The license is imported on each server in turn once the window opens. Servers the window closes on before they are reached are reported as missed; with repeat set they are retried in the next window. With canary or wave_size set the rollout is staged: the canary servers are imported on first, then the rest in waves of wave_size servers in parallel, and the rollout halts after a wave once more than max_failure_percent of that wave's imports have failed.",
+			Form: []openapi.FormField{
+				{Name: "license_file", File: true, Required: true},
+				{Name: "servers", Description: "Comma-separated inventory server names"},
+				{Name: "tag", Description: "Also import on every server with this tag"},
+				{Name: "start_at", Description: "When the (first) window opens, in RFC 3339", Required: true},
+				{Name: "window_minutes", Description: "How long the window stays open (default 60)"},
+				{Name: "repeat", Description: "daily or weekly for a recurring window"},
+				{Name: "name", Description: "A description of the rollout"},
+				{Name: "canary", Description: "How many servers, in the order given, to import on before the first wave"},
+				{Name: "wave_size", Description: "How many servers each following wave imports on in parallel (default all remaining)"},
+				{Name: "max_failure_percent", Description: "The share of a wave's imports, 0 to 100, that may fail before a staged rollout halts (default 0)"},
+			},
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusCreated, Body: rollouts.Rollout{}},
+			}, http.StatusBadRequest, http.StatusServiceUnavailable),
+			Handler: v1CreateRollout,
+		},
+		{
+			Method: http.MethodGet, Path: "/rollouts/:id", ID: "getRollout", Tags: []string{"rollouts"},
+			Summary: "Get a rollout and the status of each server",
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, Body: rollouts.Rollout{}},
+			}, http.StatusNotFound, http.StatusServiceUnavailable),
+			Handler: v1GetRollout,
+		},
+		{
+			Method: http.MethodPost, Path: "/rollouts/:id/cancel", ID: "cancelRollout", Tags: []string{"rollouts"},
+			Summary:     "Cancel a rollout waiting for its window",
+			Description: "A rollout that is running cannot be cancelled. Cancelling a recurring rollout between windows leaves the servers already imported as they are.",
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, Body: rollouts.Rollout{}, Description: "The cancelled rollout"},
+			}, http.StatusNotFound, http.StatusConflict, http.StatusServiceUnavailable),
+			Handler: v1CancelRollout,
+		},
+		{
+			Method: http.MethodPost, Path: "/rollouts/:id/resume", ID: "resumeRollout", Tags: []string{"rollouts"},
+			Summary:     "Resume a halted rollout",
+			Description: "The next wave runs in the current window if it is still open, otherwise in the next one. A rollout that does not repeat cannot be resumed once its window has closed: abort it and schedule a new one.",
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, Body: rollouts.Rollout{}, Description: "The resumed rollout"},
+			}, http.StatusNotFound, http.StatusConflict, http.StatusServiceUnavailable),
+			Handler: v1ResumeRollout,
+		},
+		{
+			Method: http.MethodPost, Path: "/rollouts/:id/abort", ID: "abortRollout", Tags: []string{"rollouts"},
+			Summary:     "Abort a rollout that has not finished",
+			Description: "Servers not yet imported on are skipped. Imports already running finish.",
+			Responses: responses([]openapi.Response{
+				{Status: http.StatusOK, Body: rollouts.Rollout{}, Description: "The aborted rollout"},
+			}, http.StatusNotFound, http.StatusConflict, http.StatusServiceUnavailable),
+			Handler: v1AbortRollout,
+		},
+	}
+}
+
+// OpenAPIDocument is the OpenAPI document of the versioned API
+func OpenAPIDocument() map[string]any {
+	return openapi.Document(openapi.Info{
+		Title:       "License Manager API",
+		Version:     "1",
+		Description: "Manage the server inventory, run license operations on inventory servers, schedule them for maintenance windows, register webhooks for their events, route them to chat channels and subscribe to email digests.",
+	}, api.V1Prefix, V1Operations())
+}
+
+// RegisterV1 adds the versioned API to group
+func RegisterV1(group *gin.RouterGroup) {
+	for _, op := range V1Operations() {
+		group.Handle(op.Method, op.Path, op.Handler)
+	}
+}
+
+// RegisterV1Document adds the versioned API's OpenAPI document to group.
+// The document holds no data, so it can be served without authentication
+// for generating clients.
+func RegisterV1Document(group *gin.RouterGroup) {
+	doc := OpenAPIDocument()
+	group.GET("/openapi.json", func(c *gin.Context) {
+		c.JSON(http.StatusOK, doc)
+	})
+}
+
+// NotFoundHandler answers unknown versioned API paths with the error
+// envelope; other paths get gin's default 404
+func NotFoundHandler(c *gin.Context) {
+	if api.Versioned(c) {
+		api.Abort(c, http.StatusNotFound, api.CodeNotFound, "No route for "+c.Request.Method+" "+c.Request.URL.Path)
+	}
+}
+
+func v1WhoAmI(c *gin.Context) {
+	c.JSON(http.StatusOK, Identity{Actor: actor(c), Token: middleware.APITokenName(c)})
+}
+
+// v1Error responds with the envelope for err
+func v1Error(c *gin.Context, err error) {
+	code := ErrorCode(err)
+	api.Abort(c, api.Status(code), code, err.Error())
+}
+
+func v1ListServers(c *gin.Context) {
+	limit, offset, err := api.PageParams(c)
+	if err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, api.Paginate(ListInventory(c.Query("tag")), limit, offset))
+}
+
+func hasTag(server inventory.Server, tag string) bool {
+	for _, t := range server.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func v1CreateServer(c *gin.Context) {
+	var req ServerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request data: "+err.Error())
+		return
+	}
+	v1SaveServer(c, req, true)
+}
+
+func v1PutServer(c *gin.Context) {
+	var req ServerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request data: "+err.Error())
+		return
+	}
+	name := c.Param("name")
+	if req.Name != "" && req.Name != name {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, "name does not match the path")
+		return
+	}
+	req.Name = name
+	v1SaveServer(c, req, false)
+}
+
+// v1SaveServer stores the server and responds with it, 201 when created
+func v1SaveServer(c *gin.Context, req ServerRequest, create bool) {
+	server, created, err := SaveServer(c.Request.Context(), actor(c), req, create)
+	if err != nil {
+		v1Error(c, err)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, server)
+}
+
+func v1GetServer(c *gin.Context) {
+	server, err := GetServer(c.Param("name"))
+	if err != nil {
+		v1Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, server)
+}
+
+func v1DeleteServer(c *gin.Context) {
+	if err := DeleteInventoryServer(c.Request.Context(), actor(c), c.Param("name")); err != nil {
+		v1Error(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// v1Start starts an operation on the server named in the path. It returns
+// nil after responding when that fails.
+func v1Start(c *gin.Context, kind string) *Operation {
+	op, err := StartOperation(c.Request.Context(), actor(c), kind, c.Param("name"))
+	if err != nil {
+		v1Error(c, err)
+		return nil
+	}
+	c.Request = c.Request.WithContext(op.Context())
+	return op
+}
+
+func v1CheckServer(c *gin.Context) {
+	op := v1Start(c, audit.ActionCheckLicenseCLI)
+	if op == nil {
+		return
+	}
+	result, err := op.Check()
+	op.End(err)
+	if err != nil {
+		v1Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func v1PreflightServer(c *gin.Context) {
+	op := v1Start(c, audit.ActionPreflight)
+	if op == nil {
+		return
+	}
+	result := op.Preflight()
+	op.End(nil)
+	c.JSON(http.StatusOK, result)
+}
+
+func v1DownloadSysinfo(c *gin.Context) {
+	op := v1Start(c, audit.ActionDownloadSysinfo)
+	if op == nil {
+		return
+	}
+	err := op.DownloadSysinfo(func(filename string) io.Writer {
+		if op.JobID() != "" {
+			c.Header("X-Job-ID", op.JobID())
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Content-Transfer-Encoding", "binary")
+		return c.Writer
+	})
+	op.End(err)
+	if err != nil {
+		logging.FromContext(op.Context()).Error("downloading sysinfo file", "error", err)
+		// Once streaming has started the status is already sent
+		if !c.Writer.Written() {
+			v1Error(c, err)
+		}
+	}
+}
+
+func v1ImportLicense(c *gin.Context) {
+	file, err := c.FormFile("license_file")
+	if err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, "No license file uploaded: "+err.Error())
+		return
+	}
+	license, err := file.Open()
+	if err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, "Failed to read uploaded file: "+err.Error())
+		return
+	}
+	defer license.Close()
+
+	op := v1Start(c, audit.ActionUploadLicense)
+	if op == nil {
+		return
+	}
+	result, err := op.ImportLicense(file.Filename, license)
+	op.End(err)
+	if err != nil && result != nil {
+		// The import command's output explains the failure
+		code := ErrorCode(err)
+		api.AbortWithDetails(c, api.Status(code), code, err.Error(), result)
+		return
+	}
+	if err != nil {
+		v1Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func v1ListJobs(c *gin.Context) {
+	limit, offset, err := api.PageParams(c)
+	if err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, api.Paginate(ListJobs(c.Query("status")), limit, offset))
+}
+
+func v1GetJob(c *gin.Context) {
+	job, err := GetJob(c.Param("id"))
+	if err != nil {
+		v1Error(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
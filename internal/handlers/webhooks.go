@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"errors"
+	"license-manager/internal/api"
+	"license-manager/internal/audit"
+	"license-manager/internal/logging"
+	"license-manager/internal/webhooks"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebhookRequest registers a webhook
+type WebhookRequest struct {
+	URL string `json:"url"`
+	// Events to send; none sends every event
+	Events []string `json:"events,omitempty"`
+	// Secret signs deliveries; one is generated when empty
+	Secret string `json:"secret,omitempty"`
+}
+
+// WebhookInfo is a registered webhook. Its secret is only returned when it
+// is created.
+type WebhookInfo struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookCreated is a new webhook with the secret that signs its deliveries
+type WebhookCreated struct {
+	WebhookInfo
+	Secret string `json:"secret"`
+}
+
+func webhookInfo(w webhooks.Webhook) WebhookInfo {
+	events := w.Events
+	if events == nil {
+		events = []string{}
+	}
+	return WebhookInfo{ID: w.ID, URL: w.URL, Events: events, CreatedAt: w.CreatedAt}
+}
+
+// webhookError responds with the envelope for an error from the dispatcher
+func webhookError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, webhooks.ErrNotFound):
+		api.Abort(c, http.StatusNotFound, api.CodeNotFound, "Webhook "+c.Param("id")+" not found")
+	case errors.Is(err, webhooks.ErrDeliveryNotFound):
+		api.Abort(c, http.StatusNotFound, api.CodeNotFound, "Delivery "+c.Param("delivery")+" not found")
+	default:
+		api.Abort(c, http.StatusInternalServerError, api.CodeInternal, err.Error())
+	}
+}
+
+// requireWebhooks responds with 503 and returns false when webhooks are not
+// configured
+func requireWebhooks(c *gin.Context) bool {
+	if webhookDispatcher == nil {
+		api.Abort(c, http.StatusServiceUnavailable, api.CodeUnavailable, "Webhooks are not configured")
+		return false
+	}
+	return true
+}
+
+// recordWebhookChange writes an audit record for a webhook being added or
+// removed, since a webhook receives details of every operation
+func recordWebhookChange(c *gin.Context, action string, w webhooks.Webhook) {
+	host := w.URL
+	if u, err := url.Parse(w.URL); err == nil {
+		host = u.Host
+	}
+	rec := audit.Record{
+		Time:    time.Now(),
+		Actor:   actor(c),
+		Action:  action,
+		Host:    host,
+		Command: w.URL,
+		Outcome: audit.OutcomeSuccess,
+	}
+	if err := auditLog.Append(rec); err != nil {
+		logging.FromContext(c.Request.Context()).Error("writing audit record", "error", err)
+	}
+}
+
+func v1ListWebhooks(c *gin.Context) {
+	limit, offset, err := api.PageParams(c)
+	if err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+	list := []WebhookInfo{}
+	if webhookDispatcher != nil {
+		for _, w := range webhookDispatcher.List() {
+			list = append(list, webhookInfo(w))
+		}
+	}
+	c.JSON(http.StatusOK, api.Paginate(list, limit, offset))
+}
+
+func v1CreateWebhook(c *gin.Context) {
+	if !requireWebhooks(c) {
+		return
+	}
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request data: "+err.Error())
+		return
+	}
+	w, err := webhookDispatcher.Create(req.URL, req.Events, req.Secret)
+	if err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+	recordWebhookChange(c, audit.ActionWebhookCreate, w)
+	c.JSON(http.StatusCreated, WebhookCreated{WebhookInfo: webhookInfo(w), Secret: w.Secret})
+}
+
+func v1GetWebhook(c *gin.Context) {
+	if !requireWebhooks(c) {
+		return
+	}
+	w, err := webhookDispatcher.Get(c.Param("id"))
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, webhookInfo(w))
+}
+
+func v1DeleteWebhook(c *gin.Context) {
+	if !requireWebhooks(c) {
+		return
+	}
+	w, err := webhookDispatcher.Get(c.Param("id"))
+	if err == nil {
+		err = webhookDispatcher.Delete(w.ID)
+	}
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	recordWebhookChange(c, audit.ActionWebhookDelete, w)
+	c.Status(http.StatusNoContent)
+}
+
+func v1PingWebhook(c *gin.Context) {
+	if !requireWebhooks(c) {
+		return
+	}
+	delivery, err := webhookDispatcher.Ping(c.Param("id"))
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, delivery)
+}
+
+func v1ListDeliveries(c *gin.Context) {
+	if !requireWebhooks(c) {
+		return
+	}
+	limit, offset, err := api.PageParams(c)
+	if err != nil {
+		api.Abort(c, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+	list, err := webhookDispatcher.Deliveries(c.Param("id"))
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	if status := c.Query("status"); status != "" {
+		filtered := []webhooks.Delivery{}
+		for _, delivery := range list {
+			if delivery.Status == status {
+				filtered = append(filtered, delivery)
+			}
+		}
+		list = filtered
+	}
+	c.JSON(http.StatusOK, api.Paginate(list, limit, offset))
+}
+
+func v1Redeliver(c *gin.Context) {
+	if !requireWebhooks(c) {
+		return
+	}
+	delivery, err := webhookDispatcher.Redeliver(c.Param("id"), c.Param("delivery"))
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, delivery)
+}
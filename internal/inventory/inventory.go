@@ -0,0 +1,217 @@
+package inventory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"license-manager/internal/services"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrNotFound is returned for a server name that is not in the inventory
+var ErrNotFound = errors.New("server not found in inventory")
+
+// validName limits server names to characters that are safe in URLs and
+// file names
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// Server is a named host with the credentials and escalation settings used
+// to manage it
+type Server struct {
+	Name           string   `json:"name" yaml:"name"`
+	Host           string   `json:"host" yaml:"host"`
+	Port           string   `json:"port" yaml:"port"`
+	Username       string   `json:"username" yaml:"username"`
+	Password       string   `json:"password,omitempty" yaml:"password"`
+	Become         string   `json:"become,omitempty" yaml:"become"`
+	BecomeUser     string   `json:"become_user,omitempty" yaml:"become_user"`
+	BecomePassword string   `json:"become_password,omitempty" yaml:"become_password"`
+	Tags           []string `json:"tags,omitempty" yaml:"tags"`
+}
+
+// Escalation returns the server's sudo or su settings
+func (s Server) Escalation() services.Escalation {
+	return services.Escalation{
+		Method:   s.Become,
+		User:     s.BecomeUser,
+		Password: s.BecomePassword,
+	}
+}
+
+// Validate checks that the server can be connected to
+func (s Server) Validate() error {
+	if !validName.MatchString(s.Name) {
+		return fmt.Errorf("invalid server name %q: use letters, digits, '.', '_' and '-'", s.Name)
+	}
+	if s.Host == "" || s.Port == "" || s.Username == "" || s.Password == "" {
+		return fmt.Errorf("server %s: host, port, username and password are required", s.Name)
+	}
+	return s.Escalation().Validate()
+}
+
+// Load reads and validates a list of servers from a YAML (.yaml, .yml) or
+// JSON file, such as a copy of the server's inventory file. Ports default to
+// 22.
+func Load(path string) ([]Server, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory: %v", err)
+	}
+
+	var servers []Server
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(strings.NewReader(string(data)))
+		dec.KnownFields(true)
+		if err = dec.Decode(&servers); errors.Is(err, io.EOF) {
+			err = nil
+		}
+	default:
+		err = json.Unmarshal(data, &servers)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse inventory %s: %v", path, err)
+	}
+
+	names := make(map[string]bool, len(servers))
+	for i := range servers {
+		if servers[i].Port == "" {
+			servers[i].Port = "22"
+		}
+		if err := servers[i].Validate(); err != nil {
+			return nil, err
+		}
+		if names[servers[i].Name] {
+			return nil, fmt.Errorf("server name %q is used twice", servers[i].Name)
+		}
+		names[servers[i].Name] = true
+	}
+	return servers, nil
+}
+
+// Store is the server inventory, persisted as a JSON file readable only by
+// its owner since it holds credentials
+type Store struct {
+	mu      sync.Mutex
+	path    string
+	servers map[string]Server
+}
+
+// Open loads the inventory at path, which need not exist yet
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create inventory directory: %v", err)
+	}
+
+	s := &Store{path: path, servers: make(map[string]Server)}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read inventory: %v", err)
+	}
+	if len(data) > 0 {
+		var saved []Server
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return nil, fmt.Errorf("failed to parse inventory %s: %v", path, err)
+		}
+		for _, server := range saved {
+			s.servers[server.Name] = server
+		}
+	}
+	return s, nil
+}
+
+// List returns every server, sorted by name
+func (s *Store) List() []Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list()
+}
+
+// Get returns the named server
+func (s *Store) Get(name string) (Server, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	server, ok := s.servers[name]
+	if !ok {
+		return Server{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return server, nil
+}
+
+// Put adds server, or replaces the server with the same name
+func (s *Store) Put(server Server) error {
+	if err := server.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.servers[server.Name]
+	s.servers[server.Name] = server
+	if err := s.save(); err != nil {
+		if existed {
+			s.servers[server.Name] = previous
+		} else {
+			delete(s.servers, server.Name)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes the named server
+func (s *Store) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	server, ok := s.servers[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	delete(s.servers, name)
+	if err := s.save(); err != nil {
+		s.servers[name] = server
+		return err
+	}
+	return nil
+}
+
+func (s *Store) list() []Server {
+	list := make([]Server, 0, len(s.servers))
+	for _, server := range s.servers {
+		list = append(list, server)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// save writes the inventory atomically. Callers must hold s.mu.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.list(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode inventory: %v", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write inventory: %v", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace inventory: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,358 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Job statuses
+const (
+	StatusRunning     = "running"
+	StatusSucceeded   = "succeeded"
+	StatusFailed      = "failed"
+	StatusInterrupted = "interrupted"
+)
+
+// maxFinishedJobs bounds how many completed jobs are kept in the state file
+const maxFinishedJobs = 1000
+
+// subscriberBuffer is how many updates a subscriber may fall behind by
+// before further updates to it are dropped
+const subscriberBuffer = 64
+
+// ErrShuttingDown is returned by Start once Shutdown has been called
+var ErrShuttingDown = errors.New("server is shutting down")
+
+// Job is one remote operation against one host
+type Job struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	Host       string     `json:"host"`
+	Actor      string     `json:"actor"`
+	License    string     `json:"license,omitempty"`
+	Status     string     `json:"status"`
+	Step       string     `json:"step,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Manager tracks in-flight jobs and persists their state so that jobs cut
+// off by a shutdown or crash are visible after a restart
+type Manager struct {
+	mu       sync.Mutex
+	path     string
+	jobs     map[string]*Job
+	running  sync.WaitGroup
+	draining bool
+	subs     map[chan Job]struct{}
+}
+
+// Open loads the job state at path. Jobs still marked running were cut off
+// when the previous process stopped and are marked interrupted.
+func Open(path string) (*Manager, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create job state directory: %v", err)
+	}
+
+	m := &Manager{path: path, jobs: make(map[string]*Job)}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read job state: %v", err)
+	}
+	if len(data) > 0 {
+		var saved []*Job
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return nil, fmt.Errorf("failed to parse job state %s: %v", path, err)
+		}
+		for _, job := range saved {
+			if job.Status == StatusRunning {
+				markInterrupted(job, "process stopped before the job finished")
+			}
+			m.jobs[job.ID] = job
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.save(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Start registers a new running job. It fails with ErrShuttingDown once the
+// manager is draining.
+func (m *Manager) Start(kind, host, actor string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.draining {
+		return nil, ErrShuttingDown
+	}
+
+	job := &Job{
+		ID:        newID(),
+		Kind:      kind,
+		Host:      host,
+		Actor:     actor,
+		Status:    StatusRunning,
+		StartedAt: time.Now().UTC(),
+	}
+	m.jobs[job.ID] = job
+	m.running.Add(1)
+
+	if err := m.save(); err != nil {
+		delete(m.jobs, job.ID)
+		m.running.Done()
+		return nil, err
+	}
+	m.notify(job)
+	return copyJob(job), nil
+}
+
+// SetLicense records the license file a job is importing
+func (m *Manager) SetLicense(id, license string) {
+	m.update(id, func(job *Job) {
+		job.License = license
+	})
+}
+
+// SetStep records the step a running job has reached, so an interrupted job
+// shows how far it got
+func (m *Manager) SetStep(id, step string) {
+	m.update(id, func(job *Job) {
+		job.Step = step
+	})
+}
+
+// Finish marks a job succeeded, or failed when err is not nil
+func (m *Manager) Finish(id string, err error) {
+	finished := m.update(id, func(job *Job) {
+		if job.Status != StatusRunning {
+			return
+		}
+		now := time.Now().UTC()
+		job.FinishedAt = &now
+		job.Status = StatusSucceeded
+		if err != nil {
+			job.Status = StatusFailed
+			job.Error = err.Error()
+		}
+	})
+	if finished {
+		m.running.Done()
+	}
+}
+
+// Get returns a copy of the job with the given ID
+func (m *Manager) Get(id string) (*Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	return copyJob(job), true
+}
+
+// List returns copies of all jobs with the given status (or all jobs when
+// status is empty), newest first
+func (m *Manager) List(status string) []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := []Job{}
+	for _, job := range m.jobs {
+		if status == "" || job.Status == status {
+			list = append(list, *copyJob(job))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].StartedAt.After(list[j].StartedAt)
+	})
+	return list
+}
+
+// Running returns the number of jobs in progress
+func (m *Manager) Running() int {
+	return len(m.List(StatusRunning))
+}
+
+// Draining reports whether Shutdown has been called
+func (m *Manager) Draining() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.draining
+}
+
+// Shutdown stops new jobs from starting and waits for running jobs to
+// finish. If ctx expires first, the remaining jobs are marked interrupted
+// and ctx's error is returned.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	m.draining = true
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, job := range m.jobs {
+		if job.Status == StatusRunning {
+			markInterrupted(job, "shutdown grace period expired")
+			m.notify(job)
+		}
+	}
+	if err := m.save(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// Subscribe returns a channel that receives a copy of each job every time
+// it starts, changes or finishes, and a function that ends the
+// subscription. A subscriber that falls behind misses updates rather than
+// holding up jobs; Get always has the latest state.
+func (m *Manager) Subscribe() (<-chan Job, func()) {
+	ch := make(chan Job, subscriberBuffer)
+	m.mu.Lock()
+	if m.subs == nil {
+		m.subs = make(map[chan Job]struct{})
+	}
+	m.subs[ch] = struct{}{}
+	m.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			m.mu.Lock()
+			delete(m.subs, ch)
+			m.mu.Unlock()
+		})
+	}
+}
+
+// notify sends job to every subscriber. Callers must hold m.mu.
+func (m *Manager) notify(job *Job) {
+	for ch := range m.subs {
+		select {
+		case ch <- *copyJob(job):
+		default:
+		}
+	}
+}
+
+// update applies fn to the job and persists the result. It reports whether
+// the job moved out of the running state.
+func (m *Manager) update(id string, fn func(*Job)) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return false
+	}
+	wasRunning := job.Status == StatusRunning
+	fn(job)
+	if err := m.save(); err != nil {
+		// The in-memory state is still correct; the next save retries
+		slog.Error("saving job state", "job_id", id, "error", err)
+	}
+	m.notify(job)
+	return wasRunning && job.Status != StatusRunning
+}
+
+// save writes the job state atomically. Callers must hold m.mu.
+func (m *Manager) save() error {
+	m.prune()
+
+	list := make([]*Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		list = append(list, job)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].StartedAt.Before(list[j].StartedAt)
+	})
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode job state: %v", err)
+	}
+
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write job state: %v", err)
+	}
+	if err := os.Rename(tmp, m.path); err != nil {
+		return fmt.Errorf("failed to replace job state: %v", err)
+	}
+	return nil
+}
+
+// prune drops the oldest finished jobs beyond maxFinishedJobs. Interrupted
+// jobs are always kept so they can be reviewed. Callers must hold m.mu.
+func (m *Manager) prune() {
+	var finished []*Job
+	for _, job := range m.jobs {
+		if job.Status == StatusSucceeded || job.Status == StatusFailed {
+			finished = append(finished, job)
+		}
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].StartedAt.Before(finished[j].StartedAt)
+	})
+	for _, job := range finished[:len(finished)-maxFinishedJobs] {
+		delete(m.jobs, job.ID)
+	}
+}
+
+func markInterrupted(job *Job, reason string) {
+	now := time.Now().UTC()
+	job.Status = StatusInterrupted
+	job.Error = reason
+	job.FinishedAt = &now
+}
+
+func copyJob(job *Job) *Job {
+	cp := *job
+	if job.FinishedAt != nil {
+		t := *job.FinishedAt
+		cp.FinishedAt = &t
+	}
+	return &cp
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic("crypto/rand failed: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,586 @@
+package lmctl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"license-manager/internal/api"
+	"license-manager/internal/audit"
+	"license-manager/internal/handlers"
+	"license-manager/internal/inventory"
+	"license-manager/internal/jobs"
+	"license-manager/internal/rollouts"
+	"license-manager/internal/services"
+)
+
+func serversList(ctx context.Context, c *cli, args []string) (int, error) {
+	fs := c.flags("servers list")
+	if err := c.parse(fs, args); err != nil {
+		return ExitUsage, err
+	}
+
+	var resp handlers.ServersResponse
+	if err := c.client.call(ctx, http.MethodGet, "/api/servers", nil, &resp); err != nil {
+		return ExitFailure, err
+	}
+
+	return ExitOK, c.print(resp, func(w io.Writer) {
+		row(w, "NAME", "HOST", "USER", "BECOME", "TAGS")
+		for _, s := range resp.Servers {
+			become := s.Become
+			if become != "" {
+				become += " " + orDash(s.BecomeUser)
+			}
+			row(w, s.Name, s.Host+":"+s.Port, s.Username, orDash(become), orDash(strings.Join(s.Tags, ",")))
+		}
+	})
+}
+
+// serversAdd adds or replaces a server. Passwords default to
+// $LMCTL_SSH_PASSWORD and $LMCTL_BECOME_PASSWORD so that they stay out of
+// the process list.
+func serversAdd(ctx context.Context, c *cli, args []string) (int, error) {
+	fs := c.flags("servers add")
+	var server inventory.Server
+	var tags string
+	fs.StringVar(&server.Host, "host", "", "host name or IP address")
+	fs.StringVar(&server.Port, "port", "22", "SSH port")
+	fs.StringVar(&server.Username, "user", "", "SSH user")
+	fs.StringVar(&server.Password, "password", c.getenv("LMCTL_SSH_PASSWORD"), "SSH password (LMCTL_SSH_PASSWORD)")
+	fs.StringVar(&server.Become, "become", "", "run license2_cli through sudo or su")
+	fs.StringVar(&server.BecomeUser, "become-user", "", "user to become (default root)")
+	fs.StringVar(&server.BecomePassword, "become-password", c.getenv("LMCTL_BECOME_PASSWORD"), "sudo or su password (LMCTL_BECOME_PASSWORD)")
+	fs.StringVar(&tags, "tags", "", "comma-separated tags")
+	if err := c.parse(fs, args); err != nil {
+		return ExitUsage, err
+	}
+	if fs.NArg() != 1 {
+		return ExitUsage, fmt.Errorf("%w: servers add takes one server name", errUsage)
+	}
+	server.Name = fs.Arg(0)
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			server.Tags = append(server.Tags, tag)
+		}
+	}
+
+	var resp handlers.ServerResponse
+	if err := c.client.call(ctx, http.MethodPost, "/api/servers", server, &resp); err != nil {
+		return ExitFailure, err
+	}
+
+	return ExitOK, c.print(resp, func(w io.Writer) {
+		fmt.Fprintf(w, "saved %s (%s@%s:%s)\n", resp.Server.Name, resp.Server.Username, resp.Server.Host, resp.Server.Port)
+	})
+}
+
+func serversRemove(ctx context.Context, c *cli, args []string) (int, error) {
+	fs := c.flags("servers remove")
+	if err := c.parse(fs, args); err != nil {
+		return ExitUsage, err
+	}
+	if fs.NArg() != 1 {
+		return ExitUsage, fmt.Errorf("%w: servers remove takes one server name", errUsage)
+	}
+
+	var resp handlers.ServerResponse
+	if err := c.client.call(ctx, http.MethodDelete, "/api/servers/"+url.PathEscape(fs.Arg(0)), nil, &resp); err != nil {
+		return ExitFailure, err
+	}
+
+	return ExitOK, c.print(resp, func(w io.Writer) {
+		fmt.Fprintf(w, "removed %s\n", resp.Server.Name)
+	})
+}
+
+// serverNames returns the server names given to a command
+func serverNames(fs *flag.FlagSet, name string) ([]string, error) {
+	if fs.NArg() == 0 {
+		return nil, fmt.Errorf("%w: %s needs at least one server name", errUsage, name)
+	}
+	return fs.Args(), nil
+}
+
+type checkResult struct {
+	Server string `json:"server"`
+	handlers.CheckLicenseCLIResponse
+}
+
+func check(ctx context.Context, c *cli, args []string) (int, error) {
+	fs := c.flags("check")
+	if err := c.parse(fs, args); err != nil {
+		return ExitUsage, err
+	}
+	names, err := serverNames(fs, "check")
+	if err != nil {
+		return ExitUsage, err
+	}
+
+	code := ExitOK
+	results := make([]checkResult, 0, len(names))
+	for _, name := range names {
+		result := checkResult{Server: name}
+		err := c.client.call(ctx, http.MethodPost, "/api/check-license-cli", handlers.ServerConfig{Server: name}, &result.CheckLicenseCLIResponse)
+		result.Error = errorText(result.Error, err)
+		if result.Error != "" || !result.Exists {
+			code = ExitFailure
+		}
+		results = append(results, result)
+	}
+
+	return code, c.print(results, func(w io.Writer) {
+		row(w, "SERVER", "LICENSE2_CLI", "ERROR")
+		for _, r := range results {
+			status := "found"
+			switch {
+			case r.Error != "":
+				status = "error"
+			case !r.Exists:
+				status = "missing"
+			}
+			row(w, r.Server, status, orDash(r.Error))
+		}
+	})
+}
+
+type preflightResult struct {
+	Server string `json:"server"`
+	handlers.PreflightResponse
+}
+
+func preflight(ctx context.Context, c *cli, args []string) (int, error) {
+	fs := c.flags("preflight")
+	if err := c.parse(fs, args); err != nil {
+		return ExitUsage, err
+	}
+	names, err := serverNames(fs, "preflight")
+	if err != nil {
+		return ExitUsage, err
+	}
+
+	code := ExitOK
+	results := make([]preflightResult, 0, len(names))
+	for _, name := range names {
+		result := preflightResult{Server: name}
+		err := c.client.call(ctx, http.MethodPost, "/api/preflight", handlers.ServerConfig{Server: name}, &result.PreflightResponse)
+		result.Error = errorText(result.Error, err)
+		if result.Error != "" || result.Report == nil || result.Report.Status == services.PreflightFail {
+			code = ExitFailure
+		}
+		results = append(results, result)
+	}
+
+	return code, c.print(results, func(w io.Writer) {
+		row(w, "SERVER", "CHECK", "STATUS", "MESSAGE")
+		for _, r := range results {
+			if r.Report == nil {
+				row(w, r.Server, "-", services.PreflightFail, r.Error)
+				continue
+			}
+			for _, check := range r.Report.Checks {
+				row(w, r.Server, check.Name, check.Status, check.Message)
+			}
+		}
+	})
+}
+
+type sysinfoResult struct {
+	Server string `json:"server"`
+	File   string `json:"file,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func sysinfoPull(ctx context.Context, c *cli, args []string) (int, error) {
+	fs := c.flags("sysinfo pull")
+	dir := fs.String("dir", ".", "directory to save sysinfo files in")
+	if err := c.parse(fs, args); err != nil {
+		return ExitUsage, err
+	}
+	names, err := serverNames(fs, "sysinfo pull")
+	if err != nil {
+		return ExitUsage, err
+	}
+
+	code := ExitOK
+	results := make([]sysinfoResult, 0, len(names))
+	for _, name := range names {
+		result := sysinfoResult{Server: name}
+		file, err := c.client.download(ctx, "/api/download-sysinfo", handlers.ServerConfig{Server: name}, *dir)
+		if err != nil {
+			result.Error = err.Error()
+			code = ExitFailure
+		}
+		result.File = file
+		results = append(results, result)
+	}
+
+	return code, c.print(results, func(w io.Writer) {
+		row(w, "SERVER", "FILE", "ERROR")
+		for _, r := range results {
+			row(w, r.Server, orDash(r.File), orDash(r.Error))
+		}
+	})
+}
+
+type licenseResult struct {
+	Server string `json:"server"`
+	handlers.UploadLicenseResponse
+}
+
+func licensePush(ctx context.Context, c *cli, args []string) (int, error) {
+	fs := c.flags("license push")
+	if err := c.parse(fs, args); err != nil {
+		return ExitUsage, err
+	}
+	if fs.NArg() < 2 {
+		return ExitUsage, fmt.Errorf("%w: license push takes a license file and at least one server name", errUsage)
+	}
+	file, names := fs.Arg(0), fs.Args()[1:]
+
+	code := ExitOK
+	results := make([]licenseResult, 0, len(names))
+	for _, name := range names {
+		result := licenseResult{Server: name}
+		err := c.client.upload(ctx, "/api/upload-license", map[string]string{"server": name}, "license_file", file, &result.UploadLicenseResponse)
+		result.Error = errorText(result.Error, err)
+		if result.Error != "" || !result.Success {
+			code = ExitFailure
+		}
+		results = append(results, result)
+	}
+
+	return code, c.print(results, func(w io.Writer) {
+		row(w, "SERVER", "RESULT", "MESSAGE")
+		for _, r := range results {
+			if r.Error != "" {
+				row(w, r.Server, "failed", r.Error)
+				continue
+			}
+			row(w, r.Server, "imported", r.Message)
+		}
+	})
+}
+
+// rolloutCreate schedules a license import through /api/v1, which stages
+// it when -canary or -wave-size is given
+func rolloutCreate(ctx context.Context, c *cli, args []string) (int, error) {
+	fs := c.flags("rollout create")
+	fields := map[string]*string{
+		"servers":  fs.String("servers", "", "comma-separated server names, imported on in this order"),
+		"tag":      fs.String("tag", "", "also import on every server with this tag"),
+		"start_at": fs.String("start", "", "when the (first) window opens, in RFC 3339"),
+		"repeat":   fs.String("repeat", "", "daily or weekly for a recurring window"),
+		"name":     fs.String("name", "", "a description of the rollout"),
+	}
+	counts := map[string]*int{
+		"window_minutes":      fs.Int("window", 0, "minutes the window stays open (default 60)"),
+		"canary":              fs.Int("canary", 0, "servers to import on before the first wave"),
+		"wave_size":           fs.Int("wave-size", 0, "servers each following wave imports on in parallel"),
+		"max_failure_percent": fs.Int("max-failure-percent", 0, "halt after a wave once more than this share of its imports failed"),
+	}
+	if err := c.parse(fs, args); err != nil {
+		return ExitUsage, err
+	}
+	if fs.NArg() != 1 {
+		return ExitUsage, fmt.Errorf("%w: rollout create takes one license file", errUsage)
+	}
+
+	form := map[string]string{}
+	for name, value := range fields {
+		if *value != "" {
+			form[name] = *value
+		}
+	}
+	for name, value := range counts {
+		if *value != 0 {
+			form[name] = strconv.Itoa(*value)
+		}
+	}
+	var r rollouts.Rollout
+	if err := c.client.upload(ctx, "/api/v1/rollouts", form, "license_file", fs.Arg(0), &r); err != nil {
+		return ExitFailure, err
+	}
+	return ExitOK, c.printRollout(r)
+}
+
+func rolloutList(ctx context.Context, c *cli, args []string) (int, error) {
+	fs := c.flags("rollout list")
+	status := fs.String("status", "", "only list rollouts with this status")
+	if err := c.parse(fs, args); err != nil {
+		return ExitUsage, err
+	}
+
+	var page api.Page[rollouts.Rollout]
+	if err := c.client.call(ctx, http.MethodGet, "/api/v1/rollouts"+query(map[string]string{"status": *status, "limit": "500"}), nil, &page); err != nil {
+		return ExitFailure, err
+	}
+
+	return ExitOK, c.print(page.Items, func(w io.Writer) {
+		row(w, "ID", "NAME", "LICENSE", "STATUS", "SERVERS", "NEXT WINDOW")
+		for _, r := range page.Items {
+			next := "-"
+			if r.NextWindowAt != nil {
+				next = r.NextWindowAt.Local().Format(time.DateTime)
+			}
+			row(w, r.ID, orDash(r.Name), r.License, r.Status, len(r.Targets), next)
+		}
+	})
+}
+
+func rolloutGet(ctx context.Context, c *cli, args []string) (int, error) {
+	fs := c.flags("rollout get")
+	if err := c.parse(fs, args); err != nil {
+		return ExitUsage, err
+	}
+	if fs.NArg() != 1 {
+		return ExitUsage, fmt.Errorf("%w: rollout get takes one rollout ID", errUsage)
+	}
+
+	var r rollouts.Rollout
+	if err := c.client.call(ctx, http.MethodGet, "/api/v1/rollouts/"+url.PathEscape(fs.Arg(0)), nil, &r); err != nil {
+		return ExitFailure, err
+	}
+	return ExitOK, c.printRollout(r)
+}
+
+// rolloutChange returns the command that resumes, aborts or cancels a
+// rollout
+func rolloutChange(change string) command {
+	return func(ctx context.Context, c *cli, args []string) (int, error) {
+		fs := c.flags("rollout " + change)
+		if err := c.parse(fs, args); err != nil {
+			return ExitUsage, err
+		}
+		if fs.NArg() != 1 {
+			return ExitUsage, fmt.Errorf("%w: rollout %s takes one rollout ID", errUsage, change)
+		}
+
+		var r rollouts.Rollout
+		if err := c.client.call(ctx, http.MethodPost, "/api/v1/rollouts/"+url.PathEscape(fs.Arg(0))+"/"+change, nil, &r); err != nil {
+			return ExitFailure, err
+		}
+		return ExitOK, c.printRollout(r)
+	}
+}
+
+// printRollout writes a rollout and the status of each of its servers
+func (c *cli) printRollout(r rollouts.Rollout) error {
+	return c.print(r, func(w io.Writer) {
+		fmt.Fprintf(w, "rollout %s %s", r.ID, r.Status)
+		if r.HaltReason != "" {
+			fmt.Fprintf(w, ": %s", r.HaltReason)
+		}
+		if r.NextWindowAt != nil {
+			fmt.Fprintf(w, ", next window %s", r.NextWindowAt.Local().Format(time.DateTime))
+		}
+		fmt.Fprintln(w)
+		row(w, "SERVER", "WAVE", "STATUS", "JOB", "ERROR")
+		for _, t := range r.Targets {
+			wave := "-"
+			if t.Wave > 0 {
+				wave = strconv.Itoa(t.Wave)
+			}
+			row(w, t.Server, wave, t.Status, orDash(t.JobID), orDash(t.Error))
+		}
+	})
+}
+
+func jobsList(ctx context.Context, c *cli, args []string) (int, error) {
+	fs := c.flags("jobs list")
+	status := fs.String("status", "", "only list jobs with this status")
+	if err := c.parse(fs, args); err != nil {
+		return ExitUsage, err
+	}
+
+	var resp handlers.JobsResponse
+	if err := c.client.call(ctx, http.MethodGet, "/api/jobs"+query(map[string]string{"status": *status}), nil, &resp); err != nil {
+		return ExitFailure, err
+	}
+
+	return ExitOK, c.print(resp, func(w io.Writer) {
+		row(w, "ID", "KIND", "HOST", "ACTOR", "STATUS", "STEP", "STARTED", "ERROR")
+		for _, job := range resp.Jobs {
+			row(w, job.ID, job.Kind, job.Host, job.Actor, job.Status, orDash(job.Step), job.StartedAt.Local().Format(time.DateTime), orDash(job.Error))
+		}
+	})
+}
+
+// jobsWatch polls the job list and prints every change of status or step.
+// Given job IDs it follows those jobs, otherwise the jobs running when it
+// starts; it returns once they have all finished, failing if any did.
+func jobsWatch(ctx context.Context, c *cli, args []string) (int, error) {
+	fs := c.flags("jobs watch")
+	interval := fs.Duration("interval", 2*time.Second, "polling interval")
+	if err := c.parse(fs, args); err != nil {
+		return ExitUsage, err
+	}
+	if *interval <= 0 {
+		return ExitUsage, fmt.Errorf("%w: -interval must be positive", errUsage)
+	}
+
+	watched := make(map[string]bool)
+	for _, id := range fs.Args() {
+		watched[id] = true
+	}
+	seen := make(map[string]jobs.Job)
+	first := true
+
+	for {
+		var resp handlers.JobsResponse
+		if err := c.client.call(ctx, http.MethodGet, "/api/jobs", nil, &resp); err != nil {
+			return ExitFailure, err
+		}
+
+		if first && len(watched) == 0 {
+			for _, job := range resp.Jobs {
+				if job.Status == jobs.StatusRunning {
+					watched[job.ID] = true
+				}
+			}
+			if len(watched) == 0 {
+				fmt.Fprintln(c.stderr, "no running jobs")
+				return ExitOK, nil
+			}
+		}
+
+		running, failed := 0, 0
+		for _, job := range resp.Jobs {
+			if !watched[job.ID] {
+				continue
+			}
+			if prev, ok := seen[job.ID]; !ok || prev.Status != job.Status || prev.Step != job.Step {
+				if err := c.printJob(job); err != nil {
+					return ExitFailure, err
+				}
+			}
+			seen[job.ID] = job
+			switch job.Status {
+			case jobs.StatusRunning:
+				running++
+			case jobs.StatusFailed, jobs.StatusInterrupted:
+				failed++
+			}
+		}
+
+		if first {
+			for id := range watched {
+				if _, ok := seen[id]; !ok {
+					return ExitFailure, fmt.Errorf("job %s not found", id)
+				}
+			}
+			first = false
+		}
+		if running == 0 {
+			if failed > 0 {
+				return ExitFailure, fmt.Errorf("%d of %d jobs did not succeed", failed, len(watched))
+			}
+			return ExitOK, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ExitFailure, ctx.Err()
+		case <-time.After(*interval):
+		}
+	}
+}
+
+// printJob writes one job update: a line of text, or a JSON object per line
+func (c *cli) printJob(job jobs.Job) error {
+	if c.output == OutputJSON {
+		return json.NewEncoder(c.stdout).Encode(job)
+	}
+	line := fmt.Sprintf("%s  %s  %s  %s  %s", time.Now().Format(time.TimeOnly), job.ID, job.Kind, job.Host, job.Status)
+	if job.Step != "" && job.Status == jobs.StatusRunning {
+		line += " (" + job.Step + ")"
+	}
+	if job.Error != "" {
+		line += ": " + job.Error
+	}
+	_, err := fmt.Fprintln(c.stdout, line)
+	return err
+}
+
+func auditCommand(ctx context.Context, c *cli, args []string) (int, error) {
+	if len(args) > 0 && args[0] == "verify" {
+		return auditVerify(ctx, c, args[1:])
+	}
+
+	fs := c.flags("audit")
+	filter := map[string]*string{}
+	for _, name := range []string{"actor", "action", "host", "outcome", "since", "until"} {
+		filter[name] = fs.String(name, "", "only list records with this "+name)
+	}
+	limit := fs.Int("limit", 0, "list only the most recent records")
+	if err := c.parse(fs, args); err != nil {
+		return ExitUsage, err
+	}
+
+	params := map[string]string{}
+	for name, value := range filter {
+		params[name] = *value
+	}
+	if *limit > 0 {
+		params["limit"] = strconv.Itoa(*limit)
+	}
+
+	var resp handlers.AuditResponse
+	if err := c.client.call(ctx, http.MethodGet, "/api/audit"+query(params), nil, &resp); err != nil {
+		return ExitFailure, err
+	}
+
+	return ExitOK, c.print(resp, func(w io.Writer) {
+		row(w, "SEQ", "TIME", "ACTOR", "ACTION", "HOST", "OUTCOME", "DETAIL")
+		for _, rec := range resp.Records {
+			row(w, rec.Seq, rec.Time.Local().Format(time.DateTime), rec.Actor, rec.Action, orDash(rec.Host), rec.Outcome, orDash(auditDetail(rec)))
+		}
+	})
+}
+
+// auditDetail summarises what a record is about
+func auditDetail(rec audit.Record) string {
+	switch {
+	case rec.Error != "":
+		return rec.Error
+	case rec.Command != "":
+		return rec.Command
+	case rec.LicenseFile != "":
+		return rec.LicenseFile
+	}
+	return rec.Server
+}
+
+func auditVerify(ctx context.Context, c *cli, args []string) (int, error) {
+	fs := c.flags("audit verify")
+	if err := c.parse(fs, args); err != nil {
+		return ExitUsage, err
+	}
+
+	var resp handlers.AuditVerifyResponse
+	err := c.client.call(ctx, http.MethodGet, "/api/audit/verify", nil, &resp)
+	var apiErr *APIError
+	if err != nil && !(errors.As(err, &apiErr) && apiErr.Status == http.StatusConflict) {
+		return ExitFailure, err
+	}
+
+	code := ExitOK
+	if !resp.Valid {
+		code = ExitFailure
+	}
+	return code, c.print(resp, func(w io.Writer) {
+		if resp.Valid {
+			fmt.Fprintf(w, "audit log is intact: %d records verified\n", resp.Records)
+			return
+		}
+		fmt.Fprintf(w, "audit log failed verification: %s\n", resp.Error)
+	})
+}
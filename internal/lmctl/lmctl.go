@@ -0,0 +1,226 @@
+// Package lmctl implements the lmctl command-line client, which drives the
+// License Manager HTTP API for scripts and CI pipelines.
+package lmctl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Exit codes
+const (
+	ExitOK      = 0
+	ExitFailure = 1
+	ExitUsage   = 2
+)
+
+// Output formats
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+)
+
+// errUsage marks errors that should be followed by the command's usage
+var errUsage = errors.New("usage")
+
+const usage = `Usage: lmctl [flags] <command> [arguments]
+
+Commands:
+  servers list                       list the server inventory
+  servers add [flags] NAME           add or replace an inventory server
+  servers remove NAME                remove an inventory server
+  check NAME...                      check that license2_cli is installed
+  preflight NAME...                  run preflight checks
+  sysinfo pull [-dir DIR] NAME...    generate and download sysinfo files
+  license push FILE NAME...          upload and import a license
+  rollout create [flags] FILE        schedule a license import for a window
+  rollout list [-status STATUS]      list rollouts
+  rollout get ID                     show a rollout and its servers
+  rollout resume|abort|cancel ID     resume, abort or cancel a rollout
+  jobs list [-status STATUS]         list jobs
+  jobs watch [-interval D] [ID...]   follow jobs until they finish
+  audit [filters]                    list audit records
+  audit verify                       verify the audit log hash chain
+
+NAME is the name of a server in the License Manager inventory.
+
+Flags:
+`
+
+// cli holds the global options shared by every command
+type cli struct {
+	client *client
+	stdout io.Writer
+	stderr io.Writer
+	getenv func(string) string
+	output string
+}
+
+// command runs a subcommand with the arguments that follow its name
+type command func(ctx context.Context, c *cli, args []string) (int, error)
+
+var commands = map[string]command{
+	"servers":   subcommands(map[string]command{"list": serversList, "add": serversAdd, "remove": serversRemove}),
+	"check":     check,
+	"preflight": preflight,
+	"sysinfo":   subcommands(map[string]command{"pull": sysinfoPull}),
+	"license":   subcommands(map[string]command{"push": licensePush}),
+	"jobs":      subcommands(map[string]command{"list": jobsList, "watch": jobsWatch}),
+	"rollout": subcommands(map[string]command{
+		"create": rolloutCreate,
+		"list":   rolloutList,
+		"get":    rolloutGet,
+		"resume": rolloutChange("resume"),
+		"abort":  rolloutChange("abort"),
+		"cancel": rolloutChange("cancel"),
+	}),
+	"audit": auditCommand,
+}
+
+// Run runs lmctl with args (without the program name) and returns its exit
+// code. The API URL and token default to $LMCTL_URL and $LMCTL_TOKEN.
+func Run(ctx context.Context, args []string, stdout, stderr io.Writer, getenv func(string) string) int {
+	c := &cli{stdout: stdout, stderr: stderr, getenv: getenv}
+
+	fs := flag.NewFlagSet("lmctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	baseURL := fs.String("url", envOr(getenv, "LMCTL_URL", "http://localhost:8080"), "License Manager URL (LMCTL_URL)")
+	token := fs.String("token", getenv("LMCTL_TOKEN"), "API token (LMCTL_TOKEN)")
+	timeout := fs.Duration("timeout", 5*time.Minute, "timeout for each API request")
+	fs.StringVar(&c.output, "o", OutputTable, "output format: table or json")
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	run, ok := commands[fs.Arg(0)]
+	if !ok {
+		if fs.Arg(0) != "" {
+			fmt.Fprintf(stderr, "lmctl: unknown command %q\n", fs.Arg(0))
+		}
+		fs.Usage()
+		return ExitUsage
+	}
+
+	c.client = &client{
+		baseURL: *baseURL,
+		token:   *token,
+		http:    &http.Client{Timeout: *timeout},
+	}
+
+	code, err := run(ctx, c, fs.Args()[1:])
+	if errors.Is(err, errUsage) {
+		fmt.Fprintf(stderr, "lmctl: %v\n", err)
+		return ExitUsage
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "lmctl: %v\n", err)
+		if code == ExitOK {
+			code = ExitFailure
+		}
+	}
+	return code
+}
+
+// subcommands dispatches on the first argument
+func subcommands(cmds map[string]command) command {
+	return func(ctx context.Context, c *cli, args []string) (int, error) {
+		names := make([]string, 0, len(cmds))
+		for name := range cmds {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		if len(args) == 0 {
+			return ExitUsage, fmt.Errorf("%w: expected one of %s", errUsage, strings.Join(names, ", "))
+		}
+		run, ok := cmds[args[0]]
+		if !ok {
+			return ExitUsage, fmt.Errorf("%w: unknown subcommand %q, expected one of %s", errUsage, args[0], strings.Join(names, ", "))
+		}
+		return run(ctx, c, args[1:])
+	}
+}
+
+// flags returns a flag set for a subcommand. The -o flag is accepted after
+// the subcommand as well as before it.
+func (c *cli) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("lmctl "+name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.StringVar(&c.output, "o", c.output, "output format: table or json")
+	return fs
+}
+
+// parse parses subcommand flags, reporting errors as usage errors
+func (c *cli) parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+	if c.output != OutputTable && c.output != OutputJSON {
+		return fmt.Errorf("%w: unknown output format %q", errUsage, c.output)
+	}
+	return nil
+}
+
+// print writes v as indented JSON, or calls table to write it as a table
+func (c *cli) print(v any, table func(w io.Writer)) error {
+	if c.output == OutputJSON {
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+// row writes tab-separated columns
+func row(w io.Writer, columns ...any) {
+	for i, col := range columns {
+		if i > 0 {
+			fmt.Fprint(w, "\t")
+		}
+		fmt.Fprint(w, col)
+	}
+	fmt.Fprintln(w)
+}
+
+// errorText returns the error message for a result, preferring the API's
+// own message
+func errorText(message string, err error) string {
+	if message != "" {
+		return message
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func envOr(getenv func(string) string, name, fallback string) string {
+	if value := getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// orDash keeps empty table cells visible
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,179 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "license_manager"
+
+// Outcome label values
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Transfer direction label values
+const (
+	DirectionUpload   = "upload"
+	DirectionDownload = "download"
+)
+
+// Registry holds every metric exposed by Handler. A dedicated registry keeps
+// the output to this application's metrics plus the Go and process collectors.
+var Registry = prometheus.NewRegistry()
+
+var (
+	sshDialDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ssh_dial_duration_seconds",
+		Help:      "Time to connect and authenticate to an SSH server.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"host", "outcome"})
+
+	sshDialFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ssh_dial_failures_total",
+		Help:      "SSH connections that failed to connect or authenticate.",
+	}, []string{"host"})
+
+	commandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ssh_command_duration_seconds",
+		Help:      "Duration of remote commands by operation.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"operation", "outcome"})
+
+	bytesTransferred = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ssh_transferred_bytes_total",
+		Help:      "Bytes copied to or from remote servers.",
+	}, []string{"direction"})
+
+	licenseDaysRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "license_days_remaining",
+		Help:      "Days until the license expires, from the last license2_cli check of each server.",
+	}, []string{"host"})
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		sshDialDuration,
+		sshDialFailures,
+		commandDuration,
+		bytesTransferred,
+		licenseDaysRemaining,
+		httpRequests,
+		httpDuration,
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// RegisterActiveJobs exposes the number of running jobs, as reported by
+// running at scrape time
+func RegisterActiveJobs(running func() int) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_jobs",
+		Help:      "Jobs currently running.",
+	}, func() float64 {
+		return float64(running())
+	}))
+}
+
+// ObserveDial records an SSH connection attempt to host that took d
+func ObserveDial(host string, d time.Duration, err error) {
+	sshDialDuration.WithLabelValues(host, outcome(err)).Observe(d.Seconds())
+	if err != nil {
+		sshDialFailures.WithLabelValues(host).Inc()
+	}
+}
+
+// ObserveCommand records a remote command that took d
+func ObserveCommand(command string, d time.Duration, err error) {
+	commandDuration.WithLabelValues(Operation(command), outcome(err)).Observe(d.Seconds())
+}
+
+// AddTransferred records n bytes copied in direction
+func AddTransferred(direction string, n int64) {
+	if n > 0 {
+		bytesTransferred.WithLabelValues(direction).Add(float64(n))
+	}
+}
+
+// SetLicenseDaysRemaining records the days left on host's license
+func SetLicenseDaysRemaining(host string, days float64) {
+	licenseDaysRemaining.WithLabelValues(host).Set(days)
+}
+
+// Operation maps a remote command to a low-cardinality operation label
+func Operation(command string) string {
+	switch {
+	case command == "which license2_cli":
+		return "cli-lookup"
+	case strings.HasPrefix(command, "license2_cli check"):
+		return "check"
+	case strings.HasPrefix(command, "license2_cli getsysinfo"):
+		return "getsysinfo"
+	case strings.HasPrefix(command, "license2_cli import"):
+		return "import"
+	case strings.HasPrefix(command, "license2_cli --version"):
+		return "version"
+	case strings.HasPrefix(command, "cat > "):
+		return "upload"
+	case strings.HasPrefix(command, "cat "):
+		return "download"
+	}
+	return "other"
+}
+
+// Middleware records the count and latency of HTTP requests. Requests that
+// match no route are grouped under "unmatched" to bound the label values.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		started := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		httpRequests.WithLabelValues(route, method, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(route, method).Observe(time.Since(started).Seconds())
+	}
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return OutcomeFailure
+	}
+	return OutcomeSuccess
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminErrorResponse is returned when admin authentication fails
+type AdminErrorResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error"`
+}
+
+// AdminAuth requires an "Authorization: Bearer <token>" header matching one
+// of tokens. With no tokens configured the protected routes respond 404, as
+// if they did not exist.
+func AdminAuth(tokens []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(tokens) == 0 {
+			c.AbortWithStatusJSON(http.StatusNotFound, AdminErrorResponse{
+				Success: false,
+				Error:   "Admin endpoints are disabled",
+			})
+			return
+		}
+
+		token, ok := bearerToken(c.GetHeader("Authorization"))
+		if !ok || !matchToken(token, tokens) {
+			c.Header("WWW-Authenticate", `Bearer realm="admin"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, AdminErrorResponse{
+				Success: false,
+				Error:   "Admin token required",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// bearerToken extracts the token from an Authorization header value
+func bearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// matchToken compares token against every candidate in constant time
+func matchToken(token string, tokens []string) bool {
+	match := 0
+	for _, candidate := range tokens {
+		match |= subtle.ConstantTimeCompare([]byte(token), []byte(candidate))
+	}
+	return match == 1
+}
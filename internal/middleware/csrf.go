@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+
+	"license-manager/internal/api"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// CSRFCookieName is the cookie holding the per-browser CSRF token
+	CSRFCookieName = "csrf_token"
+	// CSRFHeaderName is the request header the UI echoes the token in
+	CSRFHeaderName = "X-CSRF-Token"
+	// CSRFFormField is the form field accepted as an alternative to the header
+	CSRFFormField = "csrf_token"
+
+	csrfContextKey = "csrf_token"
+)
+
+type CSRFErrorResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error"`
+}
+
+// CSRF implements double-submit cookie protection. Safe requests get a random
+// token cookie; state-changing requests must echo that token in the
+// X-CSRF-Token header or csrf_token form field. Requests carrying an
+// Authorization header are exempt because browsers never attach one on their
+// own, so they cannot be forged cross-site.
+func CSRF() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, err := c.Cookie(CSRFCookieName)
+		issued := err != nil || token == ""
+		if issued {
+			token = newCSRFToken()
+			http.SetCookie(c.Writer, &http.Cookie{
+				Name:     CSRFCookieName,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   c.Request.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+			})
+		}
+		c.Set(csrfContextKey, token)
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			c.Next()
+			return
+		}
+
+		if c.GetHeader("Authorization") != "" {
+			c.Next()
+			return
+		}
+
+		sent := c.GetHeader(CSRFHeaderName)
+		if sent == "" {
+			sent = c.PostForm(CSRFFormField)
+		}
+		// A token issued on this request cannot have been echoed yet
+		if issued || sent == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+			const message = "Missing or invalid CSRF token, reload the page and try again"
+			if api.Versioned(c) {
+				api.Abort(c, http.StatusForbidden, api.CodeForbidden, message)
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusForbidden, CSRFErrorResponse{
+				Success: false,
+				Error:   message,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// CSRFToken returns the token to embed in pages rendered for this request
+func CSRFToken(c *gin.Context) string {
+	return c.GetString(csrfContextKey)
+}
+
+func newCSRFToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic("crypto/rand failed: " + err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,478 @@
+// Package notify emails subscribers a digest of licenses expiring soon and
+// of failed jobs. Each subscriber chooses what the digest covers and whether
+// it is sent daily or weekly; digests are rendered from HTML and text
+// templates and sent over SMTP.
+package notify
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Schedules
+const (
+	ScheduleDaily  = "daily"
+	ScheduleWeekly = "weekly"
+)
+
+// Defaults for Options and Preferences
+const (
+	DefaultPort       = 587
+	DefaultTimeout    = 30 * time.Second
+	DefaultInterval   = time.Minute
+	DefaultExpiryDays = 30
+)
+
+var (
+	// ErrNotFound is returned for an unknown subscriber ID
+	ErrNotFound = errors.New("subscriber not found")
+	// ErrSendFailed wraps errors from the SMTP server or connecting to it
+	ErrSendFailed = errors.New("email could not be sent")
+)
+
+// Preferences choose what a subscriber's digest covers and when it is sent
+type Preferences struct {
+	// Expiring includes licenses that expire within ExpiryDays
+	Expiring   bool `json:"expiring"`
+	ExpiryDays int  `json:"expiry_days,omitempty"`
+	// Failures includes jobs that failed since the previous digest
+	Failures bool `json:"failures"`
+	// Schedule is daily or weekly. Digests are sent at Hour (UTC) and,
+	// when weekly, on Weekday (0 is Sunday).
+	Schedule string       `json:"schedule,omitempty"`
+	Hour     int          `json:"hour"`
+	Weekday  time.Weekday `json:"weekday"`
+}
+
+// Subscriber is someone receiving digests
+type Subscriber struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+	Preferences
+	// LastSentAt is when the previous scheduled digest was due
+	LastSentAt *time.Time `json:"last_sent_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ExpiringLicense is the license last imported on a host, expiring within
+// the subscriber's warning period or already expired
+type ExpiringLicense struct {
+	Server        string    `json:"server,omitempty"`
+	Host          string    `json:"host"`
+	License       string    `json:"license"`
+	LicenseSHA256 string    `json:"license_sha256,omitempty"`
+	Expires       string    `json:"expires"`
+	DaysRemaining int       `json:"days_remaining"`
+	ImportedAt    time.Time `json:"imported_at"`
+}
+
+// FailedJob is a job that failed or was interrupted
+type FailedJob struct {
+	ID         string    `json:"id"`
+	Kind       string    `json:"kind"`
+	Host       string    `json:"host"`
+	Actor      string    `json:"actor"`
+	License    string    `json:"license,omitempty"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// Digest is what one email reports
+type Digest struct {
+	Email      string            `json:"email"`
+	Name       string            `json:"name,omitempty"`
+	Since      time.Time         `json:"since"`
+	Until      time.Time         `json:"until"`
+	ExpiryDays int               `json:"expiry_days,omitempty"`
+	Expiring   []ExpiringLicense `json:"expiring"`
+	Failed     []FailedJob       `json:"failed"`
+}
+
+// Empty reports whether the digest has nothing to report
+func (d Digest) Empty() bool {
+	return len(d.Expiring) == 0 && len(d.Failed) == 0
+}
+
+// Source supplies the contents of digests
+type Source interface {
+	// ExpiringLicenses returns the licenses expiring within days of now
+	ExpiringLicenses(now time.Time, days int) ([]ExpiringLicense, error)
+	// FailedJobs returns the jobs that finished unsuccessfully in
+	// (since, until]
+	FailedJobs(since, until time.Time) ([]FailedJob, error)
+}
+
+// Options configure a Notifier; zero values take the defaults
+type Options struct {
+	// Host and Port are the SMTP server's
+	Host string
+	Port int
+	// Username and Password authenticate with PLAIN when Username is set
+	Username string
+	Password string
+	// Security is starttls (the default), tls or none
+	Security string
+	// From is the sender, an address with an optional display name
+	From string
+	// Timeout bounds sending each email
+	Timeout time.Duration
+	// Interval is how often Run looks for digests that are due
+	Interval time.Duration
+}
+
+// Notifier holds the subscribers and sends them their digests. Its state is
+// persisted as a JSON file readable only by its owner.
+type Notifier struct {
+	mu          sync.Mutex
+	path        string
+	opts        Options
+	source      Source
+	subscribers map[string]*Subscriber
+}
+
+// Open loads the subscribers at path, which need not exist yet. Digests are
+// built from source.
+func Open(path string, opts Options, source Source) (*Notifier, error) {
+	if opts.Port == 0 {
+		opts.Port = DefaultPort
+	}
+	if opts.Security == "" {
+		opts.Security = SecurityStartTLS
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create notifications directory: %v", err)
+	}
+
+	n := &Notifier{path: path, opts: opts, source: source, subscribers: make(map[string]*Subscriber)}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read subscribers: %v", err)
+	}
+	if len(data) > 0 {
+		var saved []*Subscriber
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return nil, fmt.Errorf("failed to parse subscribers %s: %v", path, err)
+		}
+		for _, s := range saved {
+			n.subscribers[s.ID] = s
+		}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.save(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Path returns the location of the subscribers file
+func (n *Notifier) Path() string {
+	return n.path
+}
+
+// Create subscribes email to digests
+func (n *Notifier) Create(email, name string, prefs Preferences) (Subscriber, error) {
+	s := &Subscriber{ID: newID(), CreatedAt: time.Now().UTC()}
+	if err := s.set(email, name, prefs); err != nil {
+		return Subscriber{}, err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.subscribers[s.ID] = s
+	if err := n.save(); err != nil {
+		delete(n.subscribers, s.ID)
+		return Subscriber{}, err
+	}
+	return *s, nil
+}
+
+// Update replaces a subscriber's address and preferences. The schedule
+// continues from the previous digest.
+func (n *Notifier) Update(id, email, name string, prefs Preferences) (Subscriber, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	s, ok := n.subscribers[id]
+	if !ok {
+		return Subscriber{}, ErrNotFound
+	}
+	updated := *s
+	if err := updated.set(email, name, prefs); err != nil {
+		return Subscriber{}, err
+	}
+	n.subscribers[id] = &updated
+	if err := n.save(); err != nil {
+		n.subscribers[id] = s
+		return Subscriber{}, err
+	}
+	return updated, nil
+}
+
+// List returns every subscriber, oldest first
+func (n *Notifier) List() []Subscriber {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	list := make([]Subscriber, 0, len(n.subscribers))
+	for _, s := range n.subscribers {
+		list = append(list, *s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
+
+// Get returns the subscriber with id
+func (n *Notifier) Get(id string) (Subscriber, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	s, ok := n.subscribers[id]
+	if !ok {
+		return Subscriber{}, ErrNotFound
+	}
+	return *s, nil
+}
+
+// Delete unsubscribes a subscriber
+func (n *Notifier) Delete(id string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	s, ok := n.subscribers[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(n.subscribers, id)
+	if err := n.save(); err != nil {
+		n.subscribers[id] = s
+		return err
+	}
+	return nil
+}
+
+// Digest builds the digest a subscriber would receive at now, covering
+// failures since their previous digest
+func (n *Notifier) Digest(id string, now time.Time) (Digest, error) {
+	s, err := n.Get(id)
+	if err != nil {
+		return Digest{}, err
+	}
+	return n.digest(s, now)
+}
+
+// Send emails a subscriber their digest now, even when it is empty, without
+// changing when their next scheduled digest is due
+func (n *Notifier) Send(id string, now time.Time) (Digest, error) {
+	digest, err := n.Digest(id, now)
+	if err != nil {
+		return Digest{}, err
+	}
+	return digest, n.send(digest, now)
+}
+
+// SendDue emails every subscriber whose scheduled digest is due at now.
+// Empty digests are skipped. A subscriber whose email could not be sent
+// stays due, so that it is retried.
+func (n *Notifier) SendDue(now time.Time) error {
+	var errs []error
+	for _, s := range n.List() {
+		slot := s.lastSlot(now)
+		if !slot.After(s.since()) {
+			continue
+		}
+		digest, err := n.digest(s, now)
+		if err == nil && !digest.Empty() {
+			err = n.send(digest, now)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("digest for %s: %w", s.Email, err))
+			continue
+		}
+		if err := n.markSent(s.ID, slot); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run sends scheduled digests until stop is closed
+func (n *Notifier) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(n.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if err := n.SendDue(now); err != nil {
+				slog.Error("sending digests", "error", err)
+			}
+		}
+	}
+}
+
+// digest builds s's digest for the period ending at now
+func (n *Notifier) digest(s Subscriber, now time.Time) (Digest, error) {
+	d := Digest{
+		Email:    s.Email,
+		Name:     s.Name,
+		Since:    s.since(),
+		Until:    now.UTC(),
+		Expiring: []ExpiringLicense{},
+		Failed:   []FailedJob{},
+	}
+	if s.Expiring {
+		d.ExpiryDays = s.ExpiryDays
+		expiring, err := n.source.ExpiringLicenses(now, s.ExpiryDays)
+		if err != nil {
+			return Digest{}, err
+		}
+		d.Expiring = append(d.Expiring, expiring...)
+	}
+	if s.Failures {
+		failed, err := n.source.FailedJobs(d.Since, d.Until)
+		if err != nil {
+			return Digest{}, err
+		}
+		d.Failed = append(d.Failed, failed...)
+	}
+	return d, nil
+}
+
+// markSent records that the digest due at slot was handled
+func (n *Notifier) markSent(id string, slot time.Time) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	s, ok := n.subscribers[id]
+	if !ok {
+		// Unsubscribed while the digest was being sent
+		return nil
+	}
+	slot = slot.UTC()
+	s.LastSentAt = &slot
+	return n.save()
+}
+
+// set validates and applies an address and preferences
+func (s *Subscriber) set(email, name string, prefs Preferences) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil {
+		return fmt.Errorf("invalid email address %q", email)
+	}
+	if name == "" {
+		name = addr.Name
+	}
+	if !prefs.Expiring && !prefs.Failures {
+		return fmt.Errorf("subscribe to expiring licenses, failures or both")
+	}
+	if prefs.ExpiryDays == 0 {
+		prefs.ExpiryDays = DefaultExpiryDays
+	}
+	if prefs.ExpiryDays < 0 {
+		return fmt.Errorf("expiry_days must not be negative")
+	}
+	if prefs.Schedule == "" {
+		prefs.Schedule = ScheduleDaily
+	}
+	if prefs.Schedule != ScheduleDaily && prefs.Schedule != ScheduleWeekly {
+		return fmt.Errorf("schedule %q must be daily or weekly", prefs.Schedule)
+	}
+	if prefs.Hour < 0 || prefs.Hour > 23 {
+		return fmt.Errorf("hour must be between 0 and 23")
+	}
+	if prefs.Weekday < time.Sunday || prefs.Weekday > time.Saturday {
+		return fmt.Errorf("weekday must be between 0 (Sunday) and 6")
+	}
+
+	s.Email = addr.Address
+	s.Name = name
+	s.Preferences = prefs
+	return nil
+}
+
+// since is the start of the period the next digest covers
+func (s Subscriber) since() time.Time {
+	if s.LastSentAt != nil {
+		return *s.LastSentAt
+	}
+	return s.CreatedAt
+}
+
+// lastSlot returns the latest time at or before now that a digest is
+// scheduled for
+func (p Preferences) lastSlot(now time.Time) time.Time {
+	now = now.UTC()
+	slot := time.Date(now.Year(), now.Month(), now.Day(), p.Hour, 0, 0, 0, time.UTC)
+	days := 1
+	if p.Schedule == ScheduleWeekly {
+		days = 7
+		slot = slot.AddDate(0, 0, -((int(now.Weekday()) - int(p.Weekday) + 7) % 7))
+	}
+	if slot.After(now) {
+		slot = slot.AddDate(0, 0, -days)
+	}
+	return slot
+}
+
+// save writes the subscribers atomically. Callers must hold n.mu.
+func (n *Notifier) save() error {
+	list := make([]*Subscriber, 0, len(n.subscribers))
+	for _, s := range n.subscribers {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode subscribers: %v", err)
+	}
+
+	tmp := n.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write subscribers: %v", err)
+	}
+	if err := os.Rename(tmp, n.path); err != nil {
+		return fmt.Errorf("failed to replace subscribers: %v", err)
+	}
+	return nil
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic("crypto/rand failed: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+// SMTP connection security
+const (
+	// SecurityStartTLS upgrades the connection with STARTTLS, failing when
+	// the server does not offer it
+	SecurityStartTLS = "starttls"
+	// SecurityTLS connects with TLS, usually on port 465
+	SecurityTLS = "tls"
+	// SecurityNone sends in the clear, for local relays and test sinks
+	SecurityNone = "none"
+)
+
+// Validate checks the SMTP settings
+func (o Options) Validate() error {
+	if o.Host == "" {
+		return fmt.Errorf("SMTP host must not be empty")
+	}
+	if o.Port < 1 || o.Port > 65535 {
+		return fmt.Errorf("SMTP port %d is out of range", o.Port)
+	}
+	switch o.Security {
+	case SecurityStartTLS, SecurityTLS, SecurityNone:
+	default:
+		return fmt.Errorf("SMTP security %q must be starttls, tls or none", o.Security)
+	}
+	if _, err := mail.ParseAddress(o.From); err != nil {
+		return fmt.Errorf("invalid sender address %q", o.From)
+	}
+	return nil
+}
+
+// send renders a digest and emails it
+func (n *Notifier) send(d Digest, now time.Time) error {
+	email, err := render(d)
+	if err != nil {
+		return err
+	}
+	to := mail.Address{Name: d.Name, Address: d.Email}
+	msg, err := n.message(to, email, now)
+	if err != nil {
+		return err
+	}
+	if err := n.deliver(to.Address, msg); err != nil {
+		return fmt.Errorf("%w: %v", ErrSendFailed, err)
+	}
+	return nil
+}
+
+// message builds a multipart/alternative message with the text and HTML
+// bodies
+func (n *Notifier) message(to mail.Address, email rendered, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	body := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", n.opts.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@license-manager>\r\n", newID())
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", body.Boundary())
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", email.Text},
+		{"text/html; charset=utf-8", email.HTML},
+	} {
+		w, err := body.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// deliver sends msg to the SMTP server for one recipient
+func (n *Notifier) deliver(to string, msg []byte) error {
+	from, err := mail.ParseAddress(n.opts.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address %q", n.opts.From)
+	}
+
+	addr := net.JoinHostPort(n.opts.Host, strconv.Itoa(n.opts.Port))
+	dialer := &net.Dialer{Timeout: n.opts.Timeout}
+	tlsConfig := &tls.Config{ServerName: n.opts.Host}
+	var conn net.Conn
+	if n.opts.Security == SecurityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server %s: %v", addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(n.opts.Timeout))
+
+	c, err := smtp.NewClient(conn, n.opts.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake with %s failed: %v", addr, err)
+	}
+	defer c.Close()
+
+	if n.opts.Security == SecurityStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP server %s does not offer STARTTLS", addr)
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS with %s failed: %v", addr, err)
+		}
+	}
+	if n.opts.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", n.opts.Username, n.opts.Password, n.opts.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %v", err)
+		}
+	}
+
+	if err := c.Mail(from.Address); err != nil {
+		return fmt.Errorf("SMTP server rejected sender: %v", err)
+	}
+	if err := c.Rcpt(to); err != nil {
+		return fmt.Errorf("SMTP server rejected recipient %s: %v", to, err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %v", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected email: %v", err)
+	}
+	return c.Quit()
+}
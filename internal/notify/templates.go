@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed templates
+var templateFiles embed.FS
+
+var templateFuncs = map[string]any{
+	"date": func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 UTC") },
+}
+
+var (
+	htmlDigest = htmltemplate.Must(htmltemplate.New("digest.html").Funcs(templateFuncs).ParseFS(templateFiles, "templates/digest.html"))
+	textDigest = texttemplate.Must(texttemplate.New("digest.txt").Funcs(templateFuncs).ParseFS(templateFiles, "templates/digest.txt"))
+)
+
+// rendered is an email ready to send
+type rendered struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// render fills the digest templates
+func render(d Digest) (rendered, error) {
+	var text, html bytes.Buffer
+	if err := textDigest.Execute(&text, d); err != nil {
+		return rendered{}, fmt.Errorf("failed to render digest: %v", err)
+	}
+	if err := htmlDigest.Execute(&html, d); err != nil {
+		return rendered{}, fmt.Errorf("failed to render digest: %v", err)
+	}
+	return rendered{Subject: subject(d), Text: text.String(), HTML: html.String()}, nil
+}
+
+// subject summarises the digest, e.g. "License Manager: 2 licenses
+// expiring, 1 failed job"
+func subject(d Digest) string {
+	if d.Empty() {
+		return "License Manager: nothing to report"
+	}
+	s := "License Manager: "
+	if n := len(d.Expiring); n > 0 {
+		s += plural(n, "license") + " expiring"
+		if len(d.Failed) > 0 {
+			s += ", "
+		}
+	}
+	if n := len(d.Failed); n > 0 {
+		s += plural(n, "failed job")
+	}
+	return s
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
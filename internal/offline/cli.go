@@ -0,0 +1,267 @@
+package offline
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"license-manager/internal/inventory"
+	"license-manager/internal/logging"
+	"license-manager/internal/services"
+)
+
+// Exit codes
+const (
+	ExitOK      = 0
+	ExitFailure = 1
+	ExitUsage   = 2
+)
+
+const usage = `Usage: license-manager offline -inventory FILE [flags] [SERVER...]
+
+Runs check, sysinfo and import directly over SSH, without the web server,
+against the servers in a local inventory file (YAML or JSON), or only the
+named ones. Sysinfo files, report.json, report.txt and an audit log are
+written to the output directory.
+
+Flags:
+`
+
+// Main runs the offline mode with args (after "offline") and returns its
+// exit code: 1 if any host failed, 2 for usage errors
+func Main(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("license-manager offline", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	inventoryPath := fs.String("inventory", "", "inventory file listing the servers (required)")
+	outputDir := fs.String("out", "", "output directory (default offline-<time>)")
+	ops := fs.String("ops", OpCheck+","+OpSysinfo, "comma-separated operations: check, sysinfo, import")
+	license := fs.String("license", "", "license file for the import operation")
+	tags := fs.String("tags", "", "only servers with one of these comma-separated tags")
+	parallel := fs.Int("parallel", DefaultParallel, "hosts to work on at once")
+	remoteTempDir := fs.String("remote-temp-dir", "/tmp/", "remote directory license files are copied to")
+	sshTimeout := fs.Duration("ssh-timeout", services.DefaultTimeout, "SSH connection timeout")
+	commandTimeout := fs.Duration("command-timeout", services.DefaultCommandTimeout, "timeout for each remote command")
+	transferTimeout := fs.Duration("transfer-timeout", services.DefaultTransferTimeout, "timeout for each file transfer")
+	logLevel := fs.String("log-level", "warn", "log level: debug, info, warn or error")
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	fail := func(code int, format string, args ...any) int {
+		fmt.Fprintf(stderr, "offline: "+format+"\n", args...)
+		return code
+	}
+	if *inventoryPath == "" {
+		fs.Usage()
+		return ExitUsage
+	}
+	if !strings.HasPrefix(*remoteTempDir, "/") {
+		return fail(ExitUsage, "-remote-temp-dir must be an absolute path")
+	}
+
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		return fail(ExitUsage, "%v", err)
+	}
+	logger, err := logging.New(stderr, logging.Options{Level: level, Format: logging.FormatText})
+	if err != nil {
+		return fail(ExitUsage, "%v", err)
+	}
+
+	servers, err := inventory.Load(*inventoryPath)
+	if err != nil {
+		return fail(ExitUsage, "%v", err)
+	}
+	servers, err = selectServers(servers, fs.Args(), splitList(*tags))
+	if err != nil {
+		return fail(ExitUsage, "%v", err)
+	}
+
+	opts := Options{
+		Servers:         servers,
+		Operations:      splitList(*ops),
+		License:         *license,
+		OutputDir:       *outputDir,
+		Parallel:        *parallel,
+		RemoteTempDir:   *remoteTempDir,
+		SSHTimeout:      *sshTimeout,
+		CommandTimeout:  *commandTimeout,
+		TransferTimeout: *transferTimeout,
+		Actor:           "offline:" + currentUser(),
+		Logger:          logger,
+	}
+	if opts.OutputDir == "" {
+		opts.OutputDir = "offline-" + time.Now().Format("20060102-150405")
+	}
+	if err := opts.Validate(); err != nil {
+		return fail(ExitUsage, "%v", err)
+	}
+
+	report, err := Run(ctx, opts)
+	if err != nil {
+		return fail(ExitFailure, "%v", err)
+	}
+	if err := WriteReport(opts.OutputDir, report); err != nil {
+		return fail(ExitFailure, "%v", err)
+	}
+
+	writeSummary(stdout, report)
+	fmt.Fprintf(stdout, "\nResults written to %s\n", opts.OutputDir)
+	if report.Failed > 0 {
+		return ExitFailure
+	}
+	return ExitOK
+}
+
+// WriteReport writes report.json and report.txt to dir
+func WriteReport(dir string, report *Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ReportJSON), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write report: %v", err)
+	}
+
+	f, err := os.Create(filepath.Join(dir, ReportText))
+	if err != nil {
+		return fmt.Errorf("failed to write report: %v", err)
+	}
+	defer f.Close()
+
+	fmt.Fprintf(f, "License Manager offline run by %s\n", report.Actor)
+	fmt.Fprintf(f, "Started:    %s\n", report.StartedAt.Format(time.RFC3339))
+	fmt.Fprintf(f, "Finished:   %s\n", report.FinishedAt.Format(time.RFC3339))
+	fmt.Fprintf(f, "Operations: %s\n", strings.Join(report.Operations, ", "))
+	if report.License != "" {
+		fmt.Fprintf(f, "License:    %s (sha256 %s)\n", report.License, report.LicenseSHA256)
+	}
+	fmt.Fprintln(f)
+	writeSummary(f, report)
+
+	for _, host := range report.Hosts {
+		fmt.Fprintf(f, "\n== %s (%s): %s\n", host.Server, host.Host, host.Status)
+		for _, step := range host.Steps {
+			fmt.Fprintf(f, "\n-- %s: %s", step.Operation, step.Status)
+			if step.Message != "" {
+				fmt.Fprintf(f, ": %s", step.Message)
+			}
+			fmt.Fprintln(f)
+			if step.Command != "" {
+				fmt.Fprintf(f, "$ %s (exit status %d)\n", step.Command, step.ExitStatus)
+			}
+			if step.Output != "" {
+				fmt.Fprintln(f, strings.TrimRight(step.Output, "\n"))
+			}
+		}
+	}
+	return f.Close()
+}
+
+// writeSummary writes a table with a row per host
+func writeSummary(w io.Writer, report *Report) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVER\tHOST\tSTATUS\tDETAIL")
+	for _, host := range report.Hosts {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", host.Server, host.Host, host.Status, hostDetail(host))
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\n%d succeeded, %d failed\n", report.Succeeded, report.Failed)
+}
+
+// hostDetail is the first failure on a host, or the files it produced
+func hostDetail(host HostReport) string {
+	var files []string
+	for _, step := range host.Steps {
+		if step.Status == StatusFailure && step.Operation != StepVerify {
+			return step.Operation + ": " + firstLine(step.Message)
+		}
+		if step.File != "" {
+			files = append(files, step.File)
+		}
+	}
+	if len(files) == 0 {
+		return "-"
+	}
+	return strings.Join(files, ", ")
+}
+
+// selectServers keeps the named servers, or those with one of tags; with
+// neither every server is kept
+func selectServers(servers []inventory.Server, names, tags []string) ([]inventory.Server, error) {
+	if len(names) > 0 {
+		byName := make(map[string]inventory.Server, len(servers))
+		for _, server := range servers {
+			byName[server.Name] = server
+		}
+		selected := make([]inventory.Server, 0, len(names))
+		for _, name := range names {
+			server, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", inventory.ErrNotFound, name)
+			}
+			selected = append(selected, server)
+		}
+		servers = selected
+	}
+
+	if len(tags) > 0 {
+		var selected []inventory.Server
+		for _, server := range servers {
+			if hasAnyTag(server, tags) {
+				selected = append(selected, server)
+			}
+		}
+		servers = selected
+	}
+
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no servers selected")
+	}
+	return servers, nil
+}
+
+func hasAnyTag(server inventory.Server, tags []string) bool {
+	for _, have := range server.Tags {
+		for _, want := range tags {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return "unknown"
+}
@@ -0,0 +1,404 @@
+// Package offline runs license operations directly over SSH from the command
+// line, for networks where the web service cannot be deployed. Results and a
+// report are written to a local directory.
+package offline
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"license-manager/internal/audit"
+	"license-manager/internal/inventory"
+	"license-manager/internal/services"
+)
+
+// Operations, run on each host in this order
+const (
+	OpCheck   = "check"
+	OpSysinfo = "sysinfo"
+	OpImport  = "import"
+)
+
+// Steps that are reported but not requested directly
+const (
+	StepConnect = "connect"
+	StepVerify  = "verify"
+)
+
+// Step and host statuses
+const (
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+	StatusSkipped = "skipped"
+)
+
+// DefaultParallel is how many hosts are worked on at once
+const DefaultParallel = 4
+
+// Report file names in the output directory
+const (
+	ReportJSON = "report.json"
+	ReportText = "report.txt"
+	AuditLog   = "audit.log"
+)
+
+// Options configures an offline run
+type Options struct {
+	Servers    []inventory.Server
+	Operations []string
+	// License is the local license file to import
+	License string
+	// OutputDir receives a directory of sysinfo files per server, the
+	// report and an audit log of every remote command
+	OutputDir string
+	Parallel  int
+
+	RemoteTempDir   string
+	SSHTimeout      time.Duration
+	CommandTimeout  time.Duration
+	TransferTimeout time.Duration
+
+	// Actor identifies the operator in the audit log
+	Actor  string
+	Logger *slog.Logger
+}
+
+// Step is the outcome of one operation on one host
+type Step struct {
+	Operation string `json:"operation"`
+	Status    string `json:"status"`
+	Message   string `json:"message,omitempty"`
+	// File is the path of a downloaded file, relative to the output directory
+	File       string `json:"file,omitempty"`
+	Command    string `json:"command,omitempty"`
+	Output     string `json:"output,omitempty"`
+	ExitStatus int    `json:"exit_status,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// HostReport is the outcome of every operation on one host. Status is
+// failure if any step failed.
+type HostReport struct {
+	Server     string `json:"server"`
+	Host       string `json:"host"`
+	Status     string `json:"status"`
+	Steps      []Step `json:"steps"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Report is the outcome of an offline run
+type Report struct {
+	StartedAt     time.Time    `json:"started_at"`
+	FinishedAt    time.Time    `json:"finished_at"`
+	Actor         string       `json:"actor"`
+	Operations    []string     `json:"operations"`
+	License       string       `json:"license,omitempty"`
+	LicenseSHA256 string       `json:"license_sha256,omitempty"`
+	Hosts         []HostReport `json:"hosts"`
+	Succeeded     int          `json:"succeeded"`
+	Failed        int          `json:"failed"`
+}
+
+// Validate checks the operations and the license file
+func (o Options) Validate() error {
+	if len(o.Operations) == 0 {
+		return fmt.Errorf("no operations given")
+	}
+	for _, op := range o.Operations {
+		switch op {
+		case OpCheck, OpSysinfo:
+		case OpImport:
+			if o.License == "" {
+				return fmt.Errorf("the import operation needs a license file")
+			}
+			if _, err := os.Stat(o.License); err != nil {
+				return fmt.Errorf("license file: %v", err)
+			}
+		default:
+			return fmt.Errorf("unknown operation %q, use %s, %s or %s", op, OpCheck, OpSysinfo, OpImport)
+		}
+	}
+	if o.OutputDir == "" {
+		return fmt.Errorf("no output directory given")
+	}
+	return nil
+}
+
+func (o Options) has(op string) bool {
+	for _, want := range o.Operations {
+		if want == op {
+			return true
+		}
+	}
+	return false
+}
+
+// Run performs the operations on every server, up to Parallel at a time, and
+// returns the report. Failures on a host are recorded in its report; the
+// error is only for problems that stop the run from starting.
+func Run(ctx context.Context, opts Options) (*Report, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.Parallel <= 0 {
+		opts.Parallel = DefaultParallel
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+
+	if err := os.MkdirAll(opts.OutputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %v", err)
+	}
+	auditLog, err := audit.Open(filepath.Join(opts.OutputDir, AuditLog))
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		StartedAt:  time.Now().UTC(),
+		Actor:      opts.Actor,
+		Operations: opts.Operations,
+		Hosts:      make([]HostReport, len(opts.Servers)),
+	}
+	if opts.has(OpImport) {
+		report.License = filepath.Base(opts.License)
+		if report.LicenseSHA256, err = fileSHA256(opts.License); err != nil {
+			return nil, err
+		}
+	}
+
+	sem := make(chan struct{}, opts.Parallel)
+	var wg sync.WaitGroup
+	for i, server := range opts.Servers {
+		wg.Add(1)
+		go func(i int, server inventory.Server) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			run := &hostRun{opts: opts, server: server, auditLog: auditLog, licenseSHA256: report.LicenseSHA256}
+			report.Hosts[i] = run.run(ctx)
+		}(i, server)
+	}
+	wg.Wait()
+
+	for _, host := range report.Hosts {
+		if host.Status == StatusSuccess {
+			report.Succeeded++
+		} else {
+			report.Failed++
+		}
+	}
+	report.FinishedAt = time.Now().UTC()
+	return report, nil
+}
+
+// hostRun performs the operations on one server
+type hostRun struct {
+	opts          Options
+	server        inventory.Server
+	auditLog      *audit.Log
+	licenseSHA256 string
+	ssh           *services.SSHService
+	report        HostReport
+}
+
+func (h *hostRun) run(ctx context.Context) HostReport {
+	started := time.Now()
+	h.report = HostReport{
+		Server: h.server.Name,
+		Host:   net.JoinHostPort(h.server.Host, h.server.Port),
+		Status: StatusSuccess,
+		Steps:  []Step{},
+	}
+	defer func() { h.report.DurationMS = time.Since(started).Milliseconds() }()
+
+	logger := h.opts.Logger.With("server", h.server.Name, "host", h.report.Host)
+	h.ssh = services.NewSSHService(&services.SSHConfig{
+		Host:            h.server.Host,
+		Port:            h.server.Port,
+		Username:        h.server.Username,
+		Password:        h.server.Password,
+		Timeout:         h.opts.SSHTimeout,
+		CommandTimeout:  h.opts.CommandTimeout,
+		TransferTimeout: h.opts.TransferTimeout,
+		Escalation:      h.server.Escalation(),
+	})
+	h.ssh.SetAudit(h.auditLog, h.opts.Actor)
+	h.ssh.SetLogger(logger)
+	defer h.ssh.Close()
+
+	if !h.step(StepConnect, func(s *Step) error { return h.ssh.Connect(ctx) }) {
+		h.skip(OpCheck, OpSysinfo, OpImport)
+		return h.report
+	}
+
+	// Every operation needs license2_cli; without it the rest are skipped
+	found := false
+	h.step(OpCheck, func(s *Step) error {
+		exists, err := h.ssh.CheckLicenseCLI(ctx)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("license2_cli not found on server")
+		}
+		found = true
+		s.Message = "license2_cli found"
+		return nil
+	})
+	if !found {
+		h.skip(OpSysinfo, OpImport)
+		return h.report
+	}
+
+	if h.opts.has(OpSysinfo) {
+		h.step(OpSysinfo, func(s *Step) error { return h.sysinfo(ctx, s) })
+	}
+	if h.opts.has(OpImport) && h.step(OpImport, func(s *Step) error { return h.importLicense(ctx, s) }) {
+		h.step(StepVerify, func(s *Step) error {
+			s.Command = "license2_cli check"
+			result, err := h.ssh.ExecuteCommand(ctx, s.Command)
+			setResult(s, result)
+			return err
+		})
+	}
+	return h.report
+}
+
+// step runs fn and records its outcome, reporting whether it succeeded.
+// The check step is always run but only reported when it was requested or
+// failed. As in the web UI, a failed verify after a successful import is
+// reported without failing the host.
+func (h *hostRun) step(op string, fn func(s *Step) error) bool {
+	started := time.Now()
+	s := Step{Operation: op, Status: StatusSuccess}
+	err := fn(&s)
+	s.DurationMS = time.Since(started).Milliseconds()
+	if err != nil {
+		s.Status = StatusFailure
+		s.Message = err.Error()
+		if op != StepVerify {
+			h.report.Status = StatusFailure
+		}
+	}
+
+	if op != OpCheck || err != nil || h.opts.has(OpCheck) {
+		h.report.Steps = append(h.report.Steps, s)
+		h.audit(s, started, err)
+	}
+	return err == nil
+}
+
+// skip reports the requested operations among ops as skipped
+func (h *hostRun) skip(ops ...string) {
+	for _, op := range ops {
+		if h.opts.has(op) {
+			h.report.Steps = append(h.report.Steps, Step{Operation: op, Status: StatusSkipped, Message: "skipped after an earlier failure"})
+		}
+	}
+}
+
+// sysinfo generates a sysinfo file and downloads it to the server's
+// directory in the output directory
+func (h *hostRun) sysinfo(ctx context.Context, s *Step) error {
+	remote, err := h.ssh.GenerateSysinfoFile(ctx)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(h.opts.OutputDir, h.server.Name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", dir, err)
+	}
+	name := path.Base(remote)
+	if err := h.ssh.DownloadFile(ctx, remote, filepath.Join(dir, name)); err != nil {
+		return err
+	}
+	s.File = filepath.Join(h.server.Name, name)
+	s.Message = "downloaded " + remote
+	return nil
+}
+
+// importLicense uploads the license, imports it and removes the upload
+func (h *hostRun) importLicense(ctx context.Context, s *Step) error {
+	remote := path.Join(h.opts.RemoteTempDir, filepath.Base(h.opts.License))
+	if err := h.ssh.UploadFile(ctx, h.opts.License, remote); err != nil {
+		return fmt.Errorf("failed to upload license file: %w", err)
+	}
+	defer h.ssh.ExecuteCommand(ctx, "rm -f "+services.ShellQuote(remote))
+
+	s.Command = "license2_cli import -l " + services.ShellQuote(remote)
+	result, err := h.ssh.ExecuteCommand(ctx, s.Command)
+	setResult(s, result)
+	return err
+}
+
+// audit records an operation in the run's audit log, alongside the records
+// the SSH service writes for the connection and each remote command
+func (h *hostRun) audit(s Step, started time.Time, err error) {
+	action := map[string]string{
+		OpCheck:   audit.ActionCheckLicenseCLI,
+		OpSysinfo: audit.ActionDownloadSysinfo,
+		OpImport:  audit.ActionUploadLicense,
+	}[s.Operation]
+	if action == "" {
+		return
+	}
+
+	rec := audit.Record{
+		Time:       started,
+		Actor:      h.opts.Actor,
+		Action:     action,
+		Host:       h.report.Host,
+		Server:     h.server.Name,
+		RemoteUser: h.server.Username,
+		Outcome:    audit.OutcomeSuccess,
+		DurationMS: s.DurationMS,
+	}
+	if s.Operation == OpImport {
+		rec.LicenseFile = filepath.Base(h.opts.License)
+		rec.LicenseSHA256 = h.licenseSHA256
+	}
+	if err != nil {
+		rec.Outcome = audit.OutcomeFailure
+		rec.ExitStatus = -1
+		rec.Error = err.Error()
+	}
+	if err := h.auditLog.Append(rec); err != nil {
+		h.opts.Logger.Error("writing audit record", "error", err)
+	}
+}
+
+func setResult(s *Step, result *services.CommandResult) {
+	if result == nil {
+		return
+	}
+	s.Output = result.Output()
+	s.ExitStatus = result.ExitStatus
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open license file: %v", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read license file: %v", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,335 @@
+// Package openapi generates an OpenAPI 3 document from the route table that
+// also registers the routes, so the document cannot drift from the handlers.
+// Schemas are derived from the Go types of request and response bodies.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Version is the OpenAPI version of generated documents
+const Version = "3.0.3"
+
+// Content types
+const (
+	JSON      = "application/json"
+	Multipart = "multipart/form-data"
+	Binary    = "application/octet-stream"
+)
+
+// Info describes the API
+type Info struct {
+	Title       string
+	Version     string
+	Description string
+}
+
+// Operation is one route: its handler and its documentation
+type Operation struct {
+	Method      string
+	Path        string // gin syntax: /servers/:name
+	ID          string
+	Summary     string
+	Description string
+	Tags        []string
+	Query       []Param
+	// Request is a value of the JSON request body type, or nil
+	Request any
+	// Form describes a multipart/form-data request body instead
+	Form      []FormField
+	Responses []Response
+	Handler   gin.HandlerFunc
+}
+
+// Param is a query parameter
+type Param struct {
+	Name        string
+	Description string
+	Type        string // "string" or "integer"
+	Required    bool
+}
+
+// FormField is a multipart/form-data field
+type FormField struct {
+	Name        string
+	Description string
+	File        bool
+	Required    bool
+}
+
+// Response is one documented response
+type Response struct {
+	Status      int
+	Description string
+	// Body is a value of the response body type, or nil for no body
+	Body any
+	// ContentType defaults to JSON; Binary documents a file download
+	ContentType string
+}
+
+// Document builds the OpenAPI document for ops served under basePath
+func Document(info Info, basePath string, ops []Operation) map[string]any {
+	g := &generator{schemas: map[string]any{}, names: map[string]reflect.Type{}}
+
+	paths := map[string]any{}
+	for _, op := range ops {
+		path, params := convertPath(op.Path)
+		item, ok := paths[path].(map[string]any)
+		if !ok {
+			item = map[string]any{}
+			paths[path] = item
+		}
+		item[strings.ToLower(op.Method)] = g.operation(op, params)
+	}
+
+	doc := map[string]any{
+		"openapi": Version,
+		"info": map[string]any{
+			"title":       info.Title,
+			"version":     info.Version,
+			"description": info.Description,
+		},
+		"servers": []any{map[string]any{"url": basePath}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []any{map[string]any{"bearer": []any{}}},
+	}
+	return doc
+}
+
+// convertPath turns gin's :param segments into {param} and returns the
+// parameter names
+func convertPath(path string) (string, []string) {
+	var params []string
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			params = append(params, name)
+			segments[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+type generator struct {
+	schemas map[string]any
+	names   map[string]reflect.Type
+}
+
+func (g *generator) operation(op Operation, pathParams []string) map[string]any {
+	out := map[string]any{
+		"operationId": op.ID,
+		"summary":     op.Summary,
+	}
+	if op.Description != "" {
+		out["description"] = op.Description
+	}
+	if len(op.Tags) > 0 {
+		out["tags"] = op.Tags
+	}
+
+	var params []any
+	for _, name := range pathParams {
+		params = append(params, map[string]any{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]any{"type": "string"},
+		})
+	}
+	for _, p := range op.Query {
+		param := map[string]any{
+			"name":   p.Name,
+			"in":     "query",
+			"schema": map[string]any{"type": p.Type},
+		}
+		if p.Description != "" {
+			param["description"] = p.Description
+		}
+		if p.Required {
+			param["required"] = true
+		}
+		params = append(params, param)
+	}
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+
+	switch {
+	case op.Request != nil:
+		out["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{JSON: map[string]any{"schema": g.schema(reflect.TypeOf(op.Request))}},
+		}
+	case len(op.Form) > 0:
+		out["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{Multipart: map[string]any{"schema": formSchema(op.Form)}},
+		}
+	}
+
+	responses := map[string]any{}
+	for _, r := range op.Responses {
+		description := r.Description
+		if description == "" {
+			description = http.StatusText(r.Status)
+		}
+		resp := map[string]any{"description": description}
+		switch {
+		case r.ContentType == Binary:
+			resp["content"] = map[string]any{Binary: map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}}
+		case r.Body != nil:
+			resp["content"] = map[string]any{JSON: map[string]any{"schema": g.schema(reflect.TypeOf(r.Body))}}
+		}
+		responses[fmt.Sprint(r.Status)] = resp
+	}
+	out["responses"] = responses
+	return out
+}
+
+func formSchema(fields []FormField) map[string]any {
+	properties := map[string]any{}
+	var required []string
+	for _, f := range fields {
+		prop := map[string]any{"type": "string"}
+		if f.File {
+			prop["format"] = "binary"
+		}
+		if f.Description != "" {
+			prop["description"] = f.Description
+		}
+		properties[f.Name] = prop
+		if f.Required {
+			required = append(required, f.Name)
+		}
+	}
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	// rawType is embedded JSON, which may be any value
+	rawType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schema returns the schema for t; named structs become components
+// referenced with $ref
+func (g *generator) schema(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := g.schema(t.Elem())
+		return map[string]any{"allOf": []any{s}, "nullable": true}
+	case reflect.Struct:
+		if t == timeType {
+			return map[string]any{"type": "string", "format": "date-time"}
+		}
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := schemaName(t)
+		if existing, ok := g.names[name]; ok && existing != t {
+			panic(fmt.Sprintf("openapi: schema name %s is used by %v and %v", name, existing, t))
+		}
+		if _, ok := g.schemas[name]; !ok {
+			g.names[name] = t
+			g.schemas[name] = map[string]any{} // placeholder for recursive types
+			g.schemas[name] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	case reflect.Slice, reflect.Array:
+		if t == rawType {
+			return map[string]any{}
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	}
+	return map[string]any{}
+}
+
+// object returns the schema of a struct as encoding/json would encode it.
+// Fields without omitempty are required.
+func (g *generator) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	var required []string
+	g.fields(t, properties, &required)
+	sort.Strings(required)
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (g *generator) fields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		// Embedded structs without a name are flattened, as encoding/json does
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.fields(f.Type, properties, required)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		properties[name] = g.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// schemaName names a component after its Go type; Page[T] becomes TPage
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	base, arg, generic := strings.Cut(name, "[")
+	if !generic {
+		return name
+	}
+	arg = strings.TrimSuffix(arg, "]")
+	if i := strings.LastIndex(arg, "."); i >= 0 {
+		arg = arg[i+1:]
+	}
+	return arg + base
+}
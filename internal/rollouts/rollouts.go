@@ -0,0 +1,856 @@
+// Package rollouts holds license imports for maintenance windows. A rollout
+// imports one license file on a list of inventory servers during a window
+// that opens once or repeats daily or weekly. Hosts the window closes on
+// before they are reached are reported as missed; with a repeating window
+// they are retried in the next one. A staged rollout imports on a canary
+// subset first and then in waves, and halts for an operator to resume or
+// abort it once too many imports have failed.
+package rollouts
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Rollout statuses
+const (
+	StatusScheduled = "scheduled"
+	StatusRunning   = "running"
+	StatusHalted    = "halted"
+	StatusCompleted = "completed"
+	StatusCancelled = "cancelled"
+	StatusAborted   = "aborted"
+)
+
+// Target statuses
+const (
+	TargetPending   = "pending"
+	TargetRunning   = "running"
+	TargetSucceeded = "succeeded"
+	TargetFailed    = "failed"
+	TargetMissed    = "missed"
+	TargetSkipped   = "skipped"
+)
+
+// Window repeats; an empty repeat is a single window
+const (
+	RepeatDaily  = "daily"
+	RepeatWeekly = "weekly"
+)
+
+// Defaults for Schedule and Options
+const (
+	DefaultWindowMinutes = 60
+	DefaultInterval      = 30 * time.Second
+)
+
+var (
+	// ErrNotFound is returned for an unknown rollout ID
+	ErrNotFound = errors.New("rollout not found")
+	// ErrStarted is returned when cancelling a rollout that is no longer
+	// waiting for its window
+	ErrStarted = errors.New("rollout is no longer scheduled")
+	// ErrNotHalted is returned when resuming a rollout that is not halted
+	ErrNotHalted = errors.New("rollout is not halted")
+	// ErrFinished is returned when aborting a rollout that has finished
+	ErrFinished = errors.New("rollout has finished")
+	// ErrWindowClosed is returned when resuming a rollout that does not
+	// repeat after its window has closed
+	ErrWindowClosed = errors.New("rollout window has closed")
+	// ErrUnavailable is returned by Runner.Import when imports cannot start,
+	// such as while the server shuts down. The host is tried again the next
+	// time the rollout runs.
+	ErrUnavailable = errors.New("imports are unavailable")
+)
+
+// Schedule is when a rollout may run: a window of WindowMinutes from
+// StartAt, repeated every 24 hours or 7 days when Repeat is set
+type Schedule struct {
+	StartAt       time.Time `json:"start_at"`
+	WindowMinutes int       `json:"window_minutes"`
+	Repeat        string    `json:"repeat,omitempty"`
+}
+
+// Validate checks the window fits within its repeat period
+func (s Schedule) Validate() error {
+	if s.StartAt.IsZero() {
+		return fmt.Errorf("start_at is required")
+	}
+	if s.WindowMinutes <= 0 {
+		return fmt.Errorf("window_minutes must be positive")
+	}
+	switch s.Repeat {
+	case "", RepeatDaily, RepeatWeekly:
+	default:
+		return fmt.Errorf("repeat %q must be daily or weekly", s.Repeat)
+	}
+	if p := s.period(); p > 0 && s.length() > p {
+		return fmt.Errorf("a %s window must be no longer than %v", s.Repeat, p)
+	}
+	return nil
+}
+
+// period is the time between windows, zero for a single window
+func (s Schedule) period() time.Duration {
+	switch s.Repeat {
+	case RepeatDaily:
+		return 24 * time.Hour
+	case RepeatWeekly:
+		return 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+func (s Schedule) length() time.Duration {
+	return time.Duration(s.WindowMinutes) * time.Minute
+}
+
+// window returns the latest window to open at or before now, and false
+// when the first window has not opened yet
+func (s Schedule) window(now time.Time) (start, end time.Time, ok bool) {
+	if now.Before(s.StartAt) {
+		return time.Time{}, time.Time{}, false
+	}
+	start = s.StartAt
+	if p := s.period(); p > 0 {
+		start = start.Add(now.Sub(start) / p * p)
+	}
+	return start, start.Add(s.length()), true
+}
+
+// Strategy stages a rollout: the first Canary servers are imported on
+// first, then the rest in waves of WaveSize servers, with each wave's
+// servers imported in parallel. After each wave that leaves servers to
+// import on, the rollout halts if more than MaxFailurePercent of that
+// wave's imports failed. The zero Strategy imports on one server at a
+// time and never halts.
+type Strategy struct {
+	Canary            int `json:"canary,omitempty"`
+	WaveSize          int `json:"wave_size,omitempty"`
+	MaxFailurePercent int `json:"max_failure_percent,omitempty"`
+}
+
+// Staged reports whether the strategy imports in waves
+func (s Strategy) Staged() bool {
+	return s.Canary > 0 || s.WaveSize > 0
+}
+
+// Validate checks the strategy's sizes and threshold
+func (s Strategy) Validate() error {
+	if s.Canary < 0 || s.WaveSize < 0 {
+		return fmt.Errorf("canary and wave_size must not be negative")
+	}
+	if s.MaxFailurePercent < 0 || s.MaxFailurePercent > 100 {
+		return fmt.Errorf("max_failure_percent must be between 0 and 100")
+	}
+	if !s.Staged() && s.MaxFailurePercent != 0 {
+		return fmt.Errorf("max_failure_percent needs canary or wave_size")
+	}
+	return nil
+}
+
+// wave returns the wave of the i'th server: 1 for the canary servers, or
+// for the first wave when there are none. Without waves it is 0.
+func (s Strategy) wave(i int) int {
+	if !s.Staged() {
+		return 0
+	}
+	first := 1
+	if s.Canary > 0 {
+		if i < s.Canary {
+			return 1
+		}
+		i -= s.Canary
+		first = 2
+	}
+	if s.WaveSize == 0 {
+		return first
+	}
+	return first + i/s.WaveSize
+}
+
+// Target is one server a rollout imports the license on
+type Target struct {
+	Server string `json:"server"`
+	Status string `json:"status"`
+	// Wave is the wave the server is imported in by a staged rollout
+	Wave  int    `json:"wave,omitempty"`
+	JobID string `json:"job_id,omitempty"`
+	Error string `json:"error,omitempty"`
+	// Window is the start of the window the host was last attempted or
+	// missed in
+	Window     *time.Time `json:"window,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Rollout imports License on each target during its schedule's windows
+type Rollout struct {
+	ID            string `json:"id"`
+	Name          string `json:"name,omitempty"`
+	Actor         string `json:"actor"`
+	License       string `json:"license"`
+	LicenseSHA256 string `json:"license_sha256"`
+	Schedule
+	Strategy
+	Status string `json:"status"`
+	// HaltReason is why a halted rollout stopped
+	HaltReason string   `json:"halt_reason,omitempty"`
+	Targets    []Target `json:"targets"`
+	// NextWindowAt is when the next window the rollout runs in opens, while
+	// it is scheduled
+	NextWindowAt *time.Time `json:"next_window_at,omitempty"`
+	// LastWindowAt is the start of the last window the rollout finished or
+	// missed
+	LastWindowAt *time.Time `json:"last_window_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+}
+
+// Missed returns the servers that missed the rollout's last window
+func (r Rollout) Missed() []string {
+	missed := []string{}
+	for _, t := range r.Targets {
+		if t.Status == TargetMissed {
+			missed = append(missed, t.Server)
+		}
+	}
+	return missed
+}
+
+// Runner imports licenses for the scheduler and hears about missed hosts
+type Runner interface {
+	// Import imports r's license on server and returns the job ID
+	Import(ctx context.Context, r Rollout, server string, license []byte) (string, error)
+	// Missed reports the servers r's window closed on before they were
+	// reached
+	Missed(r Rollout, window time.Time, servers []string)
+	// Halted reports that staged rollout r halted after a wave, with
+	// HaltReason set
+	Halted(r Rollout)
+}
+
+// Options configure a Scheduler; zero values take the defaults
+type Options struct {
+	// Interval is how often windows are checked for opening
+	Interval time.Duration
+}
+
+// stored is a rollout as persisted, with the license file's contents
+type stored struct {
+	Rollout
+	Data []byte `json:"license_data"`
+}
+
+// Scheduler holds rollouts until their window opens and runs them. They
+// are persisted, with their license files, as a JSON file readable only by
+// its owner.
+type Scheduler struct {
+	mu       sync.Mutex
+	path     string
+	opts     Options
+	runner   Runner
+	rollouts map[string]*stored
+}
+
+// Open loads the rollouts at path, which need not exist yet. Hosts whose
+// import was cut off when the previous process stopped are marked failed,
+// and their rollouts resume if the window is still open. Halted rollouts
+// stay halted.
+func Open(path string, opts Options, runner Runner) (*Scheduler, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create rollouts directory: %v", err)
+	}
+
+	s := &Scheduler{path: path, opts: opts, runner: runner, rollouts: make(map[string]*stored)}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read rollouts: %v", err)
+	}
+	if len(data) > 0 {
+		var saved []*stored
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return nil, fmt.Errorf("failed to parse rollouts %s: %v", path, err)
+		}
+		for _, r := range saved {
+			if r.Status == StatusRunning {
+				r.Status = StatusScheduled
+			}
+			for i := range r.Targets {
+				if t := &r.Targets[i]; t.Status == TargetRunning {
+					finish(t, errors.New("process stopped before the import finished"))
+				}
+			}
+			s.rollouts[r.ID] = r
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Path returns the location of the rollouts file
+func (s *Scheduler) Path() string {
+	return s.path
+}
+
+// Create schedules license, named filename, to be imported on servers, in
+// that order, on behalf of actor
+func (s *Scheduler) Create(name, actor, filename string, license []byte, servers []string, schedule Schedule, strategy Strategy) (Rollout, error) {
+	if filename == "" {
+		return Rollout{}, fmt.Errorf("a license file name is required")
+	}
+	if len(license) == 0 {
+		return Rollout{}, fmt.Errorf("the license file is empty")
+	}
+	if len(servers) == 0 {
+		return Rollout{}, fmt.Errorf("at least one server is required")
+	}
+	if schedule.WindowMinutes == 0 {
+		schedule.WindowMinutes = DefaultWindowMinutes
+	}
+	if err := schedule.Validate(); err != nil {
+		return Rollout{}, err
+	}
+	if err := strategy.Validate(); err != nil {
+		return Rollout{}, err
+	}
+	schedule.StartAt = schedule.StartAt.UTC()
+	now := time.Now().UTC()
+	if schedule.Repeat == "" && !now.Before(schedule.StartAt.Add(schedule.length())) {
+		return Rollout{}, fmt.Errorf("the window has already closed")
+	}
+
+	targets := make([]Target, 0, len(servers))
+	seen := make(map[string]bool)
+	for _, server := range servers {
+		if server == "" || seen[server] {
+			return Rollout{}, fmt.Errorf("servers must be unique and not empty")
+		}
+		seen[server] = true
+		targets = append(targets, Target{Server: server, Status: TargetPending, Wave: strategy.wave(len(targets))})
+	}
+
+	sum := sha256.Sum256(license)
+	r := &stored{
+		Rollout: Rollout{
+			ID:            newID(),
+			Name:          name,
+			Actor:         actor,
+			License:       filename,
+			LicenseSHA256: hex.EncodeToString(sum[:]),
+			Schedule:      schedule,
+			Strategy:      strategy,
+			Status:        StatusScheduled,
+			Targets:       targets,
+			CreatedAt:     now,
+		},
+		Data: append([]byte{}, license...),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rollouts[r.ID] = r
+	if err := s.save(); err != nil {
+		delete(s.rollouts, r.ID)
+		return Rollout{}, err
+	}
+	return r.view(now), nil
+}
+
+// List returns copies of the rollouts with the given status (or all
+// rollouts when status is empty), newest first
+func (s *Scheduler) List(status string) []Rollout {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	list := []Rollout{}
+	for _, r := range s.rollouts {
+		if status == "" || r.Status == status {
+			list = append(list, r.view(now))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list
+}
+
+// Get returns a copy of the rollout with the given ID
+func (s *Scheduler) Get(id string) (Rollout, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.rollouts[id]
+	if !ok {
+		return Rollout{}, ErrNotFound
+	}
+	return r.view(time.Now()), nil
+}
+
+// Cancel stops a rollout that is waiting for a window. A running rollout
+// cannot be cancelled.
+func (s *Scheduler) Cancel(id string) (Rollout, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.rollouts[id]
+	if !ok {
+		return Rollout{}, ErrNotFound
+	}
+	if r.Status != StatusScheduled {
+		return Rollout{}, fmt.Errorf("%w: it is %s", ErrStarted, r.Status)
+	}
+	now := time.Now().UTC()
+	r.Status = StatusCancelled
+	r.FinishedAt = &now
+	if err := s.save(); err != nil {
+		r.Status, r.FinishedAt = StatusScheduled, nil
+		return Rollout{}, err
+	}
+	return r.view(now), nil
+}
+
+// Resume continues a halted rollout with its next wave: in the current
+// window if it is still open, otherwise in the next one. A rollout that
+// does not repeat has no next window, so it cannot be resumed once its
+// window has closed; abort it and schedule a new one instead.
+func (s *Scheduler) Resume(id string) (Rollout, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.rollouts[id]
+	if !ok {
+		return Rollout{}, ErrNotFound
+	}
+	if r.Status != StatusHalted {
+		return Rollout{}, fmt.Errorf("%w: it is %s", ErrNotHalted, r.Status)
+	}
+	now := time.Now()
+	if _, end, ok := r.window(now); ok && r.Repeat == "" && !now.Before(end) {
+		return Rollout{}, fmt.Errorf("%w at %s and it does not repeat", ErrWindowClosed, end.Format(time.RFC3339))
+	}
+	reason := r.HaltReason
+	r.Status, r.HaltReason = StatusScheduled, ""
+	if err := s.save(); err != nil {
+		r.Status, r.HaltReason = StatusHalted, reason
+		return Rollout{}, err
+	}
+	return r.view(now), nil
+}
+
+// Abort stops a rollout that has not finished, whether it is waiting for a
+// window, running or halted. Servers not yet imported on are skipped;
+// imports already running finish.
+func (s *Scheduler) Abort(id string) (Rollout, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.rollouts[id]
+	if !ok {
+		return Rollout{}, ErrNotFound
+	}
+	switch r.Status {
+	case StatusCompleted, StatusCancelled, StatusAborted:
+		return Rollout{}, fmt.Errorf("%w: it is %s", ErrFinished, r.Status)
+	}
+	prev := r.Rollout
+	prev.Targets = append([]Target{}, r.Targets...)
+
+	now := time.Now().UTC()
+	r.Status = StatusAborted
+	r.FinishedAt = &now
+	for i := range r.Targets {
+		if t := &r.Targets[i]; t.Status == TargetPending || t.Status == TargetMissed {
+			t.Status = TargetSkipped
+		}
+	}
+	if err := s.save(); err != nil {
+		r.Rollout = prev
+		return Rollout{}, err
+	}
+	return r.view(now), nil
+}
+
+// RunDue runs the rollouts whose window is open at now and waits for them
+// to finish. Rollouts whose window closed before they could run have their
+// hosts reported as missed.
+func (s *Scheduler) RunDue(ctx context.Context, now time.Time) {
+	var wg sync.WaitGroup
+	s.start(ctx, now, &wg)
+	wg.Wait()
+}
+
+// Run starts rollouts as their windows open until stop is closed. Hosts
+// not yet started at stop are left for the next run.
+func (s *Scheduler) Run(stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+
+	s.start(ctx, time.Now(), &wg)
+	for {
+		select {
+		case <-stop:
+			cancel()
+			return
+		case now := <-ticker.C:
+			s.start(ctx, now, &wg)
+		}
+	}
+}
+
+// window is an open window a rollout runs in
+type window struct {
+	id         string
+	now        time.Time
+	start, end time.Time
+}
+
+// start runs each rollout whose window is open at now in its own goroutine,
+// tracked by wg
+func (s *Scheduler) start(ctx context.Context, now time.Time, wg *sync.WaitGroup) {
+	for _, w := range s.due(now) {
+		wg.Add(1)
+		go func(w window) {
+			defer wg.Done()
+			s.execute(ctx, w)
+		}(w)
+	}
+}
+
+// due marks the rollouts whose window is open at now as running and
+// returns their windows. Rollouts that missed a window have their hosts
+// marked and reported as missed.
+func (s *Scheduler) due(now time.Time) []window {
+	type report struct {
+		rollout Rollout
+		start   time.Time
+		servers []string
+	}
+	var open []window
+	var missed []report
+
+	s.mu.Lock()
+	for _, r := range s.rollouts {
+		if r.Status != StatusScheduled {
+			continue
+		}
+		start, end, ok := r.window(now)
+		if !ok || (r.LastWindowAt != nil && !start.After(*r.LastWindowAt)) {
+			continue
+		}
+		if now.Before(end) {
+			r.Status = StatusRunning
+			open = append(open, window{id: r.ID, now: now, start: start, end: end})
+			continue
+		}
+		// The window closed without the rollout running, as when the
+		// server was down throughout
+		if servers := r.closeWindow(start, now); len(servers) > 0 {
+			missed = append(missed, report{rollout: r.view(now), start: start, servers: servers})
+		}
+	}
+	if len(open) > 0 || len(missed) > 0 {
+		if err := s.save(); err != nil {
+			slog.Error("saving rollouts", "error", err)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, m := range missed {
+		s.reportMissed(m.rollout, m.start, m.servers)
+	}
+	return open
+}
+
+// execute imports the license on the rollout's hosts until the window
+// closes: one at a time, or a wave at a time for a staged rollout, which
+// halts after a wave once too many imports have failed. w.now stands for
+// the time execute starts, so that RunDue can be given any time.
+func (s *Scheduler) execute(ctx context.Context, w window) {
+	started := time.Now()
+	clock := func() time.Time { return w.now.Add(time.Since(started)) }
+
+	type outcome struct {
+		jobID string
+		err   error
+	}
+	interrupted, halted := false, false
+	for {
+		s.mu.Lock()
+		r := s.rollouts[w.id]
+		wave := r.nextWave()
+		if r.Status != StatusRunning || len(wave) == 0 || !clock().Before(w.end) {
+			s.mu.Unlock()
+			break
+		}
+		if ctx.Err() != nil {
+			interrupted = true
+			s.mu.Unlock()
+			break
+		}
+		start := w.start
+		for _, i := range wave {
+			t := &r.Targets[i]
+			t.Status, t.JobID, t.Error, t.Window, t.FinishedAt = TargetRunning, "", "", &start, nil
+		}
+		if err := s.save(); err != nil {
+			slog.Error("saving rollouts", "rollout_id", w.id, "error", err)
+		}
+		view, data := r.view(clock()), r.Data
+		s.mu.Unlock()
+
+		outcomes := make([]outcome, len(wave))
+		var wg sync.WaitGroup
+		for k, i := range wave {
+			wg.Add(1)
+			go func(k int, server string) {
+				defer wg.Done()
+				outcomes[k].jobID, outcomes[k].err = s.runner.Import(ctx, view, server, data)
+			}(k, view.Targets[i].Server)
+		}
+		wg.Wait()
+
+		s.mu.Lock()
+		for k, i := range wave {
+			t := &r.Targets[i]
+			switch {
+			case errors.Is(outcomes[k].err, ErrUnavailable) && r.Status == StatusAborted:
+				t.Status, t.Window = TargetSkipped, nil
+			case errors.Is(outcomes[k].err, ErrUnavailable):
+				t.Status, t.Window = TargetPending, nil
+				interrupted = true
+			default:
+				t.JobID = outcomes[k].jobID
+				finish(t, outcomes[k].err)
+			}
+		}
+		if !interrupted && r.Status == StatusRunning && r.next() >= 0 {
+			if reason := r.haltReason(wave); reason != "" {
+				r.Status, r.HaltReason = StatusHalted, reason
+				halted = true
+			}
+		}
+		if err := s.save(); err != nil {
+			slog.Error("saving rollouts", "rollout_id", w.id, "error", err)
+		}
+		s.mu.Unlock()
+		if interrupted || halted {
+			break
+		}
+	}
+
+	s.mu.Lock()
+	r := s.rollouts[w.id]
+	var missed []string
+	switch {
+	case r.Status != StatusRunning:
+		// Halted, or aborted while a wave ran
+	case interrupted:
+		// Resumed by the next run while the window is still open
+		r.Status = StatusScheduled
+	default:
+		missed = r.closeWindow(w.start, clock())
+	}
+	if err := s.save(); err != nil {
+		slog.Error("saving rollouts", "rollout_id", w.id, "error", err)
+	}
+	view := r.view(clock())
+	s.mu.Unlock()
+
+	if halted {
+		s.reportHalted(view)
+	}
+	if len(missed) > 0 {
+		s.reportMissed(view, w.start, missed)
+	}
+}
+
+func (s *Scheduler) reportHalted(r Rollout) {
+	slog.Warn("rollout halted", "rollout_id", r.ID, "reason", r.HaltReason)
+	if s.runner != nil {
+		s.runner.Halted(r)
+	}
+}
+
+func (s *Scheduler) reportMissed(r Rollout, start time.Time, servers []string) {
+	slog.Warn("rollout window closed before every host was reached", "rollout_id", r.ID, "window", start, "missed", servers)
+	if s.runner != nil {
+		s.runner.Missed(r, start, servers)
+	}
+}
+
+// next returns the index of the next target to import on, or -1
+func (r *stored) next() int {
+	for i, t := range r.Targets {
+		if t.Status == TargetPending || t.Status == TargetMissed {
+			return i
+		}
+	}
+	return -1
+}
+
+// nextWave returns the indexes of the targets to import on next: the
+// remaining targets of the earliest wave with any, or just the next target
+// when the rollout is not staged
+func (r *stored) nextWave() []int {
+	first := r.next()
+	if first < 0 {
+		return nil
+	}
+	if !r.Staged() {
+		return []int{first}
+	}
+	var wave []int
+	for i := first; i < len(r.Targets); i++ {
+		if t := r.Targets[i]; t.Wave == r.Targets[first].Wave && (t.Status == TargetPending || t.Status == TargetMissed) {
+			wave = append(wave, i)
+		}
+	}
+	return wave
+}
+
+// haltReason is why a staged rollout must halt after the wave of targets
+// just imported on: more than MaxFailurePercent of the wave's imports
+// failed. Earlier waves do not count, so a resumed rollout goes on once a
+// wave succeeds. It is empty when the rollout may go on.
+func (r *stored) haltReason(wave []int) string {
+	if !r.Staged() || len(wave) == 0 {
+		return ""
+	}
+	finished, failed := 0, 0
+	for _, i := range wave {
+		switch r.Targets[i].Status {
+		case TargetSucceeded:
+			finished++
+		case TargetFailed:
+			finished++
+			failed++
+		}
+	}
+	if finished == 0 || failed*100 <= r.MaxFailurePercent*finished {
+		return ""
+	}
+	return fmt.Sprintf("%d of %d imports in wave %d failed, more than %d%%", failed, finished, r.Targets[wave[0]].Wave, r.MaxFailurePercent)
+}
+
+// closeWindow marks the hosts not reached in the window starting at start
+// as missed and returns them. The rollout completes unless a repeating
+// window will retry them.
+func (r *stored) closeWindow(start, now time.Time) []string {
+	var missed []string
+	for i := range r.Targets {
+		if t := &r.Targets[i]; t.Status == TargetPending || t.Status == TargetMissed {
+			w := start
+			t.Status, t.Window = TargetMissed, &w
+			missed = append(missed, t.Server)
+		}
+	}
+	r.LastWindowAt = &start
+	r.Status = StatusScheduled
+	if len(missed) == 0 || r.Repeat == "" {
+		finished := now.UTC()
+		r.Status = StatusCompleted
+		r.FinishedAt = &finished
+	}
+	return missed
+}
+
+// view returns a copy of the rollout without its license, with its next
+// window as of now
+func (r *stored) view(now time.Time) Rollout {
+	v := r.Rollout
+	v.Targets = append([]Target{}, r.Targets...)
+	v.NextWindowAt = nil
+	if r.Status != StatusScheduled {
+		return v
+	}
+	p := r.period()
+	start, end, ok := r.window(now)
+	switch {
+	case p == 0:
+		if r.LastWindowAt != nil || ok && !now.Before(end) {
+			return v
+		}
+		start = r.StartAt
+	case !ok:
+		start = r.StartAt
+	case !now.Before(end):
+		start = start.Add(p)
+	}
+	if r.LastWindowAt != nil && !start.After(*r.LastWindowAt) {
+		start = r.LastWindowAt.Add(p)
+	}
+	v.NextWindowAt = &start
+	return v
+}
+
+// finish records the outcome of a target's import
+func finish(t *Target, err error) {
+	now := time.Now().UTC()
+	t.FinishedAt = &now
+	t.Status = TargetSucceeded
+	if err != nil {
+		t.Status = TargetFailed
+		t.Error = err.Error()
+	}
+}
+
+// save writes the rollouts atomically. Callers must hold s.mu.
+func (s *Scheduler) save() error {
+	list := make([]*stored, 0, len(s.rollouts))
+	for _, r := range s.rollouts {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode rollouts: %v", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write rollouts: %v", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace rollouts: %v", err)
+	}
+	return nil
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic("crypto/rand failed: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,80 @@
+// Package server assembles the HTTP router: middleware, the web interface
+// and every API route.
+package server
+
+import (
+	"license-manager/internal/config"
+	"license-manager/internal/handlers"
+	"license-manager/internal/logging"
+	"license-manager/internal/metrics"
+	"license-manager/internal/middleware"
+	"license-manager/internal/tracing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewRouter returns the router for cfg. Handlers use the state set on the
+// handlers package (audit log, jobs, inventory), so that is set up first.
+func NewRouter(cfg *config.Config) *gin.Engine {
+	r := gin.New()
+
+	// Add middleware
+	r.Use(gin.Recovery(), logging.Middleware("/healthz", "/readyz"), tracing.Middleware())
+	if cfg.Metrics.Enabled {
+		r.Use(metrics.Middleware())
+	}
+	if corsConfig := cfg.CORSMiddleware(); corsConfig.Enabled() {
+		r.Use(middleware.CORS(corsConfig))
+	}
+	r.Use(middleware.SecurityHeaders(cfg.SecurityHeadersMiddleware()))
+	if !cfg.Security.CSRFDisabled {
+		r.Use(middleware.CSRF())
+	}
+
+	// Serve static files
+	r.Static("/static", cfg.Server.StaticDir)
+	r.LoadHTMLGlob(cfg.Server.TemplatesGlob)
+
+	// Probes
+	r.GET("/healthz", handlers.HealthzHandler)
+	r.GET("/readyz", handlers.ReadyzHandler)
+
+	// Routes
+	r.GET("/", handlers.IndexHandler)
+
+	// API routes accept the browser's CSRF token or an API token. The web
+	// interface's operations carry the credentials typed into it; naming an
+	// inventory server instead requires authentication.
+	api := r.Group("/api", middleware.APIAuth(cfg.APITokens()))
+	api.POST("/check-license-cli", handlers.CheckLicenseCLIHandler)
+	api.POST("/preflight", handlers.PreflightHandler)
+	api.POST("/download-sysinfo", handlers.DownloadSysinfoHandler)
+	api.POST("/upload-license", handlers.UploadLicenseHandler)
+
+	// The inventory stores SSH and sudo passwords, so it, the audit log,
+	// the job list and the versioned API need an API token or client
+	// certificate
+	authed := api.Group("", middleware.RequireAuth())
+	authed.GET("/servers", handlers.ListServersHandler)
+	authed.POST("/servers", handlers.PutServerHandler)
+	authed.DELETE("/servers/:name", handlers.DeleteServerHandler)
+	authed.GET("/audit", handlers.AuditHandler)
+	authed.GET("/audit/verify", handlers.AuditVerifyHandler)
+	authed.GET("/jobs", handlers.JobsHandler)
+
+	// Versioned API, described by /api/v1/openapi.json, which stays public
+	// for generating clients
+	handlers.RegisterV1Document(api.Group("/v1"))
+	handlers.RegisterV1(authed.Group("/v1"))
+	r.NoRoute(handlers.NotFoundHandler)
+
+	if cfg.Metrics.Enabled {
+		r.GET("/metrics", gin.WrapH(metrics.Handler()))
+	}
+
+	// Admin-only routes; disabled unless security.admin_tokens is set
+	admin := r.Group("/debug", middleware.AdminAuth(cfg.Security.AdminTokens))
+	admin.GET("/diagnostics", handlers.DiagnosticsHandler)
+
+	return r
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// maxReasonLength bounds the command output quoted in a CommandError
+const maxReasonLength = 1024
+
+// CommandResult is the outcome of a remote command that was started
+type CommandResult struct {
+	Command string
+	Stdout  string
+	Stderr  string
+	// ExitStatus is the remote exit status, 128+n when the command was
+	// killed by signal n, or -1 when the server reported neither
+	ExitStatus int
+	// Signal names the signal that killed the command ("TERM", "KILL", ...)
+	Signal   string
+	Duration time.Duration
+}
+
+// newCommandResult builds the result of command from its captured output and
+// the error returned by the session
+func newCommandResult(command, stdout, stderr string, duration time.Duration, err error) *CommandResult {
+	result := &CommandResult{
+		Command:    command,
+		Stdout:     stdout,
+		Stderr:     stderr,
+		ExitStatus: exitStatus(err),
+		Duration:   duration,
+	}
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		result.Signal = exitErr.Signal()
+	}
+	return result
+}
+
+// Success reports whether the command exited with status 0
+func (r *CommandResult) Success() bool {
+	return r.ExitStatus == 0 && r.Signal == ""
+}
+
+// Output returns stdout followed by stderr, for display
+func (r *CommandResult) Output() string {
+	switch {
+	case r.Stderr == "":
+		return r.Stdout
+	case r.Stdout == "":
+		return r.Stderr
+	}
+	return strings.TrimRight(r.Stdout, "\n") + "\n" + r.Stderr
+}
+
+// Reason returns the command's own explanation of a failure: its stderr, or
+// its stdout when it wrote nothing to stderr
+func (r *CommandResult) Reason() string {
+	reason := strings.TrimSpace(r.Stderr)
+	if reason == "" {
+		reason = strings.TrimSpace(r.Stdout)
+	}
+	if len(reason) > maxReasonLength {
+		reason = reason[:maxReasonLength] + "..."
+	}
+	return reason
+}
+
+// CommandError is returned when a remote command exits with a non-zero
+// status or is killed by a signal. It carries the full result.
+type CommandError struct {
+	Result *CommandResult
+	err    error
+}
+
+func (e *CommandError) Error() string {
+	var msg string
+	switch r := e.Result; {
+	case r.Signal != "":
+		msg = fmt.Sprintf("%s killed by signal %s", r.Command, r.Signal)
+	case r.ExitStatus == -1:
+		msg = fmt.Sprintf("%s exited without reporting a status", r.Command)
+	default:
+		msg = fmt.Sprintf("%s exited with status %d", r.Command, r.ExitStatus)
+	}
+	if reason := e.Result.Reason(); reason != "" {
+		msg += ": " + reason
+	}
+	return msg
+}
+
+// Unwrap returns the underlying *ssh.ExitError or *ssh.ExitMissingError
+func (e *CommandError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/crypto/ssh"
+)
+
+// Privilege escalation methods
+const (
+	EscalateNone = ""
+	EscalateSudo = "sudo"
+	EscalateSu   = "su"
+)
+
+// DefaultEscalationUser is the target user when Escalation.User is empty
+const DefaultEscalationUser = "root"
+
+var (
+	// ErrNotInSudoers is returned when sudo refuses the login user outright
+	ErrNotInSudoers = errors.New("not permitted to use sudo")
+	// ErrEscalationPassword is returned when sudo or su rejects the password,
+	// or asks for one when none is configured
+	ErrEscalationPassword = errors.New("escalation password rejected")
+)
+
+// validEscalationUser limits target user names to what useradd accepts
+var validEscalationUser = regexp.MustCompile(`^[a-z_][a-z0-9_.-]{0,31}$`)
+
+// suPrompt matches the password prompt of su, which cannot be customised
+var suPrompt = regexp.MustCompile(`(?i)password[^\n]*:\s*$`)
+
+// notInSudoers are sudo's messages for users it will not run commands for
+var notInSudoers = []string{
+	"is not in the sudoers file",
+	"is not allowed to execute",
+	"is not allowed to run sudo",
+	"may not run sudo",
+}
+
+// Escalation runs license2_cli commands as another user through sudo or su.
+// When the command prompts for a password it is typed into a PTY with echo
+// disabled, and only in answer to the expected prompt.
+type Escalation struct {
+	// Method is EscalateNone, EscalateSudo or EscalateSu
+	Method string
+	// User is the user to run as; root when empty
+	User string
+	// Password answers the prompt: the login user's password for sudo (the
+	// SSH password when empty), the target user's password for su
+	Password string
+}
+
+// Validate checks the method and target user
+func (e Escalation) Validate() error {
+	switch e.Method {
+	case EscalateNone, EscalateSudo, EscalateSu:
+	default:
+		return fmt.Errorf("unknown escalation method %q, use sudo or su", e.Method)
+	}
+	if e.User != "" && !validEscalationUser.MatchString(e.User) {
+		return fmt.Errorf("invalid escalation user %q", e.User)
+	}
+	return nil
+}
+
+func (e Escalation) user() string {
+	if e.User == "" {
+		return DefaultEscalationUser
+	}
+	return e.User
+}
+
+// describe returns how command is run, for the audit log and logs
+func (e Escalation) describe(command string) string {
+	if e.Method == EscalateSu {
+		return "su " + e.user() + " -c " + ShellQuote(command)
+	}
+	return "sudo -u " + e.user() + " -- " + command
+}
+
+// escalates reports whether command runs through sudo or su
+func (s *SSHService) escalates(command string) bool {
+	return s.config.Escalation.Method != EscalateNone && strings.HasPrefix(command, "license2_cli")
+}
+
+// runEscalated runs command through sudo or su on a PTY, answering the
+// password prompt. A PTY merges the command's stderr into its stdout.
+func (s *SSHService) runEscalated(ctx context.Context, command string) (result *CommandResult, err error) {
+	e := s.config.Escalation
+	ctx, span := s.startCommandSpan(ctx, "ssh.exec", command)
+	span.SetAttributes(
+		attribute.String("ssh.escalation", e.Method),
+		attribute.String("ssh.escalation.user", e.user()),
+	)
+	defer func() { endCommandSpan(span, err) }()
+
+	session, err := s.newSession(ctx, orDefault(s.config.CommandTimeout, DefaultCommandTimeout))
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	// No echo, so the password never appears in the output, and wide enough
+	// that long lines are not wrapped
+	modes := ssh.TerminalModes{ssh.ECHO: 0, ssh.TTY_OP_ISPEED: 14400, ssh.TTY_OP_OSPEED: 14400}
+	if err := session.RequestPty("dumb", 40, 1000, modes); err != nil {
+		return nil, fmt.Errorf("failed to request pty: %v", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe: %v", err)
+	}
+
+	password := e.Password
+	if password == "" && e.Method == EscalateSudo {
+		password = s.config.Password
+	}
+
+	var wrapped string
+	responder := &promptResponder{
+		answer: func() bool {
+			if password == "" {
+				return false
+			}
+			_, err := io.WriteString(stdin, password+"\n")
+			return err == nil
+		},
+		// Closing the raw session leaves the context alone, so the failure is
+		// reported as the rejected password rather than a cancellation
+		abort: func() { session.Session.Close() },
+	}
+	if e.Method == EscalateSu {
+		wrapped = "su " + ShellQuote(e.user()) + " -c " + ShellQuote(command)
+		responder.prompt = suPrompt
+	} else {
+		// A prompt unique to this command cannot be confused with its output,
+		// so a second one reliably means the password was wrong
+		prompt := "[license-manager sudo " + nonce() + "] password: "
+		wrapped = "sudo -p " + ShellQuote(prompt) + " -u " + ShellQuote(e.user()) + " -- sh -c " + ShellQuote(command)
+		responder.prompt = regexp.MustCompile(regexp.QuoteMeta(prompt))
+		responder.reprompts = true
+	}
+	session.Stdout = responder
+	session.Stderr = responder
+
+	started := time.Now()
+	err = session.err(session.Run(wrapped))
+	output := responder.output()
+	result = newCommandResult(command, output, "", time.Since(started), err)
+
+	switch {
+	case isCancelled(err):
+	case responder.rejected:
+		err = fmt.Errorf("%s as %s: %w", e.Method, e.user(), ErrEscalationPassword)
+	case err != nil && e.Method == EscalateSudo && containsAny(output, notInSudoers):
+		err = fmt.Errorf("sudo as %s refused for %s: %w", e.user(), s.config.Username, ErrNotInSudoers)
+	case err != nil && responder.prompts > 0 && containsAny(output, []string{"authentication failure", "incorrect password"}):
+		err = fmt.Errorf("%s as %s: %w", e.Method, e.user(), ErrEscalationPassword)
+	default:
+		var exitErr *ssh.ExitError
+		var missingErr *ssh.ExitMissingError
+		if errors.As(err, &exitErr) || errors.As(err, &missingErr) {
+			err = &CommandError{Result: result, err: err}
+		}
+	}
+	s.recordCommand(command, started, err)
+	return result, err
+}
+
+// promptResponder collects PTY output and types the password the first time
+// the prompt appears. A repeated prompt, or a prompt with no password to give,
+// aborts the command rather than leaving it waiting for input.
+type promptResponder struct {
+	prompt *regexp.Regexp
+	// reprompts is set when later prompts can be told apart from output
+	reprompts bool
+	answer    func() bool
+	abort     func()
+
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	scanned  int
+	spans    [][2]int
+	prompts  int
+	rejected bool
+}
+
+func (p *promptResponder) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.buf.Write(b)
+	for !p.rejected && (p.prompts == 0 || p.reprompts) {
+		loc := p.prompt.FindIndex(p.buf.Bytes()[p.scanned:])
+		if loc == nil {
+			break
+		}
+		p.spans = append(p.spans, [2]int{p.scanned + loc[0], p.scanned + loc[1]})
+		p.scanned += loc[1]
+		p.prompts++
+		if p.prompts > 1 || !p.answer() {
+			p.rejected = true
+			p.abort()
+		}
+	}
+	return len(b), nil
+}
+
+// output returns what the command wrote, without the prompts and with the
+// terminal's CRLF line endings undone
+func (p *promptResponder) output() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var out strings.Builder
+	raw, last := p.buf.Bytes(), 0
+	for _, span := range p.spans {
+		out.Write(raw[last:span[0]])
+		last = span[1]
+	}
+	out.Write(raw[last:])
+	return strings.TrimLeft(strings.ReplaceAll(out.String(), "\r\n", "\n"), "\n")
+}
+
+func containsAny(s string, substrs []string) bool {
+	s = strings.ToLower(s)
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+func nonce() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		panic("crypto/rand failed: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var (
+	// "123 days remaining", "5 days left"
+	daysBeforeLabel = regexp.MustCompile(`(?i)(-?\d+)\s+days?\s+(?:remaining|left)`)
+	// "Days remaining: 123", "days left = 5"
+	daysAfterLabel = regexp.MustCompile(`(?i)days?\s+(?:remaining|left)\s*[:=]?\s*(-?\d+)`)
+	// "Expires: 2025-12-31", "Expiration date: 2025-12-31", "expires on 2025-12-31"
+	expiryDate = regexp.MustCompile(`(?i)expir\w*(?:\s+date|\s+on|\s+at)?\s*[:=]?\s*(\d{4}-\d{2}-\d{2})`)
+)
+
+// ParseDaysRemaining extracts the days left on a license from license2_cli
+// check output, either stated directly or computed from an expiry date
+// relative to now. It reports false when the output has neither.
+func ParseDaysRemaining(output string, now time.Time) (float64, bool) {
+	for _, re := range []*regexp.Regexp{daysBeforeLabel, daysAfterLabel} {
+		if m := re.FindStringSubmatch(output); m != nil {
+			days, err := strconv.Atoi(m[1])
+			if err == nil {
+				return float64(days), true
+			}
+		}
+	}
+
+	if m := expiryDate.FindStringSubmatch(output); m != nil {
+		expires, err := time.ParseInLocation("2006-01-02", m[1], now.Location())
+		if err == nil {
+			// The license is valid through the end of its expiry day
+			remaining := expires.AddDate(0, 0, 1).Sub(now)
+			return math.Floor(remaining.Hours() / 24), true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,343 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Defaults used when the corresponding PoolConfig field is not set
+const (
+	DefaultPoolIdleTTL        = 5 * time.Minute
+	DefaultKeepaliveInterval  = 30 * time.Second
+	DefaultMaxSessionsPerHost = 4
+)
+
+// PoolConfig controls how long authenticated clients are kept and how many
+// operations may run against one host at a time
+type PoolConfig struct {
+	// IdleTTL is how long an unused client is kept before it is closed
+	IdleTTL time.Duration
+	// KeepaliveInterval is how often idle clients are probed; a client that
+	// does not answer is dropped
+	KeepaliveInterval time.Duration
+	// MaxSessionsPerHost bounds concurrent operations against one host:port,
+	// across all credentials
+	MaxSessionsPerHost int
+}
+
+// Pool keeps authenticated SSH clients for reuse across requests. Clients
+// are keyed by host, port, user and a hash of the password, so a client is
+// only reused by callers presenting the same credentials.
+type Pool struct {
+	config PoolConfig
+
+	mu      sync.Mutex
+	clients map[string]*pooledClient
+	slots   map[string]chan struct{}
+	closed  bool
+}
+
+type pooledClient struct {
+	key      string
+	client   *ssh.Client
+	users    int
+	lastUsed time.Time
+	// detached clients were dialled while another client already held the
+	// key; they are closed when released instead of being kept
+	detached bool
+	dead     bool
+	// cliFound caches a successful license2_cli lookup for this client
+	cliFound bool
+}
+
+// lease is one borrower's hold on a pooled client and a host slot
+type lease struct {
+	pool   *Pool
+	pc     *pooledClient
+	slot   chan struct{}
+	once   sync.Once
+	client *ssh.Client
+}
+
+// NewPool returns an empty pool. Call Maintain in a goroutine to evict idle
+// and dead clients.
+func NewPool(config PoolConfig) *Pool {
+	if config.IdleTTL <= 0 {
+		config.IdleTTL = DefaultPoolIdleTTL
+	}
+	if config.KeepaliveInterval <= 0 {
+		config.KeepaliveInterval = DefaultKeepaliveInterval
+	}
+	if config.MaxSessionsPerHost <= 0 {
+		config.MaxSessionsPerHost = DefaultMaxSessionsPerHost
+	}
+	return &Pool{
+		config:  config,
+		clients: make(map[string]*pooledClient),
+		slots:   make(map[string]chan struct{}),
+	}
+}
+
+// Maintain probes idle clients with keepalives every KeepaliveInterval and
+// closes those that fail or have been idle longer than IdleTTL. It returns
+// when stop is closed.
+func (p *Pool) Maintain(stop <-chan struct{}) {
+	ticker := time.NewTicker(p.config.KeepaliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			p.sweep()
+		}
+	}
+}
+
+// Close closes every pooled client. Clients in use are closed when released.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	for key, pc := range p.clients {
+		if pc.users == 0 {
+			pc.client.Close()
+		} else {
+			pc.detached = true
+		}
+		delete(p.clients, key)
+	}
+}
+
+// PoolStats is a snapshot of the pool for diagnostics
+type PoolStats struct {
+	Clients            int            `json:"clients"`
+	InUse              int            `json:"in_use"`
+	MaxSessionsPerHost int            `json:"max_sessions_per_host"`
+	ActiveSessions     map[string]int `json:"active_sessions"`
+}
+
+// Len returns the number of pooled clients
+func (p *Pool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.clients)
+}
+
+// Stats returns the pooled client count and the sessions in use per host
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := PoolStats{
+		Clients:            len(p.clients),
+		MaxSessionsPerHost: p.config.MaxSessionsPerHost,
+		ActiveSessions:     make(map[string]int),
+	}
+	for _, pc := range p.clients {
+		if pc.users > 0 {
+			stats.InUse++
+		}
+	}
+	for host, slot := range p.slots {
+		if n := len(slot); n > 0 {
+			stats.ActiveSessions[host] = n
+		}
+	}
+	return stats
+}
+
+// acquire waits for a slot on the config's host and returns a lease on a
+// healthy client for its credentials, calling dial when there is none
+func (p *Pool) acquire(ctx context.Context, config *SSHConfig, dial func(context.Context) (*ssh.Client, error)) (*lease, error) {
+	slot := p.slot(net.JoinHostPort(config.Host, config.Port))
+	select {
+	case slot <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for a free session on %s: %w", net.JoinHostPort(config.Host, config.Port), ctx.Err())
+	}
+
+	l := &lease{pool: p, slot: slot}
+	key := poolKey(config)
+
+	if pc := p.borrow(key); pc != nil {
+		// An idle client may have been dropped by the server or a firewall
+		// since it was last used
+		if pc.users > 1 || ping(pc.client, keepaliveTimeout(ctx)) == nil {
+			l.pc, l.client = pc, pc.client
+			return l, nil
+		}
+		p.markDead(pc)
+		p.release(pc)
+	}
+
+	client, err := dial(ctx)
+	if err != nil {
+		<-slot
+		return nil, err
+	}
+	l.pc = p.add(key, client)
+	l.client = client
+	return l, nil
+}
+
+// Release returns the client to the pool and frees the host slot. It is safe
+// to call more than once.
+func (l *lease) Release() {
+	l.once.Do(func() {
+		l.pool.release(l.pc)
+		<-l.slot
+	})
+}
+
+// CLIFound reports whether license2_cli was already found through this client
+func (l *lease) CLIFound() bool {
+	l.pool.mu.Lock()
+	defer l.pool.mu.Unlock()
+	return l.pc.cliFound
+}
+
+// SetCLIFound caches a successful license2_cli lookup on the client
+func (l *lease) SetCLIFound() {
+	l.pool.mu.Lock()
+	defer l.pool.mu.Unlock()
+	l.pc.cliFound = true
+}
+
+func (p *Pool) slot(host string) chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	slot, ok := p.slots[host]
+	if !ok {
+		slot = make(chan struct{}, p.config.MaxSessionsPerHost)
+		p.slots[host] = slot
+	}
+	return slot
+}
+
+// borrow returns the live client for key, if any, with its user count raised
+func (p *Pool) borrow(key string) *pooledClient {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pc, ok := p.clients[key]
+	if !ok || pc.dead {
+		return nil
+	}
+	pc.users++
+	return pc
+}
+
+// add stores a newly dialled client and returns it borrowed once
+func (p *Pool) add(key string, client *ssh.Client) *pooledClient {
+	pc := &pooledClient{key: key, client: client, users: 1}
+
+	p.mu.Lock()
+	if _, exists := p.clients[key]; exists || p.closed {
+		pc.detached = true
+	} else {
+		p.clients[key] = pc
+	}
+	p.mu.Unlock()
+
+	// Drop the client as soon as the connection goes away
+	go func() {
+		client.Wait()
+		p.markDead(pc)
+	}()
+	return pc
+}
+
+func (p *Pool) release(pc *pooledClient) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pc.users--
+	pc.lastUsed = time.Now()
+	if pc.users == 0 && (pc.detached || pc.dead) {
+		pc.client.Close()
+	}
+}
+
+// markDead removes pc from the pool; it is closed once no one is using it
+func (p *Pool) markDead(pc *pooledClient) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pc.dead = true
+	if p.clients[pc.key] == pc {
+		delete(p.clients, pc.key)
+	}
+	if pc.users == 0 {
+		pc.client.Close()
+	}
+}
+
+// sweep closes expired idle clients and probes the rest
+func (p *Pool) sweep() {
+	var idle []*pooledClient
+
+	p.mu.Lock()
+	for key, pc := range p.clients {
+		if pc.users > 0 {
+			continue
+		}
+		if time.Since(pc.lastUsed) > p.config.IdleTTL {
+			delete(p.clients, key)
+			pc.client.Close()
+			continue
+		}
+		idle = append(idle, pc)
+	}
+	p.mu.Unlock()
+
+	for _, pc := range idle {
+		if err := ping(pc.client, p.config.KeepaliveInterval); err != nil {
+			slog.Info("dropping pooled SSH connection", "host", pc.client.RemoteAddr().String(), "error", err)
+			p.markDead(pc)
+		}
+	}
+}
+
+// ping sends an OpenSSH keepalive and waits up to timeout for the reply.
+// Servers reject the request type, but any reply proves the connection is up.
+func ping(client *ssh.Client, timeout time.Duration) error {
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("no keepalive reply within %v", timeout)
+	}
+}
+
+// keepaliveTimeout bounds the health check of a borrowed client by ctx's
+// deadline, or a few seconds when there is none
+func keepaliveTimeout(ctx context.Context) time.Duration {
+	timeout := 5 * time.Second
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+	return timeout
+}
+
+func poolKey(config *SSHConfig) string {
+	sum := sha256.Sum256([]byte(config.Password))
+	return net.JoinHostPort(config.Host, config.Port) + "|" + config.Username + "|" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Preflight check statuses, in increasing severity
+const (
+	PreflightPass = "pass"
+	PreflightWarn = "warn"
+	PreflightFail = "fail"
+)
+
+// Preflight checks
+const (
+	CheckSSH        = "ssh"
+	CheckAuth       = "auth"
+	CheckOS         = "os"
+	CheckDiskSpace  = "disk_space"
+	CheckWritable   = "write_permission"
+	CheckCLI        = "license2_cli"
+	CheckClockSkew  = "clock_skew"
+	CheckEscalation = "sudo"
+)
+
+// Preflight thresholds
+const (
+	// PreflightMinFreeBytes is the free space in the remote temp dir below
+	// which preflight warns; none at all fails
+	PreflightMinFreeBytes = 10 << 20
+	// PreflightClockSkewWarn and PreflightClockSkewFail bound the difference
+	// between the remote and local clocks; licenses carry validity dates, so
+	// a skewed remote clock can make a valid license look expired
+	PreflightClockSkewWarn = 30 * time.Second
+	PreflightClockSkewFail = 5 * time.Minute
+)
+
+// PreflightCheck is the outcome of one preflight check
+type PreflightCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// PreflightReport is the outcome of every preflight check against one host.
+// Status is the most severe status of its checks.
+type PreflightReport struct {
+	Host       string           `json:"host"`
+	Status     string           `json:"status"`
+	Checks     []PreflightCheck `json:"checks"`
+	DurationMS int64            `json:"duration_ms"`
+}
+
+func (r *PreflightReport) add(name, status, format string, args ...any) {
+	r.Checks = append(r.Checks, PreflightCheck{Name: name, Status: status, Message: fmt.Sprintf(format, args...)})
+	if severity(status) > severity(r.Status) {
+		r.Status = status
+	}
+}
+
+func severity(status string) int {
+	switch status {
+	case PreflightWarn:
+		return 1
+	case PreflightFail:
+		return 2
+	}
+	return 0
+}
+
+// Preflight connects to the server and checks that a license can be uploaded
+// and imported: reachability and authentication, the OS, free space and
+// write permission in tempDir, license2_cli, the remote clock, and sudo. A
+// failure to connect ends the run; every other check runs regardless.
+func (s *SSHService) Preflight(ctx context.Context, tempDir string) *PreflightReport {
+	started := time.Now()
+	report := &PreflightReport{
+		Host:   net.JoinHostPort(s.config.Host, s.config.Port),
+		Status: PreflightPass,
+	}
+	defer func() { report.DurationMS = time.Since(started).Milliseconds() }()
+
+	if err := s.Connect(ctx); err != nil {
+		report.add(CheckSSH, PreflightFail, "%v", err)
+		return report
+	}
+	report.add(CheckSSH, PreflightPass, "connected in %v (%s)", time.Since(started).Round(time.Millisecond), s.client.ServerVersion())
+	report.add(CheckAuth, PreflightPass, "password authentication as %s", s.config.Username)
+
+	s.preflightOS(ctx, report)
+	s.preflightDiskSpace(ctx, report, tempDir)
+	s.preflightWritable(ctx, report, tempDir)
+	s.preflightCLI(ctx, report)
+	s.preflightClock(ctx, report)
+	return report
+}
+
+func (s *SSHService) preflightOS(ctx context.Context, report *PreflightReport) {
+	result, err := s.run(ctx, "uname -srm; cat /etc/os-release 2>/dev/null")
+	if err != nil {
+		report.add(CheckOS, PreflightWarn, "could not determine the OS: %v", err)
+		return
+	}
+
+	lines := strings.Split(strings.TrimSpace(result.Stdout), "\n")
+	kernel := strings.TrimSpace(lines[0])
+	for _, line := range lines[1:] {
+		if name, ok := strings.CutPrefix(line, "PRETTY_NAME="); ok {
+			report.add(CheckOS, PreflightPass, "%s (%s)", strings.Trim(name, `"'`), kernel)
+			return
+		}
+	}
+	report.add(CheckOS, PreflightPass, "%s", kernel)
+}
+
+func (s *SSHService) preflightDiskSpace(ctx context.Context, report *PreflightReport, tempDir string) {
+	result, err := s.run(ctx, "df -Pk "+ShellQuote(tempDir))
+	if err != nil {
+		report.add(CheckDiskSpace, PreflightWarn, "could not check free space in %s: %v", tempDir, err)
+		return
+	}
+
+	// POSIX df: a header, then filesystem, blocks, used, available, ...
+	lines := strings.Split(strings.TrimSpace(result.Stdout), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	var available int64 = -1
+	if len(fields) >= 4 {
+		if kb, err := strconv.ParseInt(fields[3], 10, 64); err == nil {
+			available = kb << 10
+		}
+	}
+
+	switch {
+	case available < 0:
+		report.add(CheckDiskSpace, PreflightWarn, "could not parse df output for %s", tempDir)
+	case available == 0:
+		report.add(CheckDiskSpace, PreflightFail, "no free space in %s", tempDir)
+	case available < PreflightMinFreeBytes:
+		report.add(CheckDiskSpace, PreflightWarn, "only %s free in %s", formatBytes(available), tempDir)
+	default:
+		report.add(CheckDiskSpace, PreflightPass, "%s free in %s", formatBytes(available), tempDir)
+	}
+}
+
+func (s *SSHService) preflightWritable(ctx context.Context, report *PreflightReport, tempDir string) {
+	probe := ShellQuote(strings.TrimRight(tempDir, "/") + "/.license-manager-preflight")
+	if _, err := s.run(ctx, "touch "+probe+" && rm -f "+probe); err != nil {
+		report.add(CheckWritable, PreflightFail, "%s is not writable by %s: %v", tempDir, s.config.Username, err)
+		return
+	}
+	report.add(CheckWritable, PreflightPass, "%s is writable by %s", tempDir, s.config.Username)
+}
+
+// preflightCLI finds license2_cli and reads its version, through sudo or su
+// when escalation is configured, which also tests the escalation
+func (s *SSHService) preflightCLI(ctx context.Context, report *PreflightReport) {
+	found, err := s.run(ctx, "which license2_cli")
+	path := ""
+	if err == nil {
+		path = strings.TrimSpace(found.Stdout)
+	}
+	if path == "" {
+		report.add(CheckCLI, PreflightFail, "license2_cli not found in the PATH of %s", s.config.Username)
+		s.preflightSudo(ctx, report)
+		return
+	}
+
+	version, err := s.run(ctx, "license2_cli --version 2>/dev/null || license2_cli -v 2>/dev/null")
+	if err == nil {
+		report.add(CheckCLI, PreflightPass, "%s, %s", path, firstLine(version.Stdout))
+	} else {
+		report.add(CheckCLI, PreflightWarn, "%s, could not read the version: %v", path, err)
+	}
+
+	if e := s.config.Escalation; e.Method != EscalateNone {
+		switch {
+		case errors.Is(err, ErrNotInSudoers), errors.Is(err, ErrEscalationPassword):
+			report.add(CheckEscalation, PreflightFail, "%v", err)
+		case err != nil:
+			report.add(CheckEscalation, PreflightWarn, "could not confirm %s as %s: %v", e.Method, e.user(), err)
+		default:
+			report.add(CheckEscalation, PreflightPass, "license2_cli runs as %s via %s", e.user(), e.Method)
+		}
+		return
+	}
+	s.preflightSudo(ctx, report)
+}
+
+// preflightSudo reports whether sudo could be used, when it is not configured
+func (s *SSHService) preflightSudo(ctx context.Context, report *PreflightReport) {
+	if e := s.config.Escalation; e.Method != EscalateNone {
+		report.add(CheckEscalation, PreflightWarn, "%s as %s not tested without license2_cli", e.Method, e.user())
+		return
+	}
+
+	result, err := s.run(ctx, "sudo -n true 2>&1")
+	output := ""
+	if result != nil {
+		output = strings.ToLower(result.Stdout)
+	}
+	switch {
+	case err == nil:
+		report.add(CheckEscalation, PreflightPass, "not configured; passwordless sudo is available")
+	case strings.Contains(output, "password is required"):
+		report.add(CheckEscalation, PreflightPass, "not configured; sudo is available with a password")
+	case containsAny(output, notInSudoers):
+		report.add(CheckEscalation, PreflightPass, "not configured; %s may not use sudo", s.config.Username)
+	default:
+		report.add(CheckEscalation, PreflightPass, "not configured; sudo is not available")
+	}
+}
+
+func (s *SSHService) preflightClock(ctx context.Context, report *PreflightReport) {
+	before := time.Now()
+	result, err := s.run(ctx, "date -u +%s")
+	if err != nil {
+		report.add(CheckClockSkew, PreflightWarn, "could not read the remote clock: %v", err)
+		return
+	}
+	after := time.Now()
+
+	seconds, err := strconv.ParseInt(strings.TrimSpace(result.Stdout), 10, 64)
+	if err != nil {
+		report.add(CheckClockSkew, PreflightWarn, "could not parse the remote time %q", strings.TrimSpace(result.Stdout))
+		return
+	}
+
+	// Compare against the local time halfway through the round trip
+	local := before.Add(after.Sub(before) / 2)
+	skew := time.Unix(seconds, 0).Sub(local).Round(time.Second)
+	magnitude := skew
+	if magnitude < 0 {
+		magnitude = -magnitude
+	}
+
+	direction := "ahead of"
+	if skew < 0 {
+		direction = "behind"
+	}
+	switch {
+	case magnitude <= time.Second:
+		report.add(CheckClockSkew, PreflightPass, "remote clock matches this server")
+	case magnitude < PreflightClockSkewWarn:
+		report.add(CheckClockSkew, PreflightPass, "remote clock is %v %s this server", magnitude, direction)
+	case magnitude < PreflightClockSkewFail:
+		report.add(CheckClockSkew, PreflightWarn, "remote clock is %v %s this server", magnitude, direction)
+	default:
+		report.add(CheckClockSkew, PreflightFail, "remote clock is %v %s this server; license validity may be misjudged", magnitude, direction)
+	}
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(line)
+}
+
+func formatBytes(n int64) string {
+	const unit = 1 << 10
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
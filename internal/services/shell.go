@@ -0,0 +1,9 @@
+package services
+
+import "strings"
+
+// ShellQuote quotes s as a single POSIX shell word. Every path or name put
+// into a remote command goes through it.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -1,27 +1,57 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"license-manager/internal/audit"
+	"license-manager/internal/metrics"
+	"license-manager/internal/tracing"
+	"log/slog"
 	"net"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/ssh"
 )
 
+// Defaults used when the corresponding SSHConfig timeout is not set
+const (
+	DefaultTimeout         = 10 * time.Second
+	DefaultCommandTimeout  = 2 * time.Minute
+	DefaultTransferTimeout = 10 * time.Minute
+)
+
 type SSHConfig struct {
 	Host     string
 	Port     string
 	Username string
 	Password string
+	// Timeout bounds connecting and the SSH handshake
+	Timeout time.Duration
+	// CommandTimeout bounds each remote command
+	CommandTimeout time.Duration
+	// TransferTimeout bounds each file upload or download
+	TransferTimeout time.Duration
+	// Escalation, when set, runs license2_cli commands through sudo or su
+	Escalation Escalation
 }
 
 type SSHService struct {
-	config *SSHConfig
-	client *ssh.Client
+	config   *SSHConfig
+	client   *ssh.Client
+	pool     *Pool
+	lease    *lease
+	auditLog *audit.Log
+	actor    string
+	logger   *slog.Logger
 }
 
 // Config returns the SSH configuration (for testing)
@@ -35,80 +65,217 @@ func NewSSHService(config *SSHConfig) *SSHService {
 	}
 }
 
-func (s *SSHService) Connect() error {
+// SetAudit records every remote command run by this service in log,
+// attributed to actor
+func (s *SSHService) SetAudit(log *audit.Log, actor string) {
+	s.auditLog = log
+	s.actor = actor
+}
+
+// SetLogger sets the logger for connections and remote commands, typically
+// one carrying the request and job IDs
+func (s *SSHService) SetLogger(logger *slog.Logger) {
+	s.logger = logger
+}
+
+// SetPool makes Connect borrow clients from pool instead of dialing, and
+// Close return them
+func (s *SSHService) SetPool(pool *Pool) {
+	s.pool = pool
+}
+
+// Connect dials the server and authenticates, or borrows an authenticated
+// client from the pool when one is set. Waiting for the pool, connecting and
+// the handshake are bounded by ctx and the connect timeout.
+func (s *SSHService) Connect(ctx context.Context) (err error) {
+	ctx, span := s.startSpan(ctx, "ssh.connect")
+	defer func() { tracing.End(span, err) }()
+
+	timeout := orDefault(s.config.Timeout, DefaultTimeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if s.pool == nil {
+		client, err := s.dial(ctx, timeout)
+		if err != nil {
+			return err
+		}
+		s.client = client
+		return nil
+	}
+
+	reused := true
+	lease, err := s.pool.acquire(ctx, s.config, func(ctx context.Context) (*ssh.Client, error) {
+		reused = false
+		return s.dial(ctx, timeout)
+	})
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(attribute.Bool("ssh.pool.reused", reused))
+	s.lease = lease
+	s.client = lease.client
+	return nil
+}
+
+// dial opens and records a new authenticated connection
+func (s *SSHService) dial(ctx context.Context, timeout time.Duration) (*ssh.Client, error) {
 	config := &ssh.ClientConfig{
 		User: s.config.Username,
 		Auth: []ssh.AuthMethod{
 			ssh.Password(s.config.Password),
 		},
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         10 * time.Second,
+		Timeout:         timeout,
 	}
 
 	addr := net.JoinHostPort(s.config.Host, s.config.Port)
-	client, err := ssh.Dial("tcp", addr, config)
+	started := time.Now()
+	client, err := dial(ctx, addr, config)
+	s.record(audit.ActionConnect, "", started, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	return client, nil
+}
+
+// dial is ssh.Dial with the TCP connect and handshake bounded by ctx
+func dial(ctx context.Context, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
 	if err != nil {
-		return fmt.Errorf("failed to connect to %s: %v", addr, err)
+		return nil, err
 	}
 
-	s.client = client
-	return nil
+	// Closing the connection is the only way to abort a stuck handshake
+	handshakeDone := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-handshakeDone:
+		}
+	}()
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	close(handshakeDone)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
 }
 
+// Close disconnects, or returns the client to the pool it was borrowed from
 func (s *SSHService) Close() error {
+	if s.lease != nil {
+		s.lease.Release()
+		s.lease = nil
+		s.client = nil
+		return nil
+	}
 	if s.client != nil {
 		return s.client.Close()
 	}
 	return nil
 }
 
-func (s *SSHService) CheckLicenseCLI() (bool, error) {
+func (s *SSHService) CheckLicenseCLI(ctx context.Context) (bool, error) {
 	if s.client == nil {
 		return false, fmt.Errorf("not connected to server")
 	}
 
-	session, err := s.client.NewSession()
-	if err != nil {
-		return false, fmt.Errorf("failed to create session: %v", err)
+	// A pooled client remembers that license2_cli was found; a missing one is
+	// looked up again in case it has been installed since
+	if s.lease != nil && s.lease.CLIFound() {
+		trace.SpanFromContext(ctx).AddEvent("license2_cli lookup cached")
+		return true, nil
 	}
-	defer session.Close()
 
 	// Check if license2_cli exists
-	output, err := session.CombinedOutput("which license2_cli")
+	result, err := s.run(ctx, "which license2_cli")
 	if err != nil {
+		if isCancelled(err) {
+			return false, err
+		}
 		return false, nil // Command failed, likely means license2_cli doesn't exist
 	}
 
-	return strings.TrimSpace(string(output)) != "", nil
+	found := strings.TrimSpace(result.Stdout) != ""
+	if found && s.lease != nil {
+		s.lease.SetCLIFound()
+	}
+	return found, nil
 }
 
-func (s *SSHService) ExecuteCommand(command string) (string, error) {
+// ExecuteCommand runs command, bounded by ctx and the command timeout, and
+// returns its output and exit status. If the command exits non-zero or is
+// killed, the error is a *CommandError quoting the command's own message and
+// the result is returned as well. The result is nil only when the command
+// could not be started.
+func (s *SSHService) ExecuteCommand(ctx context.Context, command string) (*CommandResult, error) {
 	if s.client == nil {
-		return "", fmt.Errorf("not connected to server")
+		return nil, fmt.Errorf("not connected to server")
 	}
 
-	session, err := s.client.NewSession()
-	if err != nil {
-		return "", fmt.Errorf("failed to create session: %v", err)
+	result, err := s.run(ctx, command)
+	var cmdErr *CommandError
+	if err != nil && !errors.As(err, &cmdErr) {
+		return result, fmt.Errorf("command failed: %w", err)
 	}
-	defer session.Close()
+	return result, err
+}
 
-	output, err := session.CombinedOutput(command)
+// run runs command in a new session bounded by ctx and the command timeout,
+// through sudo or su when it needs escalating, and records it in the audit log
+func (s *SSHService) run(ctx context.Context, command string) (result *CommandResult, err error) {
+	if s.escalates(command) {
+		return s.runEscalated(ctx, command)
+	}
+
+	ctx, span := s.startCommandSpan(ctx, "ssh.exec", command)
+	defer func() { endCommandSpan(span, err) }()
+
+	session, err := s.newSession(ctx, orDefault(s.config.CommandTimeout, DefaultCommandTimeout))
 	if err != nil {
-		return "", fmt.Errorf("command failed: %v", err)
+		return nil, err
 	}
+	defer session.Close()
 
-	return string(output), nil
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	started := time.Now()
+	err = session.err(session.Run(command))
+	result = newCommandResult(command, stdout.String(), stderr.String(), time.Since(started), err)
+
+	var exitErr *ssh.ExitError
+	var missingErr *ssh.ExitMissingError
+	if errors.As(err, &exitErr) || errors.As(err, &missingErr) {
+		err = &CommandError{Result: result, err: err}
+	}
+	s.recordCommand(command, started, err)
+	return result, err
 }
 
-func (s *SSHService) DownloadFile(remotePath, localPath string) error {
+// DownloadFile copies remotePath to localPath, bounded by ctx and the
+// transfer timeout
+func (s *SSHService) DownloadFile(ctx context.Context, remotePath, localPath string) (err error) {
 	if s.client == nil {
 		return fmt.Errorf("not connected to server")
 	}
 
-	session, err := s.client.NewSession()
+	command := "cat " + ShellQuote(remotePath)
+	ctx, span := s.startCommandSpan(ctx, "ssh.download", command)
+	defer func() { endCommandSpan(span, err) }()
+
+	session, err := s.newSession(ctx, orDefault(s.config.TransferTimeout, DefaultTransferTimeout))
 	if err != nil {
-		return fmt.Errorf("failed to create session: %v", err)
+		return err
 	}
 	defer session.Close()
 
@@ -126,25 +293,39 @@ func (s *SSHService) DownloadFile(remotePath, localPath string) error {
 	}
 
 	// Start the command
-	if err := session.Start(fmt.Sprintf("cat %s", remotePath)); err != nil {
+	started := time.Now()
+	if err := session.Start(command); err != nil {
+		s.recordCommand(command, started, err)
 		return fmt.Errorf("failed to start command: %v", err)
 	}
 
 	// Copy data
-	_, err = io.Copy(localFile, remoteFile)
+	n, err := io.Copy(localFile, remoteFile)
+	metrics.AddTransferred(metrics.DirectionDownload, n)
+	span.SetAttributes(attribute.Int64("ssh.transferred_bytes", n))
 	if err != nil {
-		return fmt.Errorf("failed to copy data: %v", err)
+		err = session.err(err)
+		s.recordCommand(command, started, err)
+		return fmt.Errorf("failed to copy data: %w", err)
 	}
 
 	// Wait for command to complete
-	return session.Wait()
+	err = session.err(session.Wait())
+	s.recordCommand(command, started, err)
+	return err
 }
 
-func (s *SSHService) UploadFile(localPath, remotePath string) error {
+// UploadFile copies localPath to remotePath, bounded by ctx and the
+// transfer timeout
+func (s *SSHService) UploadFile(ctx context.Context, localPath, remotePath string) (err error) {
 	if s.client == nil {
 		return fmt.Errorf("not connected to server")
 	}
 
+	command := "cat > " + ShellQuote(remotePath)
+	ctx, span := s.startCommandSpan(ctx, "ssh.upload", command)
+	defer func() { endCommandSpan(span, err) }()
+
 	// Read local file
 	localFile, err := os.Open(localPath)
 	if err != nil {
@@ -152,9 +333,9 @@ func (s *SSHService) UploadFile(localPath, remotePath string) error {
 	}
 	defer localFile.Close()
 
-	session, err := s.client.NewSession()
+	session, err := s.newSession(ctx, orDefault(s.config.TransferTimeout, DefaultTransferTimeout))
 	if err != nil {
-		return fmt.Errorf("failed to create session: %v", err)
+		return err
 	}
 	defer session.Close()
 
@@ -165,85 +346,83 @@ func (s *SSHService) UploadFile(localPath, remotePath string) error {
 	}
 
 	// Start the command
-	if err := session.Start(fmt.Sprintf("cat > %s", remotePath)); err != nil {
+	started := time.Now()
+	if err := session.Start(command); err != nil {
+		s.recordCommand(command, started, err)
 		return fmt.Errorf("failed to start command: %v", err)
 	}
 
 	// Copy data
-	_, err = io.Copy(remoteFile, localFile)
+	n, err := io.Copy(remoteFile, localFile)
+	metrics.AddTransferred(metrics.DirectionUpload, n)
+	span.SetAttributes(attribute.Int64("ssh.transferred_bytes", n))
 	if err != nil {
-		return fmt.Errorf("failed to copy data: %v", err)
+		err = session.err(err)
+		s.recordCommand(command, started, err)
+		return fmt.Errorf("failed to copy data: %w", err)
 	}
 
 	// Close the pipe and wait for command to complete
 	remoteFile.Close()
-	return session.Wait()
+	err = session.err(session.Wait())
+	s.recordCommand(command, started, err)
+	return err
 }
 
-func (s *SSHService) GenerateSysinfoFile() (string, error) {
+// GenerateSysinfoFile runs license2_cli getsysinfo and returns the name of
+// the generated file. Each command is bounded by the command timeout and the
+// whole operation by ctx.
+func (s *SSHService) GenerateSysinfoFile(ctx context.Context) (file string, err error) {
 	if s.client == nil {
 		return "", fmt.Errorf("not connected to server")
 	}
 
+	ctx, span := s.startSpan(ctx, "ssh.generate_sysinfo")
+	defer func() { tracing.End(span, err) }()
+
 	// First, check if license2_cli exists and get its version
-	_, err := s.ExecuteCommand("license2_cli --version 2>/dev/null || license2_cli -v 2>/dev/null || echo 'version command failed'")
+	_, err = s.ExecuteCommand(ctx, "license2_cli --version 2>/dev/null || license2_cli -v 2>/dev/null || echo 'version command failed'")
 	if err != nil {
-		return "", fmt.Errorf("failed to check license2_cli version: %v", err)
+		return "", fmt.Errorf("failed to check license2_cli version: %w", err)
 	}
 
-	// Execute license2_cli getsysinfo -f 10
-	output, err := s.ExecuteCommand("license2_cli getsysinfo -f 10")
-	if err != nil {
-		return "", fmt.Errorf("failed to generate sysinfo: %v, output: %s", err, output)
+	// Execute license2_cli getsysinfo -f 10; a failure quotes its output
+	if _, err = s.ExecuteCommand(ctx, "license2_cli getsysinfo -f 10"); err != nil {
+		return "", fmt.Errorf("failed to generate sysinfo: %w", err)
 	}
 
 	// The file should be generated in current directory
 	// We need to find the generated file
-	session, err := s.client.NewSession()
-	if err != nil {
-		return "", fmt.Errorf("failed to create session: %v", err)
-	}
-	defer session.Close()
 
 	// List all files in current directory to see what was created
-	allFiles, err := session.CombinedOutput("ls -la")
-	if err != nil {
-		return "", fmt.Errorf("failed to list all files: %v", err)
-	}
-
-	// Close the current session and create a new one for the next command
-	session.Close()
-	session, err = s.client.NewSession()
+	listing, err := s.run(ctx, "ls -la")
 	if err != nil {
-		return "", fmt.Errorf("failed to create new session: %v", err)
+		return "", fmt.Errorf("failed to list all files: %w", err)
 	}
-	defer session.Close()
+	allFiles := listing.Output()
 
 	// List files to find the generated sysinfo file (license2_cli generates sys_info.bin)
-	fileList, err := session.CombinedOutput("ls -la sys_info.bin 2>/dev/null || ls -la *.sysinfo 2>/dev/null || ls -la sysinfo* 2>/dev/null || echo 'No sysinfo files found'")
+	listCmd := "ls -la sys_info.bin 2>/dev/null || ls -la *.sysinfo 2>/dev/null || ls -la sysinfo* 2>/dev/null || echo 'No sysinfo files found'"
+	fileList, err := s.run(ctx, listCmd)
 	if err != nil {
-		return "", fmt.Errorf("failed to list sysinfo files: %v", err)
+		return "", fmt.Errorf("failed to list sysinfo files: %w", err)
 	}
 
-	output = strings.TrimSpace(string(fileList))
+	output := strings.TrimSpace(fileList.Output())
 	if output == "" || strings.Contains(output, "No sysinfo files found") {
-		// Close current session and create new one for alternative search
-		session.Close()
-		session, err = s.client.NewSession()
-		if err != nil {
-			return "", fmt.Errorf("failed to create session for alternative search: %v", err)
-		}
-		defer session.Close()
-		
 		// Try alternative file patterns
-		altFiles, err := session.CombinedOutput("find . -name 'sys_info*' -o -name '*sysinfo*' -o -name '*.info' -o -name 'system*' 2>/dev/null || echo 'No alternative files found'")
+		findCmd := "find . -name 'sys_info*' -o -name '*sysinfo*' -o -name '*.info' -o -name 'system*' 2>/dev/null || echo 'No alternative files found'"
+		altFiles, err := s.run(ctx, findCmd)
+		if isCancelled(err) {
+			return "", fmt.Errorf("failed to search for sysinfo files: %w", err)
+		}
 		if err == nil {
-			altOutput := strings.TrimSpace(string(altFiles))
+			altOutput := strings.TrimSpace(altFiles.Output())
 			if altOutput != "" && !strings.Contains(altOutput, "No alternative files found") {
-				return "", fmt.Errorf("no sysinfo file generated, but found alternative files: %s. All files: %s", altOutput, string(allFiles))
+				return "", fmt.Errorf("no sysinfo file generated, but found alternative files: %s. All files: %s", altOutput, allFiles)
 			}
 		}
-		return "", fmt.Errorf("no sysinfo file generated. Command output: %s. All files: %s", output, string(allFiles))
+		return "", fmt.Errorf("no sysinfo file generated. Command output: %s. All files: %s", output, allFiles)
 	}
 
 	lines := strings.Split(output, "\n")
@@ -268,21 +447,38 @@ func (s *SSHService) GenerateSysinfoFile() (string, error) {
 	}
 
 	if latestFile == "" {
-		return "", fmt.Errorf("could not determine sysinfo filename from output: %s. All files: %s", output, string(allFiles))
+		return "", fmt.Errorf("could not determine sysinfo filename from output: %s. All files: %s", output, allFiles)
 	}
 
 	return latestFile, nil
 }
 
-// StreamFileToResponse streams a remote file directly to the HTTP response
-func (s *SSHService) StreamFileToResponse(c *gin.Context, remotePath, downloadFilename string) error {
+// StreamFileToResponse streams a remote file directly to the HTTP response.
+// Pass the request context so the transfer stops when the client goes away.
+func (s *SSHService) StreamFileToResponse(ctx context.Context, c *gin.Context, remotePath, downloadFilename string) error {
+	return s.StreamFile(ctx, remotePath, func() io.Writer {
+		// Set response headers for file download
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", downloadFilename))
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Content-Transfer-Encoding", "binary")
+		return c.Writer
+	})
+}
+
+// StreamFile streams a remote file to the writer returned by start, which
+// is called once the remote file has been opened
+func (s *SSHService) StreamFile(ctx context.Context, remotePath string, start func() io.Writer) (err error) {
 	if s.client == nil {
 		return fmt.Errorf("not connected to server")
 	}
 
-	session, err := s.client.NewSession()
+	command := "cat " + ShellQuote(remotePath)
+	ctx, span := s.startCommandSpan(ctx, "ssh.download", command)
+	defer func() { endCommandSpan(span, err) }()
+
+	session, err := s.newSession(ctx, orDefault(s.config.TransferTimeout, DefaultTransferTimeout))
 	if err != nil {
-		return fmt.Errorf("failed to create session: %v", err)
+		return err
 	}
 	defer session.Close()
 
@@ -293,21 +489,211 @@ func (s *SSHService) StreamFileToResponse(c *gin.Context, remotePath, downloadFi
 	}
 
 	// Start the command
-	if err := session.Start(fmt.Sprintf("cat %s", remotePath)); err != nil {
+	started := time.Now()
+	if err := session.Start(command); err != nil {
+		s.recordCommand(command, started, err)
 		return fmt.Errorf("failed to start command: %v", err)
 	}
 
-	// Set response headers for file download
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", downloadFilename))
-	c.Header("Content-Type", "application/octet-stream")
-	c.Header("Content-Transfer-Encoding", "binary")
-
-	// Stream the file content directly to the response
-	_, err = io.Copy(c.Writer, remoteFile)
+	// Stream the file content directly to the destination
+	n, err := io.Copy(start(), remoteFile)
+	metrics.AddTransferred(metrics.DirectionDownload, n)
+	span.SetAttributes(attribute.Int64("ssh.transferred_bytes", n))
 	if err != nil {
-		return fmt.Errorf("failed to copy data to response: %v", err)
+		err = session.err(err)
+		s.recordCommand(command, started, err)
+		return fmt.Errorf("failed to copy data: %w", err)
 	}
 
 	// Wait for command to complete
-	return session.Wait()
+	err = session.err(session.Wait())
+	s.recordCommand(command, started, err)
+	return err
+}
+
+// boundSession is a remote session tied to a context. When the context is
+// cancelled or its deadline passes, the remote process is sent SIGTERM and
+// the session is closed, which unblocks any pending read, write or wait.
+type boundSession struct {
+	*ssh.Session
+	ctx     context.Context
+	timeout time.Duration
+
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// newSession opens a session bounded by ctx and timeout. Callers must Close it.
+func (s *SSHService) newSession(ctx context.Context, timeout time.Duration) (*boundSession, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	session, err := s.client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	b := &boundSession{
+		Session: session,
+		ctx:     ctx,
+		timeout: timeout,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Not every server honours signal requests, so always close too
+			session.Signal(ssh.SIGTERM)
+			session.Close()
+		case <-b.done:
+		}
+	}()
+
+	return b, nil
+}
+
+// Close stops watching the context and closes the session
+func (b *boundSession) Close() error {
+	b.closeOnce.Do(func() {
+		close(b.done)
+		b.cancel()
+	})
+	return b.Session.Close()
+}
+
+// err replaces err with the reason the session was cut short, if it was.
+// The I/O errors seen after an aborted session only say the channel closed.
+func (b *boundSession) err(err error) error {
+	if err == nil {
+		return nil
+	}
+	switch b.ctx.Err() {
+	case context.DeadlineExceeded:
+		return fmt.Errorf("timed out after %v: %w", b.timeout, context.DeadlineExceeded)
+	case context.Canceled:
+		return fmt.Errorf("cancelled: %w", context.Canceled)
+	}
+	return err
+}
+
+// isCancelled reports whether err was caused by a cancelled or expired context
+func isCancelled(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func orDefault(d, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return d
+}
+
+// startSpan starts a span for an operation against this service's server
+func (s *SSHService) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracing.Start(ctx, name, append([]attribute.KeyValue{
+		attribute.String("server.address", s.config.Host),
+		attribute.String("server.port", s.config.Port),
+		attribute.String("ssh.user", s.config.Username),
+	}, attrs...)...)
+}
+
+// startCommandSpan starts a span for one remote command
+func (s *SSHService) startCommandSpan(ctx context.Context, name, command string) (context.Context, trace.Span) {
+	return s.startSpan(ctx, name,
+		attribute.String("ssh.command", command),
+		attribute.String("ssh.operation", metrics.Operation(command)),
+	)
+}
+
+// endCommandSpan records the command's exit status and ends the span
+func endCommandSpan(span trace.Span, err error) {
+	span.SetAttributes(attribute.Int("ssh.exit_status", exitStatus(err)))
+	tracing.End(span, err)
+}
+
+// recordCommand appends an audit record for a remote command that started at
+// started and finished with err
+func (s *SSHService) recordCommand(command string, started time.Time, err error) {
+	s.record(audit.ActionExec, command, started, err)
+}
+
+func (s *SSHService) record(action, command string, started time.Time, err error) {
+	host := net.JoinHostPort(s.config.Host, s.config.Port)
+	switch action {
+	case audit.ActionConnect:
+		metrics.ObserveDial(host, time.Since(started), err)
+	case audit.ActionExec:
+		metrics.ObserveCommand(command, time.Since(started), err)
+	}
+
+	// Metrics group commands by what they run; the audit log and logs also
+	// show how they were run
+	if action == audit.ActionExec && s.escalates(command) {
+		command = s.config.Escalation.describe(command)
+	}
+	s.log(action, command, host, started, err)
+
+	if s.auditLog == nil {
+		return
+	}
+
+	rec := audit.Record{
+		Time:       started,
+		Actor:      s.actor,
+		Action:     action,
+		Host:       host,
+		RemoteUser: s.config.Username,
+		Command:    command,
+		Outcome:    audit.OutcomeSuccess,
+		ExitStatus: exitStatus(err),
+		DurationMS: time.Since(started).Milliseconds(),
+	}
+	if err != nil {
+		rec.Outcome = audit.OutcomeFailure
+		rec.Error = err.Error()
+	}
+
+	if err := s.auditLog.Append(rec); err != nil {
+		s.logger.Error("writing audit record", "error", err)
+	}
+}
+
+// log writes a debug line for a successful connect or command and a warning
+// for a failed one
+func (s *SSHService) log(action, command, host string, started time.Time, err error) {
+	if s.logger == nil {
+		s.logger = slog.Default()
+	}
+
+	args := []any{
+		"host", host,
+		"remote_user", s.config.Username,
+		"duration_ms", time.Since(started).Milliseconds(),
+	}
+	if command != "" {
+		args = append(args, "command", command, "exit_status", exitStatus(err))
+	}
+	if err != nil {
+		s.logger.Warn("ssh "+action+" failed", append(args, "error", err)...)
+		return
+	}
+	s.logger.Debug("ssh "+action, args...)
+}
+
+// exitStatus returns the remote exit status carried by err, 0 for success and
+// -1 when the command did not report one
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus()
+	}
+	return -1
 }
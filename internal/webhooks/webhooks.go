@@ -0,0 +1,755 @@
+// Package webhooks delivers license and job events to registered URLs as
+// signed JSON. Deliveries are retried with exponential backoff and kept in
+// a delivery log, persisted with the webhooks, from which any delivery can
+// be sent again.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	EventJobCompleted     = "job.completed"
+	EventJobFailed        = "job.failed"
+	EventLicenseImported  = "license.imported"
+	EventLicenseExpiring  = "license.expiring"
+	EventFingerprintDrift = "fingerprint.drift"
+	EventHostUnreachable  = "host.unreachable"
+	EventRolloutMissed    = "rollout.missed"
+	EventRolloutHalted    = "rollout.halted"
+	// EventPing is only sent by Ping, whatever a webhook subscribes to
+	EventPing = "ping"
+)
+
+// Events lists the event types a webhook can subscribe to
+var Events = []string{
+	EventJobCompleted,
+	EventJobFailed,
+	EventLicenseImported,
+	EventLicenseExpiring,
+	EventFingerprintDrift,
+	EventHostUnreachable,
+	EventRolloutMissed,
+	EventRolloutHalted,
+}
+
+// Headers sent with every delivery
+const (
+	// SignatureHeader is "t=<unix time>,v1=<hex HMAC-SHA256>", signing the
+	// time, a dot and the body with the webhook's secret
+	SignatureHeader = "X-License-Manager-Signature"
+	EventHeader     = "X-License-Manager-Event"
+	DeliveryHeader  = "X-License-Manager-Delivery"
+)
+
+// Delivery statuses
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Defaults for Options
+const (
+	DefaultMaxAttempts = 5
+	DefaultBackoff     = 10 * time.Second
+	DefaultMaxBackoff  = 10 * time.Minute
+	DefaultTimeout     = 10 * time.Second
+)
+
+// maxFinishedDeliveries bounds how many completed deliveries are kept
+const maxFinishedDeliveries = 1000
+
+// maxResponseBody is how much of a receiver's response body is recorded
+const maxResponseBody = 512
+
+var (
+	// ErrNotFound is returned for an unknown webhook ID
+	ErrNotFound = errors.New("webhook not found")
+	// ErrDeliveryNotFound is returned for an unknown delivery ID
+	ErrDeliveryNotFound = errors.New("delivery not found")
+)
+
+// Event is the JSON body of a delivery
+type Event struct {
+	ID   string    `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Data any       `json:"data"`
+}
+
+// Webhook is a registered receiver. An empty Events list subscribes to
+// every event.
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Subscribed reports whether the webhook receives events of type event
+func (w Webhook) Subscribed(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Attempt is one try at sending a delivery. StatusCode is 0 when no
+// response was received.
+type Attempt struct {
+	Time       time.Time `json:"time"`
+	StatusCode int       `json:"status_code"`
+	Response   string    `json:"response,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+}
+
+// Delivery is one event sent to one webhook, with every attempt made
+type Delivery struct {
+	ID        string          `json:"id"`
+	WebhookID string          `json:"webhook_id"`
+	EventID   string          `json:"event_id"`
+	EventType string          `json:"event_type"`
+	Payload   json.RawMessage `json:"payload"`
+	Status    string          `json:"status"`
+	Attempts  []Attempt       `json:"attempts"`
+	// NextAttemptAt is when a pending delivery is tried next
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	// RedeliveryOf is the delivery this one resends
+	RedeliveryOf string    `json:"redelivery_of,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Options configure a Dispatcher; zero values take the defaults
+type Options struct {
+	// MaxAttempts is how many times a delivery is tried before it fails
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled for each
+	// further retry up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Timeout bounds each attempt
+	Timeout time.Duration
+	// Client sends deliveries; the default transport is used when nil
+	Client *http.Client
+}
+
+// Dispatcher holds the registered webhooks and sends them events. Its state
+// is persisted as a JSON file readable only by its owner since it holds the
+// webhook secrets.
+type Dispatcher struct {
+	mu         sync.Mutex
+	path       string
+	opts       Options
+	webhooks   map[string]*Webhook
+	deliveries map[string]*Delivery
+	// sending holds the deliveries being attempted
+	sending map[string]bool
+	wake    chan struct{}
+}
+
+// state is the persisted form of a Dispatcher
+type state struct {
+	Webhooks   []*Webhook  `json:"webhooks"`
+	Deliveries []*Delivery `json:"deliveries"`
+}
+
+// Open loads the webhooks and delivery log at path, which need not exist
+// yet. Deliveries still pending are resumed by Run.
+func Open(path string, opts Options) (*Dispatcher, error) {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultMaxBackoff
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create webhooks directory: %v", err)
+	}
+
+	d := &Dispatcher{
+		path:       path,
+		opts:       opts,
+		webhooks:   make(map[string]*Webhook),
+		deliveries: make(map[string]*Delivery),
+		sending:    make(map[string]bool),
+		wake:       make(chan struct{}, 1),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read webhooks: %v", err)
+	}
+	if len(data) > 0 {
+		var saved state
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return nil, fmt.Errorf("failed to parse webhooks %s: %v", path, err)
+		}
+		for _, w := range saved.Webhooks {
+			d.webhooks[w.ID] = w
+		}
+		for _, delivery := range saved.Deliveries {
+			d.deliveries[delivery.ID] = delivery
+		}
+	}
+	return d, nil
+}
+
+// Path returns the location of the webhooks file
+func (d *Dispatcher) Path() string {
+	return d.path
+}
+
+// Create registers a webhook for url. events must be known event types;
+// none subscribes to all. A secret is generated when secret is empty.
+func (d *Dispatcher) Create(rawURL string, events []string, secret string) (Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Webhook{}, fmt.Errorf("url %q must be an absolute http or https URL", rawURL)
+	}
+	for _, event := range events {
+		if !known(event) {
+			return Webhook{}, fmt.Errorf("unknown event %q, use one of %s", event, strings.Join(Events, ", "))
+		}
+	}
+	if secret == "" {
+		secret = newID(32)
+	}
+
+	w := &Webhook{
+		ID:        newID(8),
+		URL:       rawURL,
+		Events:    append([]string{}, events...),
+		Secret:    secret,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.webhooks[w.ID] = w
+	if err := d.save(); err != nil {
+		delete(d.webhooks, w.ID)
+		return Webhook{}, err
+	}
+	return *w, nil
+}
+
+// List returns every webhook, oldest first
+func (d *Dispatcher) List() []Webhook {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	list := make([]Webhook, 0, len(d.webhooks))
+	for _, w := range d.webhooks {
+		list = append(list, *w)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
+
+// Get returns the webhook with the given ID
+func (d *Dispatcher) Get(id string) (Webhook, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	w, ok := d.webhooks[id]
+	if !ok {
+		return Webhook{}, ErrNotFound
+	}
+	return *w, nil
+}
+
+// Delete removes a webhook and its deliveries
+func (d *Dispatcher) Delete(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.webhooks[id]; !ok {
+		return ErrNotFound
+	}
+	delete(d.webhooks, id)
+	for deliveryID, delivery := range d.deliveries {
+		if delivery.WebhookID == id {
+			delete(d.deliveries, deliveryID)
+		}
+	}
+	return d.save()
+}
+
+// Deliveries returns the webhook's deliveries, newest first
+func (d *Dispatcher) Deliveries(webhookID string) ([]Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.webhooks[webhookID]; !ok {
+		return nil, ErrNotFound
+	}
+	list := []Delivery{}
+	for _, delivery := range d.deliveries {
+		if delivery.WebhookID == webhookID {
+			list = append(list, copyDelivery(delivery))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list, nil
+}
+
+// Publish sends an event to every webhook subscribed to it. Sending
+// happens in Run; Publish only queues the deliveries. A nil Dispatcher
+// discards the event, which keeps callers free of nil checks when no
+// webhooks are configured.
+func (d *Dispatcher) Publish(eventType string, data any) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	var targets []string
+	for _, w := range d.webhooks {
+		if w.Subscribed(eventType) {
+			targets = append(targets, w.ID)
+		}
+	}
+	d.mu.Unlock()
+	if len(targets) == 0 {
+		return
+	}
+
+	event, payload, err := newEvent(eventType, data)
+	if err != nil {
+		slog.Error("encoding webhook event", "event", eventType, "error", err)
+		return
+	}
+	d.queue(targets, event, payload, "")
+}
+
+// Ping sends a ping event to the webhook, whatever it subscribes to, and
+// returns the queued delivery
+func (d *Dispatcher) Ping(webhookID string) (Delivery, error) {
+	if _, err := d.Get(webhookID); err != nil {
+		return Delivery{}, err
+	}
+	event, payload, err := newEvent(EventPing, map[string]string{"webhook_id": webhookID})
+	if err != nil {
+		return Delivery{}, err
+	}
+	return d.queue([]string{webhookID}, event, payload, "")
+}
+
+// Redeliver queues a new delivery of the same payload as an earlier one,
+// with a new delivery ID and signature
+func (d *Dispatcher) Redeliver(webhookID, deliveryID string) (Delivery, error) {
+	d.mu.Lock()
+	if _, ok := d.webhooks[webhookID]; !ok {
+		d.mu.Unlock()
+		return Delivery{}, ErrNotFound
+	}
+	original, ok := d.deliveries[deliveryID]
+	if !ok || original.WebhookID != webhookID {
+		d.mu.Unlock()
+		return Delivery{}, ErrDeliveryNotFound
+	}
+	event := Event{ID: original.EventID, Type: original.EventType}
+	payload := original.Payload
+	d.mu.Unlock()
+
+	return d.queue([]string{webhookID}, event, payload, deliveryID)
+}
+
+// queue adds a pending delivery of payload for each webhook and wakes Run.
+// It returns the last delivery queued.
+func (d *Dispatcher) queue(webhookIDs []string, event Event, payload []byte, redeliveryOf string) (Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now().UTC()
+	var last *Delivery
+	for _, id := range webhookIDs {
+		if _, ok := d.webhooks[id]; !ok {
+			continue
+		}
+		next := now
+		last = &Delivery{
+			ID:            newID(8),
+			WebhookID:     id,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       payload,
+			Status:        StatusPending,
+			Attempts:      []Attempt{},
+			NextAttemptAt: &next,
+			RedeliveryOf:  redeliveryOf,
+			CreatedAt:     now,
+		}
+		d.deliveries[last.ID] = last
+	}
+	if last == nil {
+		return Delivery{}, ErrNotFound
+	}
+	if err := d.save(); err != nil {
+		// The in-memory state is still correct; the next save retries
+		slog.Error("saving webhooks", "event", event.Type, "error", err)
+	}
+	d.signal()
+	return copyDelivery(last), nil
+}
+
+// signal wakes Run without blocking
+func (d *Dispatcher) signal() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends due deliveries until stop is closed, including those left
+// pending by the previous process
+func (d *Dispatcher) Run(stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer func() {
+		// Cancel in-flight attempts before waiting for them
+		cancel()
+		wg.Wait()
+	}()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-d.wake:
+		case <-timer.C:
+		}
+
+		due, next := d.due(time.Now())
+		for _, id := range due {
+			wg.Add(1)
+			go func(id string) {
+				defer wg.Done()
+				d.attempt(ctx, id)
+			}(id)
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if !next.IsZero() {
+			timer.Reset(time.Until(next))
+		}
+	}
+}
+
+// due marks the pending deliveries due at now as sending and returns them,
+// with the time the next of the others is due (zero when there is none)
+func (d *Dispatcher) due(now time.Time) ([]string, time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var due []string
+	var next time.Time
+	for id, delivery := range d.deliveries {
+		if delivery.Status != StatusPending || d.sending[id] || delivery.NextAttemptAt == nil {
+			continue
+		}
+		if !delivery.NextAttemptAt.After(now) {
+			d.sending[id] = true
+			due = append(due, id)
+		} else if next.IsZero() || delivery.NextAttemptAt.Before(next) {
+			next = *delivery.NextAttemptAt
+		}
+	}
+	return due, next
+}
+
+// attempt sends a delivery once and records the outcome, scheduling a
+// retry or failing it when the receiver did not answer with 2xx
+func (d *Dispatcher) attempt(ctx context.Context, id string) {
+	d.mu.Lock()
+	delivery, ok := d.deliveries[id]
+	var webhook Webhook
+	if ok {
+		if w, found := d.webhooks[delivery.WebhookID]; found {
+			webhook = *w
+		} else {
+			ok = false
+		}
+	}
+	var payload []byte
+	var eventType string
+	if ok {
+		payload, eventType = delivery.Payload, delivery.EventType
+	}
+	d.mu.Unlock()
+	if !ok {
+		// Deleted with its webhook while waiting
+		d.mu.Lock()
+		delete(d.sending, id)
+		d.mu.Unlock()
+		return
+	}
+
+	result := d.send(ctx, webhook, id, eventType, payload)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.sending, id)
+	delivery, ok = d.deliveries[id]
+	if !ok || ctx.Err() != nil {
+		// Stopped mid-attempt; the delivery stays due for the next Run
+		return
+	}
+	delivery.Attempts = append(delivery.Attempts, result)
+	switch {
+	case result.StatusCode >= 200 && result.StatusCode < 300:
+		delivery.Status = StatusSucceeded
+		delivery.NextAttemptAt = nil
+	case len(delivery.Attempts) >= d.opts.MaxAttempts:
+		delivery.Status = StatusFailed
+		delivery.NextAttemptAt = nil
+		slog.Warn("webhook delivery failed", "webhook_id", webhook.ID, "delivery_id", id, "event", eventType, "attempts", len(delivery.Attempts))
+	default:
+		next := time.Now().UTC().Add(d.backoff(len(delivery.Attempts)))
+		delivery.NextAttemptAt = &next
+	}
+	if err := d.save(); err != nil {
+		slog.Error("saving webhooks", "delivery_id", id, "error", err)
+	}
+	d.signal()
+}
+
+// send posts the signed payload to the webhook
+func (d *Dispatcher) send(ctx context.Context, webhook Webhook, deliveryID, eventType string, payload []byte) Attempt {
+	started := time.Now()
+	result := Attempt{Time: started.UTC()}
+	defer func() { result.DurationMS = time.Since(started).Milliseconds() }()
+
+	ctx, cancel := context.WithTimeout(ctx, d.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "license-manager-webhooks")
+	req.Header.Set(EventHeader, eventType)
+	req.Header.Set(DeliveryHeader, deliveryID)
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, started.Unix(), payload))
+
+	resp, err := d.opts.Client.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	io.Copy(io.Discard, resp.Body)
+
+	result.StatusCode = resp.StatusCode
+	result.Response = string(body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		result.Error = "receiver answered " + resp.Status
+	}
+	return result
+}
+
+// backoff is the delay after the given number of failed attempts: Backoff
+// doubled per retry up to MaxBackoff, less up to half at random so that
+// retries to one receiver spread out
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.opts.Backoff
+	for i := 1; i < attempts && delay < d.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.opts.MaxBackoff {
+		delay = d.opts.MaxBackoff
+	}
+	return delay - time.Duration(mathrand.Int63n(int64(delay)/2+1))
+}
+
+// save writes the webhooks and deliveries atomically. Callers must hold
+// d.mu.
+func (d *Dispatcher) save() error {
+	d.prune()
+
+	saved := state{Webhooks: []*Webhook{}, Deliveries: []*Delivery{}}
+	for _, w := range d.webhooks {
+		saved.Webhooks = append(saved.Webhooks, w)
+	}
+	sort.Slice(saved.Webhooks, func(i, j int) bool {
+		return saved.Webhooks[i].CreatedAt.Before(saved.Webhooks[j].CreatedAt)
+	})
+	for _, delivery := range d.deliveries {
+		saved.Deliveries = append(saved.Deliveries, delivery)
+	}
+	sort.Slice(saved.Deliveries, func(i, j int) bool {
+		return saved.Deliveries[i].CreatedAt.Before(saved.Deliveries[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode webhooks: %v", err)
+	}
+
+	tmp := d.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write webhooks: %v", err)
+	}
+	if err := os.Rename(tmp, d.path); err != nil {
+		return fmt.Errorf("failed to replace webhooks: %v", err)
+	}
+	return nil
+}
+
+// prune drops the oldest finished deliveries beyond maxFinishedDeliveries.
+// Callers must hold d.mu.
+func (d *Dispatcher) prune() {
+	var finished []*Delivery
+	for _, delivery := range d.deliveries {
+		if delivery.Status != StatusPending {
+			finished = append(finished, delivery)
+		}
+	}
+	if len(finished) <= maxFinishedDeliveries {
+		return
+	}
+
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].CreatedAt.Before(finished[j].CreatedAt)
+	})
+	for _, delivery := range finished[:len(finished)-maxFinishedDeliveries] {
+		delete(d.deliveries, delivery.ID)
+	}
+}
+
+// Sign returns the signature header value for a body sent at timestamp
+func Sign(secret string, timestamp int64, body []byte) string {
+	t := strconv.FormatInt(timestamp, 10)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac(secret, t, body))
+}
+
+// Verify checks a signature header against the body, as a receiver would.
+// A signature older than tolerance is rejected to prevent replays; zero
+// accepts any age.
+func Verify(secret, header string, body []byte, tolerance time.Duration) error {
+	var t string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			if sig, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+	timestamp, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return errors.New("malformed signature header")
+	}
+	if tolerance > 0 {
+		if age := time.Since(time.Unix(timestamp, 0)); age > tolerance || age < -tolerance {
+			return errors.New("signature timestamp is outside the tolerance")
+		}
+	}
+	expected := mac(secret, t, body)
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+	return errors.New("signature does not match")
+}
+
+func mac(secret, timestamp string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+func newEvent(eventType string, data any) (Event, []byte, error) {
+	event := Event{ID: newID(8), Type: eventType, Time: time.Now().UTC(), Data: data}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return Event{}, nil, fmt.Errorf("failed to encode event: %v", err)
+	}
+	return event, payload, nil
+}
+
+func known(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func copyDelivery(delivery *Delivery) Delivery {
+	cp := *delivery
+	cp.Attempts = append([]Attempt{}, delivery.Attempts...)
+	if delivery.NextAttemptAt != nil {
+		t := *delivery.NextAttemptAt
+		cp.NextAttemptAt = &t
+	}
+	return cp
+}
+
+func newID(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic("crypto/rand failed: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
@@ -1,33 +1,282 @@
 package main
 
 import (
+	"context"
+	"license-manager/internal/audit"
+	"license-manager/internal/certs"
+	"license-manager/internal/chat"
+	"license-manager/internal/config"
+	"license-manager/internal/expiry"
+	"license-manager/internal/grpcserver"
 	"license-manager/internal/handlers"
-	"license-manager/internal/middleware"
-	"log"
+	"license-manager/internal/inventory"
+	"license-manager/internal/jobs"
+	"license-manager/internal/logging"
+	"license-manager/internal/metrics"
+	"license-manager/internal/notify"
+	"license-manager/internal/offline"
+	"license-manager/internal/rollouts"
+	"license-manager/internal/server"
+	"license-manager/internal/services"
+	"license-manager/internal/tracing"
+	"license-manager/internal/webhooks"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 
 	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
 func main() {
-	// Create Gin router
-	r := gin.Default()
+	// "license-manager offline ..." works directly over SSH without serving
+	if len(os.Args) > 1 && os.Args[1] == "offline" {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		code := offline.Main(ctx, os.Args[2:], os.Stdout, os.Stderr)
+		stop()
+		os.Exit(code)
+	}
+
+	// Load configuration from file, environment and flags
+	cfg, opts, err := config.Parse(os.Args[1:])
+	if err != nil {
+		fatal("invalid configuration", err)
+	}
+	// The configuration is printed before it is validated, so that an
+	// invalid one can be inspected; the validation error follows
+	if opts.PrintConfig {
+		if err := cfg.PrintConfig(os.Stdout); err != nil {
+			fatal("failed to print configuration", err)
+		}
+		if err := cfg.Validate(); err != nil {
+			fatal("invalid configuration", err)
+		}
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		fatal("invalid configuration", err)
+	}
+
+	// Structured logs; the standard log package is routed through the same
+	// handler so nothing bypasses redaction
+	logOptions, _ := cfg.Logging()
+	logger, err := logging.New(os.Stderr, logOptions)
+	if err != nil {
+		fatal("invalid log settings", err)
+	}
+	slog.SetDefault(logger)
+	if os.Getenv(gin.EnvGinMode) == "" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	handlers.Configure(handlers.Settings{
+		UploadDir:          cfg.Storage.UploadDir,
+		RemoteTempDir:      cfg.SSH.RemoteTempDir,
+		SSHTimeout:         cfg.SSH.Timeout,
+		SSHCommandTimeout:  cfg.SSH.CommandTimeout,
+		SSHTransferTimeout: cfg.SSH.TransferTimeout,
+		ExpiryWarningDays:  cfg.Webhooks.ExpiryWarningDays,
+	})
+
+	// Send spans to the configured exporter
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.TracingOptions(), os.Stdout)
+	if err != nil {
+		fatal("failed to set up tracing", err)
+	}
+
+	// Share authenticated SSH connections across requests
+	stop := make(chan struct{})
+	var sshPool *services.Pool
+	if cfg.SSH.PoolIdleTTL > 0 {
+		sshPool = services.NewPool(cfg.SSHPool())
+		go sshPool.Maintain(stop)
+		handlers.SetSSHPool(sshPool)
+	}
 
-	// Add middleware
-	r.Use(middleware.CORS())
+	// Open the audit log
+	auditLog, err := audit.Open(cfg.Storage.AuditLogPath)
+	if err != nil {
+		fatal("failed to open audit log", err)
+	}
+	if _, err := auditLog.Verify(); err != nil {
+		slog.Warn("audit log failed verification", "path", cfg.Storage.AuditLogPath, "error", err)
+	}
+	handlers.SetAuditLog(auditLog)
 
-	// Serve static files
-	r.Static("/static", "./static")
-	r.LoadHTMLGlob("templates/*")
+	// Open the job state; jobs cut off by the last shutdown become interrupted
+	jobManager, err := jobs.Open(cfg.Storage.JobsStatePath)
+	if err != nil {
+		fatal("failed to open job state", err)
+	}
+	if interrupted := jobManager.List(jobs.StatusInterrupted); len(interrupted) > 0 {
+		slog.Warn("interrupted jobs need review, see /api/jobs?status=interrupted", "count", len(interrupted))
+	}
+	handlers.SetJobManager(jobManager)
 
-	// Routes
-	r.GET("/", handlers.IndexHandler)
-	r.POST("/api/check-license-cli", handlers.CheckLicenseCLIHandler)
-	r.POST("/api/download-sysinfo", handlers.DownloadSysinfoHandler)
-	r.POST("/api/upload-license", handlers.UploadLicenseHandler)
+	// Open the server inventory that requests and lmctl refer to by name
+	servers, err := inventory.Open(cfg.Storage.InventoryPath)
+	if err != nil {
+		fatal("failed to open server inventory", err)
+	}
+	handlers.SetInventory(servers)
+
+	// Send events to registered webhooks, resuming deliveries left pending
+	dispatcher, err := webhooks.Open(cfg.Storage.WebhooksPath, cfg.WebhookOptions())
+	if err != nil {
+		fatal("failed to open webhooks", err)
+	}
+	go dispatcher.Run(stop)
+	handlers.SetWebhooks(dispatcher)
+
+	// Post job outcomes and expiry alerts to routed chat channels
+	chatNotifier, err := chat.Open(cfg.Storage.ChatRoutesPath, cfg.ChatOptions())
+	if err != nil {
+		fatal("failed to open chat routes", err)
+	}
+	go chatNotifier.Run(stop)
+	handlers.SetChat(chatNotifier)
+
+	// Report licenses as they enter the expiry warning period, once each
+	expiryWatcher, err := expiry.Open(cfg.Storage.ExpiryPath, cfg.ExpiryOptions(), handlers.DigestSource(), handlers.ReportExpiring)
+	if err != nil {
+		fatal("failed to open expiry state", err)
+	}
+	go expiryWatcher.Run(stop)
+	handlers.SetExpiry(expiryWatcher)
+
+	// Hold scheduled license imports until their maintenance window opens
+	scheduler, err := rollouts.Open(cfg.Storage.RolloutsPath, cfg.RolloutOptions(), handlers.RolloutRunner())
+	if err != nil {
+		fatal("failed to open rollouts", err)
+	}
+	go scheduler.Run(stop)
+	handlers.SetRollouts(scheduler)
+
+	// Email subscribers digests of expiring licenses and failed jobs
+	if cfg.EmailEnabled() {
+		notifier, err := notify.Open(cfg.Storage.SubscribersPath, cfg.NotifyOptions(), handlers.DigestSource())
+		if err != nil {
+			fatal("failed to open email subscribers", err)
+		}
+		go notifier.Run(stop)
+		handlers.SetNotifier(notifier)
+	}
+
+	handlers.SetBuildVersion(version)
+	readiness := []handlers.ReadinessCheck{
+		{Name: "config", Check: func(context.Context) error { return cfg.Validate() }},
+		{Name: "templates_static", Check: func(context.Context) error { return cfg.ValidatePaths() }},
+		{Name: "upload_dir", Check: handlers.DirWritable(cfg.Storage.UploadDir)},
+		{Name: "audit_log", Check: handlers.DirWritable(filepath.Dir(cfg.Storage.AuditLogPath))},
+		{Name: "job_state", Check: handlers.DirWritable(filepath.Dir(cfg.Storage.JobsStatePath))},
+		{Name: "inventory", Check: handlers.DirWritable(filepath.Dir(cfg.Storage.InventoryPath))},
+		{Name: "webhooks", Check: handlers.FileWritable(cfg.Storage.WebhooksPath)},
+		{Name: "chat_routes", Check: handlers.FileWritable(cfg.Storage.ChatRoutesPath)},
+		{Name: "rollouts", Check: handlers.FileWritable(cfg.Storage.RolloutsPath)},
+		{Name: "expiry_state", Check: handlers.FileWritable(cfg.Storage.ExpiryPath)},
+	}
+	if cfg.EmailEnabled() {
+		readiness = append(readiness, handlers.ReadinessCheck{Name: "subscribers", Check: handlers.FileWritable(cfg.Storage.SubscribersPath)})
+	}
+	handlers.SetReadinessChecks(readiness...)
+	metrics.RegisterActiveJobs(jobManager.Running)
+
+	// Create Gin router with its middleware and routes
+	r := server.NewRouter(cfg)
 
 	// Start server
-	log.Println("License Manager starting on :8080")
-	if err := r.Run(":8080"); err != nil {
-		log.Fatal("Failed to start server:", err)
+	srv := &http.Server{
+		Addr:    cfg.Server.ListenAddr,
+		Handler: r,
+	}
+
+	if cfg.Certs().Enabled() {
+		reloader, err := certs.NewReloader(cfg.Certs())
+		if err != nil {
+			fatal("failed to load TLS certificate", err)
+		}
+		go reloader.Watch(cfg.TLS.ReloadInterval, stop)
+		srv.TLSConfig = reloader.TLSConfig()
+	}
+
+	// The gRPC API runs beside the HTTP server, with the same TLS settings
+	var grpcServer *grpcserver.Server
+	if cfg.Server.GRPCListenAddr != "" {
+		var opts []grpc.ServerOption
+		if srv.TLSConfig != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(srv.TLSConfig)))
+		}
+		grpcServer = grpcserver.New(cfg.APITokens(), opts...)
+	}
+
+	serveErr := make(chan error, 2)
+	if grpcServer != nil {
+		lis, err := net.Listen("tcp", cfg.Server.GRPCListenAddr)
+		if err != nil {
+			fatal("failed to listen for gRPC", err)
+		}
+		go func() {
+			slog.Info("gRPC API starting", "addr", cfg.Server.GRPCListenAddr, "tls", srv.TLSConfig != nil)
+			serveErr <- grpcServer.Serve(lis)
+		}()
 	}
+	go func() {
+		if srv.TLSConfig != nil {
+			slog.Info("License Manager starting", "addr", cfg.Server.ListenAddr, "tls", true)
+			serveErr <- srv.ListenAndServeTLS("", "")
+		} else {
+			slog.Info("License Manager starting", "addr", cfg.Server.ListenAddr, "tls", false)
+			serveErr <- srv.ListenAndServe()
+		}
+	}()
+
+	// Wait for SIGTERM (Kubernetes) or SIGINT (Ctrl-C)
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-serveErr:
+		fatal("failed to start server", err)
+	case sig := <-quit:
+		slog.Info("shutting down, draining running jobs", "signal", sig.String(), "running_jobs", jobManager.Running(), "grace_period", cfg.Server.ShutdownGracePeriod.String())
+	}
+
+	// Stop accepting requests and give in-flight jobs the grace period to
+	// finish; whatever is still running afterwards is marked interrupted
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownGracePeriod)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("HTTP server did not shut down cleanly", "error", err)
+	}
+	if grpcServer != nil {
+		if err := grpcServer.Shutdown(ctx); err != nil {
+			slog.Warn("gRPC server did not shut down cleanly", "error", err)
+		}
+	}
+	if err := jobManager.Shutdown(ctx); err != nil {
+		slog.Warn("marked unfinished jobs as interrupted", "error", err)
+	}
+	close(stop)
+	if sshPool != nil {
+		sshPool.Close()
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Warn("failed to flush traces", "error", err)
+	}
+
+	slog.Info("License Manager stopped")
+}
+
+// fatal logs err and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
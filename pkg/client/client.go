@@ -0,0 +1,309 @@
+// Package client is a Go client for the License Manager versioned API
+// (/api/v1). It authenticates with an API token, retries requests that
+// failed before the server did any work, and reports the progress of
+// long-running operations by following their jobs.
+//
+//	c, err := client.New("https://license-manager.example.com", client.Options{Token: os.Getenv("LM_TOKEN")})
+//	result, err := c.PushLicenseFile(ctx, "web-1", "site.lic", func(job client.Job) {
+//		log.Printf("%s: %s %s", job.ID, job.Status, job.Step)
+//	})
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPollInterval is how often job progress is polled
+const DefaultPollInterval = time.Second
+
+// DefaultRetryPolicy retries three times, backing off from 250ms to 5s
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	MinBackoff: 250 * time.Millisecond,
+	MaxBackoff: 5 * time.Second,
+}
+
+// Options configures a Client
+type Options struct {
+	// Token is an API token secret from security.api_tokens
+	Token string
+	// HTTPClient defaults to a client without a timeout; deadlines come
+	// from the context of each call, since imports can take minutes
+	HTTPClient *http.Client
+	// Retry defaults to DefaultRetryPolicy
+	Retry RetryPolicy
+	// PollInterval defaults to DefaultPollInterval
+	PollInterval time.Duration
+	UserAgent    string
+}
+
+// RetryPolicy decides how failed requests are retried. Requests are retried
+// when the server rejected them before doing any work (429, 503 or a
+// refused connection) and, for GET, PUT and DELETE, also after gateway
+// errors and dropped connections. Failed remote operations are never
+// retried, so a license is not imported twice.
+type RetryPolicy struct {
+	// MaxRetries is how many times a request is retried; negative disables
+	// retries
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// Client calls the versioned API. It is safe for concurrent use.
+type Client struct {
+	baseURL *url.URL
+	opts    Options
+}
+
+// New returns a client for the server at baseURL, e.g.
+// "https://license-manager.example.com"
+func New(baseURL string, opts Options) (*Client, error) {
+	u, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid server URL %q", baseURL)
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{}
+	}
+	if opts.Retry == (RetryPolicy{}) {
+		opts.Retry = DefaultRetryPolicy
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.UserAgent == "" {
+		opts.UserAgent = "license-manager-client"
+	}
+	return &Client{baseURL: u, opts: opts}, nil
+}
+
+// Error codes of API errors
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeUnavailable      = "unavailable"
+	CodeConnectionFailed = "connection_failed"
+	CodeCLINotFound      = "cli_not_found"
+	CodeRemoteFailed     = "remote_command_failed"
+	CodeInternal         = "internal"
+)
+
+// Error is an error response from the API
+type Error struct {
+	StatusCode int
+	// Code is one of the Code constants, or empty when the response did not
+	// come from the API (e.g. a proxy error page)
+	Code    string
+	Message string
+	// Details is what the operation produced before it failed, such as the
+	// LicenseImport of a rejected license with the import command's output
+	Details json.RawMessage
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("%s (HTTP %d %s)", e.Message, e.StatusCode, e.Code)
+}
+
+// ErrorCode returns the API error code of err, or "" when err is not an
+// API error
+func ErrorCode(err error) string {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return ""
+}
+
+// IsNotFound reports whether err is a 404 from the API
+func IsNotFound(err error) bool {
+	return ErrorCode(err) == CodeNotFound
+}
+
+// request is one API call; the body is kept so it can be resent
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	body        []byte
+	contentType string
+}
+
+func jsonRequest(method, path string, body any) (request, error) {
+	req := request{method: method, path: path}
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return req, fmt.Errorf("failed to encode request: %v", err)
+		}
+		req.body, req.contentType = data, "application/json"
+	}
+	return req, nil
+}
+
+// call sends req and decodes a JSON response into out, if given
+func (c *Client) call(ctx context.Context, req request, out any) (int, error) {
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("failed to decode response: %v", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// send sends req, retrying as the policy allows, and returns a successful
+// response for the caller to read and close
+func (c *Client) send(ctx context.Context, req request) (*http.Response, error) {
+	u := *c.baseURL
+	u.Path += "/api/v1" + req.path
+	u.RawQuery = req.query.Encode()
+
+	for attempt := 0; ; attempt++ {
+		httpReq, err := http.NewRequestWithContext(ctx, req.method, u.String(), bytes.NewReader(req.body))
+		if err != nil {
+			return nil, err
+		}
+		if req.contentType != "" {
+			httpReq.Header.Set("Content-Type", req.contentType)
+		}
+		if c.opts.Token != "" {
+			httpReq.Header.Set("Authorization", "Bearer "+c.opts.Token)
+		}
+		httpReq.Header.Set("Accept", "application/json")
+		httpReq.Header.Set("User-Agent", c.opts.UserAgent)
+
+		resp, err := c.opts.HTTPClient.Do(httpReq)
+		var retryAfter time.Duration
+		switch {
+		case err != nil:
+			if ctx.Err() != nil || !c.retryableError(req.method, err) {
+				return nil, err
+			}
+		case resp.StatusCode < http.StatusBadRequest:
+			return resp, nil
+		default:
+			apiErr := readError(resp)
+			if !retryableStatus(req.method, resp.StatusCode) {
+				return nil, apiErr
+			}
+			retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+			err = apiErr
+		}
+
+		if attempt >= c.opts.Retry.MaxRetries {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(c.backoff(attempt, retryAfter)):
+		}
+	}
+}
+
+// idempotent methods can be resent after a failure midway
+func idempotent(method string) bool {
+	return method == http.MethodGet || method == http.MethodPut || method == http.MethodDelete
+}
+
+// retryableError reports whether a transport error can be retried: a
+// refused connection never reached the server
+func (c *Client) retryableError(method string, err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return idempotent(method)
+}
+
+func retryableStatus(method string, status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent(method)
+	}
+	return false
+}
+
+// backoff doubles from MinBackoff up to MaxBackoff with jitter, waiting at
+// least as long as the server asked
+func (c *Client) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	policy := c.opts.Retry
+	d := policy.MinBackoff << attempt
+	if d <= 0 || d > policy.MaxBackoff {
+		d = policy.MaxBackoff
+	}
+	d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	if retryAfter > d {
+		d = retryAfter
+	}
+	if d > policy.MaxBackoff {
+		d = policy.MaxBackoff
+	}
+	return d
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 0
+}
+
+// readError reads an error response into an *Error and closes it
+func readError(resp *http.Response) *Error {
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	var envelope struct {
+		Error struct {
+			Code    string          `json:"code"`
+			Message string          `json:"message"`
+			Details json.RawMessage `json:"details"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(data, &envelope) == nil && envelope.Error.Code != "" {
+		return &Error{StatusCode: resp.StatusCode, Code: envelope.Error.Code, Message: envelope.Error.Message, Details: envelope.Error.Details}
+	}
+	message := strings.TrimSpace(string(data))
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+	return &Error{StatusCode: resp.StatusCode, Message: message}
+}
+
+// pageQuery adds limit and offset when set
+func pageQuery(query url.Values, limit, offset int) url.Values {
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if offset > 0 {
+		query.Set("offset", strconv.Itoa(offset))
+	}
+	return query
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ListJobsOptions filters and pages the job list
+type ListJobsOptions struct {
+	// Status is one of the Job statuses, or empty for every job
+	Status string
+	Limit  int
+	Offset int
+}
+
+// ListJobs returns one page of jobs, newest first
+func (c *Client) ListJobs(ctx context.Context, opts ListJobsOptions) (*JobPage, error) {
+	query := url.Values{}
+	if opts.Status != "" {
+		query.Set("status", opts.Status)
+	}
+	var page JobPage
+	req := request{method: http.MethodGet, path: "/jobs", query: pageQuery(query, opts.Limit, opts.Offset)}
+	if _, err := c.call(ctx, req, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// GetJob returns the job with the given ID
+func (c *Client) GetJob(ctx context.Context, id string) (*Job, error) {
+	var job Job
+	if _, err := c.call(ctx, request{method: http.MethodGet, path: "/jobs/" + url.PathEscape(id)}, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// WatchOptions selects the jobs WatchJobs follows; empty fields match
+// every job
+type WatchOptions struct {
+	Kind string
+	// Host is "host:port"
+	Host  string
+	Actor string
+	// Since skips jobs started before it
+	Since time.Time
+}
+
+// WatchJobs polls running jobs until ctx is done and calls fn each time a
+// matching job starts, moves to another step or finishes. It returns the
+// context's error, or the first error from the API.
+func (c *Client) WatchJobs(ctx context.Context, opts WatchOptions, fn func(Job)) error {
+	seen := map[string]string{} // running job ID -> step
+	ticker := time.NewTicker(c.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		page, err := c.ListJobs(ctx, ListJobsOptions{Status: JobRunning, Limit: maxPageLimit})
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		running := map[string]bool{}
+		for _, job := range page.Items {
+			if !opts.matches(job) {
+				continue
+			}
+			running[job.ID] = true
+			if step, ok := seen[job.ID]; !ok || step != job.Step {
+				seen[job.ID] = job.Step
+				fn(job)
+			}
+		}
+		for id := range seen {
+			if running[id] {
+				continue
+			}
+			delete(seen, id)
+			if job, err := c.GetJob(ctx, id); err == nil {
+				fn(*job)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (o WatchOptions) matches(job Job) bool {
+	return (o.Kind == "" || job.Kind == o.Kind) &&
+		(o.Host == "" || job.Host == o.Host) &&
+		(o.Actor == "" || job.Actor == o.Actor) &&
+		!job.StartedAt.Before(o.Since)
+}
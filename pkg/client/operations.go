@@ -0,0 +1,140 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// CheckServer checks that license2_cli is installed on the named server
+func (c *Client) CheckServer(ctx context.Context, name string) (*Check, error) {
+	var check Check
+	if _, err := c.call(ctx, request{method: http.MethodPost, path: serverPath(name, "check")}, &check); err != nil {
+		return nil, err
+	}
+	return &check, nil
+}
+
+// Preflight runs the preflight checks on the named server. Failed checks
+// are reported in the report, not as an error.
+func (c *Client) Preflight(ctx context.Context, name string) (*Preflight, error) {
+	var preflight Preflight
+	if _, err := c.call(ctx, request{method: http.MethodPost, path: serverPath(name, "preflight")}, &preflight); err != nil {
+		return nil, err
+	}
+	return &preflight, nil
+}
+
+// DownloadSysinfo generates a sysinfo file on the named server and writes
+// it to w
+func (c *Client) DownloadSysinfo(ctx context.Context, name string, w io.Writer) (*Sysinfo, error) {
+	resp, err := c.send(ctx, request{method: http.MethodPost, path: serverPath(name, "sysinfo")})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	sysinfo := &Sysinfo{JobID: resp.Header.Get("X-Job-ID")}
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		sysinfo.Filename = params["filename"]
+	}
+	if sysinfo.Size, err = io.Copy(w, resp.Body); err != nil {
+		return nil, fmt.Errorf("failed to download sysinfo file: %v", err)
+	}
+	return sysinfo, nil
+}
+
+// PushLicense imports a license on the named server. When progress is not
+// nil it is called, from another goroutine while the import runs, with the
+// import job each time its step changes, and once more when it has
+// finished.
+func (c *Client) PushLicense(ctx context.Context, name, filename string, license io.Reader, progress func(Job)) (*LicenseImport, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("license_file", filepath.Base(filename))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, license); err != nil {
+		return nil, fmt.Errorf("failed to read license file: %v", err)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	req := request{
+		method:      http.MethodPost,
+		path:        serverPath(name, "licenses"),
+		body:        body.Bytes(),
+		contentType: mw.FormDataContentType(),
+	}
+
+	if progress == nil {
+		var result LicenseImport
+		if _, err := c.call(ctx, req, &result); err != nil {
+			return nil, err
+		}
+		return &result, nil
+	}
+
+	// The job ID is only known once the import returns, so follow this
+	// client's running imports on the server's host meanwhile
+	server, err := c.GetServer(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := c.WhoAmI(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var last Job
+	watchCtx, stopWatching := context.WithCancel(ctx)
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+		c.WatchJobs(watchCtx, WatchOptions{
+			Kind:  KindImport,
+			Host:  net.JoinHostPort(server.Host, server.Port),
+			Actor: identity.Actor,
+		}, func(job Job) {
+			last = job
+			progress(job)
+		})
+	}()
+
+	var result LicenseImport
+	_, err = c.call(ctx, req, &result)
+	stopWatching()
+	<-watched
+	if err != nil {
+		return nil, err
+	}
+	if result.JobID != "" && (last.ID != result.JobID || last.Status == JobRunning) {
+		if job, err := c.GetJob(ctx, result.JobID); err == nil {
+			progress(*job)
+		}
+	}
+	return &result, nil
+}
+
+// PushLicenseFile imports the license file at path on the named server;
+// see PushLicense
+func (c *Client) PushLicenseFile(ctx context.Context, name, path string, progress func(Job)) (*LicenseImport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return c.PushLicense(ctx, name, filepath.Base(path), f, progress)
+}
+
+func serverPath(name, operation string) string {
+	return "/servers/" + url.PathEscape(name) + "/" + operation
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ListRolloutsOptions filters and pages rollouts
+type ListRolloutsOptions struct {
+	// Status is one of the Rollout statuses, or empty for all
+	Status string
+	Limit  int
+	Offset int
+}
+
+// ListRollouts returns one page of rollouts, newest first
+func (c *Client) ListRollouts(ctx context.Context, opts ListRolloutsOptions) (*RolloutPage, error) {
+	query := url.Values{}
+	if opts.Status != "" {
+		query.Set("status", opts.Status)
+	}
+	var page RolloutPage
+	req := request{method: http.MethodGet, path: "/rollouts", query: pageQuery(query, opts.Limit, opts.Offset)}
+	if _, err := c.call(ctx, req, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// GetRollout returns a rollout and the status of each server
+func (c *Client) GetRollout(ctx context.Context, id string) (*Rollout, error) {
+	var rollout Rollout
+	if _, err := c.call(ctx, request{method: http.MethodGet, path: "/rollouts/" + url.PathEscape(id)}, &rollout); err != nil {
+		return nil, err
+	}
+	return &rollout, nil
+}
+
+// CreateRollout schedules license, named filename, to be imported as spec
+// describes
+func (c *Client) CreateRollout(ctx context.Context, spec RolloutSpec, filename string, license io.Reader) (*Rollout, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("license_file", filepath.Base(filename))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, license); err != nil {
+		return nil, fmt.Errorf("failed to read license file: %v", err)
+	}
+	fields := map[string]string{
+		"name":     spec.Name,
+		"servers":  strings.Join(spec.Servers, ","),
+		"tag":      spec.Tag,
+		"start_at": spec.StartAt.Format(time.RFC3339),
+		"repeat":   spec.Repeat,
+	}
+	for name, value := range map[string]int{
+		"window_minutes":      spec.WindowMinutes,
+		"canary":              spec.Canary,
+		"wave_size":           spec.WaveSize,
+		"max_failure_percent": spec.MaxFailurePercent,
+	} {
+		if value != 0 {
+			fields[name] = strconv.Itoa(value)
+		}
+	}
+	for name, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := mw.WriteField(name, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var rollout Rollout
+	req := request{method: http.MethodPost, path: "/rollouts", body: body.Bytes(), contentType: mw.FormDataContentType()}
+	if _, err := c.call(ctx, req, &rollout); err != nil {
+		return nil, err
+	}
+	return &rollout, nil
+}
+
+// CancelRollout cancels a rollout waiting for its window
+func (c *Client) CancelRollout(ctx context.Context, id string) (*Rollout, error) {
+	return c.changeRollout(ctx, id, "cancel")
+}
+
+// ResumeRollout continues a halted rollout with its next wave
+func (c *Client) ResumeRollout(ctx context.Context, id string) (*Rollout, error) {
+	return c.changeRollout(ctx, id, "resume")
+}
+
+// AbortRollout stops a rollout that has not finished, skipping the servers
+// not yet imported on
+func (c *Client) AbortRollout(ctx context.Context, id string) (*Rollout, error) {
+	return c.changeRollout(ctx, id, "abort")
+}
+
+func (c *Client) changeRollout(ctx context.Context, id, change string) (*Rollout, error) {
+	var rollout Rollout
+	if _, err := c.call(ctx, request{method: http.MethodPost, path: "/rollouts/" + url.PathEscape(id) + "/" + change}, &rollout); err != nil {
+		return nil, err
+	}
+	return &rollout, nil
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// maxPageLimit is the largest page the API returns
+const maxPageLimit = 500
+
+// WhoAmI checks the token and returns the identity requests are made as
+func (c *Client) WhoAmI(ctx context.Context) (*Identity, error) {
+	var identity Identity
+	if _, err := c.call(ctx, request{method: http.MethodGet, path: "/whoami"}, &identity); err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// ListServersOptions filters and pages the inventory
+type ListServersOptions struct {
+	Tag    string
+	Limit  int
+	Offset int
+}
+
+// ListServers returns one page of the inventory, in name order
+func (c *Client) ListServers(ctx context.Context, opts ListServersOptions) (*ServerPage, error) {
+	query := url.Values{}
+	if opts.Tag != "" {
+		query.Set("tag", opts.Tag)
+	}
+	var page ServerPage
+	req := request{method: http.MethodGet, path: "/servers", query: pageQuery(query, opts.Limit, opts.Offset)}
+	if _, err := c.call(ctx, req, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// AllServers returns every inventory server with tag, or every server when
+// tag is empty
+func (c *Client) AllServers(ctx context.Context, tag string) ([]Server, error) {
+	servers := []Server{}
+	for {
+		page, err := c.ListServers(ctx, ListServersOptions{Tag: tag, Limit: maxPageLimit, Offset: len(servers)})
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, page.Items...)
+		if len(page.Items) == 0 || len(servers) >= page.Total {
+			return servers, nil
+		}
+	}
+}
+
+// GetServer returns the named inventory server
+func (c *Client) GetServer(ctx context.Context, name string) (*Server, error) {
+	var server Server
+	if _, err := c.call(ctx, request{method: http.MethodGet, path: "/servers/" + url.PathEscape(name)}, &server); err != nil {
+		return nil, err
+	}
+	return &server, nil
+}
+
+// CreateServer adds a server to the inventory. It fails with CodeConflict
+// when the name is taken.
+func (c *Client) CreateServer(ctx context.Context, spec ServerSpec) (*Server, error) {
+	req, err := jsonRequest(http.MethodPost, "/servers", spec)
+	if err != nil {
+		return nil, err
+	}
+	var server Server
+	if _, err := c.call(ctx, req, &server); err != nil {
+		return nil, err
+	}
+	return &server, nil
+}
+
+// PutServer creates or replaces the named server and reports whether it
+// was created
+func (c *Client) PutServer(ctx context.Context, name string, spec ServerSpec) (*Server, bool, error) {
+	req, err := jsonRequest(http.MethodPut, "/servers/"+url.PathEscape(name), spec)
+	if err != nil {
+		return nil, false, err
+	}
+	var server Server
+	status, err := c.call(ctx, req, &server)
+	if err != nil {
+		return nil, false, err
+	}
+	return &server, status == http.StatusCreated, nil
+}
+
+// DeleteServer removes the named server from the inventory
+func (c *Client) DeleteServer(ctx context.Context, name string) error {
+	_, err := c.call(ctx, request{method: http.MethodDelete, path: "/servers/" + url.PathEscape(name)}, nil)
+	return err
+}
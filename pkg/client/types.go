@@ -0,0 +1,232 @@
+package client
+
+import "time"
+
+// Job statuses
+const (
+	JobRunning     = "running"
+	JobSucceeded   = "succeeded"
+	JobFailed      = "failed"
+	JobInterrupted = "interrupted"
+)
+
+// Job kinds
+const (
+	KindCheck     = "check-license-cli"
+	KindPreflight = "preflight"
+	KindSysinfo   = "download-sysinfo"
+	KindImport    = "upload-license"
+)
+
+// Preflight statuses
+const (
+	PreflightPass = "pass"
+	PreflightWarn = "warn"
+	PreflightFail = "fail"
+)
+
+// Rollout statuses
+const (
+	RolloutScheduled = "scheduled"
+	RolloutRunning   = "running"
+	RolloutHalted    = "halted"
+	RolloutCompleted = "completed"
+	RolloutCancelled = "cancelled"
+	RolloutAborted   = "aborted"
+)
+
+// Rollout target statuses
+const (
+	TargetPending   = "pending"
+	TargetRunning   = "running"
+	TargetSucceeded = "succeeded"
+	TargetFailed    = "failed"
+	TargetMissed    = "missed"
+	TargetSkipped   = "skipped"
+)
+
+// Identity is who the client's requests are made as
+type Identity struct {
+	// Actor is how requests appear in the audit log and job list
+	Actor string `json:"actor"`
+	// Token is the name of the API token, empty without one
+	Token string `json:"token,omitempty"`
+}
+
+// Server is an inventory server; passwords are never returned
+type Server struct {
+	Name              string   `json:"name"`
+	Host              string   `json:"host"`
+	Port              string   `json:"port"`
+	Username          string   `json:"username"`
+	Become            string   `json:"become,omitempty"`
+	BecomeUser        string   `json:"become_user,omitempty"`
+	Tags              []string `json:"tags,omitempty"`
+	HasPassword       bool     `json:"has_password"`
+	HasBecomePassword bool     `json:"has_become_password"`
+}
+
+// ServerSpec adds or replaces an inventory server. Port defaults to 22;
+// Become is "", "sudo" or "su".
+type ServerSpec struct {
+	Name           string   `json:"name,omitempty"`
+	Host           string   `json:"host"`
+	Port           string   `json:"port,omitempty"`
+	Username       string   `json:"username"`
+	Password       string   `json:"password"`
+	Become         string   `json:"become,omitempty"`
+	BecomeUser     string   `json:"become_user,omitempty"`
+	BecomePassword string   `json:"become_password,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+}
+
+// ServerPage is one page of the inventory
+type ServerPage struct {
+	Items  []Server `json:"items"`
+	Total  int      `json:"total"`
+	Limit  int      `json:"limit"`
+	Offset int      `json:"offset"`
+}
+
+// Job is one remote operation against one host
+type Job struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	Host       string     `json:"host"`
+	Actor      string     `json:"actor"`
+	License    string     `json:"license,omitempty"`
+	Status     string     `json:"status"`
+	Step       string     `json:"step,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// JobPage is one page of jobs, newest first
+type JobPage struct {
+	Items  []Job `json:"items"`
+	Total  int   `json:"total"`
+	Limit  int   `json:"limit"`
+	Offset int   `json:"offset"`
+}
+
+// Check reports whether license2_cli is installed on a server
+type Check struct {
+	Server   string `json:"server"`
+	JobID    string `json:"job_id,omitempty"`
+	CLIFound bool   `json:"cli_found"`
+}
+
+// PreflightCheck is one preflight check
+type PreflightCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// PreflightReport is the outcome of every preflight check. Status is the
+// most severe status of its checks.
+type PreflightReport struct {
+	Host       string           `json:"host"`
+	Status     string           `json:"status"`
+	Checks     []PreflightCheck `json:"checks"`
+	DurationMS int64            `json:"duration_ms"`
+}
+
+// Preflight is the preflight report for a server
+type Preflight struct {
+	Server string          `json:"server"`
+	JobID  string          `json:"job_id,omitempty"`
+	Report PreflightReport `json:"report"`
+}
+
+// Sysinfo describes a downloaded sysinfo file
+type Sysinfo struct {
+	Filename string
+	JobID    string
+	Size     int64
+}
+
+// CommandOutput is the result of a remote command
+type CommandOutput struct {
+	Command    string `json:"command"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	ExitStatus int    `json:"exit_status"`
+	Signal     string `json:"signal,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// LicenseImport reports an imported license. CheckError is set when the
+// import succeeded but the verifying license2_cli check did not.
+type LicenseImport struct {
+	Server        string         `json:"server"`
+	JobID         string         `json:"job_id,omitempty"`
+	License       string         `json:"license"`
+	LicenseSHA256 string         `json:"license_sha256"`
+	Import        *CommandOutput `json:"import"`
+	Check         *CommandOutput `json:"check,omitempty"`
+	CheckError    string         `json:"check_error,omitempty"`
+}
+
+// RolloutSpec schedules a license import on inventory servers for a
+// maintenance window. Servers are imported on in the order given, then
+// those with Tag.
+type RolloutSpec struct {
+	Name    string
+	Servers []string
+	Tag     string
+	StartAt time.Time
+	// WindowMinutes defaults to 60
+	WindowMinutes int
+	// Repeat is "", "daily" or "weekly"
+	Repeat string
+	// Canary and WaveSize stage the rollout: the first Canary servers are
+	// imported on first, then the rest in waves of WaveSize servers. The
+	// rollout halts after a wave once more than MaxFailurePercent of that
+	// wave's imports have failed.
+	Canary            int
+	WaveSize          int
+	MaxFailurePercent int
+}
+
+// RolloutTarget is one server of a rollout
+type RolloutTarget struct {
+	Server     string     `json:"server"`
+	Status     string     `json:"status"`
+	Wave       int        `json:"wave,omitempty"`
+	JobID      string     `json:"job_id,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Window     *time.Time `json:"window,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Rollout is a scheduled license import and the status of each server
+type Rollout struct {
+	ID                string          `json:"id"`
+	Name              string          `json:"name,omitempty"`
+	Actor             string          `json:"actor"`
+	License           string          `json:"license"`
+	LicenseSHA256     string          `json:"license_sha256"`
+	StartAt           time.Time       `json:"start_at"`
+	WindowMinutes     int             `json:"window_minutes"`
+	Repeat            string          `json:"repeat,omitempty"`
+	Canary            int             `json:"canary,omitempty"`
+	WaveSize          int             `json:"wave_size,omitempty"`
+	MaxFailurePercent int             `json:"max_failure_percent,omitempty"`
+	Status            string          `json:"status"`
+	HaltReason        string          `json:"halt_reason,omitempty"`
+	Targets           []RolloutTarget `json:"targets"`
+	NextWindowAt      *time.Time      `json:"next_window_at,omitempty"`
+	LastWindowAt      *time.Time      `json:"last_window_at,omitempty"`
+	CreatedAt         time.Time       `json:"created_at"`
+	FinishedAt        *time.Time      `json:"finished_at,omitempty"`
+}
+
+// RolloutPage is one page of rollouts, newest first
+type RolloutPage struct {
+	Items  []Rollout `json:"items"`
+	Total  int       `json:"total"`
+	Limit  int       `json:"limit"`
+	Offset int       `json:"offset"`
+}
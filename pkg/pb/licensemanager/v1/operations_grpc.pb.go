@@ -0,0 +1,260 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: licensemanager/v1/operations.proto
+
+package licensemanagerv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	OperationService_CheckServer_FullMethodName     = "/licensemanager.v1.OperationService/CheckServer"
+	OperationService_Preflight_FullMethodName       = "/licensemanager.v1.OperationService/Preflight"
+	OperationService_ImportLicense_FullMethodName   = "/licensemanager.v1.OperationService/ImportLicense"
+	OperationService_DownloadSysinfo_FullMethodName = "/licensemanager.v1.OperationService/DownloadSysinfo"
+)
+
+// OperationServiceClient is the client API for OperationService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type OperationServiceClient interface {
+	// CheckServer checks that license2_cli is installed
+	CheckServer(ctx context.Context, in *CheckServerRequest, opts ...grpc.CallOption) (*CheckServerResponse, error)
+	// Preflight runs the preflight checks; failed checks are reported, not
+	// returned as an error
+	Preflight(ctx context.Context, in *PreflightRequest, opts ...grpc.CallOption) (*PreflightResponse, error)
+	// ImportLicense imports a license file and verifies it
+	ImportLicense(ctx context.Context, in *ImportLicenseRequest, opts ...grpc.CallOption) (*ImportLicenseResponse, error)
+	// DownloadSysinfo generates a sysinfo file and streams it; the first
+	// message names the file and job
+	DownloadSysinfo(ctx context.Context, in *DownloadSysinfoRequest, opts ...grpc.CallOption) (OperationService_DownloadSysinfoClient, error)
+}
+
+type operationServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewOperationServiceClient(cc grpc.ClientConnInterface) OperationServiceClient {
+	return &operationServiceClient{cc}
+}
+
+func (c *operationServiceClient) CheckServer(ctx context.Context, in *CheckServerRequest, opts ...grpc.CallOption) (*CheckServerResponse, error) {
+	out := new(CheckServerResponse)
+	err := c.cc.Invoke(ctx, OperationService_CheckServer_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *operationServiceClient) Preflight(ctx context.Context, in *PreflightRequest, opts ...grpc.CallOption) (*PreflightResponse, error) {
+	out := new(PreflightResponse)
+	err := c.cc.Invoke(ctx, OperationService_Preflight_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *operationServiceClient) ImportLicense(ctx context.Context, in *ImportLicenseRequest, opts ...grpc.CallOption) (*ImportLicenseResponse, error) {
+	out := new(ImportLicenseResponse)
+	err := c.cc.Invoke(ctx, OperationService_ImportLicense_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *operationServiceClient) DownloadSysinfo(ctx context.Context, in *DownloadSysinfoRequest, opts ...grpc.CallOption) (OperationService_DownloadSysinfoClient, error) {
+	stream, err := c.cc.NewStream(ctx, &OperationService_ServiceDesc.Streams[0], OperationService_DownloadSysinfo_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &operationServiceDownloadSysinfoClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type OperationService_DownloadSysinfoClient interface {
+	Recv() (*DownloadSysinfoResponse, error)
+	grpc.ClientStream
+}
+
+type operationServiceDownloadSysinfoClient struct {
+	grpc.ClientStream
+}
+
+func (x *operationServiceDownloadSysinfoClient) Recv() (*DownloadSysinfoResponse, error) {
+	m := new(DownloadSysinfoResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// OperationServiceServer is the server API for OperationService service.
+// All implementations must embed UnimplementedOperationServiceServer
+// for forward compatibility
+type OperationServiceServer interface {
+	// CheckServer checks that license2_cli is installed
+	CheckServer(context.Context, *CheckServerRequest) (*CheckServerResponse, error)
+	// Preflight runs the preflight checks; failed checks are reported, not
+	// returned as an error
+	Preflight(context.Context, *PreflightRequest) (*PreflightResponse, error)
+	// ImportLicense imports a license file and verifies it
+	ImportLicense(context.Context, *ImportLicenseRequest) (*ImportLicenseResponse, error)
+	// DownloadSysinfo generates a sysinfo file and streams it; the first
+	// message names the file and job
+	DownloadSysinfo(*DownloadSysinfoRequest, OperationService_DownloadSysinfoServer) error
+	mustEmbedUnimplementedOperationServiceServer()
+}
+
+// UnimplementedOperationServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedOperationServiceServer struct {
+}
+
+func (UnimplementedOperationServiceServer) CheckServer(context.Context, *CheckServerRequest) (*CheckServerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckServer not implemented")
+}
+func (UnimplementedOperationServiceServer) Preflight(context.Context, *PreflightRequest) (*PreflightResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Preflight not implemented")
+}
+func (UnimplementedOperationServiceServer) ImportLicense(context.Context, *ImportLicenseRequest) (*ImportLicenseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ImportLicense not implemented")
+}
+func (UnimplementedOperationServiceServer) DownloadSysinfo(*DownloadSysinfoRequest, OperationService_DownloadSysinfoServer) error {
+	return status.Errorf(codes.Unimplemented, "method DownloadSysinfo not implemented")
+}
+func (UnimplementedOperationServiceServer) mustEmbedUnimplementedOperationServiceServer() {}
+
+// UnsafeOperationServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to OperationServiceServer will
+// result in compilation errors.
+type UnsafeOperationServiceServer interface {
+	mustEmbedUnimplementedOperationServiceServer()
+}
+
+func RegisterOperationServiceServer(s grpc.ServiceRegistrar, srv OperationServiceServer) {
+	s.RegisterService(&OperationService_ServiceDesc, srv)
+}
+
+func _OperationService_CheckServer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckServerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OperationServiceServer).CheckServer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OperationService_CheckServer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OperationServiceServer).CheckServer(ctx, req.(*CheckServerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OperationService_Preflight_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PreflightRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OperationServiceServer).Preflight(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OperationService_Preflight_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OperationServiceServer).Preflight(ctx, req.(*PreflightRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OperationService_ImportLicense_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ImportLicenseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OperationServiceServer).ImportLicense(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OperationService_ImportLicense_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OperationServiceServer).ImportLicense(ctx, req.(*ImportLicenseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OperationService_DownloadSysinfo_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DownloadSysinfoRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(OperationServiceServer).DownloadSysinfo(m, &operationServiceDownloadSysinfoServer{stream})
+}
+
+type OperationService_DownloadSysinfoServer interface {
+	Send(*DownloadSysinfoResponse) error
+	grpc.ServerStream
+}
+
+type operationServiceDownloadSysinfoServer struct {
+	grpc.ServerStream
+}
+
+func (x *operationServiceDownloadSysinfoServer) Send(m *DownloadSysinfoResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// OperationService_ServiceDesc is the grpc.ServiceDesc for OperationService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var OperationService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "licensemanager.v1.OperationService",
+	HandlerType: (*OperationServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CheckServer",
+			Handler:    _OperationService_CheckServer_Handler,
+		},
+		{
+			MethodName: "Preflight",
+			Handler:    _OperationService_Preflight_Handler,
+		},
+		{
+			MethodName: "ImportLicense",
+			Handler:    _OperationService_ImportLicense_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "DownloadSysinfo",
+			Handler:       _OperationService_DownloadSysinfo_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "licensemanager/v1/operations.proto",
+}
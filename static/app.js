@@ -8,6 +8,24 @@ function testFunction() {
     alert('JavaScript is working!');
 }
 
+// csrfHeaders returns the headers state-changing requests must carry
+function csrfHeaders(headers = {}) {
+    const meta = document.querySelector('meta[name="csrf-token"]');
+    if (meta && meta.content) {
+        headers['X-CSRF-Token'] = meta.content;
+    }
+    return headers;
+}
+
+// Inline event handlers are blocked by the Content-Security-Policy, so
+// buttons are wired up here instead
+document.addEventListener('DOMContentLoaded', function() {
+    document.getElementById('add_server_btn').addEventListener('click', addServer);
+    document.getElementById('batch_download_btn').addEventListener('click', batchDownloadSysinfo);
+    document.getElementById('add_upload_line_btn').addEventListener('click', addUploadLine);
+    document.getElementById('upload_all_btn').addEventListener('click', uploadAllFiles);
+});
+
 function getServerConfig() {
     const hostPort = document.getElementById('server_ip').value;
     const [host, port] = hostPort.includes(':') ? hostPort.split(':') : [hostPort, '22'];
@@ -16,7 +34,24 @@ function getServerConfig() {
         host: host,
         port: port,
         username: document.getElementById('username').value,
-        password: document.getElementById('password').value
+        password: document.getElementById('password').value,
+        become: document.getElementById('become').value,
+        become_user: document.getElementById('become_user').value,
+        become_password: document.getElementById('become_password').value
+    };
+}
+
+// serverRequest returns the connection and privilege escalation settings
+// sent with every request for server
+function serverRequest(server) {
+    return {
+        host: server.host,
+        port: server.port,
+        username: server.username,
+        password: server.password,
+        become: server.become,
+        become_user: server.become_user,
+        become_password: server.become_password
     };
 }
 
@@ -48,6 +83,9 @@ function addServer() {
         port: config.port,
         username: config.username,
         password: config.password,
+        become: config.become,
+        become_user: config.become_user,
+        become_password: config.become_password,
         status: 'checking',
         connected: false
     };
@@ -59,6 +97,7 @@ function addServer() {
     // Clear form
     document.getElementById('server_ip').value = '';
     document.getElementById('password').value = '';
+    document.getElementById('become_password').value = '';
     
     // Check license2_cli on the server
     checkServerLicenseCLI(server);
@@ -78,18 +117,103 @@ function renderServerCard(server) {
     card.id = cardId;
     card.className = `server-card ${server.connected ? 'connected' : server.status === 'error' ? 'error' : ''}`;
     
-                card.innerHTML = 
-                '<div class="server-card-header">' +
-                    '<div class="server-info">' + server.host + ':' + server.port + '</div>' +
-                    '<div class="server-status ' + server.status + '">' + server.status + '</div>' +
-                '</div>' +
-                '<div class="server-actions">' +
-                    '<button class="btn btn-sm" onclick="removeServer(\'' + server.id + '\')">' +
-                        'Remove' +
-                    '</button>' +
-                '</div>';
+    const header = document.createElement('div');
+    header.className = 'server-card-header';
+    
+    const info = document.createElement('div');
+    info.className = 'server-info';
+    info.textContent = server.host + ':' + server.port;
+    
+    const status = document.createElement('div');
+    status.className = 'server-status ' + server.status;
+    status.textContent = server.status;
+    
+    header.appendChild(info);
+    header.appendChild(status);
+    
+    const actions = document.createElement('div');
+    actions.className = 'server-actions';
+    
+    const preflightBtn = document.createElement('button');
+    preflightBtn.className = 'btn btn-sm';
+    preflightBtn.textContent = 'Preflight';
+    preflightBtn.onclick = function() { preflightServer(server, preflightBtn); };
+    actions.appendChild(preflightBtn);
+    
+    const removeBtn = document.createElement('button');
+    removeBtn.className = 'btn btn-sm';
+    removeBtn.textContent = 'Remove';
+    removeBtn.onclick = function() { removeServer(server.id); };
+    actions.appendChild(removeBtn);
+    
+    const results = document.createElement('div');
+    results.id = `preflight_${server.id}`;
+    results.className = 'preflight-results hidden';
+    
+    card.appendChild(header);
+    card.appendChild(actions);
+    card.appendChild(results);
     
     container.appendChild(card);
+    renderPreflight(server);
+}
+
+// preflightServer runs the preflight checks against server and shows each
+// check's pass/warn/fail result on its card
+async function preflightServer(server, button) {
+    button.disabled = true;
+    button.textContent = 'Checking...';
+    
+    try {
+        const response = await fetch('/api/preflight', {
+            method: 'POST',
+            headers: csrfHeaders({
+                'Content-Type': 'application/json',
+            }),
+            body: JSON.stringify(serverRequest(server))
+        });
+
+        const result = await response.json();
+        if (result.report) {
+            server.preflight = result.report;
+            renderPreflight(server);
+            const type = { pass: 'success', warn: 'info', fail: 'error' }[result.report.status];
+            showStatus(`Preflight ${result.report.status} for ${server.host}:${server.port}`, type);
+        } else {
+            showStatus(`✗ Preflight failed for ${server.host}:${server.port}: ${result.error}`, 'error');
+        }
+    } catch (error) {
+        showStatus(`✗ Preflight failed for ${server.host}:${server.port}: ${error.message}`, 'error');
+    } finally {
+        button.disabled = false;
+        button.textContent = 'Preflight';
+    }
+}
+
+function renderPreflight(server) {
+    const results = document.getElementById(`preflight_${server.id}`);
+    if (!results || !server.preflight) return;
+    
+    results.replaceChildren();
+    for (const check of server.preflight.checks) {
+        const row = document.createElement('div');
+        row.className = 'preflight-check';
+        
+        const status = document.createElement('span');
+        status.className = 'preflight-status ' + check.status;
+        status.textContent = check.status;
+        
+        const name = document.createElement('span');
+        name.className = 'preflight-name';
+        name.textContent = check.name;
+        
+        const message = document.createElement('span');
+        message.textContent = check.message;
+        
+        row.append(status, name, message);
+        results.appendChild(row);
+    }
+    results.classList.remove('hidden');
 }
 
 function removeServer(serverId) {
@@ -108,15 +232,10 @@ async function checkServerLicenseCLI(server) {
     try {
         const response = await fetch('/api/check-license-cli', {
             method: 'POST',
-            headers: {
+            headers: csrfHeaders({
                 'Content-Type': 'application/json',
-            },
-            body: JSON.stringify({
-                host: server.host,
-                port: server.port,
-                username: server.username,
-                password: server.password
-            })
+            }),
+            body: JSON.stringify(serverRequest(server))
         });
 
         const result = await response.json();
@@ -167,15 +286,10 @@ async function downloadFromServer(serverId) {
     try {
         const response = await fetch('/api/download-sysinfo', {
             method: 'POST',
-            headers: {
+            headers: csrfHeaders({
                 'Content-Type': 'application/json',
-            },
-            body: JSON.stringify({
-                host: server.host,
-                port: server.port,
-                username: server.username,
-                password: server.password
-            })
+            }),
+            body: JSON.stringify(serverRequest(server))
         });
 
         if (response.ok) {
@@ -394,7 +508,7 @@ async function batchDownloadSysinfo() {
         return;
     }
 
-    const button = document.querySelector('button[onclick="batchDownloadSysinfo()"]');
+    const button = document.getElementById('batch_download_btn');
     if (!button) {
         console.error('Batch download button not found');
         return;
@@ -411,15 +525,10 @@ async function batchDownloadSysinfo() {
         try {
             const response = await fetch('/api/download-sysinfo', {
                 method: 'POST',
-                headers: {
+                headers: csrfHeaders({
                     'Content-Type': 'application/json',
-                },
-                body: JSON.stringify({
-                    host: server.host,
-                    port: server.port,
-                    username: server.username,
-                    password: server.password
-                })
+                }),
+                body: JSON.stringify(serverRequest(server))
             });
 
             if (response.ok) {
@@ -507,7 +616,7 @@ async function uploadAllFiles() {
         });
     }
 
-    const button = document.querySelector('button[onclick="uploadAllFiles()"]');
+    const button = document.getElementById('upload_all_btn');
     console.log('Upload button found:', button);
     if (!button) {
         console.error('Upload button not found');
@@ -546,13 +655,13 @@ async function uploadAllFiles() {
         try {
             const formData = new FormData();
             formData.append('license_file', task.file);
-            formData.append('host', task.server.host);
-            formData.append('port', task.server.port);
-            formData.append('username', task.server.username);
-            formData.append('password', task.server.password);
+            for (const [key, value] of Object.entries(serverRequest(task.server))) {
+                formData.append(key, value);
+            }
 
             const response = await fetch('/api/upload-license', {
                 method: 'POST',
+                headers: csrfHeaders(),
                 body: formData
             });
 
@@ -0,0 +1,236 @@
+package fixtures
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ExecRequest is a command received by the test SSH server
+type ExecRequest struct {
+	Command string
+	Stdin   io.Reader
+	Stdout  io.Writer
+	Stderr  io.Writer
+	// PTY is true when the client requested a pseudo-terminal
+	PTY bool
+	// Signals receives signal names ("TERM", "KILL", ...) sent by the client
+	Signals <-chan string
+	// Closed is closed when the client closes the session
+	Closed <-chan struct{}
+	// ExitSignal, when set by the handler, is reported instead of an exit
+	// status, as if the command was killed by that signal
+	ExitSignal string
+}
+
+// CommandHandler runs a command and returns its exit status
+type CommandHandler func(req *ExecRequest) int
+
+// SSHServer is an in-process SSH server for tests. It accepts the
+// TestSSHConfigs.Valid credentials and runs every exec request through its
+// handler.
+type SSHServer struct {
+	Host string
+	Port string
+
+	listener net.Listener
+	config   *ssh.ServerConfig
+	handler  CommandHandler
+
+	mu       sync.Mutex
+	commands []string
+	signals  []string
+	conns    int
+}
+
+// NewSSHServer starts a test SSH server that is stopped when the test ends
+func NewSSHServer(t *testing.T, handler CommandHandler) *SSHServer {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if meta.User() == TestSSHConfigs.Valid.Username && string(password) == TestSSHConfigs.Valid.Password {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	s := &SSHServer{
+		Host:     host,
+		Port:     port,
+		listener: listener,
+		config:   config,
+		handler:  handler,
+	}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+
+	return s
+}
+
+// Commands returns every command received so far
+func (s *SSHServer) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// Signals returns every signal received so far
+func (s *SSHServer) Signals() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.signals...)
+}
+
+// Connections returns the number of SSH connections accepted so far
+func (s *SSHServer) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+func (s *SSHServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *SSHServer) handleConn(conn net.Conn) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	s.mu.Lock()
+	s.conns++
+	s.mu.Unlock()
+
+	go func() {
+		for req := range reqs {
+			// Answer keepalives so clients see a healthy connection
+			if req.WantReply {
+				req.Reply(req.Type == "keepalive@openssh.com", nil)
+			}
+		}
+	}()
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go s.handleSession(channel, requests)
+	}
+}
+
+func (s *SSHServer) handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	signals := make(chan string, 8)
+	closed := make(chan struct{})
+	pty := false
+	started := false
+
+	defer close(closed)
+	for req := range requests {
+		switch req.Type {
+		case "pty-req":
+			pty = true
+			req.Reply(true, nil)
+		case "env":
+			req.Reply(true, nil)
+		case "signal":
+			name := parseString(req.Payload)
+			s.mu.Lock()
+			s.signals = append(s.signals, name)
+			s.mu.Unlock()
+			select {
+			case signals <- name:
+			default:
+			}
+			if req.WantReply {
+				req.Reply(true, nil)
+			}
+		case "exec":
+			if started {
+				req.Reply(false, nil)
+				continue
+			}
+			started = true
+			command := parseString(req.Payload)
+			s.mu.Lock()
+			s.commands = append(s.commands, command)
+			s.mu.Unlock()
+			req.Reply(true, nil)
+
+			exec := &ExecRequest{
+				Command: command,
+				Stdin:   channel,
+				Stdout:  channel,
+				Stderr:  channel.Stderr(),
+				PTY:     pty,
+				Signals: signals,
+				Closed:  closed,
+			}
+			go func() {
+				status := s.handler(exec)
+				if exec.ExitSignal != "" {
+					channel.SendRequest("exit-signal", false, ssh.Marshal(struct {
+						Signal     string
+						CoreDumped bool
+						Message    string
+						Lang       string
+					}{exec.ExitSignal, false, "", ""}))
+				} else {
+					channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+				}
+				channel.Close()
+			}()
+		default:
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+// parseString decodes an SSH string payload
+func parseString(payload []byte) string {
+	if len(payload) < 4 {
+		return ""
+	}
+	n := binary.BigEndian.Uint32(payload)
+	if int(n) > len(payload)-4 {
+		return ""
+	}
+	return string(payload[4 : 4+n])
+}
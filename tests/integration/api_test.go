@@ -2,12 +2,17 @@ package integration
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"license-manager/internal/audit"
 	"license-manager/internal/handlers"
+	"license-manager/internal/jobs"
 	"license-manager/tests/fixtures"
 
 	"github.com/gin-gonic/gin"
@@ -158,3 +163,185 @@ func TestAPIEndpointsIntegration(t *testing.T) {
 		}
 	})
 }
+
+func TestAuditIntegration(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	auditLog, err := audit.Open(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers.SetAuditLog(auditLog)
+	defer handlers.SetAuditLog(nil)
+
+	router := gin.New()
+	router.POST("/api/check-license-cli", handlers.CheckLicenseCLIHandler)
+	router.GET("/api/audit", handlers.AuditHandler)
+	router.GET("/api/audit/verify", handlers.AuditVerifyHandler)
+
+	jsonData, err := json.Marshal(handlers.ServerConfig{
+		Host:     fixtures.TestSSHConfigs.Valid.Host,
+		Port:     fixtures.TestSSHConfigs.Valid.Port,
+		Username: fixtures.TestSSHConfigs.Valid.Username,
+		Password: fixtures.TestSSHConfigs.Valid.Password,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("POST", "/api/check-license-cli", bytes.NewBuffer(jsonData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	t.Run("Records Failed Check", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/api/audit?action=check-license-cli", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+
+		var response handlers.AuditResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Count != 1 {
+			t.Fatalf("Expected 1 check record, got %d", response.Count)
+		}
+		rec := response.Records[0]
+		if rec.Outcome != audit.OutcomeFailure {
+			t.Errorf("Expected outcome %q, got %q", audit.OutcomeFailure, rec.Outcome)
+		}
+		if rec.RemoteUser != fixtures.TestSSHConfigs.Valid.Username {
+			t.Errorf("Expected remote user %q, got %q", fixtures.TestSSHConfigs.Valid.Username, rec.RemoteUser)
+		}
+		if rec.Hash == "" {
+			t.Error("Expected record to carry a chain hash")
+		}
+	})
+
+	t.Run("CSV Export", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/api/audit?format=csv", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "text/csv" {
+			t.Errorf("Expected Content-Type text/csv, got %q", ct)
+		}
+		if !strings.HasPrefix(w.Body.String(), "seq,time,actor,action") {
+			t.Error("Expected CSV header row")
+		}
+	})
+
+	t.Run("Invalid Time Filter", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/api/audit?since=yesterday", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+
+	t.Run("Verify Chain", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/api/audit/verify", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response handlers.AuditVerifyResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if !response.Valid || response.Records < 2 {
+			t.Errorf("Expected a valid chain with connect and check records, got %+v", response)
+		}
+	})
+}
+
+func TestJobsIntegration(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	jobManager, err := jobs.Open(filepath.Join(t.TempDir(), "jobs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers.SetJobManager(jobManager)
+	defer handlers.SetJobManager(nil)
+
+	router := gin.New()
+	router.POST("/api/check-license-cli", handlers.CheckLicenseCLIHandler)
+	router.GET("/api/jobs", handlers.JobsHandler)
+
+	jsonData, err := json.Marshal(handlers.ServerConfig{
+		Host:     fixtures.TestSSHConfigs.Valid.Host,
+		Port:     fixtures.TestSSHConfigs.Valid.Port,
+		Username: fixtures.TestSSHConfigs.Valid.Username,
+		Password: fixtures.TestSSHConfigs.Valid.Password,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Failed Check Is Tracked", func(t *testing.T) {
+		req, err := http.NewRequest("POST", "/api/check-license-cli", bytes.NewBuffer(jsonData))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		req, err = http.NewRequest("GET", "/api/jobs?status=failed", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response handlers.JobsResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Count != 1 {
+			t.Fatalf("Expected 1 failed job, got %d", response.Count)
+		}
+		if response.Jobs[0].Kind != audit.ActionCheckLicenseCLI {
+			t.Errorf("Expected job kind '%s', got '%s'", audit.ActionCheckLicenseCLI, response.Jobs[0].Kind)
+		}
+	})
+
+	t.Run("Rejects Requests While Shutting Down", func(t *testing.T) {
+		if err := jobManager.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest("POST", "/api/check-license-cli", bytes.NewBuffer(jsonData))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, w.Code)
+		}
+	})
+}
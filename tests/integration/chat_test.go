@@ -0,0 +1,172 @@
+package integration
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"license-manager/internal/audit"
+	"license-manager/internal/chat"
+	"license-manager/internal/handlers"
+	"license-manager/tests/fixtures"
+)
+
+// channel is a local incoming webhook that records the messages posted to it
+type channel struct {
+	t      *testing.T
+	server *httptest.Server
+	mu     sync.Mutex
+	posts  []map[string]any
+}
+
+func newChannel(t *testing.T) *channel {
+	t.Helper()
+	c := &channel{t: t}
+	c.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var post map[string]any
+		if err := json.NewDecoder(req.Body).Decode(&post); err != nil {
+			t.Errorf("Expected a JSON message: %v", err)
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.posts = append(c.posts, post)
+	}))
+	t.Cleanup(c.server.Close)
+	return c
+}
+
+// wait returns the posted messages once there are n
+func (c *channel) wait(n int) []string {
+	c.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.mu.Lock()
+		var posts []string
+		for _, post := range c.posts {
+			data, _ := json.Marshal(post)
+			posts = append(posts, string(data))
+		}
+		c.mu.Unlock()
+		if len(posts) >= n {
+			return posts
+		}
+		if time.Now().After(deadline) {
+			c.t.Fatalf("Expected %d chat messages, got %d: %v", n, len(posts), posts)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// route creates a chat route through the API
+func (e *v1Env) route(t *testing.T, req handlers.ChatRouteRequest) chat.Route {
+	t.Helper()
+	w := e.call(t, http.MethodPost, "/api/v1/chat/routes", req, http.StatusCreated)
+	var r chat.Route
+	json.Unmarshal(w.Body.Bytes(), &r)
+	return r
+}
+
+func TestChat_RoutedByTag(t *testing.T) {
+	env := newV1Env(t)
+
+	// A prod host whose license expires in 12 days, and an unreachable
+	// dev host
+	host := fixtures.NewSSHServer(t, func(req *fixtures.ExecRequest) int {
+		switch cmd := req.Command; {
+		case cmd == "which license2_cli":
+			fmt.Fprint(req.Stdout, "/usr/local/bin/license2_cli\n")
+		case strings.HasPrefix(cmd, "cat > "):
+			io.Copy(io.Discard, req.Stdin)
+		case cmd == "license2_cli check":
+			fmt.Fprint(req.Stdout, "License OK, 12 days remaining\n")
+		}
+		return 0
+	})
+	prod := env.server("web-1", host)
+	prod.Tags = []string{"prod"}
+	env.call(t, http.MethodPost, "/api/v1/servers", prod, http.StatusCreated)
+	dev := env.server("dev-1", env.ssh)
+	dev.Host, dev.Port, dev.Tags = "127.0.0.1", "1", []string{"dev"}
+	env.call(t, http.MethodPost, "/api/v1/servers", dev, http.StatusCreated)
+
+	slack, teams := newChannel(t), newChannel(t)
+	route := env.route(t, handlers.ChatRouteRequest{Name: "prod", Format: chat.FormatSlack, URL: slack.server.URL + "/services/secret-token", Tags: []string{"prod"}})
+	env.route(t, handlers.ChatRouteRequest{Name: "dev failures", Format: chat.FormatTeams, URL: teams.server.URL, Events: []string{chat.EventJobFailed}, Tags: []string{"dev"}})
+
+	// The webhook URL is a credential and is never returned
+	if route.URL != slack.server.URL+"/..." {
+		t.Errorf("Expected a redacted URL, got %q", route.URL)
+	}
+	w := env.call(t, http.MethodGet, "/api/v1/chat/routes", nil, http.StatusOK)
+	if strings.Contains(w.Body.String(), "secret-token") {
+		t.Errorf("Expected no webhook token in the route list, got %s", w.Body.String())
+	}
+
+	env.upload(t, "web-1", "good.lic", http.StatusOK)
+	env.call(t, http.MethodPost, "/api/v1/servers/dev-1/check", nil, http.StatusBadGateway)
+
+	// The prod channel hears of the import and its expiry, and nothing of
+	// the dev host
+	posts := slack.wait(2)
+	var completed, expiring string
+	for _, post := range posts {
+		switch {
+		case strings.Contains(post, "succeeded"):
+			completed = post
+		case strings.Contains(post, "expires in"):
+			expiring = post
+		}
+	}
+	for _, want := range []string{"upload-license succeeded on web-1 (", "good.lic", "Actor", "#2eb886"} {
+		if !strings.Contains(completed, want) {
+			t.Errorf("Expected %q in the completion message %s", want, completed)
+		}
+	}
+	for _, want := range []string{"License on web-1 (", "expires in 12 days", "Expires", "#daa038"} {
+		if !strings.Contains(expiring, want) {
+			t.Errorf("Expected %q in the expiry message %s", want, expiring)
+		}
+	}
+
+	// The dev channel receives only the failure, as an Adaptive Card
+	posts = teams.wait(1)
+	for _, want := range []string{"AdaptiveCard", "check-license-cli failed on dev-1 (127.0.0.1:1)", "Attention"} {
+		if !strings.Contains(posts[0], want) {
+			t.Errorf("Expected %q in the failure message %s", want, posts[0])
+		}
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if n := len(slack.wait(0)); n != 2 {
+		t.Errorf("Expected only the prod messages on the prod channel, got %d", n)
+	}
+	if n := len(teams.wait(0)); n != 1 {
+		t.Errorf("Expected only the failure on the dev channel, got %d", n)
+	}
+
+	// Adding and removing routes is audited without the webhook's token
+	env.call(t, http.MethodDelete, "/api/v1/chat/routes/"+route.ID, nil, http.StatusNoContent)
+	for _, action := range []string{audit.ActionChatRouteCreate, audit.ActionChatRouteDelete} {
+		records, _ := env.audit.Query(audit.Filter{Action: action})
+		if len(records) == 0 || strings.Contains(records[0].Host+records[0].Command, "secret-token") {
+			t.Errorf("Expected a redacted %s record, got %+v", action, records)
+		}
+	}
+}
+
+func TestChat_Unconfigured(t *testing.T) {
+	env := newV1Env(t)
+	handlers.SetChat(nil)
+
+	env.call(t, http.MethodPost, "/api/v1/chat/routes", handlers.ChatRouteRequest{Name: "ops", Format: chat.FormatSlack, URL: "https://hooks.example.com/x"}, http.StatusServiceUnavailable)
+	w := env.call(t, http.MethodGet, "/api/v1/chat/routes", nil, http.StatusOK)
+	if !strings.Contains(w.Body.String(), `"items":[]`) {
+		t.Errorf("Expected no routes, got %s", w.Body.String())
+	}
+}
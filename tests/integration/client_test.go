@@ -0,0 +1,374 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"license-manager/internal/config"
+	"license-manager/internal/server"
+	"license-manager/pkg/client"
+	"license-manager/tests/fixtures"
+)
+
+// clientEnv runs the application's router, with an API token, behind a
+// proxy that can fail requests before they reach it
+type clientEnv struct {
+	*v1Env
+	url string
+	// failures is how many upcoming requests the proxy answers with status
+	failures atomic.Int32
+	status   int
+	requests atomic.Int32
+}
+
+func newClientEnv(t *testing.T) *clientEnv {
+	t.Helper()
+	env := &clientEnv{v1Env: newV1Env(t), status: http.StatusServiceUnavailable}
+
+	cfg := config.Default()
+	cfg.Server.TemplatesGlob = "../../templates/*"
+	cfg.Server.StaticDir = "../../static"
+	cfg.Security.APITokens = []string{"sdk:" + v1Token}
+	router := server.NewRouter(cfg)
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		env.requests.Add(1)
+		if env.failures.Add(-1) >= 0 {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, http.StatusText(env.status), env.status)
+			return
+		}
+		router.ServeHTTP(w, r)
+	}))
+	t.Cleanup(proxy.Close)
+	env.url = proxy.URL
+	return env
+}
+
+func (e *clientEnv) client(t *testing.T, token string) *client.Client {
+	t.Helper()
+	c, err := client.New(e.url, client.Options{
+		Token:        token,
+		Retry:        client.RetryPolicy{MaxRetries: 2, MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond},
+		PollInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (e *clientEnv) spec(name string) client.ServerSpec {
+	return client.ServerSpec{
+		Name:     name,
+		Host:     e.ssh.Host,
+		Port:     e.ssh.Port,
+		Username: fixtures.TestSSHConfigs.Valid.Username,
+		Password: fixtures.TestSSHConfigs.Valid.Password,
+		Tags:     []string{"prod"},
+	}
+}
+
+func TestClient_Auth(t *testing.T) {
+	env := newClientEnv(t)
+	ctx := context.Background()
+
+	identity, err := env.client(t, v1Token).WhoAmI(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Actor != "token:sdk" || identity.Token != "sdk" {
+		t.Errorf("Expected the token's identity, got %+v", identity)
+	}
+
+	_, err = env.client(t, "wrong").WhoAmI(ctx)
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Code != client.CodeUnauthorized {
+		t.Errorf("Expected a typed 401, got %v", err)
+	}
+
+	if _, err := client.New("not a url", client.Options{}); err == nil {
+		t.Error("Expected an invalid URL to be rejected")
+	}
+}
+
+func TestClient_BrowserCannotUseInventory(t *testing.T) {
+	env := newClientEnv(t)
+	if _, err := env.client(t, v1Token).CreateServer(context.Background(), env.spec("web-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Anyone can load the page and get a CSRF token
+	jar, _ := cookiejar.New(nil)
+	browser := &http.Client{Jar: jar}
+	resp, err := browser.Get(env.url + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	match := regexp.MustCompile(`name="csrf-token" content="([^"]+)"`).FindSubmatch(page)
+	if match == nil {
+		t.Fatalf("Expected a CSRF token in the page")
+	}
+	send := func(method, path, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, env.url+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-CSRF-Token", string(match[1]))
+		resp, err := browser.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// but the stored credentials need an API token
+	for _, tt := range []struct{ method, path, body string }{
+		{http.MethodGet, "/api/servers", ""},
+		{http.MethodGet, "/api/audit", ""},
+		{http.MethodGet, "/api/jobs", ""},
+		{http.MethodGet, "/api/v1/servers", ""},
+		{http.MethodPost, "/api/v1/servers/web-1/licenses", ""},
+		{http.MethodPost, "/api/check-license-cli", `{"server": "web-1"}`},
+		{http.MethodPost, "/api/download-sysinfo", `{"server": "web-1"}`},
+	} {
+		if status := send(tt.method, tt.path, tt.body); status != http.StatusUnauthorized {
+			t.Errorf("%s %s %s: expected 401, got %d", tt.method, tt.path, tt.body, status)
+		}
+	}
+
+	// Credentials typed into the web interface still work
+	body := fmt.Sprintf(`{"host": %q, "port": %q, "username": %q, "password": %q}`,
+		env.ssh.Host, env.ssh.Port, fixtures.TestSSHConfigs.Valid.Username, fixtures.TestSSHConfigs.Valid.Password)
+	if status := send(http.MethodPost, "/api/check-license-cli", body); status != http.StatusOK {
+		t.Errorf("Expected a check with typed credentials to succeed, got %d", status)
+	}
+}
+
+func TestClient_Inventory(t *testing.T) {
+	env := newClientEnv(t)
+	ctx := context.Background()
+	c := env.client(t, v1Token)
+
+	for _, name := range []string{"web-1", "web-2", "web-3"} {
+		if _, err := c.CreateServer(ctx, env.spec(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.CreateServer(ctx, env.spec("web-1")); client.ErrorCode(err) != client.CodeConflict {
+		t.Errorf("Expected a conflict creating web-1 twice, got %v", err)
+	}
+
+	page, err := c.ListServers(ctx, client.ListServersOptions{Tag: "prod", Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 3 || len(page.Items) != 2 || page.Items[0].Name != "web-1" || !page.Items[0].HasPassword {
+		t.Errorf("Unexpected first page %+v", page)
+	}
+	all, err := c.AllServers(ctx, "")
+	if err != nil || len(all) != 3 {
+		t.Errorf("Expected every server, got %+v (%v)", all, err)
+	}
+
+	spec := env.spec("")
+	spec.Become = "sudo"
+	server, created, err := c.PutServer(ctx, "web-2", spec)
+	if err != nil || created || server.Become != "sudo" {
+		t.Errorf("Expected web-2 to be replaced, got %+v, created %v (%v)", server, created, err)
+	}
+	if _, created, _ := c.PutServer(ctx, "web-4", spec); !created {
+		t.Error("Expected web-4 to be created")
+	}
+
+	if err := c.DeleteServer(ctx, "web-3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetServer(ctx, "web-3"); !client.IsNotFound(err) {
+		t.Errorf("Expected web-3 to be gone, got %v", err)
+	}
+}
+
+func TestClient_Operations(t *testing.T) {
+	env := newClientEnv(t)
+	ctx := context.Background()
+	c := env.client(t, v1Token)
+	if _, err := c.CreateServer(ctx, env.spec("web-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	check, err := c.CheckServer(ctx, "web-1")
+	if err != nil || !check.CLIFound {
+		t.Errorf("Expected license2_cli to be found, got %+v (%v)", check, err)
+	}
+	preflight, err := c.Preflight(ctx, "web-1")
+	if err != nil || len(preflight.Report.Checks) == 0 {
+		t.Errorf("Expected a preflight report, got %+v (%v)", preflight, err)
+	}
+
+	var file bytes.Buffer
+	sysinfo, err := c.DownloadSysinfo(ctx, "web-1", &file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.String() != "SYSINFO" || sysinfo.Size != 7 || sysinfo.JobID == "" || !strings.HasPrefix(sysinfo.Filename, "sys_info.bin") {
+		t.Errorf("Unexpected sysinfo download %+v: %q", sysinfo, file.String())
+	}
+
+	// Progress follows the import job through its steps to the end
+	var mu sync.Mutex
+	var updates []client.Job
+	result, err := c.PushLicense(ctx, "web-1", "slow.lic", strings.NewReader("LICENSE"), func(job client.Job) {
+		mu.Lock()
+		defer mu.Unlock()
+		updates = append(updates, job)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.License != "slow.lic" || result.Import == nil || result.Check == nil {
+		t.Errorf("Unexpected import result %+v", result)
+	}
+	mu.Lock()
+	if len(updates) < 2 || updates[0].Status != client.JobRunning {
+		t.Fatalf("Expected running and finished updates, got %+v", updates)
+	}
+	if final := updates[len(updates)-1]; final.ID != result.JobID || final.Status != client.JobSucceeded {
+		t.Errorf("Expected the last update to be the finished import, got %+v", final)
+	}
+	mu.Unlock()
+
+	_, err = c.PushLicense(ctx, "web-1", "expired.lic", strings.NewReader("LICENSE"), nil)
+	if client.ErrorCode(err) != client.CodeRemoteFailed || !strings.Contains(err.Error(), "license has expired") {
+		t.Errorf("Expected license2_cli's reason, got %v", err)
+	}
+	var rejected *client.Error
+	var details client.LicenseImport
+	if !errors.As(err, &rejected) || json.Unmarshal(rejected.Details, &details) != nil || details.Import == nil || !strings.Contains(details.Import.Stderr, "license has expired") {
+		t.Errorf("Expected the import output in the error's details, got %v", err)
+	}
+
+	jobs, err := c.ListJobs(ctx, client.ListJobsOptions{Status: client.JobSucceeded})
+	if err != nil || jobs.Total != 4 {
+		t.Errorf("Expected 4 succeeded jobs, got %+v (%v)", jobs, err)
+	}
+	job, err := c.GetJob(ctx, result.JobID)
+	if err != nil || job.Kind != client.KindImport || job.Actor != "token:sdk" || job.FinishedAt == nil {
+		t.Errorf("Unexpected job %+v (%v)", job, err)
+	}
+}
+
+func TestClient_Rollouts(t *testing.T) {
+	env := newClientEnv(t)
+	ctx := context.Background()
+	c := env.client(t, v1Token)
+	down := env.spec("down")
+	down.Host, down.Port = "127.0.0.1", "1"
+	for _, spec := range []client.ServerSpec{down, env.spec("web-1")} {
+		if _, err := c.CreateServer(ctx, spec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	spec := client.RolloutSpec{Name: "renewal", Servers: []string{"down", "web-1"}, StartAt: start, WindowMinutes: 30, Canary: 1}
+	if _, err := c.CreateRollout(ctx, client.RolloutSpec{Servers: []string{"missing"}, StartAt: start}, "good.lic", strings.NewReader("LICENSE")); client.ErrorCode(err) != client.CodeInvalidRequest {
+		t.Errorf("Expected an unknown server to be rejected, got %v", err)
+	}
+	rollout, err := c.CreateRollout(ctx, spec, "good.lic", strings.NewReader("LICENSE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rollout.Status != client.RolloutScheduled || rollout.Canary != 1 || rollout.WindowMinutes != 30 || len(rollout.Targets) != 2 || rollout.Targets[1].Wave != 2 {
+		t.Fatalf("Unexpected rollout %+v", rollout)
+	}
+
+	// The canary fails and the rollout halts before web-1
+	env.rollouts.RunDue(ctx, start.Add(time.Minute))
+	halted, err := c.ListRollouts(ctx, client.ListRolloutsOptions{Status: client.RolloutHalted})
+	if err != nil || halted.Total != 1 || halted.Items[0].ID != rollout.ID || halted.Items[0].HaltReason == "" {
+		t.Fatalf("Expected the rollout to halt, got %+v (%v)", halted, err)
+	}
+	if rollout, err = c.ResumeRollout(ctx, rollout.ID); err != nil || rollout.Status != client.RolloutScheduled {
+		t.Errorf("Expected the rollout to resume, got %+v (%v)", rollout, err)
+	}
+	if rollout, err = c.AbortRollout(ctx, rollout.ID); err != nil || rollout.Status != client.RolloutAborted || rollout.Targets[1].Status != client.TargetSkipped {
+		t.Errorf("Expected web-1 to be skipped, got %+v (%v)", rollout, err)
+	}
+	if _, err := c.CancelRollout(ctx, rollout.ID); client.ErrorCode(err) != client.CodeConflict {
+		t.Errorf("Expected an aborted rollout not to be cancellable, got %v", err)
+	}
+	if _, err := c.GetRollout(ctx, "missing"); !client.IsNotFound(err) {
+		t.Errorf("Expected a missing rollout, got %v", err)
+	}
+}
+
+func TestClient_Retry(t *testing.T) {
+	env := newClientEnv(t)
+	ctx := context.Background()
+	c := env.client(t, v1Token)
+
+	// Rejected before any work is done: retried for every method
+	env.failures.Store(2)
+	if _, err := c.CreateServer(ctx, env.spec("web-1")); err != nil {
+		t.Fatalf("Expected the create to succeed on the third attempt, got %v", err)
+	}
+	if got := env.requests.Load(); got != 3 {
+		t.Errorf("Expected 3 requests, got %d", got)
+	}
+
+	// Retries are bounded
+	env.requests.Store(0)
+	env.failures.Store(3)
+	var apiErr *client.Error
+	if _, err := c.GetServer(ctx, "web-1"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected the last 503, got %v", err)
+	}
+	if got := env.requests.Load(); got != 3 {
+		t.Errorf("Expected 3 requests, got %d", got)
+	}
+
+	// A gateway error may come after the work was done: only idempotent
+	// requests are retried
+	env.status = http.StatusBadGateway
+	env.requests.Store(0)
+	env.failures.Store(1)
+	if _, err := c.GetServer(ctx, "web-1"); err != nil {
+		t.Errorf("Expected the GET to be retried, got %v", err)
+	}
+	env.failures.Store(1)
+	if _, err := c.CheckServer(ctx, "web-1"); err == nil {
+		t.Error("Expected the POST not to be retried")
+	}
+	if got := env.requests.Load(); got != 3 {
+		t.Errorf("Expected 3 requests, got %d", got)
+	}
+
+	// Failed remote operations are not retried
+	before := len(env.ssh.Commands())
+	c.PushLicense(ctx, "web-1", "expired.lic", strings.NewReader("LICENSE"), nil)
+	imports := 0
+	for _, cmd := range env.ssh.Commands()[before:] {
+		if strings.HasPrefix(cmd, "license2_cli import") {
+			imports++
+		}
+	}
+	if imports != 1 {
+		t.Errorf("Expected one import attempt, got %d", imports)
+	}
+}
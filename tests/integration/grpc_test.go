@@ -0,0 +1,355 @@
+package integration
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"license-manager/internal/audit"
+	"license-manager/internal/grpcserver"
+	"license-manager/internal/middleware"
+	pb "license-manager/pkg/pb/licensemanager/v1"
+	"license-manager/tests/fixtures"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// grpcEnv serves the gRPC API, sharing the handlers' state with the
+// versioned HTTP API
+type grpcEnv struct {
+	*v1Env
+	server    *grpcserver.Server
+	inventory pb.InventoryServiceClient
+	ops       pb.OperationServiceClient
+	jobs      pb.JobServiceClient
+}
+
+func newGRPCEnv(t *testing.T) *grpcEnv {
+	t.Helper()
+	env := &grpcEnv{v1Env: newV1Env(t)}
+
+	tokens, err := middleware.ParseAPITokens([]string{"grpc:" + v1Token})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.server = grpcserver.New(tokens)
+	lis := bufconn.Listen(1 << 20)
+	go env.server.Serve(lis)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		env.server.Shutdown(ctx)
+	})
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	env.inventory = pb.NewInventoryServiceClient(conn)
+	env.ops = pb.NewOperationServiceClient(conn)
+	env.jobs = pb.NewJobServiceClient(conn)
+	return env
+}
+
+// authed returns a context that calls with token
+func authed(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func (e *grpcEnv) addServer(t *testing.T, name string, ssh *fixtures.SSHServer) {
+	t.Helper()
+	_, err := e.inventory.PutServer(authed(v1Token), &pb.PutServerRequest{
+		Name:     name,
+		Host:     ssh.Host,
+		Port:     ssh.Port,
+		Username: fixtures.TestSSHConfigs.Valid.Username,
+		Password: fixtures.TestSSHConfigs.Valid.Password,
+		Tags:     []string{"prod"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expectError checks err's gRPC code and the api error code it carries
+func expectError(t *testing.T, err error, code codes.Code, reason string) {
+	t.Helper()
+	if status.Code(err) != code || grpcserver.ErrorCode(err) != reason {
+		t.Errorf("Expected %s (%s), got %v (%q)", code, reason, err, grpcserver.ErrorCode(err))
+	}
+}
+
+func TestGRPC_Auth(t *testing.T) {
+	env := newGRPCEnv(t)
+
+	_, err := env.inventory.ListServers(context.Background(), &pb.ListServersRequest{})
+	expectError(t, err, codes.Unauthenticated, "unauthorized")
+	_, err = env.inventory.ListServers(authed("wrong"), &pb.ListServersRequest{})
+	expectError(t, err, codes.Unauthenticated, "unauthorized")
+
+	stream, err := env.jobs.WatchJobs(context.Background(), &pb.WatchJobsRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	expectError(t, err, codes.Unauthenticated, "unauthorized")
+
+	if _, err := env.inventory.ListServers(authed(v1Token), &pb.ListServersRequest{}); err != nil {
+		t.Errorf("Expected the token to be accepted, got %v", err)
+	}
+}
+
+func TestGRPC_Inventory(t *testing.T) {
+	env := newGRPCEnv(t)
+	ctx := authed(v1Token)
+
+	for _, name := range []string{"web-1", "web-2", "web-3"} {
+		env.addServer(t, name, env.ssh)
+	}
+	_, err := env.inventory.PutServer(ctx, &pb.PutServerRequest{Name: "web-1", Host: "h", Username: "u", Password: "p", CreateOnly: true})
+	expectError(t, err, codes.AlreadyExists, "conflict")
+	_, err = env.inventory.PutServer(ctx, &pb.PutServerRequest{Host: "h", Username: "u", Password: "p"})
+	expectError(t, err, codes.InvalidArgument, "invalid_request")
+
+	list, err := env.inventory.ListServers(ctx, &pb.ListServersRequest{Tag: "prod", Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Total != 3 || len(list.Servers) != 2 || list.Servers[0].Name != "web-1" || !list.Servers[0].HasPassword {
+		t.Errorf("Unexpected first page %v", list)
+	}
+	_, err = env.inventory.ListServers(ctx, &pb.ListServersRequest{Limit: 501})
+	expectError(t, err, codes.InvalidArgument, "invalid_request")
+
+	put, err := env.inventory.PutServer(ctx, &pb.PutServerRequest{Name: "web-2", Host: "h", Username: "u", Password: "p", Become: "sudo"})
+	if err != nil || put.Created || put.Server.Become != "sudo" || put.Server.Port != "22" {
+		t.Errorf("Expected web-2 to be replaced, got %v (%v)", put, err)
+	}
+
+	if _, err := env.inventory.DeleteServer(ctx, &pb.DeleteServerRequest{Name: "web-3"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = env.inventory.GetServer(ctx, &pb.GetServerRequest{Name: "web-3"})
+	expectError(t, err, codes.NotFound, "not_found")
+
+	// Changes are audited as the token, as over HTTP
+	records, err := env.audit.Query(audit.Filter{Action: audit.ActionServerDelete})
+	if err != nil || len(records) != 1 || records[0].Actor != "token:grpc" || records[0].Server != "web-3" {
+		t.Errorf("Expected the delete to be audited as token:grpc, got %+v (%v)", records, err)
+	}
+}
+
+func TestGRPC_Operations(t *testing.T) {
+	env := newGRPCEnv(t)
+	ctx := authed(v1Token)
+	env.addServer(t, "web-1", env.ssh)
+	env.addServer(t, "bare", env.noCLI)
+
+	check, err := env.ops.CheckServer(ctx, &pb.CheckServerRequest{Server: "web-1"})
+	if err != nil || !check.CliFound || check.JobId == "" {
+		t.Errorf("Expected license2_cli to be found, got %v (%v)", check, err)
+	}
+	check, err = env.ops.CheckServer(ctx, &pb.CheckServerRequest{Server: "bare"})
+	if err != nil || check.CliFound {
+		t.Errorf("Expected license2_cli to be missing, got %v (%v)", check, err)
+	}
+	_, err = env.ops.CheckServer(ctx, &pb.CheckServerRequest{Server: "missing"})
+	expectError(t, err, codes.NotFound, "not_found")
+
+	preflight, err := env.ops.Preflight(ctx, &pb.PreflightRequest{Server: "web-1"})
+	if err != nil || len(preflight.Checks) == 0 || preflight.Host == "" {
+		t.Errorf("Expected a preflight report, got %v (%v)", preflight, err)
+	}
+
+	imported, err := env.ops.ImportLicense(ctx, &pb.ImportLicenseRequest{Server: "web-1", Filename: "site.lic", Content: []byte("LICENSE")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.License != "site.lic" || imported.LicenseSha256 == "" || imported.Import == nil || imported.Check == nil {
+		t.Errorf("Unexpected import result %v", imported)
+	}
+	_, err = env.ops.ImportLicense(ctx, &pb.ImportLicenseRequest{Server: "web-1", Filename: "expired.lic", Content: []byte("LICENSE")})
+	expectError(t, err, codes.Aborted, "remote_command_failed")
+	if !strings.Contains(status.Convert(err).Message(), "license has expired") {
+		t.Errorf("Expected license2_cli's reason, got %v", err)
+	}
+	_, err = env.ops.ImportLicense(ctx, &pb.ImportLicenseRequest{Server: "bare", Filename: "site.lic", Content: []byte("LICENSE")})
+	expectError(t, err, codes.FailedPrecondition, "cli_not_found")
+
+	stream, err := env.ops.DownloadSysinfo(ctx, &pb.DownloadSysinfoRequest{Server: "web-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var filename, jobID string
+	var data []byte
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chunk.Filename != "" {
+			filename, jobID = chunk.Filename, chunk.JobId
+		}
+		data = append(data, chunk.Data...)
+	}
+	if string(data) != "SYSINFO" || jobID == "" || !strings.HasPrefix(filename, "sys_info.bin") {
+		t.Errorf("Unexpected sysinfo download %q, %q: %q", filename, jobID, data)
+	}
+
+	// Every operation is a job, shared with the HTTP API
+	job, err := env.jobs.GetJob(ctx, &pb.GetJobRequest{Id: imported.JobId})
+	if err != nil || job.Job.Kind != "upload-license" || job.Job.Actor != "token:grpc" || job.Job.Status != pb.JobStatus_JOB_STATUS_SUCCEEDED {
+		t.Errorf("Unexpected job %v (%v)", job, err)
+	}
+	failed, err := env.jobs.ListJobs(ctx, &pb.ListJobsRequest{Status: pb.JobStatus_JOB_STATUS_FAILED})
+	if err != nil || failed.Total != 2 {
+		t.Errorf("Expected 2 failed jobs, got %v (%v)", failed, err)
+	}
+}
+
+func TestGRPC_SubmitAndWatchJob(t *testing.T) {
+	env := newGRPCEnv(t)
+	ctx := authed(v1Token)
+	env.addServer(t, "web-1", env.ssh)
+	env.addServer(t, "bare", env.noCLI)
+
+	submitted, err := env.jobs.SubmitJob(ctx, &pb.SubmitJobRequest{
+		Server:    "web-1",
+		Operation: &pb.SubmitJobRequest_ImportLicense{ImportLicense: &pb.ImportLicenseOperation{Filename: "slow.lic", Content: []byte("LICENSE")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if submitted.Job.Status != pb.JobStatus_JOB_STATUS_RUNNING || submitted.Job.Kind != "upload-license" {
+		t.Errorf("Expected a running import, got %v", submitted.Job)
+	}
+
+	updates := watchJob(t, ctx, env.jobs, submitted.Job.Id)
+	final := updates[len(updates)-1]
+	if final.Status != pb.JobStatus_JOB_STATUS_SUCCEEDED || final.FinishedAt == nil || final.License != "slow.lic" {
+		t.Errorf("Expected the import to succeed, got %v", final)
+	}
+	steps := map[string]bool{}
+	for _, job := range updates[:len(updates)-1] {
+		if job.Status != pb.JobStatus_JOB_STATUS_RUNNING {
+			t.Errorf("Expected only the last update to be finished, got %v", updates)
+		}
+		steps[job.Step] = true
+	}
+	if !steps["import"] {
+		t.Errorf("Expected the slow import step to be streamed, got %v", updates)
+	}
+
+	// A job that fails reports why
+	submitted, err = env.jobs.SubmitJob(ctx, &pb.SubmitJobRequest{
+		Server:    "bare",
+		Operation: &pb.SubmitJobRequest_Check{Check: &pb.CheckOperation{}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates = watchJob(t, ctx, env.jobs, submitted.Job.Id)
+	if final := updates[len(updates)-1]; final.Status != pb.JobStatus_JOB_STATUS_FAILED || !strings.Contains(final.Error, "license2_cli not found") {
+		t.Errorf("Expected the check to fail, got %v", final)
+	}
+
+	// Watching a finished job sends it once
+	if updates := watchJob(t, ctx, env.jobs, submitted.Job.Id); len(updates) != 1 {
+		t.Errorf("Expected one update for a finished job, got %v", updates)
+	}
+
+	_, err = env.jobs.SubmitJob(ctx, &pb.SubmitJobRequest{Server: "web-1"})
+	expectError(t, err, codes.InvalidArgument, "invalid_request")
+	_, err = env.jobs.SubmitJob(ctx, &pb.SubmitJobRequest{Server: "missing", Operation: &pb.SubmitJobRequest_Preflight{Preflight: &pb.PreflightOperation{}}})
+	expectError(t, err, codes.NotFound, "not_found")
+	stream, err := env.jobs.WatchJob(ctx, &pb.WatchJobRequest{Id: "missing"})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	expectError(t, err, codes.NotFound, "not_found")
+}
+
+// watchJob collects the updates WatchJob streams until the job finishes
+func watchJob(t *testing.T, ctx context.Context, client pb.JobServiceClient, id string) []*pb.Job {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	stream, err := client.WatchJob(ctx, &pb.WatchJobRequest{Id: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var updates []*pb.Job
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Watching job %s: %v", id, err)
+		}
+		updates = append(updates, resp.Job)
+	}
+	if len(updates) == 0 {
+		t.Fatalf("Expected updates for job %s", id)
+	}
+	return updates
+}
+
+func TestGRPC_WatchJobs(t *testing.T) {
+	env := newGRPCEnv(t)
+	ctx := authed(v1Token)
+	env.addServer(t, "web-1", env.ssh)
+
+	stream, err := env.jobs.WatchJobs(ctx, &pb.WatchJobsRequest{Kind: "upload-license"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Header(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Jobs started over HTTP are streamed too; the check is filtered out
+	if w := env.do(t, "POST", "/api/v1/servers/web-1/check", nil, ""); w.Code != 200 {
+		t.Fatalf("Expected the check to succeed, got %d", w.Code)
+	}
+	imported, err := env.ops.ImportLicense(ctx, &pb.ImportLicenseRequest{Server: "web-1", Filename: "site.lic", Content: []byte("LICENSE")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Job.Kind != "upload-license" || resp.Job.Id != imported.JobId {
+			t.Fatalf("Expected only the import, got %v", resp.Job)
+		}
+		if resp.Job.Status == pb.JobStatus_JOB_STATUS_SUCCEEDED {
+			break
+		}
+	}
+
+	// Shutting down ends open watches
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := env.server.Shutdown(shutdownCtx); err != nil {
+		t.Fatal(err)
+	}
+	_, err = stream.Recv()
+	expectError(t, err, codes.Unavailable, "unavailable")
+}
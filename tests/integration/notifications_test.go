@@ -0,0 +1,112 @@
+package integration
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"license-manager/internal/audit"
+	"license-manager/internal/handlers"
+	"license-manager/internal/notify"
+	"license-manager/tests/fixtures"
+)
+
+// subscribe creates a subscriber through the API
+func (e *v1Env) subscribe(t *testing.T, email string, prefs notify.Preferences) notify.Subscriber {
+	t.Helper()
+	w := e.call(t, http.MethodPost, "/api/v1/notifications/subscribers", handlers.SubscriberRequest{Email: email, Preferences: prefs}, http.StatusCreated)
+	var s notify.Subscriber
+	json.Unmarshal(w.Body.Bytes(), &s)
+	return s
+}
+
+// digest previews a subscriber's digest through the API
+func (e *v1Env) digest(t *testing.T, id string) notify.Digest {
+	t.Helper()
+	w := e.call(t, http.MethodGet, "/api/v1/notifications/subscribers/"+id+"/digest", nil, http.StatusOK)
+	var d notify.Digest
+	json.Unmarshal(w.Body.Bytes(), &d)
+	return d
+}
+
+func TestNotifications_Digest(t *testing.T) {
+	env := newV1Env(t)
+
+	// A host whose license expires in 12 days
+	host := fixtures.NewSSHServer(t, func(req *fixtures.ExecRequest) int {
+		switch cmd := req.Command; {
+		case cmd == "which license2_cli":
+			fmt.Fprint(req.Stdout, "/usr/local/bin/license2_cli\n")
+		case strings.HasPrefix(cmd, "cat > "):
+			io.Copy(io.Discard, req.Stdin)
+		case cmd == "license2_cli check":
+			fmt.Fprint(req.Stdout, "License OK, 12 days remaining\n")
+		}
+		return 0
+	})
+	env.call(t, http.MethodPost, "/api/v1/servers", env.server("web-1", host), http.StatusCreated)
+	down := env.server("down", env.ssh)
+	down.Host, down.Port = "127.0.0.1", "1"
+	env.call(t, http.MethodPost, "/api/v1/servers", down, http.StatusCreated)
+
+	lead := env.subscribe(t, "ops-lead@example.com", notify.Preferences{Expiring: true, ExpiryDays: 30, Failures: true})
+	soon := env.subscribe(t, "soon@example.com", notify.Preferences{Expiring: true, ExpiryDays: 7})
+
+	env.upload(t, "web-1", "good.lic", http.StatusOK)
+	env.call(t, http.MethodPost, "/api/v1/servers/down/check", nil, http.StatusBadGateway)
+
+	// The expiry date is recorded with the import
+	records, err := env.audit.Query(audit.Filter{Action: audit.ActionUploadLicense})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Now().UTC().AddDate(0, 0, 12).Format("2006-01-02")
+	if len(records) != 1 || records[0].LicenseExpiry != want {
+		t.Fatalf("Expected the import to record expiry %s, got %+v", want, records)
+	}
+
+	digest := env.digest(t, lead.ID)
+	if len(digest.Expiring) != 1 || digest.Expiring[0].Server != "web-1" || digest.Expiring[0].License != "good.lic" || digest.Expiring[0].DaysRemaining != 12 {
+		t.Errorf("Expected web-1's license expiring in 12 days, got %+v", digest.Expiring)
+	}
+	if len(digest.Failed) != 1 || digest.Failed[0].Kind != audit.ActionCheckLicenseCLI || digest.Failed[0].Host != "127.0.0.1:1" || digest.Failed[0].Error == "" {
+		t.Errorf("Expected the failed check, got %+v", digest.Failed)
+	}
+	if d := env.digest(t, soon.ID); len(d.Expiring) != 0 || len(d.Failed) != 0 {
+		t.Errorf("Expected nothing within 7 days and no failures, got %+v", d)
+	}
+
+	// Sending emails the digest to the subscriber
+	env.call(t, http.MethodPost, "/api/v1/notifications/subscribers/"+lead.ID+"/send", nil, http.StatusOK)
+	emails := env.smtp.Emails()
+	if len(emails) != 1 || emails[0].To[0] != "ops-lead@example.com" {
+		t.Fatalf("Expected one email to the subscriber, got %+v", emails)
+	}
+	body := string(emails[0].Data)
+	for _, want := range []string{"Subject: License Manager: 1 license expiring, 1 failed job", "good.lic", "127.0.0.1:1", "text/html"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in the email:\n%s", want, body)
+		}
+	}
+
+	// Subscribing is audited
+	records, _ = env.audit.Query(audit.Filter{Action: audit.ActionSubscribe})
+	if len(records) != 2 || records[0].Command != "ops-lead@example.com" {
+		t.Errorf("Expected both subscriptions in the audit log, got %+v", records)
+	}
+}
+
+func TestNotifications_Unconfigured(t *testing.T) {
+	env := newV1Env(t)
+	handlers.SetNotifier(nil)
+
+	env.call(t, http.MethodPost, "/api/v1/notifications/subscribers", handlers.SubscriberRequest{Email: "ops@example.com", Preferences: notify.Preferences{Failures: true}}, http.StatusServiceUnavailable)
+	w := env.call(t, http.MethodGet, "/api/v1/notifications/subscribers", nil, http.StatusOK)
+	if !strings.Contains(w.Body.String(), `"items":[]`) {
+		t.Errorf("Expected no subscribers, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,190 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"license-manager/internal/audit"
+	"license-manager/internal/handlers"
+	"license-manager/internal/rollouts"
+	"license-manager/internal/webhooks"
+)
+
+// schedule creates a rollout of a license file named good.lic through the
+// API with the given form fields
+func (e *v1Env) schedule(t *testing.T, fields map[string]string, status int) (rollouts.Rollout, *httptest.ResponseRecorder) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("license_file", "good.lic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("LICENSE"))
+	for name, value := range fields {
+		mw.WriteField(name, value)
+	}
+	mw.Close()
+
+	path := "/api/v1/rollouts"
+	w := e.do(t, http.MethodPost, path, &body, mw.FormDataContentType())
+	e.expect(t, http.MethodPost, path, w, status)
+	var r rollouts.Rollout
+	json.Unmarshal(w.Body.Bytes(), &r)
+	return r, w
+}
+
+// rollout gets a rollout through the API
+func (e *v1Env) rollout(t *testing.T, id string) rollouts.Rollout {
+	t.Helper()
+	w := e.call(t, http.MethodGet, "/api/v1/rollouts/"+id, nil, http.StatusOK)
+	var r rollouts.Rollout
+	json.Unmarshal(w.Body.Bytes(), &r)
+	return r
+}
+
+func TestRollouts_MaintenanceWindow(t *testing.T) {
+	env := newV1Env(t)
+	for _, name := range []string{"web-1", "web-2"} {
+		server := env.server(name, env.ssh)
+		server.Tags = []string{"prod"}
+		env.call(t, http.MethodPost, "/api/v1/servers", server, http.StatusCreated)
+	}
+	down := env.server("down", env.ssh)
+	down.Host, down.Port = "127.0.0.1", "1"
+	env.call(t, http.MethodPost, "/api/v1/servers", down, http.StatusCreated)
+
+	// Unknown servers and unusable schedules are rejected
+	start := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	env.schedule(t, map[string]string{"servers": "missing", "start_at": start.Format(time.RFC3339)}, http.StatusBadRequest)
+	env.schedule(t, map[string]string{"tag": "prod", "start_at": "tonight"}, http.StatusBadRequest)
+	env.schedule(t, map[string]string{"tag": "prod", "start_at": start.Format(time.RFC3339), "repeat": "monthly"}, http.StatusBadRequest)
+
+	r, _ := env.schedule(t, map[string]string{
+		"name":           "renewal",
+		"tag":            "prod",
+		"servers":        "down",
+		"start_at":       start.Format(time.RFC3339),
+		"window_minutes": "90",
+	}, http.StatusCreated)
+	if r.Status != rollouts.StatusScheduled || len(r.Targets) != 3 || r.WindowMinutes != 90 || r.Actor != "token:contract" || r.NextWindowAt == nil || !r.NextWindowAt.Equal(start) {
+		t.Fatalf("Expected a scheduled rollout to down, web-1 and web-2, got %+v", r)
+	}
+
+	// Nothing is imported before the window opens
+	env.rollouts.RunDue(context.Background(), time.Now())
+	if records, _ := env.audit.Query(audit.Filter{Action: audit.ActionUploadLicense}); len(records) != 0 {
+		t.Fatalf("Expected no imports before the window, got %+v", records)
+	}
+
+	env.rollouts.RunDue(context.Background(), start.Add(time.Minute))
+	r = env.rollout(t, r.ID)
+	if r.Status != rollouts.StatusCompleted {
+		t.Errorf("Expected the rollout to complete, got %s", r.Status)
+	}
+	want := map[string]string{"down": rollouts.TargetFailed, "web-1": rollouts.TargetSucceeded, "web-2": rollouts.TargetSucceeded}
+	for _, target := range r.Targets {
+		if target.Status != want[target.Server] || target.JobID == "" {
+			t.Errorf("Expected %s to be %s with a job, got %+v", target.Server, want[target.Server], target)
+		}
+		if job, err := handlers.GetJob(target.JobID); err != nil || job.Actor != "token:contract" || job.License != "good.lic" {
+			t.Errorf("Expected the import job for %s to be the creator's, got %+v, %v", target.Server, job, err)
+		}
+	}
+
+	// Scheduling is audited with the license
+	records, _ := env.audit.Query(audit.Filter{Action: audit.ActionRolloutCreate})
+	if len(records) != 1 || records[0].LicenseFile != "good.lic" || records[0].LicenseSHA256 != r.LicenseSHA256 {
+		t.Errorf("Expected the rollout in the audit log, got %+v", records)
+	}
+}
+
+func TestRollouts_MissedWindowAndCancel(t *testing.T) {
+	env := newV1Env(t)
+	env.call(t, http.MethodPost, "/api/v1/servers", env.server("web-1", env.ssh), http.StatusCreated)
+	hook := newReceiver(t)
+	env.register(t, hook, webhooks.EventRolloutMissed)
+
+	start := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	missed, _ := env.schedule(t, map[string]string{"servers": "web-1", "start_at": start.Format(time.RFC3339), "repeat": rollouts.RepeatDaily}, http.StatusCreated)
+	cancelled, _ := env.schedule(t, map[string]string{"servers": "web-1", "start_at": start.Format(time.RFC3339)}, http.StatusCreated)
+	env.call(t, http.MethodPost, "/api/v1/rollouts/"+cancelled.ID+"/cancel", nil, http.StatusOK)
+	env.call(t, http.MethodPost, "/api/v1/rollouts/"+cancelled.ID+"/cancel", nil, http.StatusConflict)
+
+	// The service was down for the whole window
+	env.rollouts.RunDue(context.Background(), start.Add(2*time.Hour))
+
+	got := env.rollout(t, missed.ID)
+	if got.Status != rollouts.StatusScheduled || got.Targets[0].Status != rollouts.TargetMissed || got.NextWindowAt == nil || !got.NextWindowAt.Equal(start.Add(24*time.Hour)) {
+		t.Errorf("Expected web-1 to wait for the next daily window, got %+v", got)
+	}
+	events := hook.wait(webhooks.EventRolloutMissed, 1)
+	if events[0].Data["rollout_id"] != missed.ID || events[0].Data["servers"].([]any)[0] != "web-1" {
+		t.Errorf("Expected web-1 reported as missed, got %+v", events[0].Data)
+	}
+	if got := env.rollout(t, cancelled.ID); got.Status != rollouts.StatusCancelled || got.Targets[0].Status != rollouts.TargetPending {
+		t.Errorf("Expected the cancelled rollout not to run, got %+v", got)
+	}
+	if records, _ := env.audit.Query(audit.Filter{Action: audit.ActionRolloutCancel}); len(records) != 1 {
+		t.Errorf("Expected the cancellation in the audit log, got %+v", records)
+	}
+
+	w := env.call(t, http.MethodGet, "/api/v1/rollouts?status=scheduled", nil, http.StatusOK)
+	var page struct {
+		Items []rollouts.Rollout `json:"items"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &page)
+	if len(page.Items) != 1 || page.Items[0].ID != missed.ID {
+		t.Errorf("Expected only the recurring rollout to be scheduled, got %+v", page.Items)
+	}
+}
+
+func TestRollouts_StagedHaltAndResume(t *testing.T) {
+	env := newV1Env(t)
+	down := env.server("down", env.ssh)
+	down.Host, down.Port = "127.0.0.1", "1"
+	env.call(t, http.MethodPost, "/api/v1/servers", down, http.StatusCreated)
+	for _, name := range []string{"web-1", "web-2"} {
+		env.call(t, http.MethodPost, "/api/v1/servers", env.server(name, env.ssh), http.StatusCreated)
+	}
+	hook := newReceiver(t)
+	env.register(t, hook, webhooks.EventRolloutHalted)
+
+	start := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	fields := map[string]string{"servers": "down,web-1,web-2", "start_at": start.Format(time.RFC3339), "canary": "1", "wave_size": "1", "max_failure_percent": "50"}
+	env.schedule(t, map[string]string{"servers": "web-1", "start_at": start.Format(time.RFC3339), "wave_size": "-1"}, http.StatusBadRequest)
+	env.schedule(t, map[string]string{"servers": "web-1", "start_at": start.Format(time.RFC3339), "canary": "one"}, http.StatusBadRequest)
+	r, _ := env.schedule(t, fields, http.StatusCreated)
+	if r.Canary != 1 || r.WaveSize != 1 || r.MaxFailurePercent != 50 || r.Targets[0].Wave != 1 || r.Targets[2].Wave != 3 {
+		t.Fatalf("Expected the strategy and a wave per server, got %+v", r)
+	}
+
+	// The canary fails, so the rollout halts with the other servers left
+	env.rollouts.RunDue(context.Background(), start.Add(time.Minute))
+	r = env.rollout(t, r.ID)
+	if r.Status != rollouts.StatusHalted || r.HaltReason == "" || r.Targets[1].Status != rollouts.TargetPending {
+		t.Fatalf("Expected the rollout to halt after the canary, got %+v", r)
+	}
+	events := hook.wait(webhooks.EventRolloutHalted, 1)
+	if events[0].Data["rollout_id"] != r.ID || events[0].Data["failed"].([]any)[0] != "down" || len(events[0].Data["remaining"].([]any)) != 2 {
+		t.Errorf("Expected the halt reported with down failed, got %+v", events[0].Data)
+	}
+
+	// Resumed, each wave succeeds and the rollout goes on
+	env.call(t, http.MethodPost, "/api/v1/rollouts/"+r.ID+"/resume", nil, http.StatusOK)
+	env.rollouts.RunDue(context.Background(), start.Add(2*time.Minute))
+	r = env.rollout(t, r.ID)
+	if r.Status != rollouts.StatusCompleted || r.Targets[1].Status != rollouts.TargetSucceeded || r.Targets[2].Status != rollouts.TargetSucceeded {
+		t.Errorf("Expected the rollout to complete after resuming, got %+v", r)
+	}
+	env.call(t, http.MethodPost, "/api/v1/rollouts/"+r.ID+"/abort", nil, http.StatusConflict)
+	if records, _ := env.audit.Query(audit.Filter{Action: audit.ActionRolloutResume}); len(records) != 1 {
+		t.Errorf("Expected the resume in the audit log, got %+v", records)
+	}
+}
@@ -0,0 +1,746 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"license-manager/internal/api"
+	"license-manager/internal/audit"
+	"license-manager/internal/chat"
+	"license-manager/internal/expiry"
+	"license-manager/internal/handlers"
+	"license-manager/internal/inventory"
+	"license-manager/internal/jobs"
+	"license-manager/internal/middleware"
+	"license-manager/internal/notify"
+	"license-manager/internal/rollouts"
+	"license-manager/internal/services"
+	"license-manager/internal/webhooks"
+	"license-manager/tests/fixtures"
+
+	"github.com/gin-gonic/gin"
+)
+
+const v1Token = "contract-secret"
+
+// v1Env serves the versioned API as main.go does, backed by temporary
+// state, and checks every response against the OpenAPI document
+type v1Env struct {
+	router *gin.Engine
+	spec   map[string]any
+	ssh    *fixtures.SSHServer
+	noCLI  *fixtures.SSHServer
+	audit  *audit.Log
+	// webhooks retries after a few milliseconds, up to three attempts
+	webhooks *webhooks.Dispatcher
+	// smtp receives the digests emailed to subscribers
+	smtp *fixtures.SMTPServer
+	// chat retries after a few milliseconds, up to three attempts
+	chat *chat.Notifier
+	// rollouts runs due rollouts when a test calls RunDue
+	rollouts *rollouts.Scheduler
+	// expiry reports licenses entering the warning period when a test
+	// calls Check
+	expiry *expiry.Watcher
+	// checked records the documented responses seen, as "METHOD path status"
+	checked map[string]bool
+}
+
+func newV1Env(t *testing.T) *v1Env {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+
+	auditLog, err := audit.Open(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager, err := jobs.Open(filepath.Join(dir, "jobs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := inventory.Open(filepath.Join(dir, "servers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatcher, err := webhooks.Open(filepath.Join(dir, "webhooks.json"), webhooks.Options{
+		MaxAttempts: 3,
+		Backoff:     5 * time.Millisecond,
+		MaxBackoff:  20 * time.Millisecond,
+		Timeout:     time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chatNotifier, err := chat.Open(filepath.Join(dir, "chat.json"), chat.Options{
+		MaxAttempts: 3,
+		Backoff:     5 * time.Millisecond,
+		Timeout:     time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduler, err := rollouts.Open(filepath.Join(dir, "rollouts.json"), rollouts.Options{}, handlers.RolloutRunner())
+	if err != nil {
+		t.Fatal(err)
+	}
+	watcher, err := expiry.Open(filepath.Join(dir, "expiry.json"), expiry.Options{
+		WarningDays: handlers.DefaultExpiryWarningDays,
+	}, handlers.DigestSource(), handlers.ReportExpiring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		dispatcher.Run(stop)
+		close(stopped)
+	}()
+	chatStopped := make(chan struct{})
+	go func() {
+		chatNotifier.Run(stop)
+		close(chatStopped)
+	}()
+	sink := fixtures.NewSMTPServer(t)
+	port, _ := strconv.Atoi(sink.Port)
+	notifier, err := notify.Open(filepath.Join(dir, "subscribers.json"), notify.Options{
+		Host:     sink.Host,
+		Port:     port,
+		Security: notify.SecurityNone,
+		From:     "License Manager <lm@example.com>",
+		Timeout:  time.Second,
+	}, handlers.DigestSource())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers.Configure(handlers.Settings{
+		UploadDir:          filepath.Join(dir, "uploads"),
+		RemoteTempDir:      "/tmp/",
+		SSHTimeout:         services.DefaultTimeout,
+		SSHCommandTimeout:  services.DefaultCommandTimeout,
+		SSHTransferTimeout: services.DefaultTransferTimeout,
+		ExpiryWarningDays:  handlers.DefaultExpiryWarningDays,
+	})
+	handlers.SetAuditLog(auditLog)
+	handlers.SetJobManager(manager)
+	handlers.SetInventory(store)
+	handlers.SetWebhooks(dispatcher)
+	handlers.SetNotifier(notifier)
+	handlers.SetChat(chatNotifier)
+	handlers.SetRollouts(scheduler)
+	handlers.SetExpiry(watcher)
+	t.Cleanup(func() {
+		close(stop)
+		<-stopped
+		<-chatStopped
+		handlers.SetWebhooks(nil)
+		handlers.SetNotifier(nil)
+		handlers.SetChat(nil)
+		handlers.SetRollouts(nil)
+		handlers.SetExpiry(nil)
+		handlers.Configure(handlers.Settings{
+			UploadDir:          "uploads",
+			RemoteTempDir:      "/tmp/",
+			SSHTimeout:         services.DefaultTimeout,
+			SSHCommandTimeout:  services.DefaultCommandTimeout,
+			SSHTransferTimeout: services.DefaultTransferTimeout,
+		})
+		handlers.SetAuditLog(nil)
+		handlers.SetJobManager(nil)
+		handlers.SetInventory(nil)
+	})
+
+	tokens, err := middleware.ParseAPITokens([]string{"contract:" + v1Token})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.Use(middleware.CSRF())
+	group := router.Group("/api", middleware.APIAuth(tokens))
+	handlers.RegisterV1Document(group.Group("/v1"))
+	handlers.RegisterV1(group.Group("/v1", middleware.RequireAuth()))
+	router.NoRoute(handlers.NotFoundHandler)
+
+	env := &v1Env{router: router, audit: auditLog, webhooks: dispatcher, smtp: sink, chat: chatNotifier, rollouts: scheduler, expiry: watcher, checked: map[string]bool{}}
+	env.ssh = fixtures.NewSSHServer(t, func(req *fixtures.ExecRequest) int {
+		switch cmd := req.Command; {
+		case cmd == "which license2_cli":
+			fmt.Fprint(req.Stdout, "/usr/local/bin/license2_cli\n")
+		case strings.HasPrefix(cmd, "cat > "):
+			io.Copy(io.Discard, req.Stdin)
+		case strings.HasPrefix(cmd, "license2_cli import -l '/tmp/slow.lic'"):
+			time.Sleep(300 * time.Millisecond)
+		case strings.HasPrefix(cmd, "license2_cli import -l '/tmp/expired.lic'"):
+			fmt.Fprint(req.Stderr, "ERROR: license has expired\n")
+			return 3
+		case strings.HasPrefix(cmd, "ls -la sys_info.bin"):
+			fmt.Fprint(req.Stdout, "-rw-r--r-- 1 testuser testuser 7 Jan  1 00:00 sys_info.bin\n")
+		case cmd == "cat 'sys_info.bin'":
+			fmt.Fprint(req.Stdout, "SYSINFO")
+		}
+		return 0
+	})
+	env.noCLI = fixtures.NewSSHServer(t, func(req *fixtures.ExecRequest) int {
+		if req.Command == "which license2_cli" {
+			return 1
+		}
+		return 0
+	})
+
+	// The document is served without a token
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the OpenAPI document, got %d", w.Code)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &env.spec); err != nil {
+		t.Fatalf("Expected the OpenAPI document to be JSON: %v", err)
+	}
+	return env
+}
+
+// do sends a request with the API token
+func (e *v1Env) do(t *testing.T, method, path string, body io.Reader, contentType string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, body)
+	req.Header.Set("Authorization", "Bearer "+v1Token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	e.router.ServeHTTP(w, req)
+	return w
+}
+
+// call sends a request, checks the response against the document and
+// expects status
+func (e *v1Env) call(t *testing.T, method, path string, body any, status int) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader io.Reader
+	contentType := ""
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader, contentType = bytes.NewReader(data), "application/json"
+	}
+	w := e.do(t, method, path, reader, contentType)
+	e.expect(t, method, path, w, status)
+	return w
+}
+
+// upload posts a license file to the licenses endpoint of server
+func (e *v1Env) upload(t *testing.T, server, filename string, status int) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if filename != "" {
+		part, err := mw.CreateFormFile("license_file", filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte("LICENSE"))
+	}
+	mw.Close()
+
+	path := "/api/v1/servers/" + server + "/licenses"
+	w := e.do(t, http.MethodPost, path, &body, mw.FormDataContentType())
+	e.expect(t, http.MethodPost, path, w, status)
+	return w
+}
+
+// expect checks the status, that the document lists it for the operation
+// and that the body matches the documented schema
+func (e *v1Env) expect(t *testing.T, method, path string, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("%s %s: expected %d, got %d: %s", method, path, status, w.Code, w.Body.String())
+	}
+
+	template, op := e.operation(t, method, path)
+	responses, _ := op["responses"].(map[string]any)
+	resp, ok := responses[fmt.Sprint(status)].(map[string]any)
+	if !ok {
+		t.Fatalf("%s %s: status %d is not documented", method, template, status)
+	}
+	e.checked[method+" "+template+" "+fmt.Sprint(status)] = true
+
+	content, _ := resp["content"].(map[string]any)
+	if len(content) == 0 {
+		if w.Body.Len() != 0 {
+			t.Errorf("%s %s: expected no body for %d, got %q", method, template, status, w.Body.String())
+		}
+		return
+	}
+	mediaType, _, _ := strings.Cut(w.Header().Get("Content-Type"), ";")
+	media, ok := content[mediaType].(map[string]any)
+	if !ok {
+		t.Fatalf("%s %s: content type %q is not documented for %d", method, template, mediaType, status)
+	}
+	if mediaType != "application/json" {
+		return
+	}
+
+	var value any
+	if err := json.Unmarshal(w.Body.Bytes(), &value); err != nil {
+		t.Fatalf("%s %s: invalid JSON: %v", method, template, err)
+	}
+	if errs := e.validate(media["schema"], value, "body"); len(errs) > 0 {
+		t.Errorf("%s %s %d does not match the document:\n%s\n%s", method, template, status, strings.Join(errs, "\n"), w.Body.String())
+	}
+}
+
+// operation finds the documented operation serving a request path
+func (e *v1Env) operation(t *testing.T, method, path string) (string, map[string]any) {
+	t.Helper()
+	path, _, _ = strings.Cut(path, "?")
+	path = strings.TrimPrefix(path, api.V1Prefix)
+
+	paths, _ := e.spec["paths"].(map[string]any)
+	for template, item := range paths {
+		if !matchTemplate(template, path) {
+			continue
+		}
+		if op, ok := item.(map[string]any)[strings.ToLower(method)].(map[string]any); ok {
+			return template, op
+		}
+	}
+	t.Fatalf("%s %s is not documented", method, path)
+	return "", nil
+}
+
+// matchTemplate reports whether path matches a document path such as
+// /servers/{name}
+func matchTemplate(template, path string) bool {
+	want, have := strings.Split(template, "/"), strings.Split(path, "/")
+	if len(want) != len(have) {
+		return false
+	}
+	for i := range want {
+		if !strings.HasPrefix(want[i], "{") && want[i] != have[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// validate checks value against the subset of JSON Schema the generator
+// emits, returning a message per mismatch
+func (e *v1Env) validate(schemaValue any, value any, at string) []string {
+	schema, _ := schemaValue.(map[string]any)
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		components, _ := e.spec["components"].(map[string]any)
+		schemas, _ := components["schemas"].(map[string]any)
+		target, ok := schemas[name]
+		if !ok {
+			return []string{at + ": unresolved " + ref}
+		}
+		return e.validate(target, value, at)
+	}
+	if value == nil {
+		if schema["nullable"] == true {
+			return nil
+		}
+		return []string{at + ": null is not allowed"}
+	}
+	if allOf, ok := schema["allOf"].([]any); ok {
+		var errs []string
+		for _, s := range allOf {
+			errs = append(errs, e.validate(s, value, at)...)
+		}
+		return errs
+	}
+
+	switch schema["type"] {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected an object, got %T", at, value)}
+		}
+		var errs []string
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if _, ok := obj[name.(string)]; !ok {
+				errs = append(errs, fmt.Sprintf("%s: missing required %s", at, name))
+			}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		additional := schema["additionalProperties"]
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			switch prop, ok := properties[key]; {
+			case ok:
+				errs = append(errs, e.validate(prop, obj[key], at+"."+key)...)
+			case additional != nil:
+				errs = append(errs, e.validate(additional, obj[key], at+"."+key)...)
+			default:
+				errs = append(errs, fmt.Sprintf("%s: undocumented property %s", at, key))
+			}
+		}
+		return errs
+	case "array":
+		list, ok := value.([]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected an array, got %T", at, value)}
+		}
+		var errs []string
+		for i, item := range list {
+			errs = append(errs, e.validate(schema["items"], item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+		return errs
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected a string, got %T", at, value)}
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				return []string{fmt.Sprintf("%s: expected a date-time, got %q", at, s)}
+			}
+		}
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != float64(int64(n)) {
+			return []string{fmt.Sprintf("%s: expected an integer, got %v", at, value)}
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return []string{fmt.Sprintf("%s: expected a number, got %T", at, value)}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []string{fmt.Sprintf("%s: expected a boolean, got %T", at, value)}
+		}
+	}
+	return nil
+}
+
+func (e *v1Env) server(name string, ssh *fixtures.SSHServer) handlers.ServerRequest {
+	return handlers.ServerRequest{
+		Name:     name,
+		Host:     ssh.Host,
+		Port:     ssh.Port,
+		Username: fixtures.TestSSHConfigs.Valid.Username,
+		Password: fixtures.TestSSHConfigs.Valid.Password,
+		Tags:     []string{"prod"},
+	}
+}
+
+func TestV1_RoutesMatchDocument(t *testing.T) {
+	env := newV1Env(t)
+
+	routes := map[string]bool{}
+	for _, route := range env.router.Routes() {
+		if route.Path == api.V1Prefix+"/openapi.json" {
+			continue
+		}
+		path := regexp.MustCompile(`:(\w+)`).ReplaceAllString(strings.TrimPrefix(route.Path, api.V1Prefix), "{$1}")
+		routes[route.Method+" "+path] = true
+	}
+
+	documented := map[string]bool{}
+	paths, _ := env.spec["paths"].(map[string]any)
+	for path, item := range paths {
+		for method, op := range item.(map[string]any) {
+			key := strings.ToUpper(method) + " " + path
+			documented[key] = true
+			if !routes[key] {
+				t.Errorf("%s is documented but not routed", key)
+			}
+			for status, resp := range op.(map[string]any)["responses"].(map[string]any) {
+				if status >= "400" {
+					schema := resp.(map[string]any)["content"].(map[string]any)["application/json"].(map[string]any)["schema"]
+					if schema.(map[string]any)["$ref"] != "#/components/schemas/ErrorResponse" {
+						t.Errorf("%s %s does not use the error envelope", key, status)
+					}
+				}
+			}
+		}
+	}
+	for key := range routes {
+		if !documented[key] {
+			t.Errorf("%s is routed but not documented", key)
+		}
+	}
+	if len(routes) == 0 {
+		t.Fatal("Expected versioned routes")
+	}
+}
+
+func TestV1_Contract(t *testing.T) {
+	env := newV1Env(t)
+
+	w := env.call(t, http.MethodGet, "/api/v1/whoami", nil, http.StatusOK)
+	var identity handlers.Identity
+	json.Unmarshal(w.Body.Bytes(), &identity)
+	if identity.Actor != "token:contract" || identity.Token != "contract" {
+		t.Errorf("Expected the token's identity, got %+v", identity)
+	}
+
+	// Servers
+	env.call(t, http.MethodPost, "/api/v1/servers", env.server("web-1", env.ssh), http.StatusCreated)
+	env.call(t, http.MethodPost, "/api/v1/servers", env.server("web-1", env.ssh), http.StatusConflict)
+	env.call(t, http.MethodPost, "/api/v1/servers", handlers.ServerRequest{Name: "bad"}, http.StatusBadRequest)
+	env.call(t, http.MethodPut, "/api/v1/servers/no-cli", env.server("", env.noCLI), http.StatusCreated)
+	env.call(t, http.MethodPut, "/api/v1/servers/no-cli", env.server("no-cli", env.noCLI), http.StatusOK)
+	env.call(t, http.MethodPut, "/api/v1/servers/no-cli", env.server("other", env.noCLI), http.StatusBadRequest)
+	down := env.server("down", env.ssh)
+	down.Host, down.Port = "127.0.0.1", "1"
+	down.Tags = nil
+	env.call(t, http.MethodPut, "/api/v1/servers/down", down, http.StatusCreated)
+
+	w = env.call(t, http.MethodGet, "/api/v1/servers?tag=prod&limit=1&offset=1", nil, http.StatusOK)
+	var page api.Page[handlers.ServerInfo]
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 || len(page.Items) != 1 || page.Items[0].Name != "web-1" || page.Limit != 1 || page.Offset != 1 {
+		t.Errorf("Expected the second of two prod servers, got %+v", page)
+	}
+	if strings.Contains(w.Body.String(), fixtures.TestSSHConfigs.Valid.Password) {
+		t.Error("Expected passwords not to be returned")
+	}
+	env.call(t, http.MethodGet, "/api/v1/servers?limit=0", nil, http.StatusBadRequest)
+	env.call(t, http.MethodGet, "/api/v1/servers/web-1", nil, http.StatusOK)
+	env.call(t, http.MethodGet, "/api/v1/servers/missing", nil, http.StatusNotFound)
+
+	// Operations
+	w = env.call(t, http.MethodPost, "/api/v1/servers/web-1/check", nil, http.StatusOK)
+	var check handlers.ServerCheck
+	json.Unmarshal(w.Body.Bytes(), &check)
+	if !check.CLIFound || check.JobID == "" {
+		t.Errorf("Expected license2_cli to be found by a tracked job, got %+v", check)
+	}
+	env.call(t, http.MethodPost, "/api/v1/servers/down/check", nil, http.StatusBadGateway)
+	env.call(t, http.MethodPost, "/api/v1/servers/missing/check", nil, http.StatusNotFound)
+	env.call(t, http.MethodPost, "/api/v1/servers/web-1/preflight", nil, http.StatusOK)
+
+	w = env.call(t, http.MethodPost, "/api/v1/servers/web-1/sysinfo", nil, http.StatusOK)
+	if w.Body.String() != "SYSINFO" || w.Header().Get("X-Job-ID") == "" {
+		t.Errorf("Expected the sysinfo file with its job, got %q", w.Body.String())
+	}
+	env.call(t, http.MethodPost, "/api/v1/servers/no-cli/sysinfo", nil, http.StatusUnprocessableEntity)
+
+	w = env.upload(t, "web-1", "good.lic", http.StatusOK)
+	var imported handlers.LicenseImport
+	json.Unmarshal(w.Body.Bytes(), &imported)
+	if imported.License != "good.lic" || imported.LicenseSHA256 == "" || imported.Import == nil || imported.Check == nil {
+		t.Errorf("Unexpected import result %+v", imported)
+	}
+	w = env.upload(t, "web-1", "expired.lic", http.StatusBadGateway)
+	var envelope api.ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &envelope)
+	if envelope.Error.Code != api.CodeRemoteFailed || !strings.Contains(envelope.Error.Message, "license has expired") {
+		t.Errorf("Expected license2_cli's reason in the envelope, got %+v", envelope)
+	}
+	var failure struct {
+		Error struct {
+			Details handlers.LicenseImport `json:"details"`
+		} `json:"error"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &failure)
+	if details := failure.Error.Details; details.License != "expired.lic" || details.Import == nil || details.Import.ExitStatus != 3 || !strings.Contains(details.Import.Stderr, "license has expired") {
+		t.Errorf("Expected the import output in the envelope's details, got %s", w.Body.String())
+	}
+	env.upload(t, "web-1", "", http.StatusBadRequest)
+
+	// Jobs
+	w = env.call(t, http.MethodGet, "/api/v1/jobs?status=succeeded", nil, http.StatusOK)
+	var jobPage api.Page[jobs.Job]
+	json.Unmarshal(w.Body.Bytes(), &jobPage)
+	if jobPage.Total != 4 {
+		t.Errorf("Expected 4 succeeded jobs, got %+v", jobPage)
+	}
+	env.call(t, http.MethodGet, "/api/v1/jobs?offset=-1", nil, http.StatusBadRequest)
+	env.call(t, http.MethodGet, "/api/v1/jobs/"+check.JobID, nil, http.StatusOK)
+	env.call(t, http.MethodGet, "/api/v1/jobs/missing", nil, http.StatusNotFound)
+
+	env.call(t, http.MethodDelete, "/api/v1/servers/web-1", nil, http.StatusNoContent)
+	env.call(t, http.MethodDelete, "/api/v1/servers/web-1", nil, http.StatusNotFound)
+
+	// Webhooks
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer receiver.Close()
+	w = env.call(t, http.MethodPost, "/api/v1/webhooks", handlers.WebhookRequest{URL: receiver.URL, Events: []string{webhooks.EventJobFailed}}, http.StatusCreated)
+	var created handlers.WebhookCreated
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if created.ID == "" || created.Secret == "" {
+		t.Errorf("Expected the new webhook with its secret, got %+v", created)
+	}
+	env.call(t, http.MethodPost, "/api/v1/webhooks", handlers.WebhookRequest{URL: "ftp://example.com"}, http.StatusBadRequest)
+	env.call(t, http.MethodPost, "/api/v1/webhooks", handlers.WebhookRequest{URL: receiver.URL, Events: []string{"job.exploded"}}, http.StatusBadRequest)
+	w = env.call(t, http.MethodGet, "/api/v1/webhooks", nil, http.StatusOK)
+	if strings.Contains(w.Body.String(), created.Secret) {
+		t.Error("Expected webhook secrets not to be listed")
+	}
+	env.call(t, http.MethodGet, "/api/v1/webhooks/"+created.ID, nil, http.StatusOK)
+	env.call(t, http.MethodGet, "/api/v1/webhooks/missing", nil, http.StatusNotFound)
+
+	w = env.call(t, http.MethodPost, "/api/v1/webhooks/"+created.ID+"/ping", nil, http.StatusAccepted)
+	var ping webhooks.Delivery
+	json.Unmarshal(w.Body.Bytes(), &ping)
+	env.call(t, http.MethodPost, "/api/v1/webhooks/missing/ping", nil, http.StatusNotFound)
+	env.call(t, http.MethodGet, "/api/v1/webhooks/"+created.ID+"/deliveries?status=pending", nil, http.StatusOK)
+	env.call(t, http.MethodGet, "/api/v1/webhooks/"+created.ID+"/deliveries?limit=0", nil, http.StatusBadRequest)
+	env.call(t, http.MethodPost, "/api/v1/webhooks/"+created.ID+"/deliveries/"+ping.ID+"/redeliver", nil, http.StatusAccepted)
+	env.call(t, http.MethodPost, "/api/v1/webhooks/"+created.ID+"/deliveries/missing/redeliver", nil, http.StatusNotFound)
+	env.call(t, http.MethodDelete, "/api/v1/webhooks/"+created.ID, nil, http.StatusNoContent)
+	env.call(t, http.MethodGet, "/api/v1/webhooks/"+created.ID+"/deliveries", nil, http.StatusNotFound)
+
+	// Email digests
+	subscribe := handlers.SubscriberRequest{Email: "ops@example.com", Preferences: notify.Preferences{Expiring: true, Failures: true}}
+	w = env.call(t, http.MethodPost, "/api/v1/notifications/subscribers", subscribe, http.StatusCreated)
+	var subscriber notify.Subscriber
+	json.Unmarshal(w.Body.Bytes(), &subscriber)
+	env.call(t, http.MethodPost, "/api/v1/notifications/subscribers", handlers.SubscriberRequest{Email: "ops@example.com"}, http.StatusBadRequest)
+	env.call(t, http.MethodGet, "/api/v1/notifications/subscribers", nil, http.StatusOK)
+	env.call(t, http.MethodGet, "/api/v1/notifications/subscribers/"+subscriber.ID, nil, http.StatusOK)
+	env.call(t, http.MethodGet, "/api/v1/notifications/subscribers/missing", nil, http.StatusNotFound)
+	subscribe.Schedule, subscribe.Weekday = notify.ScheduleWeekly, time.Friday
+	env.call(t, http.MethodPut, "/api/v1/notifications/subscribers/"+subscriber.ID, subscribe, http.StatusOK)
+	env.call(t, http.MethodPut, "/api/v1/notifications/subscribers/missing", subscribe, http.StatusNotFound)
+	subscribe.Hour = 25
+	env.call(t, http.MethodPut, "/api/v1/notifications/subscribers/"+subscriber.ID, subscribe, http.StatusBadRequest)
+	env.call(t, http.MethodGet, "/api/v1/notifications/subscribers/"+subscriber.ID+"/digest", nil, http.StatusOK)
+	env.call(t, http.MethodPost, "/api/v1/notifications/subscribers/"+subscriber.ID+"/send", nil, http.StatusOK)
+	env.call(t, http.MethodPost, "/api/v1/notifications/subscribers/missing/send", nil, http.StatusNotFound)
+	env.call(t, http.MethodDelete, "/api/v1/notifications/subscribers/"+subscriber.ID, nil, http.StatusNoContent)
+	env.call(t, http.MethodDelete, "/api/v1/notifications/subscribers/"+subscriber.ID, nil, http.StatusNotFound)
+
+	// Chat routes
+	channel := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer channel.Close()
+	w = env.call(t, http.MethodPost, "/api/v1/chat/routes", handlers.ChatRouteRequest{Name: "ops", Format: chat.FormatSlack, URL: channel.URL + "/hooks/token"}, http.StatusCreated)
+	var route chat.Route
+	json.Unmarshal(w.Body.Bytes(), &route)
+	env.call(t, http.MethodPost, "/api/v1/chat/routes", handlers.ChatRouteRequest{Name: "ops", Format: "irc", URL: channel.URL}, http.StatusBadRequest)
+	env.call(t, http.MethodGet, "/api/v1/chat/routes", nil, http.StatusOK)
+	env.call(t, http.MethodGet, "/api/v1/chat/routes/"+route.ID, nil, http.StatusOK)
+	env.call(t, http.MethodGet, "/api/v1/chat/routes/missing", nil, http.StatusNotFound)
+	env.call(t, http.MethodPost, "/api/v1/chat/routes/"+route.ID+"/test", nil, http.StatusNoContent)
+	env.call(t, http.MethodPost, "/api/v1/chat/routes/missing/test", nil, http.StatusNotFound)
+	env.call(t, http.MethodDelete, "/api/v1/chat/routes/"+route.ID, nil, http.StatusNoContent)
+	env.call(t, http.MethodDelete, "/api/v1/chat/routes/"+route.ID, nil, http.StatusNotFound)
+
+	// Rollouts
+	start := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	rollout, _ := env.schedule(t, map[string]string{"servers": "no-cli", "start_at": start}, http.StatusCreated)
+	env.schedule(t, map[string]string{"start_at": start}, http.StatusBadRequest)
+	env.call(t, http.MethodGet, "/api/v1/rollouts", nil, http.StatusOK)
+	env.call(t, http.MethodGet, "/api/v1/rollouts/"+rollout.ID, nil, http.StatusOK)
+	env.call(t, http.MethodGet, "/api/v1/rollouts/missing", nil, http.StatusNotFound)
+	env.call(t, http.MethodPost, "/api/v1/rollouts/"+rollout.ID+"/cancel", nil, http.StatusOK)
+	env.call(t, http.MethodPost, "/api/v1/rollouts/"+rollout.ID+"/cancel", nil, http.StatusConflict)
+	env.call(t, http.MethodPost, "/api/v1/rollouts/missing/cancel", nil, http.StatusNotFound)
+	env.call(t, http.MethodPost, "/api/v1/servers", env.server("web-2", env.ssh), http.StatusCreated)
+	staged, _ := env.schedule(t, map[string]string{"servers": "no-cli,web-2", "start_at": start, "canary": "1"}, http.StatusCreated)
+	env.call(t, http.MethodPost, "/api/v1/rollouts/"+staged.ID+"/resume", nil, http.StatusConflict)
+	opens, _ := time.Parse(time.RFC3339, start)
+	env.rollouts.RunDue(context.Background(), opens.Add(time.Minute))
+	env.call(t, http.MethodPost, "/api/v1/rollouts/"+staged.ID+"/resume", nil, http.StatusOK)
+	env.call(t, http.MethodPost, "/api/v1/rollouts/missing/resume", nil, http.StatusNotFound)
+	env.call(t, http.MethodPost, "/api/v1/rollouts/"+staged.ID+"/abort", nil, http.StatusOK)
+	env.call(t, http.MethodPost, "/api/v1/rollouts/"+staged.ID+"/abort", nil, http.StatusConflict)
+	env.call(t, http.MethodPost, "/api/v1/rollouts/missing/abort", nil, http.StatusNotFound)
+
+	// Every documented success response was exercised
+	paths, _ := env.spec["paths"].(map[string]any)
+	for path, item := range paths {
+		for method, op := range item.(map[string]any) {
+			for status := range op.(map[string]any)["responses"].(map[string]any) {
+				key := strings.ToUpper(method) + " " + path + " " + status
+				if status < "300" && !env.checked[key] {
+					t.Errorf("%s was not exercised", key)
+				}
+			}
+		}
+	}
+}
+
+func TestV1_ErrorEnvelope(t *testing.T) {
+	env := newV1Env(t)
+
+	envelope := func(w *httptest.ResponseRecorder, status int, code string) {
+		t.Helper()
+		var body api.ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != status || body.Error.Code != code || body.Error.Message == "" {
+			t.Errorf("Expected %d with code %s, got %d: %s", status, code, w.Code, w.Body.String())
+		}
+	}
+
+	// Unknown versioned routes, bad tokens and missing CSRF tokens all use
+	// the envelope
+	envelope(env.do(t, http.MethodGet, "/api/v1/widgets", nil, ""), http.StatusNotFound, api.CodeNotFound)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/servers", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	envelope(w, http.StatusUnauthorized, api.CodeUnauthorized)
+	env.expect(t, http.MethodGet, "/api/v1/servers", w, http.StatusUnauthorized)
+
+	// Requests without a token are not identified by their address
+	w = httptest.NewRecorder()
+	env.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/whoami", nil))
+	envelope(w, http.StatusUnauthorized, api.CodeUnauthorized)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/servers/web-1/check", nil)
+	w = httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	envelope(w, http.StatusForbidden, api.CodeForbidden)
+
+	// Other paths keep gin's default 404
+	w = env.do(t, http.MethodGet, "/elsewhere", nil, "")
+	if w.Code != http.StatusNotFound || strings.Contains(w.Body.String(), "not_found") {
+		t.Errorf("Expected a plain 404 outside the versioned API, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestV1_ShuttingDown(t *testing.T) {
+	env := newV1Env(t)
+	env.call(t, http.MethodPost, "/api/v1/servers", env.server("web-1", env.ssh), http.StatusCreated)
+
+	manager, err := jobs.Open(filepath.Join(t.TempDir(), "jobs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.Shutdown(context.Background())
+	handlers.SetJobManager(manager)
+
+	env.call(t, http.MethodPost, "/api/v1/servers/web-1/check", nil, http.StatusServiceUnavailable)
+}
+
+func TestV1_QuotesLicenseFilename(t *testing.T) {
+	env := newV1Env(t)
+	env.call(t, http.MethodPost, "/api/v1/servers", env.server("web-1", env.ssh), http.StatusCreated)
+
+	env.upload(t, "web-1", "x;touch pwned;'.lic", http.StatusOK)
+
+	// The file name reaches the shell as a single word
+	quoted := `'/tmp/x;touch pwned;'\''.lic'`
+	commands := strings.Join(env.ssh.Commands(), "\n")
+	for _, want := range []string{"cat > " + quoted, "license2_cli import -l " + quoted, "rm -f " + quoted} {
+		if !strings.Contains(commands, want) {
+			t.Errorf("Expected %q to have been run, got:\n%s", want, commands)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package integration
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"license-manager/internal/handlers"
+	"license-manager/internal/webhooks"
+	"license-manager/tests/fixtures"
+)
+
+const webhookSecret = "receiver-secret"
+
+// receivedEvent is a delivery as the receiver saw it
+type receivedEvent struct {
+	Delivery string
+	Event    webhooks.Event
+	Data     map[string]any
+}
+
+// receiver is a local webhook endpoint that verifies every delivery's
+// signature and answers with the next of its statuses, then 200
+type receiver struct {
+	t        *testing.T
+	server   *httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	events   []receivedEvent
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	t.Helper()
+	r := &receiver{t: t, statuses: statuses}
+	r.server = httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func (r *receiver) serve(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	if err := webhooks.Verify(webhookSecret, req.Header.Get(webhooks.SignatureHeader), body, time.Minute); err != nil {
+		r.t.Errorf("Expected a valid signature on %s: %v", body, err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var event webhooks.Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		r.t.Errorf("Expected a JSON event, got %s", body)
+	}
+	if req.Header.Get(webhooks.EventHeader) != event.Type || req.Header.Get("Content-Type") != "application/json" {
+		r.t.Errorf("Expected the event type and content type in the headers, got %v", req.Header)
+	}
+	data, _ := event.Data.(map[string]any)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, receivedEvent{Delivery: req.Header.Get(webhooks.DeliveryHeader), Event: event, Data: data})
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+// wait returns the received events once there are n of type event
+func (r *receiver) wait(event string, n int) []receivedEvent {
+	r.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var matched []receivedEvent
+		r.mu.Lock()
+		for _, e := range r.events {
+			if e.Event.Type == event {
+				matched = append(matched, e)
+			}
+		}
+		r.mu.Unlock()
+		if len(matched) >= n {
+			return matched
+		}
+		if time.Now().After(deadline) {
+			r.t.Fatalf("Expected %d %s events, got %d", n, event, len(matched))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (r *receiver) count(event string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, e := range r.events {
+		if e.Event.Type == event {
+			n++
+		}
+	}
+	return n
+}
+
+// register creates a webhook for the receiver through the API
+func (e *v1Env) register(t *testing.T, r *receiver, events ...string) string {
+	t.Helper()
+	w := e.call(t, http.MethodPost, "/api/v1/webhooks", handlers.WebhookRequest{URL: r.server.URL, Events: events, Secret: webhookSecret}, http.StatusCreated)
+	var created handlers.WebhookCreated
+	json.Unmarshal(w.Body.Bytes(), &created)
+	return created.ID
+}
+
+// deliveries lists a webhook's deliveries through the API
+func (e *v1Env) deliveries(t *testing.T, id string) []webhooks.Delivery {
+	t.Helper()
+	w := e.call(t, http.MethodGet, "/api/v1/webhooks/"+id+"/deliveries", nil, http.StatusOK)
+	var page struct {
+		Items []webhooks.Delivery `json:"items"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &page)
+	return page.Items
+}
+
+// countDeliveries counts the deliveries of an event type
+func countDeliveries(list []webhooks.Delivery, event string) int {
+	n := 0
+	for _, d := range list {
+		if d.EventType == event {
+			n++
+		}
+	}
+	return n
+}
+
+func TestWebhooks_Events(t *testing.T) {
+	env := newV1Env(t)
+
+	// A host whose license expires soon and whose sysinfo file changes
+	// between downloads
+	var downloads atomic.Int32
+	host := fixtures.NewSSHServer(t, func(req *fixtures.ExecRequest) int {
+		switch cmd := req.Command; {
+		case cmd == "which license2_cli":
+			fmt.Fprint(req.Stdout, "/usr/local/bin/license2_cli\n")
+		case strings.HasPrefix(cmd, "cat > "):
+			io.Copy(io.Discard, req.Stdin)
+		case cmd == "license2_cli check":
+			fmt.Fprint(req.Stdout, "License OK, 12 days remaining\n")
+		case strings.HasPrefix(cmd, "ls -la sys_info.bin"):
+			fmt.Fprint(req.Stdout, "-rw-r--r-- 1 testuser testuser 8 Jan  1 00:00 sys_info.bin\n")
+		case cmd == "cat 'sys_info.bin'":
+			fmt.Fprintf(req.Stdout, "SYSINFO%d", downloads.Add(1)/3)
+		}
+		return 0
+	})
+	env.call(t, http.MethodPost, "/api/v1/servers", env.server("web-1", host), http.StatusCreated)
+	down := env.server("down", env.ssh)
+	down.Host, down.Port = "127.0.0.1", "1"
+	env.call(t, http.MethodPost, "/api/v1/servers", down, http.StatusCreated)
+
+	all := newReceiver(t)
+	allID := env.register(t, all)
+	failures := newReceiver(t)
+	env.register(t, failures, webhooks.EventJobFailed)
+
+	// Import: the job, the license and, within the warning period, its expiry
+	env.upload(t, "web-1", "good.lic", http.StatusOK)
+	imported := all.wait(webhooks.EventLicenseImported, 1)[0]
+	if imported.Data["server"] != "web-1" || imported.Data["license"] != "good.lic" || imported.Data["days_remaining"] != float64(12) {
+		t.Errorf("Unexpected license.imported data %v", imported.Data)
+	}
+	expiring := all.wait(webhooks.EventLicenseExpiring, 1)[0]
+	if expiring.Data["days_remaining"] != float64(12) || expiring.Data["warning_days"] != float64(handlers.DefaultExpiryWarningDays) {
+		t.Errorf("Unexpected license.expiring data %v", expiring.Data)
+	}
+	completed := all.wait(webhooks.EventJobCompleted, 1)[0]
+	if completed.Data["kind"] != "upload-license" || completed.Data["status"] != "succeeded" || completed.Data["job_id"] == "" {
+		t.Errorf("Unexpected job.completed data %v", completed.Data)
+	}
+	// The periodic check does not report the license again
+	if err := env.expiry.Check(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same sysinfo twice is not drift; a changed one is
+	env.call(t, http.MethodPost, "/api/v1/servers/web-1/sysinfo", nil, http.StatusOK)
+	env.call(t, http.MethodPost, "/api/v1/servers/web-1/sysinfo", nil, http.StatusOK)
+	env.call(t, http.MethodPost, "/api/v1/servers/web-1/sysinfo", nil, http.StatusOK)
+	drift := all.wait(webhooks.EventFingerprintDrift, 1)[0]
+	if drift.Data["previous_sha256"] == drift.Data["sysinfo_sha256"] || drift.Data["server"] != "web-1" {
+		t.Errorf("Unexpected fingerprint.drift data %v", drift.Data)
+	}
+	all.wait(webhooks.EventJobCompleted, 4)
+	if n := countDeliveries(env.deliveries(t, allID), webhooks.EventLicenseExpiring); n != 1 {
+		t.Errorf("Expected license.expiring once, got %d", n)
+	}
+	if n := all.count(webhooks.EventFingerprintDrift); n != 1 {
+		t.Errorf("Expected drift to be reported once, got %d", n)
+	}
+
+	// An unreachable host fails its job
+	env.call(t, http.MethodPost, "/api/v1/servers/down/check", nil, http.StatusBadGateway)
+	unreachable := all.wait(webhooks.EventHostUnreachable, 1)[0]
+	if unreachable.Data["host"] != "127.0.0.1:1" || unreachable.Data["kind"] != "check-license-cli" || unreachable.Data["error"] == "" {
+		t.Errorf("Unexpected host.unreachable data %v", unreachable.Data)
+	}
+	failed := failures.wait(webhooks.EventJobFailed, 1)[0]
+	if failed.Data["status"] != "failed" || failed.Data["error"] == "" {
+		t.Errorf("Unexpected job.failed data %v", failed.Data)
+	}
+	all.wait(webhooks.EventJobFailed, 1)
+
+	// A webhook only receives the events it subscribed to
+	if n := failures.count(webhooks.EventJobCompleted) + failures.count(webhooks.EventHostUnreachable); n != 0 {
+		t.Errorf("Expected only job.failed events, got %d others", n)
+	}
+}
+
+func TestWebhooks_LicenseEntersWarningPeriod(t *testing.T) {
+	env := newV1Env(t)
+	host := fixtures.NewSSHServer(t, func(req *fixtures.ExecRequest) int {
+		switch cmd := req.Command; {
+		case cmd == "which license2_cli":
+			fmt.Fprint(req.Stdout, "/usr/local/bin/license2_cli\n")
+		case strings.HasPrefix(cmd, "cat > "):
+			io.Copy(io.Discard, req.Stdin)
+		case cmd == "license2_cli check":
+			fmt.Fprint(req.Stdout, "License OK, 40 days remaining\n")
+		}
+		return 0
+	})
+	env.call(t, http.MethodPost, "/api/v1/servers", env.server("web-1", host), http.StatusCreated)
+	all := newReceiver(t)
+	id := env.register(t, all)
+
+	// Imported outside the warning period: not expiring yet
+	env.upload(t, "web-1", "good.lic", http.StatusOK)
+	all.wait(webhooks.EventJobCompleted, 1)
+	now := time.Now()
+	if err := env.expiry.Check(now); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fifteen days later the check finds it within the period, once
+	later := now.AddDate(0, 0, 15)
+	for i := 0; i < 2; i++ {
+		if err := env.expiry.Check(later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expiring := all.wait(webhooks.EventLicenseExpiring, 1)[0]
+	if expiring.Data["server"] != "web-1" || expiring.Data["license"] != "good.lic" || expiring.Data["license_sha256"] == "" ||
+		expiring.Data["days_remaining"] != float64(25) || expiring.Data["warning_days"] != float64(handlers.DefaultExpiryWarningDays) {
+		t.Errorf("Unexpected license.expiring data %v", expiring.Data)
+	}
+	if n := countDeliveries(env.deliveries(t, id), webhooks.EventLicenseExpiring); n != 1 {
+		t.Errorf("Expected license.expiring once, got %d", n)
+	}
+}
+
+func TestWebhooks_RetryAndRedeliver(t *testing.T) {
+	env := newV1Env(t)
+
+	// Two failures, then success
+	flaky := newReceiver(t, http.StatusInternalServerError, http.StatusServiceUnavailable)
+	flakyID := env.register(t, flaky)
+	env.call(t, http.MethodPost, "/api/v1/webhooks/"+flakyID+"/ping", nil, http.StatusAccepted)
+	pings := flaky.wait(webhooks.EventPing, 3)
+	if pings[0].Event.ID != pings[2].Event.ID || pings[0].Delivery != pings[2].Delivery {
+		t.Errorf("Expected retries to resend the same delivery, got %+v", pings)
+	}
+	delivery := waitDelivery(t, env, flakyID, webhooks.StatusSucceeded)
+	if len(delivery.Attempts) != 3 || delivery.Attempts[0].StatusCode != http.StatusInternalServerError || delivery.Attempts[2].StatusCode != http.StatusOK {
+		t.Errorf("Expected three recorded attempts, got %+v", delivery.Attempts)
+	}
+
+	// A receiver that never succeeds fails the delivery after max attempts
+	broken := newReceiver(t, 500, 500, 500)
+	brokenID := env.register(t, broken)
+	env.call(t, http.MethodPost, "/api/v1/webhooks/"+brokenID+"/ping", nil, http.StatusAccepted)
+	failed := waitDelivery(t, env, brokenID, webhooks.StatusFailed)
+	if len(failed.Attempts) != 3 || failed.Attempts[2].Error == "" || failed.NextAttemptAt != nil {
+		t.Errorf("Expected a failed delivery after three attempts, got %+v", failed)
+	}
+
+	// Redelivery sends the same event again, now to a working receiver
+	w := env.call(t, http.MethodPost, "/api/v1/webhooks/"+brokenID+"/deliveries/"+failed.ID+"/redeliver", nil, http.StatusAccepted)
+	var redelivery webhooks.Delivery
+	json.Unmarshal(w.Body.Bytes(), &redelivery)
+	if redelivery.ID == failed.ID || redelivery.RedeliveryOf != failed.ID || redelivery.EventID != failed.EventID {
+		t.Errorf("Expected a new delivery of the same event, got %+v", redelivery)
+	}
+	received := broken.wait(webhooks.EventPing, 4)
+	if last := received[3]; last.Delivery != redelivery.ID || last.Event.ID != failed.EventID {
+		t.Errorf("Expected the redelivery to carry the original event, got %+v", last)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		list := env.deliveries(t, brokenID)
+		if len(list) == 2 && list[0].ID == redelivery.ID && list[0].Status == webhooks.StatusSucceeded {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the redelivery to succeed, got %+v", list)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitDelivery returns the webhook's newest delivery once it has status
+func waitDelivery(t *testing.T, env *v1Env, id, status string) webhooks.Delivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		list := env.deliveries(t, id)
+		if len(list) > 0 && list[0].Status == status {
+			return list[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a %s delivery, got %+v", status, list)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
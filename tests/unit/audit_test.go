@@ -0,0 +1,201 @@
+package unit
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"license-manager/internal/audit"
+)
+
+func openTestAuditLog(t *testing.T) *audit.Log {
+	t.Helper()
+	log, err := audit.Open(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return log
+}
+
+func TestAuditLog_AppendAndVerify(t *testing.T) {
+	log := openTestAuditLog(t)
+
+	records := []audit.Record{
+		{Actor: "10.0.0.1", Action: audit.ActionConnect, Host: "192.168.5.152:22", Outcome: audit.OutcomeSuccess},
+		{Actor: "10.0.0.1", Action: audit.ActionExec, Host: "192.168.5.152:22", Command: "which license2_cli", Outcome: audit.OutcomeSuccess},
+		{Actor: "10.0.0.2", Action: audit.ActionUploadLicense, Host: "192.168.5.153:22", LicenseSHA256: "abc", Outcome: audit.OutcomeFailure, ExitStatus: 1},
+	}
+	for _, rec := range records {
+		if err := log.Append(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count, err := log.Verify()
+	if err != nil {
+		t.Fatalf("Expected valid chain, got %v", err)
+	}
+	if count != len(records) {
+		t.Errorf("Expected %d verified records, got %d", len(records), count)
+	}
+
+	all, err := log.Query(audit.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all[0].PrevHash == "" || all[1].PrevHash != all[0].Hash || all[2].PrevHash != all[1].Hash {
+		t.Error("Expected each record to link to the previous record's hash")
+	}
+}
+
+func TestAuditLog_ReopenContinuesChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	first, err := audit.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Append(audit.Record{Actor: "a", Action: audit.ActionExec}); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := audit.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Append(audit.Record{Actor: "b", Action: audit.ActionExec}); err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := second.Verify()
+	if err != nil {
+		t.Fatalf("Expected valid chain after reopen, got %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 records, got %d", count)
+	}
+}
+
+func TestAuditLog_DetectsTampering(t *testing.T) {
+	log := openTestAuditLog(t)
+	for _, actor := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		if err := log.Append(audit.Record{Actor: actor, Action: audit.ActionExec, Command: "license2_cli check"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(log.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(string) string
+	}{
+		{
+			name: "edited field",
+			modify: func(s string) string {
+				return strings.Replace(s, "10.0.0.2", "10.0.0.9", 1)
+			},
+		},
+		{
+			name: "deleted record",
+			modify: func(s string) string {
+				lines := strings.SplitAfter(s, "\n")
+				return lines[0] + lines[2]
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(log.Path(), []byte(tt.modify(string(data))), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := log.Verify(); err == nil {
+				t.Error("Expected verification to fail for tampered log")
+			}
+		})
+	}
+}
+
+func TestAuditLog_Query(t *testing.T) {
+	log := openTestAuditLog(t)
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, host := range []string{"h1:22", "h2:22", "h1:22", "h1:22"} {
+		rec := audit.Record{
+			Time:   base.Add(time.Duration(i) * time.Hour),
+			Actor:  "10.0.0.1",
+			Action: audit.ActionExec,
+			Host:   host,
+		}
+		if err := log.Append(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		filter   audit.Filter
+		expected []uint64
+	}{
+		{name: "no filter", filter: audit.Filter{}, expected: []uint64{1, 2, 3, 4}},
+		{name: "by host", filter: audit.Filter{Host: "h1:22"}, expected: []uint64{1, 3, 4}},
+		{name: "since", filter: audit.Filter{Since: base.Add(2 * time.Hour)}, expected: []uint64{3, 4}},
+		{name: "until", filter: audit.Filter{Until: base.Add(time.Hour)}, expected: []uint64{1, 2}},
+		{name: "limit keeps latest", filter: audit.Filter{Host: "h1:22", Limit: 2}, expected: []uint64{3, 4}},
+		{name: "no match", filter: audit.Filter{Actor: "nobody"}, expected: []uint64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := log.Query(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != len(tt.expected) {
+				t.Fatalf("Expected %d records, got %d", len(tt.expected), len(records))
+			}
+			for i, rec := range records {
+				if rec.Seq != tt.expected[i] {
+					t.Errorf("Expected record %d to have seq %d, got %d", i, tt.expected[i], rec.Seq)
+				}
+			}
+		})
+	}
+}
+
+func TestAuditLog_WriteCSV(t *testing.T) {
+	log := openTestAuditLog(t)
+	if err := log.Append(audit.Record{Actor: "10.0.0.1", Action: audit.ActionExec, Command: "echo \"a,b\""}); err != nil {
+		t.Fatal(err)
+	}
+	records, err := log.Query(audit.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := audit.WriteCSV(&buf, records); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Expected header and 1 row, got %d rows", len(rows))
+	}
+	if rows[0][0] != "seq" {
+		t.Errorf("Expected header row, got %v", rows[0])
+	}
+	if rows[1][8] != "echo \"a,b\"" {
+		t.Errorf("Expected command column to round-trip, got %q", rows[1][8])
+	}
+}
@@ -0,0 +1,307 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"license-manager/internal/chat"
+)
+
+// chatReceiver records the bodies posted to it, answering with the given
+// statuses in turn and 200 once they run out
+type chatReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	bodies   [][]byte
+	times    []time.Time
+	statuses []int
+}
+
+func newChatReceiver(t *testing.T, statuses ...int) *chatReceiver {
+	r := &chatReceiver{statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.bodies = append(r.bodies, body)
+		r.times = append(r.times, time.Now())
+		if len(r.statuses) > 0 {
+			status := r.statuses[0]
+			r.statuses = r.statuses[1:]
+			if status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "1")
+			}
+			w.WriteHeader(status)
+		}
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *chatReceiver) posts() ([][]byte, []time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][]byte{}, r.bodies...), append([]time.Time{}, r.times...)
+}
+
+// waitPosts waits until the receiver has n posts
+func (r *chatReceiver) waitPosts(t *testing.T, n int) ([][]byte, []time.Time) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		bodies, times := r.posts()
+		if len(bodies) >= n {
+			return bodies, times
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d posts, got %d", n, len(bodies))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func runChat(t *testing.T, n *chat.Notifier) {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		n.Run(stop)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		close(stop)
+		<-done
+	})
+}
+
+func TestChat_RouteMatches(t *testing.T) {
+	failed := chat.Message{Event: chat.EventJobFailed, Tags: []string{"prod", "eu"}}
+
+	tests := []struct {
+		name  string
+		route chat.Route
+		msg   chat.Message
+		want  bool
+	}{
+		{name: "everything", route: chat.Route{}, msg: failed, want: true},
+		{name: "subscribed event", route: chat.Route{Events: []string{chat.EventJobFailed}}, msg: failed, want: true},
+		{name: "other event", route: chat.Route{Events: []string{chat.EventJobCompleted}}, msg: failed},
+		{name: "matching tag", route: chat.Route{Tags: []string{"eu"}}, msg: failed, want: true},
+		{name: "other tag", route: chat.Route{Tags: []string{"dev"}}, msg: failed},
+		{name: "untagged server", route: chat.Route{Tags: []string{"prod"}}, msg: chat.Message{Event: chat.EventJobFailed}},
+		{name: "event and tag", route: chat.Route{Events: []string{chat.EventJobFailed}, Tags: []string{"prod"}}, msg: failed, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.route.Matches(tt.msg); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChat_Create(t *testing.T) {
+	n, err := chat.Open(filepath.Join(t.TempDir(), "chat.json"), chat.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []struct {
+		name, format, url string
+		events, tags      []string
+	}{
+		{name: "", format: chat.FormatSlack, url: "https://hooks.example.com/x"},
+		{name: "ops", format: "irc", url: "https://hooks.example.com/x"},
+		{name: "ops", format: chat.FormatSlack, url: "hooks.example.com/x"},
+		{name: "ops", format: chat.FormatSlack, url: "https://hooks.example.com/x", events: []string{"fingerprint.drift"}},
+		{name: "ops", format: chat.FormatSlack, url: "https://hooks.example.com/x", tags: []string{" "}},
+	}
+	for _, tt := range invalid {
+		if _, err := n.Create(tt.name, tt.format, tt.url, tt.events, tt.tags); err == nil {
+			t.Errorf("Expected %+v to be rejected", tt)
+		}
+	}
+
+	r, err := n.Create("ops", chat.FormatTeams, "https://hooks.example.com/workflows/secret-token?sig=abc", nil, []string{"prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Redacted().URL; got != "https://hooks.example.com/..." {
+		t.Errorf("Expected the token to be redacted, got %q", got)
+	}
+	if _, err := n.Get("missing"); !errors.Is(err, chat.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	// The file holds webhook URLs
+	info, err := os.Stat(n.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+	}
+	reopened, err := chat.Open(n.Path(), chat.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := reopened.Get(r.ID); err != nil || got.URL != r.URL {
+		t.Errorf("Expected the route to persist, got %+v, %v", got, err)
+	}
+}
+
+func TestChat_Formats(t *testing.T) {
+	msg := chat.Message{
+		Event:    chat.EventJobFailed,
+		Severity: chat.SeverityDanger,
+		Title:    "upload-license failed on web-1 (10.0.0.1:22)",
+		Text:     "exit status 1 <details>",
+		Fields:   []chat.Field{{Name: "Actor", Value: "alice"}},
+	}
+
+	var slack struct {
+		Text        string `json:"text"`
+		Username    string `json:"username"`
+		Attachments []struct {
+			Color  string `json:"color"`
+			Title  string `json:"title"`
+			Text   string `json:"text"`
+			Fields []struct {
+				Title string `json:"title"`
+				Value string `json:"value"`
+			} `json:"fields"`
+		} `json:"attachments"`
+	}
+	body, err := chat.Format(chat.FormatSlack, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(body, &slack); err != nil {
+		t.Fatal(err)
+	}
+	if slack.Text != msg.Title || len(slack.Attachments) != 1 || slack.Username != "" {
+		t.Fatalf("Unexpected Slack payload %s", body)
+	}
+	a := slack.Attachments[0]
+	if a.Color != "#a30200" || a.Text != "exit status 1 &lt;details&gt;" || len(a.Fields) != 1 || a.Fields[0].Value != "alice" {
+		t.Errorf("Unexpected Slack attachment %+v", a)
+	}
+
+	body, err = chat.Format(chat.FormatMattermost, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(body, &slack); err != nil || slack.Username != "License Manager" {
+		t.Errorf("Expected Mattermost to set the username, got %s", body)
+	}
+
+	var teams struct {
+		Type        string `json:"type"`
+		Attachments []struct {
+			ContentType string `json:"contentType"`
+			Content     struct {
+				Type string `json:"type"`
+				Body []struct {
+					Type  string `json:"type"`
+					Text  string `json:"text"`
+					Color string `json:"color"`
+					Facts []struct {
+						Title string `json:"title"`
+						Value string `json:"value"`
+					} `json:"facts"`
+				} `json:"body"`
+			} `json:"content"`
+		} `json:"attachments"`
+	}
+	body, err = chat.Format(chat.FormatTeams, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(body, &teams); err != nil {
+		t.Fatal(err)
+	}
+	if teams.Type != "message" || len(teams.Attachments) != 1 || teams.Attachments[0].ContentType != "application/vnd.microsoft.card.adaptive" {
+		t.Fatalf("Unexpected Teams payload %s", body)
+	}
+	card := teams.Attachments[0].Content
+	if card.Type != "AdaptiveCard" || len(card.Body) != 3 {
+		t.Fatalf("Expected a card with a title, text and facts, got %s", body)
+	}
+	if card.Body[0].Text != msg.Title || card.Body[0].Color != "Attention" || card.Body[1].Text != msg.Text || card.Body[2].Facts[0].Title != "Actor" {
+		t.Errorf("Unexpected Teams card %+v", card)
+	}
+
+	if _, err := chat.Format("irc", msg); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
+
+func TestChat_Test(t *testing.T) {
+	receiver := newChatReceiver(t, http.StatusForbidden)
+	n, err := chat.Open(filepath.Join(t.TempDir(), "chat.json"), chat.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := n.Create("ops", chat.FormatSlack, receiver.URL+"/services/secret-token", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A rejected post is reported without retrying or leaking the token
+	err = n.Test(context.Background(), r.ID)
+	if !errors.Is(err, chat.ErrPostFailed) || !strings.Contains(err.Error(), "403") || strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("Expected a redacted ErrPostFailed, got %v", err)
+	}
+	if err := n.Test(context.Background(), r.ID); err != nil {
+		t.Errorf("Expected the second test to be posted, got %v", err)
+	}
+	if bodies, _ := receiver.posts(); len(bodies) != 2 || !strings.Contains(string(bodies[1]), "test message") {
+		t.Errorf("Expected two test posts, got %q", bodies)
+	}
+}
+
+func TestChat_Retries(t *testing.T) {
+	receiver := newChatReceiver(t, http.StatusInternalServerError, http.StatusTooManyRequests)
+	n, err := chat.Open(filepath.Join(t.TempDir(), "chat.json"), chat.Options{Backoff: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.Create("prod", chat.FormatSlack, receiver.URL, []string{chat.EventJobFailed}, []string{"prod"}); err != nil {
+		t.Fatal(err)
+	}
+	runChat(t, n)
+
+	// Only the failed job on a prod server is routed
+	n.Publish(chat.Message{Event: chat.EventJobCompleted, Title: "completed", Tags: []string{"prod"}})
+	n.Publish(chat.Message{Event: chat.EventJobFailed, Title: "dev failed", Tags: []string{"dev"}})
+	n.Publish(chat.Message{Event: chat.EventJobFailed, Title: "prod failed", Tags: []string{"prod"}})
+
+	// A server error is retried after the backoff, then the rate limit's
+	// Retry-After is honoured
+	bodies, times := receiver.waitPosts(t, 3)
+	for _, body := range bodies {
+		if !strings.Contains(string(body), "prod failed") {
+			t.Errorf("Expected only the prod failure to be posted, got %s", body)
+		}
+	}
+	if wait := times[2].Sub(times[1]); wait < 900*time.Millisecond {
+		t.Errorf("Expected to wait for Retry-After, waited %v", wait)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if bodies, _ := receiver.posts(); len(bodies) != 3 {
+		t.Errorf("Expected no further posts after success, got %d", len(bodies))
+	}
+
+	// A nil notifier discards messages
+	var none *chat.Notifier
+	none.Publish(chat.Message{Event: chat.EventJobFailed})
+}
@@ -0,0 +1,197 @@
+package unit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"license-manager/internal/config"
+)
+
+// testPathArgs point the config at the repository's templates and static files
+var testPathArgs = []string{"-templates", "../../templates/*", "-static-dir", "../../static"}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigLoad_Defaults(t *testing.T) {
+	cfg, opts, err := config.Load(testPathArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if opts.PrintConfig {
+		t.Error("Expected print-config to be off by default")
+	}
+	if cfg.Server.ListenAddr != ":8080" {
+		t.Errorf("Expected listen address ':8080', got '%s'", cfg.Server.ListenAddr)
+	}
+	if cfg.Storage.UploadDir != "uploads" {
+		t.Errorf("Expected upload dir 'uploads', got '%s'", cfg.Storage.UploadDir)
+	}
+	if cfg.SSH.RemoteTempDir != "/tmp/" {
+		t.Errorf("Expected remote temp dir '/tmp/', got '%s'", cfg.SSH.RemoteTempDir)
+	}
+	if cfg.SSH.Timeout != 10*time.Second {
+		t.Errorf("Expected SSH timeout 10s, got %v", cfg.SSH.Timeout)
+	}
+	if cfg.CORSMiddleware().Enabled() {
+		t.Error("Expected CORS to be disabled by default")
+	}
+}
+
+func TestConfigLoad_Precedence(t *testing.T) {
+	file := writeConfigFile(t, `
+server:
+  listen_addr: ":9000"
+storage:
+  upload_dir: /var/lib/license-manager/uploads
+ssh:
+  timeout: 20s
+  remote_temp_dir: /var/tmp
+cors:
+  allowed_origins: ["https://ops.example.com"]
+`)
+	t.Setenv("SSH_TIMEOUT", "30s")
+	t.Setenv("UPLOAD_DIR", "/srv/uploads")
+
+	args := append([]string{"-config", file, "-upload-dir", "/flag/uploads"}, testPathArgs...)
+	cfg, _, err := config.Load(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Server.ListenAddr != ":9000" {
+		t.Errorf("Expected file value ':9000', got '%s'", cfg.Server.ListenAddr)
+	}
+	if cfg.SSH.RemoteTempDir != "/var/tmp" {
+		t.Errorf("Expected file value '/var/tmp', got '%s'", cfg.SSH.RemoteTempDir)
+	}
+	if cfg.SSH.Timeout != 30*time.Second {
+		t.Errorf("Expected env to override file timeout, got %v", cfg.SSH.Timeout)
+	}
+	if cfg.Storage.UploadDir != "/flag/uploads" {
+		t.Errorf("Expected flag to override env upload dir, got '%s'", cfg.Storage.UploadDir)
+	}
+	if !cfg.CORSMiddleware().Enabled() {
+		t.Error("Expected CORS origins from file to enable CORS")
+	}
+}
+
+func TestConfigLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+	}{
+		{name: "unknown field", file: "server:\n  listen: \":80\"\n"},
+		{name: "relative remote temp dir", args: []string{"-remote-temp-dir", "tmp"}},
+		{name: "zero ssh timeout", env: map[string]string{"SSH_TIMEOUT": "0s"}},
+		{name: "malformed env duration", env: map[string]string{"SSH_TIMEOUT": "soon"}},
+		{name: "missing templates", args: []string{"-templates", "/nonexistent/*"}},
+		{name: "tls cert without key", env: map[string]string{"TLS_CERT_FILE": "/etc/tls/tls.crt"}},
+		{name: "wildcard cors with credentials", env: map[string]string{"CORS_ALLOWED_ORIGINS": "*", "CORS_ALLOW_CREDENTIALS": "true"}},
+		{name: "api token without name", env: map[string]string{"API_TOKENS": "secret"}},
+		{name: "grpc without api tokens", args: []string{"-grpc-listen", ":9090"}},
+		{name: "grpc on the http address", env: map[string]string{"API_TOKENS": "ci:secret"}, args: []string{"-listen", ":9090", "-grpc-listen", ":9090"}},
+		{name: "no webhook attempts", env: map[string]string{"WEBHOOK_MAX_ATTEMPTS": "0"}},
+		{name: "webhook backoff above its maximum", env: map[string]string{"WEBHOOK_RETRY_BACKOFF": "1h", "WEBHOOK_MAX_RETRY_BACKOFF": "1m"}},
+		{name: "unknown smtp security", env: map[string]string{"SMTP_HOST": "smtp.example.com", "SMTP_SECURITY": "ssl"}},
+		{name: "invalid email sender", env: map[string]string{"SMTP_HOST": "smtp.example.com", "EMAIL_FROM": "license manager"}},
+		{name: "zero chat backoff", env: map[string]string{"CHAT_RETRY_BACKOFF": "0s"}},
+		{name: "zero rollout check interval", env: map[string]string{"ROLLOUT_CHECK_INTERVAL": "0s"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := append([]string{}, testPathArgs...)
+			if tt.file != "" {
+				args = append(args, "-config", writeConfigFile(t, tt.file))
+			}
+			args = append(args, tt.args...)
+
+			if _, _, err := config.Load(args); err == nil {
+				t.Error("Expected configuration to be rejected")
+			}
+		})
+	}
+}
+
+func TestConfig_PrintConfig(t *testing.T) {
+	cfg, opts, err := config.Load(append([]string{"-print-config"}, testPathArgs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opts.PrintConfig {
+		t.Error("Expected print-config option to be set")
+	}
+
+	var buf bytes.Buffer
+	if err := cfg.PrintConfig(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"listen_addr: :8080", "remote_temp_dir: /tmp/", "timeout: 10s"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	t.Setenv("ADMIN_TOKENS", "first-token,second-token")
+	t.Setenv("API_TOKENS", "ci:api-token")
+	cfg, _, err = config.Load(testPathArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Security.AdminTokens) != 2 {
+		t.Fatalf("Expected two admin tokens, got %v", cfg.Security.AdminTokens)
+	}
+	buf.Reset()
+	if err := cfg.PrintConfig(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); strings.Contains(out, "first-token") || strings.Contains(out, "api-token") || !strings.Contains(out, "[REDACTED]") {
+		t.Errorf("Expected admin and API tokens to be redacted, got:\n%s", out)
+	}
+}
+
+func TestConfig_PrintInvalidConfig(t *testing.T) {
+	t.Setenv("SSH_TIMEOUT", "0s")
+	t.Setenv("API_TOKENS", "ci:api-token")
+	if _, _, err := config.Load(testPathArgs); err == nil {
+		t.Fatal("Expected Load to reject the configuration")
+	}
+
+	// Parse leaves validation to the caller, so the merged configuration
+	// can be printed first
+	cfg, opts, err := config.Parse(append([]string{"-print-config"}, testPathArgs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opts.PrintConfig {
+		t.Error("Expected print-config option to be set")
+	}
+	var buf bytes.Buffer
+	if err := cfg.PrintConfig(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "timeout: 0s") || strings.Contains(out, "api-token") {
+		t.Errorf("Expected the invalid value with secrets redacted, got:\n%s", out)
+	}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "ssh.timeout") {
+		t.Errorf("Expected the ssh.timeout validation error, got %v", err)
+	}
+}
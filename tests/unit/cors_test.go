@@ -0,0 +1,146 @@
+package unit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"license-manager/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newCORSRouter(config middleware.CORSConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.CORS(config))
+	router.POST("/api/check-license-cli", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func TestCORS_DisabledByDefault(t *testing.T) {
+	config := middleware.DefaultCORSConfig()
+	if config.Enabled() {
+		t.Fatal("Expected CORS to be disabled by default")
+	}
+
+	router := newCORSRouter(config)
+	req, _ := http.NewRequest("POST", "/api/check-license-cli", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Expected no Access-Control-Allow-Origin, got %q", got)
+	}
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	config := middleware.DefaultCORSConfig()
+	config.AllowedOrigins = []string{"https://ops.example.com"}
+	config.AllowCredentials = true
+	config.MaxAge = time.Hour
+	router := newCORSRouter(config)
+
+	tests := []struct {
+		name           string
+		origin         string
+		method         string
+		headers        string
+		expectedStatus int
+		expectedOrigin string
+	}{
+		{
+			name:           "allowed origin and method",
+			origin:         "https://ops.example.com",
+			method:         "POST",
+			headers:        "content-type",
+			expectedStatus: http.StatusNoContent,
+			expectedOrigin: "https://ops.example.com",
+		},
+		{
+			name:           "disallowed method",
+			origin:         "https://ops.example.com",
+			method:         "PATCH",
+			expectedStatus: http.StatusForbidden,
+			expectedOrigin: "https://ops.example.com",
+		},
+		{
+			name:           "disallowed header",
+			origin:         "https://ops.example.com",
+			method:         "POST",
+			headers:        "X-Custom",
+			expectedStatus: http.StatusForbidden,
+			expectedOrigin: "https://ops.example.com",
+		},
+		{
+			name:           "unknown origin",
+			origin:         "https://evil.example.com",
+			method:         "POST",
+			expectedStatus: http.StatusNotFound,
+			expectedOrigin: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("OPTIONS", "/api/check-license-cli", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", tt.method)
+			if tt.headers != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.headers)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.expectedOrigin {
+				t.Errorf("Expected Access-Control-Allow-Origin %q, got %q", tt.expectedOrigin, got)
+			}
+			if tt.expectedStatus == http.StatusNoContent {
+				if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+					t.Errorf("Expected credentials to be allowed, got %q", got)
+				}
+				if got := w.Header().Get("Access-Control-Max-Age"); got != "3600" {
+					t.Errorf("Expected Max-Age 3600, got %q", got)
+				}
+			}
+		})
+	}
+}
+
+func TestCORS_SimpleRequest(t *testing.T) {
+	config := middleware.DefaultCORSConfig()
+	config.AllowedOrigins = []string{"*"}
+	router := newCORSRouter(config)
+
+	req, _ := http.NewRequest("POST", "/api/check-license-cli", nil)
+	req.Header.Set("Origin", "https://anywhere.example.com")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Expected wildcard origin, got %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got != "" {
+		t.Errorf("Expected no preflight headers on simple request, got %q", got)
+	}
+}
+
+func TestCORSConfig_Validate(t *testing.T) {
+	config := middleware.DefaultCORSConfig()
+	config.AllowedOrigins = []string{"*"}
+	config.AllowCredentials = true
+
+	if err := config.Validate(); err == nil {
+		t.Error("Expected wildcard origin with credentials to be rejected")
+	}
+}
@@ -0,0 +1,137 @@
+package unit
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"license-manager/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newCSRFRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.CSRF())
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, middleware.CSRFToken(c))
+	})
+	router.POST("/api/upload-license", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+// issueCSRFToken performs a safe request and returns the cookie and the token
+// rendered into the page
+func issueCSRFToken(t *testing.T, router *gin.Engine) (*http.Cookie, string) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == middleware.CSRFCookieName {
+			if !cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode {
+				t.Error("Expected CSRF cookie to be HttpOnly and SameSite=Strict")
+			}
+			return cookie, w.Body.String()
+		}
+	}
+	t.Fatal("Expected CSRF cookie to be set")
+	return nil, ""
+}
+
+func TestCSRF(t *testing.T) {
+	router := newCSRFRouter()
+	cookie, token := issueCSRFToken(t, router)
+	if token != cookie.Value {
+		t.Fatal("Expected rendered token to match cookie")
+	}
+
+	tests := []struct {
+		name           string
+		cookie         *http.Cookie
+		header         string
+		form           string
+		authorization  string
+		expectedStatus int
+	}{
+		{name: "valid header", cookie: cookie, header: token, expectedStatus: http.StatusOK},
+		{name: "valid form field", cookie: cookie, form: token, expectedStatus: http.StatusOK},
+		{name: "missing token", cookie: cookie, expectedStatus: http.StatusForbidden},
+		{name: "wrong token", cookie: cookie, header: "forged", expectedStatus: http.StatusForbidden},
+		{name: "no cookie", header: token, expectedStatus: http.StatusForbidden},
+		{name: "bearer client", authorization: "Bearer abc", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req *http.Request
+			if tt.form != "" {
+				req, _ = http.NewRequest("POST", "/api/upload-license", strings.NewReader(middleware.CSRFFormField+"="+tt.form))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				req, _ = http.NewRequest("POST", "/api/upload-license", nil)
+			}
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			if tt.header != "" {
+				req.Header.Set(middleware.CSRFHeaderName, tt.header)
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.SecurityHeaders(middleware.DefaultSecurityHeadersConfig()))
+	router.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	expected := map[string]string{
+		"X-Frame-Options":        "DENY",
+		"X-Content-Type-Options": "nosniff",
+		"Referrer-Policy":        "no-referrer",
+	}
+	for header, value := range expected {
+		if got := w.Header().Get(header); got != value {
+			t.Errorf("Expected %s %q, got %q", header, value, got)
+		}
+	}
+	if csp := w.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "script-src 'self'") {
+		t.Errorf("Expected CSP to restrict scripts, got %q", csp)
+	}
+	if hsts := w.Header().Get("Strict-Transport-Security"); hsts != "" {
+		t.Errorf("Expected no HSTS over plain HTTP, got %q", hsts)
+	}
+
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.TLS = &tls.ConnectionState{}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if hsts := w.Header().Get("Strict-Transport-Security"); !strings.HasPrefix(hsts, "max-age=31536000") {
+		t.Errorf("Expected HSTS over TLS, got %q", hsts)
+	}
+}
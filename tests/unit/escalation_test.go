@@ -0,0 +1,218 @@
+package unit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"license-manager/internal/services"
+	"license-manager/tests/fixtures"
+)
+
+var (
+	sudoCommand = regexp.MustCompile(`^sudo -p '([^']*)' -u '([^']*)' -- sh -c '(.*)'$`)
+	suCommand   = regexp.MustCompile(`^su '([^']*)' -c '(.*)'$`)
+)
+
+// fakeEscalation emulates sudo and su on the test SSH server. Passwords
+// typed at the prompt are counted in attempts.
+type fakeEscalation struct {
+	password string
+	sudoers  bool
+	nopasswd bool
+	attempts atomic.Int32
+}
+
+func (f *fakeEscalation) handle(req *fixtures.ExecRequest) int {
+	var prompt, user, inner string
+	if m := sudoCommand.FindStringSubmatch(req.Command); m != nil {
+		prompt, user, inner = m[1], m[2], m[3]
+	} else if m := suCommand.FindStringSubmatch(req.Command); m != nil {
+		prompt, user, inner = "Password: ", m[1], m[2]
+	} else {
+		fmt.Fprintf(req.Stdout, "ran %s as testuser", req.Command)
+		return 0
+	}
+	inner = strings.ReplaceAll(inner, `'\''`, `'`)
+	su := strings.HasPrefix(req.Command, "su ")
+
+	if !req.PTY {
+		fmt.Fprint(req.Stderr, "sudo: a terminal is required to read the password\n")
+		return 1
+	}
+	if !su && !f.sudoers {
+		fmt.Fprint(req.Stdout, "testuser is not in the sudoers file.  This incident will be reported.\r\n")
+		return 1
+	}
+
+	if !f.nopasswd {
+		input := bufio.NewReader(req.Stdin)
+		for {
+			fmt.Fprint(req.Stdout, prompt)
+			line, err := input.ReadString('\n')
+			if err != nil {
+				return 1
+			}
+			f.attempts.Add(1)
+			if strings.TrimSuffix(line, "\n") == f.password {
+				break
+			}
+			if su {
+				fmt.Fprint(req.Stdout, "\r\nsu: Authentication failure\r\n")
+				return 1
+			}
+			fmt.Fprint(req.Stdout, "\r\nSorry, try again.\r\n")
+		}
+		fmt.Fprint(req.Stdout, "\r\n")
+	}
+
+	if strings.Contains(inner, "import") && strings.Contains(inner, "bad.lic") {
+		fmt.Fprint(req.Stdout, "Error: license signature is invalid\r\n")
+		return 2
+	}
+	fmt.Fprintf(req.Stdout, "ran %s as %s\r\n", inner, user)
+	return 0
+}
+
+func escalatedService(t *testing.T, fake *fakeEscalation, escalation services.Escalation) (*services.SSHService, *fixtures.SSHServer) {
+	server := fixtures.NewSSHServer(t, fake.handle)
+	return connectTestServer(t, server, services.SSHConfig{Escalation: escalation}), server
+}
+
+func TestEscalation_Sudo(t *testing.T) {
+	fake := &fakeEscalation{password: fixtures.TestSSHConfigs.Valid.Password, sudoers: true}
+	service, server := escalatedService(t, fake, services.Escalation{Method: services.EscalateSudo})
+
+	result, err := service.ExecuteCommand(context.Background(), "license2_cli import -l '/tmp/a b.lic'")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if want := "ran license2_cli import -l '/tmp/a b.lic' as root\n"; result.Stdout != want {
+		t.Errorf("Expected output %q without the prompt, got %q", want, result.Stdout)
+	}
+	if strings.Contains(result.Stdout, fake.password) {
+		t.Error("Expected the password not to appear in the output")
+	}
+	if fake.attempts.Load() != 1 {
+		t.Errorf("Expected the password to be typed once, got %d", fake.attempts.Load())
+	}
+
+	// Only license2_cli commands are escalated
+	result, err = service.ExecuteCommand(context.Background(), "rm -f /tmp/a.lic")
+	if err != nil || result.Stdout != "ran rm -f /tmp/a.lic as testuser" {
+		t.Errorf("Expected other commands to run as the login user, got %q, %v", result.Stdout, err)
+	}
+	if commands := server.Commands(); !strings.HasPrefix(commands[0], "sudo -p ") || commands[1] != "rm -f /tmp/a.lic" {
+		t.Errorf("Unexpected commands %q", commands)
+	}
+
+	// The command's own failure is still reported as such
+	_, err = service.ExecuteCommand(context.Background(), "license2_cli import -l /tmp/bad.lic")
+	var cmdErr *services.CommandError
+	if !errors.As(err, &cmdErr) || cmdErr.Result.ExitStatus != 2 {
+		t.Fatalf("Expected a CommandError with status 2, got %v", err)
+	}
+	if !strings.HasSuffix(err.Error(), "exited with status 2: Error: license signature is invalid") {
+		t.Errorf("Expected license2_cli's message, got %q", err.Error())
+	}
+}
+
+func TestEscalation_SudoTargetUser(t *testing.T) {
+	fake := &fakeEscalation{password: "ops-password", sudoers: true}
+	service, _ := escalatedService(t, fake, services.Escalation{
+		Method:   services.EscalateSudo,
+		User:     "licadmin",
+		Password: "ops-password",
+	})
+
+	result, err := service.ExecuteCommand(context.Background(), "license2_cli check")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.Stdout != "ran license2_cli check as licadmin\n" {
+		t.Errorf("Expected the command to run as licadmin, got %q", result.Stdout)
+	}
+}
+
+func TestEscalation_SudoNoPassword(t *testing.T) {
+	fake := &fakeEscalation{sudoers: true, nopasswd: true}
+	service, _ := escalatedService(t, fake, services.Escalation{Method: services.EscalateSudo})
+
+	if _, err := service.ExecuteCommand(context.Background(), "license2_cli check"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if fake.attempts.Load() != 0 {
+		t.Error("Expected no password to be sent without a prompt")
+	}
+}
+
+func TestEscalation_SudoWrongPassword(t *testing.T) {
+	fake := &fakeEscalation{password: "something-else", sudoers: true}
+	service, _ := escalatedService(t, fake, services.Escalation{Method: services.EscalateSudo})
+
+	_, err := service.ExecuteCommand(context.Background(), "license2_cli check")
+	if !errors.Is(err, services.ErrEscalationPassword) {
+		t.Fatalf("Expected a rejected password, got %v", err)
+	}
+	if fake.attempts.Load() != 1 {
+		t.Errorf("Expected a rejected password not to be retried, got %d attempts", fake.attempts.Load())
+	}
+}
+
+func TestEscalation_NotInSudoers(t *testing.T) {
+	fake := &fakeEscalation{password: fixtures.TestSSHConfigs.Valid.Password}
+	service, _ := escalatedService(t, fake, services.Escalation{Method: services.EscalateSudo})
+
+	_, err := service.ExecuteCommand(context.Background(), "license2_cli import -l /tmp/a.lic")
+	if !errors.Is(err, services.ErrNotInSudoers) {
+		t.Fatalf("Expected not in sudoers, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "testuser") {
+		t.Errorf("Expected the error to name the login user, got %q", err.Error())
+	}
+}
+
+func TestEscalation_Su(t *testing.T) {
+	fake := &fakeEscalation{password: "root-password"}
+	service, server := escalatedService(t, fake, services.Escalation{Method: services.EscalateSu, Password: "root-password"})
+
+	result, err := service.ExecuteCommand(context.Background(), "license2_cli check")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.Stdout != "ran license2_cli check as root\n" {
+		t.Errorf("Expected output without the prompt, got %q", result.Stdout)
+	}
+	if commands := server.Commands(); commands[0] != "su 'root' -c 'license2_cli check'" {
+		t.Errorf("Unexpected command %q", commands[0])
+	}
+
+	fake.password = "changed"
+	if _, err := service.ExecuteCommand(context.Background(), "license2_cli check"); !errors.Is(err, services.ErrEscalationPassword) {
+		t.Errorf("Expected an authentication failure, got %v", err)
+	}
+}
+
+func TestEscalation_Validate(t *testing.T) {
+	tests := []struct {
+		escalation services.Escalation
+		valid      bool
+	}{
+		{services.Escalation{}, true},
+		{services.Escalation{Method: services.EscalateSudo, User: "licadmin"}, true},
+		{services.Escalation{Method: services.EscalateSu}, true},
+		{services.Escalation{Method: "doas"}, false},
+		{services.Escalation{Method: services.EscalateSudo, User: "root; rm -rf /"}, false},
+	}
+
+	for _, tt := range tests {
+		if err := tt.escalation.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate(%+v) = %v, expected valid %v", tt.escalation, err, tt.valid)
+		}
+	}
+}
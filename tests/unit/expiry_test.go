@@ -0,0 +1,109 @@
+package unit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"license-manager/internal/expiry"
+	"license-manager/internal/notify"
+)
+
+// openWatcher opens a watcher on path that records what it reports
+func openWatcher(t *testing.T, path string, days int, source expiry.Source) (*expiry.Watcher, *[]notify.ExpiringLicense) {
+	t.Helper()
+	var reported []notify.ExpiringLicense
+	w, err := expiry.Open(path, expiry.Options{WarningDays: days}, source, func(l notify.ExpiringLicense) {
+		reported = append(reported, l)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w, &reported
+}
+
+func TestExpiry_ReportsOncePerThreshold(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "expiry.json")
+	source := &digestSource{expiring: []notify.ExpiringLicense{
+		{Host: "10.0.0.1:22", License: "a.lic", LicenseSHA256: "aaa", Expires: "2026-11-01", DaysRemaining: 12},
+		{Host: "10.0.0.2:22", License: "b.lic", LicenseSHA256: "bbb", Expires: "2026-12-31", DaysRemaining: 70},
+	}}
+	now := time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)
+
+	w, reported := openWatcher(t, path, 30, source)
+	for i := 0; i < 2; i++ {
+		if err := w.Check(now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(*reported) != 1 || (*reported)[0].Host != "10.0.0.1:22" {
+		t.Fatalf("Expected only the license within 30 days, once, got %+v", *reported)
+	}
+
+	// A restart remembers what was reported
+	w, reported = openWatcher(t, path, 30, source)
+	if err := w.Check(now); err != nil {
+		t.Fatal(err)
+	}
+	if len(*reported) != 0 {
+		t.Errorf("Expected nothing reported again after reopening, got %+v", *reported)
+	}
+
+	// A new threshold reports both licenses within it
+	w, reported = openWatcher(t, path, 90, source)
+	if err := w.Check(now); err != nil {
+		t.Fatal(err)
+	}
+	if len(*reported) != 2 {
+		t.Errorf("Expected both licenses reported at the new threshold, got %+v", *reported)
+	}
+}
+
+func TestExpiry_ClaimedAtImport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "expiry.json")
+	imported := notify.ExpiringLicense{Host: "10.0.0.1:22", License: "a.lic", LicenseSHA256: "aaa", Expires: "2026-11-01", DaysRemaining: 12}
+	source := &digestSource{}
+	now := time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)
+
+	w, reported := openWatcher(t, path, 30, source)
+	if !w.Claim(imported, now) {
+		t.Fatal("Expected the first claim to succeed")
+	}
+	if w.Claim(imported, now) {
+		t.Error("Expected a second claim of the same license to fail")
+	}
+
+	// The import's audit record arrives after the claim; the check does
+	// not report the license again
+	if err := w.Check(now); err != nil {
+		t.Fatal(err)
+	}
+	source.expiring = []notify.ExpiringLicense{imported}
+	if err := w.Check(now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if len(*reported) != 0 {
+		t.Errorf("Expected the claimed license not to be reported, got %+v", *reported)
+	}
+
+	// A replaced license is forgotten a day after it was last seen
+	source.expiring = nil
+	if err := w.Check(now.Add(48 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved []json.RawMessage
+	if err := json.Unmarshal(data, &saved); err != nil || len(saved) != 0 {
+		t.Errorf("Expected the replaced license to be forgotten, got %s", data)
+	}
+
+	var nilWatcher *expiry.Watcher
+	if !nilWatcher.Claim(imported, now) {
+		t.Error("Expected a nil watcher to claim every license")
+	}
+}
@@ -3,11 +3,16 @@ package unit
 import (
 	"bytes"
 	"encoding/json"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"license-manager/internal/handlers"
+	"license-manager/internal/services"
+	"license-manager/tests/fixtures"
 
 	"github.com/gin-gonic/gin"
 )
@@ -226,4 +231,139 @@ func TestUploadLicenseHandler_NoFile(t *testing.T) {
 	if response.Error == "" {
 		t.Error("Expected Error to be set for no file request")
 	}
-}
\ No newline at end of file
+}
+func TestUploadLicenseHandler_ImportFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handlers.Configure(handlers.Settings{UploadDir: t.TempDir(), RemoteTempDir: "/tmp/"})
+	defer handlers.Configure(handlers.Settings{
+		UploadDir:          "uploads",
+		RemoteTempDir:      "/tmp/",
+		SSHTimeout:         services.DefaultTimeout,
+		SSHCommandTimeout:  services.DefaultCommandTimeout,
+		SSHTransferTimeout: services.DefaultTransferTimeout,
+	})
+
+	server := fixtures.NewSSHServer(t, func(req *fixtures.ExecRequest) int {
+		switch {
+		case req.Command == "which license2_cli":
+			req.Stdout.Write([]byte("/usr/bin/license2_cli\n"))
+		case strings.HasPrefix(req.Command, "cat > "):
+			io.Copy(io.Discard, req.Stdin)
+		case strings.HasPrefix(req.Command, "license2_cli import"):
+			req.Stderr.Write([]byte("ERROR: license is bound to a different host ID\n"))
+			return 4
+		}
+		return 0
+	})
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("host", server.Host)
+	form.WriteField("port", server.Port)
+	form.WriteField("username", fixtures.TestSSHConfigs.Valid.Username)
+	form.WriteField("password", fixtures.TestSSHConfigs.Valid.Password)
+	part, _ := form.CreateFormFile("license_file", "site.lic")
+	part.Write([]byte("license data"))
+	form.Close()
+
+	router := gin.New()
+	router.POST("/api/upload-license", handlers.UploadLicenseHandler)
+
+	req := httptest.NewRequest("POST", "/api/upload-license", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response handlers.UploadLicenseResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Success {
+		t.Fatal("Expected the upload to fail")
+	}
+	if !strings.Contains(response.Error, "ERROR: license is bound to a different host ID") {
+		t.Errorf("Expected license2_cli's message in the error, got %q", response.Error)
+	}
+	if response.Import == nil || response.Import.ExitStatus != 4 || response.Import.Command != "license2_cli import -l '/tmp/site.lic'" {
+		t.Errorf("Expected the import result in the response, got %+v", response.Import)
+	}
+}
+
+func TestUploadLicenseHandler_QuotesFilename(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handlers.Configure(handlers.Settings{UploadDir: t.TempDir(), RemoteTempDir: "/tmp/"})
+	defer handlers.Configure(handlers.Settings{
+		UploadDir:          "uploads",
+		RemoteTempDir:      "/tmp/",
+		SSHTimeout:         services.DefaultTimeout,
+		SSHCommandTimeout:  services.DefaultCommandTimeout,
+		SSHTransferTimeout: services.DefaultTransferTimeout,
+	})
+
+	server := fixtures.NewSSHServer(t, func(req *fixtures.ExecRequest) int {
+		switch {
+		case req.Command == "which license2_cli":
+			req.Stdout.Write([]byte("/usr/bin/license2_cli\n"))
+		case strings.HasPrefix(req.Command, "cat > "):
+			io.Copy(io.Discard, req.Stdin)
+		}
+		return 0
+	})
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("host", server.Host)
+	form.WriteField("port", server.Port)
+	form.WriteField("username", fixtures.TestSSHConfigs.Valid.Username)
+	form.WriteField("password", fixtures.TestSSHConfigs.Valid.Password)
+	part, _ := form.CreateFormFile("license_file", "x;reboot 'now'.lic")
+	part.Write([]byte("license data"))
+	form.Close()
+
+	router := gin.New()
+	router.POST("/api/upload-license", handlers.UploadLicenseHandler)
+
+	req := httptest.NewRequest("POST", "/api/upload-license", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// The file name reaches the shell as a single word
+	quoted := `'/tmp/x;reboot '\''now'\''.lic'`
+	want := []string{"cat > " + quoted, "license2_cli import -l " + quoted, "rm -f " + quoted}
+	commands := strings.Join(server.Commands(), "\n")
+	for _, command := range want {
+		if !strings.Contains(commands, command) {
+			t.Errorf("Expected %q to have been run, got:\n%s", command, commands)
+		}
+	}
+}
+
+func TestCheckLicenseCLIHandler_InvalidEscalation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/check-license-cli", handlers.CheckLicenseCLIHandler)
+
+	jsonData, _ := json.Marshal(handlers.ServerConfig{
+		Host:     "localhost",
+		Port:     "22",
+		Username: "ops",
+		Password: "secret",
+		Become:   "doas",
+	})
+	req := httptest.NewRequest("POST", "/api/check-license-cli", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	var response handlers.CheckLicenseCLIResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if !strings.Contains(response.Error, `unknown escalation method "doas"`) {
+		t.Errorf("Expected the escalation method to be rejected, got %q", response.Error)
+	}
+}
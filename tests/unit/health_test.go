@@ -0,0 +1,290 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"license-manager/internal/handlers"
+	"license-manager/internal/jobs"
+	"license-manager/internal/middleware"
+	"license-manager/internal/rollouts"
+	"license-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func healthRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET("/healthz", handlers.HealthzHandler)
+	router.GET("/readyz", handlers.ReadyzHandler)
+	admin := router.Group("/debug", middleware.AdminAuth([]string{"admin-secret"}))
+	admin.GET("/diagnostics", handlers.DiagnosticsHandler)
+	return router
+}
+
+func TestHealthzHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	healthRouter().ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+}
+
+func TestReadyzHandler(t *testing.T) {
+	defer handlers.SetReadinessChecks()
+	router := healthRouter()
+
+	readyz := func() (int, handlers.ReadinessResponse) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+		var response handlers.ReadinessResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		return w.Code, response
+	}
+
+	t.Run("all checks pass", func(t *testing.T) {
+		handlers.SetReadinessChecks(
+			handlers.ReadinessCheck{Name: "storage", Check: handlers.DirWritable(t.TempDir())},
+			handlers.ReadinessCheck{Name: "config", Check: func(context.Context) error { return nil }},
+		)
+
+		code, response := readyz()
+		if code != http.StatusOK || response.Status != "ready" {
+			t.Errorf("Expected 200 ready, got %d %s", code, response.Status)
+		}
+		if response.Checks["storage"].Status != handlers.CheckOK {
+			t.Errorf("Expected storage check ok, got %+v", response.Checks["storage"])
+		}
+	})
+
+	t.Run("failing check", func(t *testing.T) {
+		handlers.SetReadinessChecks(
+			handlers.ReadinessCheck{Name: "config", Check: func(context.Context) error { return nil }},
+			handlers.ReadinessCheck{Name: "templates_static", Check: func(context.Context) error {
+				return errors.New("server.static_dir \"./static\" is not a directory")
+			}},
+		)
+
+		code, response := readyz()
+		if code != http.StatusServiceUnavailable || response.Status != "not ready" {
+			t.Errorf("Expected 503 not ready, got %d %s", code, response.Status)
+		}
+		if check := response.Checks["templates_static"]; check.Status != handlers.CheckFail || check.Error == "" {
+			t.Errorf("Expected failing check with error, got %+v", check)
+		}
+		if response.Checks["config"].Status != handlers.CheckOK {
+			t.Errorf("Expected other checks to still run, got %+v", response.Checks)
+		}
+	})
+
+	t.Run("hung check", func(t *testing.T) {
+		hung := make(chan struct{})
+		defer close(hung)
+		handlers.SetReadinessChecks(
+			handlers.ReadinessCheck{Name: "config", Check: func(context.Context) error { return nil }},
+			handlers.ReadinessCheck{Name: "audit_log", Check: func(context.Context) error {
+				<-hung // stuck in a system call, not watching ctx
+				return nil
+			}},
+		)
+
+		// The request's deadline stands in for the readiness timeout
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil).WithContext(ctx))
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Expected the probe to answer at the deadline, took %v", elapsed)
+		}
+		var response handlers.ReadinessResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if w.Code != http.StatusServiceUnavailable || response.Checks["audit_log"].Status != handlers.CheckFail || response.Checks["config"].Status != handlers.CheckOK {
+			t.Errorf("Expected the hung check to fail on its own, got %d %+v", w.Code, response)
+		}
+	})
+
+	t.Run("draining", func(t *testing.T) {
+		handlers.SetReadinessChecks()
+		manager, err := jobs.Open(filepath.Join(t.TempDir(), "jobs.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		handlers.SetJobManager(manager)
+		defer handlers.SetJobManager(nil)
+		manager.Shutdown(context.Background())
+
+		code, response := readyz()
+		if code != http.StatusServiceUnavailable || response.Checks["shutdown"].Status != handlers.CheckFail {
+			t.Errorf("Expected 503 while shutting down, got %d %+v", code, response)
+		}
+	})
+}
+
+func TestDirWritable(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "created")
+	if err := handlers.DirWritable(dir)(context.Background()); err != nil {
+		t.Errorf("Expected missing directory to be created, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected probe file to be removed, found %d entries", len(entries))
+	}
+
+	// A regular file in the way cannot be used as a directory
+	file := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(file, []byte("x"), 0644)
+	if err := handlers.DirWritable(file)(context.Background()); err == nil {
+		t.Error("Expected an error for a path that is not a directory")
+	}
+
+	// A check whose deadline has passed stops between steps
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := handlers.DirWritable(t.TempDir())(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the cancelled check to stop, got %v", err)
+	}
+}
+
+func TestFileWritable(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state", "rollouts.json")
+	if err := handlers.FileWritable(path)(context.Background()); err != nil {
+		t.Errorf("Expected a file not written yet to pass, got %v", err)
+	}
+
+	os.WriteFile(path, []byte("[]"), 0600)
+	if err := handlers.FileWritable(path)(context.Background()); err != nil {
+		t.Errorf("Expected a writable file to pass, got %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "[]" {
+		t.Errorf("Expected the file to be left as it was, got %q", data)
+	}
+
+	// A directory in the way cannot be written as a file
+	taken := filepath.Join(dir, "taken")
+	os.Mkdir(taken, 0755)
+	if err := handlers.FileWritable(taken)(context.Background()); err == nil {
+		t.Error("Expected an error for a path that is a directory")
+	}
+}
+
+func TestDiagnosticsHandler_Rollouts(t *testing.T) {
+	router := healthRouter()
+	runner := &fakeRunner{fail: map[string]error{"web-1": errors.New("license has expired")}}
+	s := openScheduler(t, runner)
+	handlers.SetRollouts(s)
+	defer handlers.SetRollouts(nil)
+
+	soon := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	servers := []string{"web-1", "web-2"}
+	for _, start := range []time.Time{soon.Add(time.Hour), soon} {
+		if _, err := s.Create("", "alice", "a.lic", []byte("LICENSE"), servers, rollouts.Schedule{StartAt: start}, rollouts.Strategy{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	halted, err := s.Create("", "alice", "a.lic", []byte("LICENSE"), servers, rollouts.Schedule{StartAt: time.Now().Add(-time.Minute)}, rollouts.Strategy{Canary: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.RunDue(context.Background(), time.Now())
+	if got, _ := s.Get(halted.ID); got.Status != rollouts.StatusHalted {
+		t.Fatalf("Expected the staged rollout to halt, got %s", got.Status)
+	}
+
+	req := httptest.NewRequest("GET", "/debug/diagnostics", nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response handlers.DiagnosticsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	r := response.Rollouts
+	if r == nil || r.Held != 1 || r.Scheduled != 2 || r.Running != 0 {
+		t.Fatalf("Expected one held and two scheduled rollouts, got %+v", r)
+	}
+	if r.NextWindowAt == nil || !r.NextWindowAt.Equal(soon) {
+		t.Errorf("Expected the next window at %v, got %v", soon, r.NextWindowAt)
+	}
+}
+
+func TestDiagnosticsHandler(t *testing.T) {
+	router := healthRouter()
+
+	pool := services.NewPool(services.PoolConfig{MaxSessionsPerHost: 3})
+	handlers.SetSSHPool(pool)
+	defer handlers.SetSSHPool(nil)
+	handlers.SetBuildVersion("1.2.3")
+	defer handlers.SetBuildVersion("dev")
+
+	tests := []struct {
+		name   string
+		header string
+		status int
+	}{
+		{name: "no token", status: http.StatusUnauthorized},
+		{name: "wrong token", header: "Bearer nope", status: http.StatusUnauthorized},
+		{name: "wrong scheme", header: "Basic admin-secret", status: http.StatusUnauthorized},
+		{name: "valid token", header: "Bearer admin-secret", status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/debug/diagnostics", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, w.Code)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response handlers.DiagnosticsResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if response.Version != "1.2.3" {
+				t.Errorf("Expected version 1.2.3, got %q", response.Version)
+			}
+			if response.SSHPool == nil || response.SSHPool.MaxSessionsPerHost != 3 {
+				t.Errorf("Expected SSH pool stats, got %+v", response.SSHPool)
+			}
+			if response.GoVersion == "" || response.Uptime == "" {
+				t.Errorf("Expected runtime details, got %+v", response)
+			}
+		})
+	}
+}
+
+func TestAdminAuthDisabledWithoutTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/debug/diagnostics", middleware.AdminAuth(nil), handlers.DiagnosticsHandler)
+
+	req := httptest.NewRequest("GET", "/debug/diagnostics", nil)
+	req.Header.Set("Authorization", "Bearer anything")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 when no admin tokens are configured, got %d", w.Code)
+	}
+}
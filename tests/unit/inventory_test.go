@@ -0,0 +1,149 @@
+package unit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"license-manager/internal/inventory"
+)
+
+func testServer(name string) inventory.Server {
+	return inventory.Server{
+		Name:     name,
+		Host:     "192.168.5.152",
+		Port:     "22",
+		Username: "ops",
+		Password: "secret",
+	}
+}
+
+func TestInventory_PutGetDelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers.json")
+	store, err := inventory.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"web-2", "web-1"} {
+		if err := store.Put(testServer(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	replaced := testServer("web-1")
+	replaced.Become = "sudo"
+	if err := store.Put(replaced); err != nil {
+		t.Fatal(err)
+	}
+
+	list := store.List()
+	if len(list) != 2 || list[0].Name != "web-1" || list[1].Name != "web-2" {
+		t.Fatalf("Expected web-1 and web-2 in order, got %+v", list)
+	}
+	if got, _ := store.Get("web-1"); got.Become != "sudo" {
+		t.Errorf("Expected web-1 to be replaced, got %+v", got)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the inventory to be private, got %v", info.Mode().Perm())
+	}
+
+	// The inventory survives a restart
+	reopened, err := inventory.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reopened.List()) != 2 {
+		t.Errorf("Expected 2 servers after reopening, got %d", len(reopened.List()))
+	}
+
+	if err := reopened.Delete("web-2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Get("web-2"); !errors.Is(err, inventory.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+	if err := reopened.Delete("web-2"); !errors.Is(err, inventory.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound deleting twice, got %v", err)
+	}
+}
+
+func TestInventory_Validate(t *testing.T) {
+	store, err := inventory.Open(filepath.Join(t.TempDir(), "servers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := map[string]func(*inventory.Server){
+		"name with slash":    func(s *inventory.Server) { s.Name = "web/1" },
+		"empty name":         func(s *inventory.Server) { s.Name = "" },
+		"missing host":       func(s *inventory.Server) { s.Host = "" },
+		"missing password":   func(s *inventory.Server) { s.Password = "" },
+		"unknown escalation": func(s *inventory.Server) { s.Become = "doas" },
+	}
+	for name, mutate := range invalid {
+		t.Run(name, func(t *testing.T) {
+			server := testServer("web-1")
+			mutate(&server)
+			if err := store.Put(server); err == nil {
+				t.Error("Expected the server to be rejected")
+			}
+		})
+	}
+	if len(store.List()) != 0 {
+		t.Errorf("Expected rejected servers not to be stored, got %+v", store.List())
+	}
+}
+
+func TestInventory_Load(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	servers, err := inventory.Load(write("servers.yaml", `
+- name: web-1
+  host: 192.168.5.152
+  username: ops
+  password: secret
+  become: sudo
+  tags: [prod]
+- name: web-2
+  host: 192.168.5.153
+  port: "2222"
+  username: ops
+  password: secret
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 2 || servers[0].Port != "22" || servers[1].Port != "2222" || servers[0].Become != "sudo" {
+		t.Errorf("Unexpected servers %+v", servers)
+	}
+
+	// The server's own inventory file can be copied and used as is
+	servers, err = inventory.Load(write("servers.json", `[{"name": "web-1", "host": "h", "port": "22", "username": "u", "password": "p"}]`))
+	if err != nil || len(servers) != 1 {
+		t.Errorf("Expected one server from JSON, got %+v (%v)", servers, err)
+	}
+
+	for name, content := range map[string]string{
+		"duplicate.yaml": "- {name: a, host: h, username: u, password: p}\n- {name: a, host: h, username: u, password: p}\n",
+		"unknown.yaml":   "- {name: a, host: h, username: u, password: p, hots: x}\n",
+		"invalid.yaml":   "- {name: a, host: h, username: u}\n",
+		"broken.json":    "{",
+	} {
+		if _, err := inventory.Load(write(name, content)); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+}
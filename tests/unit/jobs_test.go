@@ -0,0 +1,194 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"license-manager/internal/jobs"
+)
+
+func TestJobManager_StartFinish(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	manager, err := jobs.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := manager.Start("check-license-cli", "192.168.5.152:22", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed, err := manager.Start("upload-license", "192.168.5.153:22", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.Finish(ok.ID, nil)
+	manager.Finish(failed.ID, errors.New("import failed"))
+
+	tests := []struct {
+		id       string
+		expected string
+	}{
+		{id: ok.ID, expected: jobs.StatusSucceeded},
+		{id: failed.ID, expected: jobs.StatusFailed},
+	}
+	for _, tt := range tests {
+		job, found := manager.Get(tt.id)
+		if !found {
+			t.Fatalf("Expected job %s to exist", tt.id)
+		}
+		if job.Status != tt.expected {
+			t.Errorf("Expected status '%s', got '%s'", tt.expected, job.Status)
+		}
+		if job.FinishedAt == nil {
+			t.Error("Expected FinishedAt to be set")
+		}
+	}
+
+	if manager.Running() != 0 {
+		t.Errorf("Expected no running jobs, got %d", manager.Running())
+	}
+}
+
+func TestJobManager_ReopenMarksRunningInterrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	manager, err := jobs.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := manager.Start("upload-license", "192.168.5.152:22", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.SetStep(job.ID, "import")
+
+	// Simulate a crash: the state file still says running
+	reopened, err := jobs.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	interrupted := reopened.List(jobs.StatusInterrupted)
+	if len(interrupted) != 1 {
+		t.Fatalf("Expected 1 interrupted job, got %d", len(interrupted))
+	}
+	if interrupted[0].Step != "import" {
+		t.Errorf("Expected interrupted job to keep its step 'import', got '%s'", interrupted[0].Step)
+	}
+}
+
+func TestJobManager_ShutdownWaitsForJobs(t *testing.T) {
+	manager, err := jobs.Open(filepath.Join(t.TempDir(), "jobs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := manager.Start("upload-license", "192.168.5.152:22", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		manager.Finish(job.ID, nil)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := manager.Shutdown(ctx); err != nil {
+		t.Fatalf("Expected clean shutdown, got %v", err)
+	}
+
+	finished, _ := manager.Get(job.ID)
+	if finished.Status != jobs.StatusSucceeded {
+		t.Errorf("Expected job to finish during grace period, got '%s'", finished.Status)
+	}
+
+	if _, err := manager.Start("check-license-cli", "192.168.5.152:22", "10.0.0.1"); !errors.Is(err, jobs.ErrShuttingDown) {
+		t.Errorf("Expected ErrShuttingDown after shutdown, got %v", err)
+	}
+}
+
+func TestJobManager_ShutdownTimeoutMarksInterrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	manager, err := jobs.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := manager.Start("upload-license", "192.168.5.152:22", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := manager.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+
+	reopened, err := jobs.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	persisted, found := reopened.Get(job.ID)
+	if !found {
+		t.Fatal("Expected interrupted job to be persisted")
+	}
+	if persisted.Status != jobs.StatusInterrupted {
+		t.Errorf("Expected status '%s', got '%s'", jobs.StatusInterrupted, persisted.Status)
+	}
+}
+
+func TestJobManager_Subscribe(t *testing.T) {
+	manager, err := jobs.Open(filepath.Join(t.TempDir(), "jobs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates, unsubscribe := manager.Subscribe()
+
+	job, err := manager.Start("upload-license", "192.168.5.152:22", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.SetStep(job.ID, "import")
+	manager.Finish(job.ID, nil)
+
+	var got []string
+	for i := 0; i < 3; i++ {
+		select {
+		case update := <-updates:
+			got = append(got, update.Status+"/"+update.Step)
+		case <-time.After(time.Second):
+			t.Fatalf("Expected 3 updates, got %v", got)
+		}
+	}
+	want := []string{"running/", "running/import", "succeeded/import"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected updates %v, got %v", want, got)
+			break
+		}
+	}
+
+	// Nothing is sent after unsubscribing, and a full subscriber never
+	// blocks jobs
+	unsubscribe()
+	slow, _ := manager.Subscribe()
+	for i := 0; i < 100; i++ {
+		job, err := manager.Start("preflight", "192.168.5.152:22", "10.0.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		manager.Finish(job.ID, nil)
+	}
+	select {
+	case update := <-updates:
+		t.Errorf("Expected no update after unsubscribing, got %+v", update)
+	default:
+	}
+	if len(slow) != cap(slow) {
+		t.Errorf("Expected the slow subscriber's buffer to be full, got %d of %d", len(slow), cap(slow))
+	}
+}
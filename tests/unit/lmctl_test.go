@@ -0,0 +1,467 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"license-manager/internal/audit"
+	"license-manager/internal/handlers"
+	"license-manager/internal/inventory"
+	"license-manager/internal/jobs"
+	"license-manager/internal/lmctl"
+	"license-manager/internal/middleware"
+	"license-manager/internal/rollouts"
+	"license-manager/internal/services"
+	"license-manager/tests/fixtures"
+
+	"github.com/gin-gonic/gin"
+)
+
+const lmctlToken = "ci-secret"
+
+// lmctlEnv is a License Manager API backed by temporary state, plus an SSH
+// server with license2_cli installed
+type lmctlEnv struct {
+	url      string
+	ssh      *fixtures.SSHServer
+	auditLog *audit.Log
+	jobs     *jobs.Manager
+	rollouts *rollouts.Scheduler
+}
+
+func newLmctlEnv(t *testing.T) *lmctlEnv {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+
+	auditLog, err := audit.Open(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager, err := jobs.Open(filepath.Join(dir, "jobs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := inventory.Open(filepath.Join(dir, "servers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduler, err := rollouts.Open(filepath.Join(dir, "rollouts.json"), rollouts.Options{}, handlers.RolloutRunner())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handlers.Configure(handlers.Settings{
+		UploadDir:          filepath.Join(dir, "uploads"),
+		RemoteTempDir:      "/tmp/",
+		SSHTimeout:         services.DefaultTimeout,
+		SSHCommandTimeout:  services.DefaultCommandTimeout,
+		SSHTransferTimeout: services.DefaultTransferTimeout,
+	})
+	handlers.SetAuditLog(auditLog)
+	handlers.SetJobManager(manager)
+	handlers.SetInventory(store)
+	handlers.SetRollouts(scheduler)
+	t.Cleanup(func() {
+		handlers.Configure(handlers.Settings{
+			UploadDir:          "uploads",
+			RemoteTempDir:      "/tmp/",
+			SSHTimeout:         services.DefaultTimeout,
+			SSHCommandTimeout:  services.DefaultCommandTimeout,
+			SSHTransferTimeout: services.DefaultTransferTimeout,
+		})
+		handlers.SetAuditLog(nil)
+		handlers.SetJobManager(nil)
+		handlers.SetInventory(nil)
+		handlers.SetRollouts(nil)
+	})
+
+	tokens, err := middleware.ParseAPITokens([]string{"ci:" + lmctlToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.Use(middleware.CSRF())
+	api := router.Group("/api", middleware.APIAuth(tokens))
+	api.POST("/check-license-cli", handlers.CheckLicenseCLIHandler)
+	api.POST("/preflight", handlers.PreflightHandler)
+	api.POST("/download-sysinfo", handlers.DownloadSysinfoHandler)
+	api.POST("/upload-license", handlers.UploadLicenseHandler)
+	authed := api.Group("", middleware.RequireAuth())
+	authed.GET("/servers", handlers.ListServersHandler)
+	authed.POST("/servers", handlers.PutServerHandler)
+	authed.DELETE("/servers/:name", handlers.DeleteServerHandler)
+	authed.GET("/audit", handlers.AuditHandler)
+	authed.GET("/audit/verify", handlers.AuditVerifyHandler)
+	authed.GET("/jobs", handlers.JobsHandler)
+	handlers.RegisterV1Document(api.Group("/v1"))
+	handlers.RegisterV1(authed.Group("/v1"))
+
+	httpServer := httptest.NewServer(router)
+	t.Cleanup(httpServer.Close)
+
+	sshServer := fixtures.NewSSHServer(t, func(req *fixtures.ExecRequest) int {
+		switch cmd := req.Command; {
+		case cmd == "which license2_cli":
+			fmt.Fprint(req.Stdout, "/usr/local/bin/license2_cli\n")
+		case strings.HasPrefix(cmd, "cat > "):
+			io.Copy(io.Discard, req.Stdin)
+		case strings.HasPrefix(cmd, "license2_cli import -l '/tmp/expired.lic'"):
+			fmt.Fprint(req.Stderr, "ERROR: license has expired\n")
+			return 3
+		case strings.HasPrefix(cmd, "ls -la sys_info.bin"):
+			fmt.Fprint(req.Stdout, "-rw-r--r-- 1 testuser testuser 7 Jan  1 00:00 sys_info.bin\n")
+		case cmd == "cat 'sys_info.bin'":
+			fmt.Fprint(req.Stdout, "SYSINFO")
+		}
+		return 0
+	})
+
+	return &lmctlEnv{url: httpServer.URL, ssh: sshServer, auditLog: auditLog, jobs: manager, rollouts: scheduler}
+}
+
+// run runs lmctl against the environment with the CI token
+func (e *lmctlEnv) run(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	return e.runWithEnv(t, map[string]string{"LMCTL_URL": e.url, "LMCTL_TOKEN": lmctlToken}, args...)
+}
+
+func (e *lmctlEnv) runWithEnv(t *testing.T, env map[string]string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := lmctl.Run(context.Background(), args, &stdout, &stderr, func(name string) string { return env[name] })
+	return code, stdout.String(), stderr.String()
+}
+
+// addServer adds the SSH server to the inventory as name
+func (e *lmctlEnv) addServer(t *testing.T, name string) {
+	t.Helper()
+	code, _, stderr := e.runWithEnv(t, map[string]string{
+		"LMCTL_URL":          e.url,
+		"LMCTL_TOKEN":        lmctlToken,
+		"LMCTL_SSH_PASSWORD": fixtures.TestSSHConfigs.Valid.Password,
+	}, "servers", "add", "-host", e.ssh.Host, "-port", e.ssh.Port, "-user", fixtures.TestSSHConfigs.Valid.Username, "-tags", "prod, eu", name)
+	if code != lmctl.ExitOK {
+		t.Fatalf("servers add failed with %d: %s", code, stderr)
+	}
+}
+
+func TestLmctl_Servers(t *testing.T) {
+	env := newLmctlEnv(t)
+	env.addServer(t, "web-1")
+
+	code, stdout, _ := env.run(t, "-o", "json", "servers", "list")
+	if code != lmctl.ExitOK {
+		t.Fatalf("Expected servers list to succeed, got %d", code)
+	}
+	if strings.Contains(stdout, fixtures.TestSSHConfigs.Valid.Password) {
+		t.Error("Expected the password not to be returned")
+	}
+	var list handlers.ServersResponse
+	if err := json.Unmarshal([]byte(stdout), &list); err != nil {
+		t.Fatalf("Expected JSON output: %v\n%s", err, stdout)
+	}
+	if list.Count != 1 || list.Servers[0].Name != "web-1" || !list.Servers[0].HasPassword || strings.Join(list.Servers[0].Tags, ",") != "prod,eu" {
+		t.Errorf("Unexpected inventory %+v", list)
+	}
+
+	code, stdout, _ = env.run(t, "servers", "list")
+	if code != lmctl.ExitOK || !strings.Contains(stdout, "NAME") || !strings.Contains(stdout, "web-1") {
+		t.Errorf("Expected a table with web-1, got %d:\n%s", code, stdout)
+	}
+
+	if code, _, stderr := env.run(t, "servers", "remove", "web-1"); code != lmctl.ExitOK {
+		t.Fatalf("Expected servers remove to succeed, got %d: %s", code, stderr)
+	}
+	code, _, stderr := env.run(t, "servers", "remove", "web-1")
+	if code != lmctl.ExitFailure || !strings.Contains(stderr, "404") {
+		t.Errorf("Expected removing an unknown server to fail with 404, got %d: %s", code, stderr)
+	}
+
+	records, err := env.auditLog.Query(audit.Filter{Actor: "token:ci"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Action != audit.ActionServerPut || records[1].Action != audit.ActionServerDelete || records[0].Server != "web-1" {
+		t.Errorf("Expected inventory changes audited as the token, got %+v", records)
+	}
+}
+
+func TestLmctl_CheckAndPreflight(t *testing.T) {
+	env := newLmctlEnv(t)
+	env.addServer(t, "web-1")
+
+	code, stdout, stderr := env.run(t, "check", "web-1", "missing")
+	if code != lmctl.ExitFailure {
+		t.Errorf("Expected an unknown server to fail the run, got %d", code)
+	}
+	if !strings.Contains(stdout, "found") || !strings.Contains(stdout, "server not found in inventory: missing") {
+		t.Errorf("Expected a row per server, got:\n%s%s", stdout, stderr)
+	}
+
+	code, stdout, _ = env.run(t, "check", "-o", "json", "web-1")
+	if code != lmctl.ExitOK {
+		t.Fatalf("Expected check to succeed, got %d: %s", code, stdout)
+	}
+	var results []struct {
+		Server string `json:"server"`
+		Exists bool   `json:"exists"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &results); err != nil || len(results) != 1 || !results[0].Exists {
+		t.Errorf("Expected license2_cli to be found, got %s (%v)", stdout, err)
+	}
+
+	// The fixture cannot answer every preflight command; warnings do not
+	// fail the run
+	code, stdout, _ = env.run(t, "preflight", "web-1")
+	if code != lmctl.ExitOK || !strings.Contains(stdout, "disk_space") || !strings.Contains(stdout, "warn") {
+		t.Errorf("Expected a preflight table, got %d:\n%s", code, stdout)
+	}
+
+	records, err := env.auditLog.Query(audit.Filter{Action: audit.ActionCheckLicenseCLI})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) == 0 || records[len(records)-1].Actor != "token:ci" || records[len(records)-1].Server != "web-1" {
+		t.Errorf("Expected check audited against the named server, got %+v", records)
+	}
+}
+
+func TestLmctl_SysinfoAndLicense(t *testing.T) {
+	env := newLmctlEnv(t)
+	env.addServer(t, "web-1")
+	dir := t.TempDir()
+
+	code, stdout, stderr := env.run(t, "sysinfo", "pull", "-dir", dir, "web-1")
+	if code != lmctl.ExitOK {
+		t.Fatalf("Expected sysinfo pull to succeed, got %d: %s%s", code, stdout, stderr)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "sys_info.bin_1"))
+	if err != nil || string(data) != "SYSINFO" {
+		t.Errorf("Expected the sysinfo file to be saved, got %q (%v)", data, err)
+	}
+
+	good := filepath.Join(dir, "site.lic")
+	expired := filepath.Join(dir, "expired.lic")
+	for _, file := range []string{good, expired} {
+		if err := os.WriteFile(file, []byte("license data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if code, stdout, stderr := env.run(t, "license", "push", good, "web-1"); code != lmctl.ExitOK || !strings.Contains(stdout, "imported") {
+		t.Errorf("Expected the license to be imported, got %d: %s%s", code, stdout, stderr)
+	}
+	code, stdout, _ = env.run(t, "license", "push", expired, "web-1")
+	if code != lmctl.ExitFailure || !strings.Contains(stdout, "ERROR: license has expired") {
+		t.Errorf("Expected license2_cli's error, got %d:\n%s", code, stdout)
+	}
+}
+
+func TestLmctl_Rollouts(t *testing.T) {
+	env := newLmctlEnv(t)
+	env.addServer(t, "web-1")
+	env.addServer(t, "web-2")
+	expired := filepath.Join(t.TempDir(), "expired.lic")
+	if err := os.WriteFile(expired, []byte("license data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	code, stdout, stderr := env.run(t, "-o", "json", "rollout", "create", "-servers", "web-1,web-2", "-start", start.Format(time.RFC3339), "-canary", "1", expired)
+	if code != lmctl.ExitOK {
+		t.Fatalf("Expected rollout create to succeed, got %d: %s%s", code, stdout, stderr)
+	}
+	var r rollouts.Rollout
+	if err := json.Unmarshal([]byte(stdout), &r); err != nil || r.Canary != 1 || len(r.Targets) != 2 {
+		t.Fatalf("Expected the staged rollout, got %s (%v)", stdout, err)
+	}
+
+	// The canary import fails and the rollout halts
+	env.rollouts.RunDue(context.Background(), start.Add(time.Minute))
+	if code, stdout, _ := env.run(t, "rollout", "get", r.ID); code != lmctl.ExitOK || !strings.Contains(stdout, "halted: 1 of 1 imports in wave 1 failed") || !strings.Contains(stdout, "license has expired") {
+		t.Errorf("Expected the halted rollout and the canary's error, got %d:\n%s", code, stdout)
+	}
+	if code, stdout, _ := env.run(t, "rollout", "list", "-status", rollouts.StatusHalted); code != lmctl.ExitOK || !strings.Contains(stdout, r.ID) {
+		t.Errorf("Expected the halted rollout to be listed, got %d:\n%s", code, stdout)
+	}
+	if code, stdout, _ := env.run(t, "rollout", "resume", r.ID); code != lmctl.ExitOK || !strings.Contains(stdout, rollouts.StatusScheduled) {
+		t.Errorf("Expected the rollout to resume, got %d:\n%s", code, stdout)
+	}
+	if code, stdout, _ := env.run(t, "rollout", "abort", r.ID); code != lmctl.ExitOK || !strings.Contains(stdout, rollouts.TargetSkipped) {
+		t.Errorf("Expected web-2 to be skipped, got %d:\n%s", code, stdout)
+	}
+
+	// The /api/v1 error envelope is reported
+	if code, _, stderr := env.run(t, "rollout", "resume", r.ID); code != lmctl.ExitFailure || !strings.Contains(stderr, "409: Rollout "+r.ID+" cannot be resumed") {
+		t.Errorf("Expected the conflict to be reported, got %d: %s", code, stderr)
+	}
+	if code, _, _ := env.run(t, "rollout", "get"); code != lmctl.ExitUsage {
+		t.Errorf("Expected a usage error without an ID, got %d", code)
+	}
+}
+
+func TestLmctl_JobsAndAudit(t *testing.T) {
+	env := newLmctlEnv(t)
+
+	succeeded, _ := env.jobs.Start(audit.ActionCheckLicenseCLI, "10.0.0.1:22", "token:ci")
+	env.jobs.Finish(succeeded.ID, nil)
+	failed, _ := env.jobs.Start(audit.ActionUploadLicense, "10.0.0.2:22", "token:ci")
+	env.jobs.Finish(failed.ID, fmt.Errorf("import failed"))
+
+	code, stdout, _ := env.run(t, "jobs", "list", "-status", jobs.StatusFailed)
+	if code != lmctl.ExitOK || !strings.Contains(stdout, failed.ID) || strings.Contains(stdout, succeeded.ID) {
+		t.Errorf("Expected only the failed job, got %d:\n%s", code, stdout)
+	}
+
+	if code, stdout, _ := env.run(t, "jobs", "watch", succeeded.ID); code != lmctl.ExitOK || !strings.Contains(stdout, "succeeded") {
+		t.Errorf("Expected watch to report success, got %d:\n%s", code, stdout)
+	}
+	if code, _, stderr := env.run(t, "jobs", "watch", succeeded.ID, failed.ID); code != lmctl.ExitFailure || !strings.Contains(stderr, "1 of 2 jobs") {
+		t.Errorf("Expected watch to fail for the failed job, got %d: %s", code, stderr)
+	}
+	if code, _, stderr := env.run(t, "jobs", "watch", "nope"); code != lmctl.ExitFailure || !strings.Contains(stderr, "job nope not found") {
+		t.Errorf("Expected an unknown job to fail, got %d: %s", code, stderr)
+	}
+
+	env.addServer(t, "web-1")
+	code, stdout, _ = env.run(t, "audit", "-action", audit.ActionServerPut)
+	if code != lmctl.ExitOK || !strings.Contains(stdout, "token:ci") || !strings.Contains(stdout, "web-1") {
+		t.Errorf("Expected the audit record, got %d:\n%s", code, stdout)
+	}
+	if code, stdout, _ := env.run(t, "audit", "verify"); code != lmctl.ExitOK || !strings.Contains(stdout, "1 records verified") {
+		t.Errorf("Expected the audit log to verify, got %d: %s", code, stdout)
+	}
+}
+
+func TestLmctl_Errors(t *testing.T) {
+	env := newLmctlEnv(t)
+
+	code, _, stderr := env.runWithEnv(t, map[string]string{"LMCTL_URL": env.url, "LMCTL_TOKEN": "wrong"}, "servers", "list")
+	if code != lmctl.ExitFailure || !strings.Contains(stderr, "Invalid API token") {
+		t.Errorf("Expected a rejected token to fail, got %d: %s", code, stderr)
+	}
+
+	// Without a token, writes are refused by CSRF protection
+	code, _, stderr = env.runWithEnv(t, map[string]string{"LMCTL_URL": env.url}, "servers", "remove", "web-1")
+	if code != lmctl.ExitFailure || !strings.Contains(stderr, "403") {
+		t.Errorf("Expected a request without a token to be refused, got %d: %s", code, stderr)
+	}
+
+	for _, args := range [][]string{
+		{},
+		{"frobnicate"},
+		{"servers"},
+		{"servers", "add", "-host", "h"},
+		{"license", "push", "only-a-file"},
+		{"-o", "yaml", "servers", "list"},
+	} {
+		if code, _, _ := env.run(t, args...); code != lmctl.ExitUsage {
+			t.Errorf("Expected usage error for %q, got %d", args, code)
+		}
+	}
+}
+
+func TestParseAPITokens(t *testing.T) {
+	tokens, err := middleware.ParseAPITokens([]string{"ci:abc", "backup:d:ef"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 2 || tokens[1].Name != "backup" || tokens[1].Secret != "d:ef" {
+		t.Errorf("Unexpected tokens %+v", tokens)
+	}
+
+	for _, entries := range [][]string{{"nosecret"}, {":abc"}, {"ci:"}, {"ci:a", "ci:b"}} {
+		if _, err := middleware.ParseAPITokens(entries); err == nil {
+			t.Errorf("Expected %q to be rejected", entries)
+		}
+	}
+}
+
+func TestAPIAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/whoami", middleware.APIAuth([]middleware.APIToken{{Name: "ci", Secret: "abc"}}), func(c *gin.Context) {
+		c.String(http.StatusOK, middleware.APITokenName(c))
+	})
+
+	tests := []struct {
+		header string
+		status int
+		body   string
+	}{
+		{header: "", status: http.StatusOK, body: ""},
+		{header: "Bearer abc", status: http.StatusOK, body: "ci"},
+		{header: "Bearer abd", status: http.StatusUnauthorized},
+		{header: "Basic abc", status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/whoami", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%q: expected status %d, got %d", tt.header, tt.status, w.Code)
+			continue
+		}
+		if tt.status == http.StatusOK && w.Body.String() != tt.body {
+			t.Errorf("%q: expected token name %q, got %q", tt.header, tt.body, w.Body.String())
+		}
+		if tt.status == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%q: expected a WWW-Authenticate challenge", tt.header)
+		}
+	}
+}
+
+func TestRequireAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/servers", middleware.APIAuth([]middleware.APIToken{{Name: "ci", Secret: "abc"}}), middleware.RequireAuth(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		cert   bool
+		status int
+	}{
+		{name: "browser", status: http.StatusUnauthorized},
+		{name: "token", header: "Bearer abc", status: http.StatusOK},
+		{name: "client certificate", cert: true, status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/servers", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		if tt.cert {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "ops"}}}}}
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, w.Code)
+		}
+		if tt.status == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: expected a WWW-Authenticate challenge", tt.name)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package unit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"license-manager/internal/metrics"
+	"license-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scrapeMetrics returns the current metrics output
+func scrapeMetrics(t *testing.T) string {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 from metrics handler, got %d", w.Code)
+	}
+	body, _ := io.ReadAll(w.Body)
+	return string(body)
+}
+
+func TestParseDaysRemaining(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		output string
+		days   float64
+		ok     bool
+	}{
+		{name: "days remaining", output: "License OK, 42 days remaining", days: 42, ok: true},
+		{name: "days left label", output: "Status: valid\nDays left: 7\n", days: 7, ok: true},
+		{name: "expiry date", output: "Expiration date: 2025-01-31", days: 30, ok: true},
+		{name: "expires today", output: "expires on 2025-01-01", days: 0, ok: true},
+		{name: "expired", output: "Expires: 2024-12-30", days: -2, ok: true},
+		{name: "no expiry", output: "License is valid", ok: false},
+		{name: "empty", output: "", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			days, ok := services.ParseDaysRemaining(tt.output, now)
+			if ok != tt.ok {
+				t.Fatalf("Expected ok=%v, got %v", tt.ok, ok)
+			}
+			if ok && days != tt.days {
+				t.Errorf("Expected %v days, got %v", tt.days, days)
+			}
+		})
+	}
+}
+
+func TestMetricsOperation(t *testing.T) {
+	tests := map[string]string{
+		"which license2_cli":                "cli-lookup",
+		"license2_cli check":                "check",
+		"license2_cli getsysinfo -f 10":     "getsysinfo",
+		"license2_cli import -l /tmp/a.lic": "import",
+		"cat > /tmp/a.lic":                  "upload",
+		"cat sys_info.bin":                  "download",
+		"cat 'sys_info.bin'":                "download",
+		"rm -f /tmp/a.lic":                  "other",
+	}
+
+	for command, want := range tests {
+		if got := metrics.Operation(command); got != want {
+			t.Errorf("Operation(%q) = %q, want %q", command, got, want)
+		}
+	}
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(metrics.Middleware())
+	router.GET("/api/things/:id", func(c *gin.Context) {
+		c.Status(http.StatusTeapot)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/things/1", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/no/such/route", nil))
+
+	body := scrapeMetrics(t)
+	for _, want := range []string{
+		`license_manager_http_requests_total{method="GET",route="/api/things/:id",status="418"} 1`,
+		`license_manager_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`license_manager_http_request_duration_seconds_count{method="GET",route="/api/things/:id"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %s", want)
+		}
+	}
+}
+
+func TestMetricsSSHService(t *testing.T) {
+	server := licenseServer(t)
+	service := connectTestServer(t, server, services.SSHConfig{})
+
+	if _, err := service.ExecuteCommand(context.Background(), "license2_cli check"); err != nil {
+		t.Fatal(err)
+	}
+
+	body := scrapeMetrics(t)
+	host := server.Host + ":" + server.Port
+	for _, want := range []string{
+		`license_manager_ssh_dial_duration_seconds_count{host="` + host + `",outcome="success"} 1`,
+		`license_manager_ssh_command_duration_seconds_count{operation="check",outcome="success"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %s", want)
+		}
+	}
+}
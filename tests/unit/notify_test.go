@@ -0,0 +1,342 @@
+package unit
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"license-manager/internal/notify"
+	"license-manager/tests/fixtures"
+)
+
+// digestSource serves fixed digest contents
+type digestSource struct {
+	expiring []notify.ExpiringLicense
+	failed   []notify.FailedJob
+}
+
+func (s *digestSource) ExpiringLicenses(now time.Time, days int) ([]notify.ExpiringLicense, error) {
+	var list []notify.ExpiringLicense
+	for _, l := range s.expiring {
+		if l.DaysRemaining <= days {
+			list = append(list, l)
+		}
+	}
+	return list, nil
+}
+
+func (s *digestSource) FailedJobs(since, until time.Time) ([]notify.FailedJob, error) {
+	var list []notify.FailedJob
+	for _, job := range s.failed {
+		if job.FinishedAt.After(since) && !job.FinishedAt.After(until) {
+			list = append(list, job)
+		}
+	}
+	return list, nil
+}
+
+func openNotifier(t *testing.T, sink *fixtures.SMTPServer, source notify.Source) *notify.Notifier {
+	t.Helper()
+	port, _ := strconv.Atoi(sink.Port)
+	n, err := notify.Open(filepath.Join(t.TempDir(), "subscribers.json"), notify.Options{
+		Host:     sink.Host,
+		Port:     port,
+		Security: notify.SecurityNone,
+		From:     "License Manager <lm@example.com>",
+		Timeout:  time.Second,
+	}, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// parseEmail returns the decoded subject and the text and HTML parts
+func parseEmail(t *testing.T, email fixtures.Email) (string, string, string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(string(email.Data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Expected multipart/alternative, got %q (%v)", mediaType, err)
+	}
+	parts := map[string]string{}
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(part)
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		parts[contentType] = string(body)
+	}
+	return subject, parts["text/plain"], parts["text/html"]
+}
+
+func TestNotify_Preferences(t *testing.T) {
+	n := openNotifier(t, fixtures.NewSMTPServer(t), &digestSource{})
+
+	tests := []struct {
+		name  string
+		email string
+		prefs notify.Preferences
+	}{
+		{name: "invalid address", email: "not-an-address", prefs: notify.Preferences{Failures: true}},
+		{name: "nothing subscribed", email: "ops@example.com"},
+		{name: "negative expiry days", email: "ops@example.com", prefs: notify.Preferences{Expiring: true, ExpiryDays: -1}},
+		{name: "unknown schedule", email: "ops@example.com", prefs: notify.Preferences{Failures: true, Schedule: "hourly"}},
+		{name: "hour out of range", email: "ops@example.com", prefs: notify.Preferences{Failures: true, Hour: 24}},
+		{name: "weekday out of range", email: "ops@example.com", prefs: notify.Preferences{Failures: true, Schedule: notify.ScheduleWeekly, Weekday: 7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := n.Create(tt.email, "", tt.prefs); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+
+	s, err := n.Create("Ops Lead <ops@example.com>", "", notify.Preferences{Expiring: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Email != "ops@example.com" || s.Name != "Ops Lead" {
+		t.Errorf("Expected the address and name to be split, got %q and %q", s.Email, s.Name)
+	}
+	if s.ExpiryDays != notify.DefaultExpiryDays || s.Schedule != notify.ScheduleDaily {
+		t.Errorf("Expected the default expiry days and schedule, got %+v", s.Preferences)
+	}
+
+	updated, err := n.Update(s.ID, "ops@example.com", "Ops", notify.Preferences{Failures: true, Schedule: notify.ScheduleWeekly, Weekday: time.Monday, Hour: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Expiring || !updated.Failures || updated.Weekday != time.Monday || !updated.CreatedAt.Equal(s.CreatedAt) {
+		t.Errorf("Expected the preferences to be replaced, got %+v", updated)
+	}
+	if _, err := n.Update("missing", "ops@example.com", "", notify.Preferences{Failures: true}); !errors.Is(err, notify.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	// The file holds email addresses
+	info, err := os.Stat(n.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+	}
+}
+
+func TestNotify_Schedule(t *testing.T) {
+	sink := fixtures.NewSMTPServer(t)
+	source := &digestSource{}
+	n := openNotifier(t, sink, source)
+
+	daily, err := n.Create("daily@example.com", "", notify.Preferences{Failures: true, Hour: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	weekly, err := n.Create("weekly@example.com", "", notify.Preferences{Failures: true, Schedule: notify.ScheduleWeekly, Weekday: time.Wednesday, Hour: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := weekly.CreatedAt
+
+	// A job fails every six hours for two weeks
+	for i := 1; i <= 56; i++ {
+		source.failed = append(source.failed, notify.FailedJob{
+			ID:         strconv.Itoa(i),
+			Kind:       "upload-license",
+			Host:       "10.0.0.1:22",
+			Status:     "failed",
+			FinishedAt: start.Add(time.Duration(i) * 6 * time.Hour),
+		})
+	}
+
+	// Run every hour for two weeks
+	for now := start; now.Before(start.Add(14 * 24 * time.Hour)); now = now.Add(time.Hour) {
+		if err := n.SendDue(now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	counts := map[string]int{}
+	for _, email := range sink.Emails() {
+		counts[email.To[0]]++
+		subject, text, _ := parseEmail(t, email)
+		if !strings.Contains(subject, "failed job") || !strings.Contains(text, "upload-license on 10.0.0.1:22") {
+			t.Errorf("Unexpected digest %q:\n%s", subject, text)
+		}
+	}
+	if counts["daily@example.com"] < 13 || counts["daily@example.com"] > 14 {
+		t.Errorf("Expected one daily digest a day, got %d", counts["daily@example.com"])
+	}
+	if counts["weekly@example.com"] < 1 || counts["weekly@example.com"] > 2 {
+		t.Errorf("Expected one weekly digest a week, got %d", counts["weekly@example.com"])
+	}
+
+	// Every digest is due at 08:00 UTC, and weekly ones on Wednesdays
+	s, err := n.Get(weekly.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.LastSentAt == nil || s.LastSentAt.Weekday() != time.Wednesday || s.LastSentAt.Hour() != 8 {
+		t.Errorf("Expected the last weekly digest on a Wednesday at 08:00, got %v", s.LastSentAt)
+	}
+	if s, _ := n.Get(daily.ID); s.LastSentAt == nil || s.LastSentAt.Hour() != 8 {
+		t.Errorf("Expected the last daily digest at 08:00, got %v", s.LastSentAt)
+	}
+}
+
+func TestNotify_EmptyDigestSkipped(t *testing.T) {
+	sink := fixtures.NewSMTPServer(t)
+	n := openNotifier(t, sink, &digestSource{})
+	s, err := n.Create("ops@example.com", "", notify.Preferences{Expiring: true, Failures: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.SendDue(s.CreatedAt.Add(25 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if emails := sink.Emails(); len(emails) != 0 {
+		t.Errorf("Expected an empty digest to be skipped, got %d emails", len(emails))
+	}
+	if s, _ := n.Get(s.ID); s.LastSentAt == nil {
+		t.Error("Expected the skipped digest to count as sent")
+	}
+
+	// Sending on request delivers even an empty digest
+	if _, err := n.Send(s.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	emails := sink.Emails()
+	if len(emails) != 1 {
+		t.Fatalf("Expected one email, got %d", len(emails))
+	}
+	if subject, text, _ := parseEmail(t, emails[0]); subject != "License Manager: nothing to report" || !strings.Contains(text, "Nothing to report.") {
+		t.Errorf("Unexpected empty digest %q:\n%s", subject, text)
+	}
+}
+
+func TestNotify_Rendering(t *testing.T) {
+	sink := fixtures.NewSMTPServer(t)
+	source := &digestSource{
+		expiring: []notify.ExpiringLicense{
+			{Server: "web-1", Host: "10.0.0.1:22", License: "web.lic", Expires: "2026-01-10", DaysRemaining: 5},
+			{Host: "10.0.0.2:22", License: "<old>.lic", Expires: "2025-12-01", DaysRemaining: -35},
+			{Host: "10.0.0.3:22", License: "later.lic", Expires: "2026-06-01", DaysRemaining: 150},
+		},
+		failed: []notify.FailedJob{
+			{ID: "1", Kind: "download-sysinfo", Host: "10.0.0.4:22", Actor: "token:ci", Status: "failed", Error: "connection refused"},
+		},
+	}
+	n := openNotifier(t, sink, source)
+	s, err := n.Create("ops@example.com", "Ops Lead", notify.Preferences{Expiring: true, ExpiryDays: 14, Failures: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source.failed[0].FinishedAt = s.CreatedAt.Add(time.Second)
+
+	digest, err := n.Send(s.ID, s.CreatedAt.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(digest.Expiring) != 2 || len(digest.Failed) != 1 {
+		t.Errorf("Expected two expiring licenses and one failed job, got %+v", digest)
+	}
+
+	emails := sink.Emails()
+	if len(emails) != 1 {
+		t.Fatalf("Expected one email, got %d", len(emails))
+	}
+	if emails[0].From != "lm@example.com" || len(emails[0].To) != 1 || emails[0].To[0] != "ops@example.com" {
+		t.Errorf("Unexpected envelope %s -> %v", emails[0].From, emails[0].To)
+	}
+	subject, text, html := parseEmail(t, emails[0])
+	if subject != "License Manager: 2 licenses expiring, 1 failed job" {
+		t.Errorf("Unexpected subject %q", subject)
+	}
+	for _, want := range []string{
+		"Hello Ops Lead,",
+		"Licenses expiring within 14 days",
+		"web-1 (10.0.0.1:22): web.lic expires on 2026-01-10, 5 days remaining",
+		"10.0.0.2:22: <old>.lic expired on 2025-12-01",
+		"download-sysinfo on 10.0.0.4:22 by token:ci: failed, connection refused",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in the text part:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "later.lic") {
+		t.Errorf("Expected licenses beyond the warning period to be left out:\n%s", text)
+	}
+	if !strings.Contains(html, "&lt;old&gt;.lic") || strings.Contains(html, "<old>") {
+		t.Errorf("Expected the HTML part to be escaped:\n%s", html)
+	}
+}
+
+func TestNotify_SendFailures(t *testing.T) {
+	sink := fixtures.NewSMTPServer(t)
+	source := &digestSource{failed: []notify.FailedJob{{ID: "1", Kind: "preflight", Host: "10.0.0.1:22", Status: "failed"}}}
+	port, _ := strconv.Atoi(sink.Port)
+
+	// The sink offers no STARTTLS, which is required by default
+	n, err := notify.Open(filepath.Join(t.TempDir(), "subscribers.json"), notify.Options{
+		Host:    sink.Host,
+		Port:    port,
+		From:    "lm@example.com",
+		Timeout: time.Second,
+	}, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := n.Create("ops@example.com", "", notify.Preferences{Failures: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	source.failed[0].FinishedAt = s.CreatedAt.Add(time.Hour)
+
+	_, err = n.Send(s.ID, time.Now())
+	if !errors.Is(err, notify.ErrSendFailed) || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("Expected STARTTLS to be required, got %v", err)
+	}
+
+	// A digest that could not be sent stays due
+	if err := n.SendDue(s.CreatedAt.Add(25 * time.Hour)); err == nil {
+		t.Error("Expected SendDue to report the failure")
+	}
+	if s, _ := n.Get(s.ID); s.LastSentAt != nil {
+		t.Errorf("Expected the digest to stay due, got last sent %v", s.LastSentAt)
+	}
+	if len(sink.Emails()) != 0 {
+		t.Error("Expected nothing to be sent")
+	}
+
+	if _, err := n.Send("missing", time.Now()); !errors.Is(err, notify.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if _, err := notify.Open(filepath.Join(t.TempDir(), "subscribers.json"), notify.Options{Host: sink.Host, From: "not an address"}, source); err == nil {
+		t.Error("Expected an invalid sender to be rejected")
+	}
+}
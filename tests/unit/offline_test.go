@@ -0,0 +1,232 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"license-manager/internal/audit"
+	"license-manager/internal/offline"
+	"license-manager/tests/fixtures"
+)
+
+// licenseHost emulates a server with license2_cli, or without it when
+// installed is false
+func licenseHost(t *testing.T, installed bool) *fixtures.SSHServer {
+	return fixtures.NewSSHServer(t, func(req *fixtures.ExecRequest) int {
+		switch cmd := req.Command; {
+		case cmd == "which license2_cli":
+			if !installed {
+				return 1
+			}
+			fmt.Fprint(req.Stdout, "/usr/local/bin/license2_cli\n")
+		case strings.HasPrefix(cmd, "cat > "):
+			io.Copy(io.Discard, req.Stdin)
+		case strings.HasPrefix(cmd, "ls -la sys_info.bin"):
+			fmt.Fprint(req.Stdout, "-rw-r--r-- 1 testuser testuser 7 Jan  1 00:00 sys_info.bin\n")
+		case cmd == "cat 'sys_info.bin'":
+			fmt.Fprint(req.Stdout, "SYSINFO")
+		case cmd == "license2_cli check":
+			fmt.Fprint(req.Stdout, "License valid until 2031-01-01\n")
+		}
+		return 0
+	})
+}
+
+// offlineInventory writes an inventory with a server entry per name
+func offlineInventory(t *testing.T, servers map[string]*fixtures.SSHServer, unreachable ...string) string {
+	var b strings.Builder
+	for name, server := range servers {
+		fmt.Fprintf(&b, "- {name: %s, host: %s, port: %q, username: %s, password: %s}\n",
+			name, server.Host, server.Port, fixtures.TestSSHConfigs.Valid.Username, fixtures.TestSSHConfigs.Valid.Password)
+	}
+	for _, name := range unreachable {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		port := listener.Addr().(*net.TCPAddr).Port
+		listener.Close()
+		fmt.Fprintf(&b, "- {name: %s, host: 127.0.0.1, port: \"%d\", username: u, password: p, tags: [dmz]}\n", name, port)
+	}
+
+	path := filepath.Join(t.TempDir(), "servers.yaml")
+	if err := os.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func runOffline(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := offline.Main(context.Background(), args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func readReport(t *testing.T, dir string) *offline.Report {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, offline.ReportJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report offline.Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	return &report
+}
+
+func TestOffline_SysinfoAcrossHosts(t *testing.T) {
+	inventory := offlineInventory(t, map[string]*fixtures.SSHServer{
+		"web-1": licenseHost(t, true),
+		"web-2": licenseHost(t, true),
+		"db-1":  licenseHost(t, false),
+	}, "dmz-1")
+	out := filepath.Join(t.TempDir(), "results")
+
+	code, stdout, stderr := runOffline("-inventory", inventory, "-out", out, "-parallel", "2")
+	if code != offline.ExitFailure {
+		t.Errorf("Expected failed hosts to fail the run, got %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "2 succeeded, 2 failed") || !strings.Contains(stdout, "license2_cli not found") {
+		t.Errorf("Unexpected summary:\n%s", stdout)
+	}
+
+	report := readReport(t, out)
+	hosts := map[string]offline.HostReport{}
+	for _, host := range report.Hosts {
+		hosts[host.Server] = host
+	}
+	for _, name := range []string{"web-1", "web-2"} {
+		host := hosts[name]
+		if host.Status != offline.StatusSuccess || len(host.Steps) != 3 || host.Steps[2].File != filepath.Join(name, "sys_info.bin") {
+			t.Errorf("Expected %s to succeed with a sysinfo file, got %+v", name, host)
+		}
+		if data, err := os.ReadFile(filepath.Join(out, name, "sys_info.bin")); err != nil || !strings.HasPrefix(string(data), "SYSINFO") {
+			t.Errorf("Expected the sysinfo file for %s, got %q (%v)", name, data, err)
+		}
+	}
+	if steps := hosts["db-1"].Steps; len(steps) != 3 || steps[1].Status != offline.StatusFailure || steps[2].Status != offline.StatusSkipped {
+		t.Errorf("Expected sysinfo to be skipped without license2_cli, got %+v", steps)
+	}
+	if steps := hosts["dmz-1"].Steps; len(steps) != 3 || steps[0].Operation != offline.StepConnect || steps[0].Status != offline.StatusFailure {
+		t.Errorf("Expected the unreachable host to fail to connect, got %+v", steps)
+	}
+
+	if text, err := os.ReadFile(filepath.Join(out, offline.ReportText)); err != nil || !strings.Contains(string(text), "== db-1") {
+		t.Errorf("Expected a text report, got %v", err)
+	}
+
+	log, err := audit.Open(filepath.Join(out, offline.AuditLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.Verify(); err != nil {
+		t.Errorf("Expected the audit log to verify: %v", err)
+	}
+	records, err := log.Query(audit.Filter{Action: audit.ActionDownloadSysinfo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || !strings.HasPrefix(records[0].Actor, "offline:") {
+		t.Errorf("Expected a sysinfo record per host, got %+v", records)
+	}
+}
+
+func TestOffline_Import(t *testing.T) {
+	inventory := offlineInventory(t, map[string]*fixtures.SSHServer{
+		"web-1": licenseHost(t, true),
+		"web-2": licenseHost(t, true),
+	})
+	dir := t.TempDir()
+	license := filepath.Join(dir, "site.lic")
+	if err := os.WriteFile(license, []byte("license data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "results")
+
+	code, _, stderr := runOffline("-inventory", inventory, "-out", out, "-ops", "import", "-license", license, "web-2")
+	if code != offline.ExitOK {
+		t.Fatalf("Expected the import to succeed, got %d: %s", code, stderr)
+	}
+
+	report := readReport(t, out)
+	if len(report.Hosts) != 1 || report.Hosts[0].Server != "web-2" {
+		t.Fatalf("Expected only web-2, got %+v", report.Hosts)
+	}
+	steps := report.Hosts[0].Steps
+	if len(steps) != 3 || steps[1].Operation != offline.OpImport || steps[1].Command != "license2_cli import -l '/tmp/site.lic'" || steps[2].Operation != offline.StepVerify {
+		t.Errorf("Expected connect, import and verify, got %+v", steps)
+	}
+	if !strings.Contains(steps[2].Output, "valid until 2031-01-01") {
+		t.Errorf("Expected the check output, got %q", steps[2].Output)
+	}
+	if report.License != "site.lic" || report.LicenseSHA256 == "" {
+		t.Errorf("Expected the license to be identified, got %q %q", report.License, report.LicenseSHA256)
+	}
+}
+
+func TestOffline_QuotesSysinfoName(t *testing.T) {
+	// The name comes from the remote ls, so it must not reach a shell as is
+	name := "sysinfo$(id);reboot.bin"
+	var mu sync.Mutex
+	var downloads []string
+	host := fixtures.NewSSHServer(t, func(req *fixtures.ExecRequest) int {
+		switch cmd := req.Command; {
+		case cmd == "which license2_cli":
+			fmt.Fprint(req.Stdout, "/usr/local/bin/license2_cli\n")
+		case strings.HasPrefix(cmd, "ls -la sys_info.bin"):
+			fmt.Fprintf(req.Stdout, "-rw-r--r-- 1 testuser testuser 7 Jan  1 00:00 %s\n", name)
+		case strings.HasPrefix(cmd, "cat "):
+			mu.Lock()
+			downloads = append(downloads, cmd)
+			mu.Unlock()
+			fmt.Fprint(req.Stdout, "SYSINFO")
+		}
+		return 0
+	})
+	inventory := offlineInventory(t, map[string]*fixtures.SSHServer{"web-1": host})
+
+	if code, _, stderr := runOffline("-inventory", inventory, "-out", filepath.Join(t.TempDir(), "results")); code != offline.ExitOK {
+		t.Fatalf("Expected the download to succeed, got %d: %s", code, stderr)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := "cat '" + name + "'"; len(downloads) != 1 || downloads[0] != want {
+		t.Errorf("Expected %q, got %q", want, downloads)
+	}
+}
+
+func TestOffline_Usage(t *testing.T) {
+	inventory := offlineInventory(t, map[string]*fixtures.SSHServer{"web-1": licenseHost(t, true)}, "dmz-1")
+
+	for name, args := range map[string][]string{
+		"no inventory":        {},
+		"missing inventory":   {"-inventory", "/nonexistent.yaml"},
+		"unknown server":      {"-inventory", inventory, "web-9"},
+		"unknown tag":         {"-inventory", inventory, "-tags", "nope"},
+		"import with no file": {"-inventory", inventory, "-ops", "import"},
+		"unknown operation":   {"-inventory", inventory, "-ops", "reboot"},
+	} {
+		if code, _, _ := runOffline(append(args, "-out", t.TempDir())...); code != offline.ExitUsage {
+			t.Errorf("%s: expected a usage error, got %d", name, code)
+		}
+	}
+
+	// Tags select servers
+	out := t.TempDir()
+	if code, _, _ := runOffline("-inventory", inventory, "-tags", "dmz", "-ops", "check", "-out", out); code != offline.ExitFailure {
+		t.Errorf("Expected the unreachable dmz server to fail, got %d", code)
+	}
+	if report := readReport(t, out); len(report.Hosts) != 1 || report.Hosts[0].Server != "dmz-1" {
+		t.Errorf("Expected only dmz-1, got %+v", report.Hosts)
+	}
+}
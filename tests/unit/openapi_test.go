@@ -0,0 +1,63 @@
+package unit
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"license-manager/internal/api"
+	"license-manager/internal/openapi"
+)
+
+type openapiItem struct {
+	ID      string            `json:"id"`
+	Note    string            `json:"note,omitempty"`
+	At      time.Time         `json:"at"`
+	Done    *time.Time        `json:"done,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Count   int64             `json:"count"`
+	Ignored string            `json:"-"`
+	secret  string
+}
+
+func TestOpenAPI_Document(t *testing.T) {
+	doc := openapi.Document(openapi.Info{Title: "Test", Version: "1"}, "/api/v1", []openapi.Operation{
+		{
+			Method: http.MethodGet, Path: "/items", ID: "listItems",
+			Responses: []openapi.Response{{Status: http.StatusOK, Body: api.Page[openapiItem]{}}},
+		},
+		{
+			Method: http.MethodDelete, Path: "/items/:id", ID: "deleteItem",
+			Responses: []openapi.Response{{Status: http.StatusNoContent}},
+		},
+	})
+
+	paths := doc["paths"].(map[string]any)
+	del, ok := paths["/items/{id}"].(map[string]any)["delete"].(map[string]any)
+	if !ok {
+		t.Fatalf("Expected gin parameters to become path templates, got %v", paths)
+	}
+	if param := del["parameters"].([]any)[0].(map[string]any); param["name"] != "id" || param["in"] != "path" {
+		t.Errorf("Expected an id path parameter, got %v", param)
+	}
+
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+	if _, ok := schemas["openapiItemPage"]; !ok {
+		t.Fatalf("Expected Page[openapiItem] to be named openapiItemPage, got %v", schemas)
+	}
+	item := schemas["openapiItem"].(map[string]any)
+	properties := item["properties"].(map[string]any)
+	if len(properties) != 6 {
+		t.Errorf("Expected ignored and unexported fields to be left out, got %v", properties)
+	}
+	required := item["required"].([]string)
+	if len(required) != 3 || required[0] != "at" || required[1] != "count" || required[2] != "id" {
+		t.Errorf("Expected fields without omitempty to be required, got %v", required)
+	}
+	if at := properties["at"].(map[string]any); at["format"] != "date-time" {
+		t.Errorf("Expected times to be date-time strings, got %v", at)
+	}
+	if done := properties["done"].(map[string]any); done["nullable"] != true {
+		t.Errorf("Expected pointers to be nullable, got %v", done)
+	}
+}
@@ -0,0 +1,169 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"license-manager/internal/services"
+	"license-manager/tests/fixtures"
+)
+
+// licenseServer starts a test SSH server where license2_cli is installed
+func licenseServer(t *testing.T) *fixtures.SSHServer {
+	return fixtures.NewSSHServer(t, func(req *fixtures.ExecRequest) int {
+		if req.Command == "which license2_cli" {
+			req.Stdout.Write([]byte("/usr/local/bin/license2_cli\n"))
+		}
+		return 0
+	})
+}
+
+func pooledService(server *fixtures.SSHServer, pool *services.Pool, password string) *services.SSHService {
+	service := services.NewSSHService(&services.SSHConfig{
+		Host:     server.Host,
+		Port:     server.Port,
+		Username: fixtures.TestSSHConfigs.Valid.Username,
+		Password: password,
+	})
+	service.SetPool(pool)
+	return service
+}
+
+func TestPool_ReusesClientAcrossServices(t *testing.T) {
+	server := licenseServer(t)
+	pool := services.NewPool(services.PoolConfig{})
+	defer pool.Close()
+
+	for i := 0; i < 3; i++ {
+		service := pooledService(server, pool, fixtures.TestSSHConfigs.Valid.Password)
+		if err := service.Connect(context.Background()); err != nil {
+			t.Fatalf("Connect %d failed: %v", i, err)
+		}
+		if _, err := service.ExecuteCommand(context.Background(), "license2_cli check"); err != nil {
+			t.Fatalf("ExecuteCommand %d failed: %v", i, err)
+		}
+		service.Close()
+	}
+
+	if got := server.Connections(); got != 1 {
+		t.Errorf("Expected 1 connection for 3 borrowers, got %d", got)
+	}
+	if got := pool.Len(); got != 1 {
+		t.Errorf("Expected 1 pooled client, got %d", got)
+	}
+}
+
+func TestPool_KeysByCredential(t *testing.T) {
+	server := licenseServer(t)
+	pool := services.NewPool(services.PoolConfig{})
+	defer pool.Close()
+
+	service := pooledService(server, pool, fixtures.TestSSHConfigs.Valid.Password)
+	if err := service.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	service.Close()
+
+	// A wrong password must not be served the authenticated client
+	other := pooledService(server, pool, "wrong-password")
+	if err := other.Connect(context.Background()); err == nil {
+		other.Close()
+		t.Fatal("Expected authentication failure with a different password")
+	}
+	if got := server.Connections(); got != 1 {
+		t.Errorf("Expected only the valid credential to connect, got %d connections", got)
+	}
+}
+
+func TestPool_CachesLicenseCLICheck(t *testing.T) {
+	server := licenseServer(t)
+	pool := services.NewPool(services.PoolConfig{})
+	defer pool.Close()
+
+	for i := 0; i < 3; i++ {
+		service := pooledService(server, pool, fixtures.TestSSHConfigs.Valid.Password)
+		if err := service.Connect(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		exists, err := service.CheckLicenseCLI(context.Background())
+		service.Close()
+		if err != nil || !exists {
+			t.Fatalf("Expected license2_cli to be found, got %v, %v", exists, err)
+		}
+	}
+
+	checks := 0
+	for _, command := range server.Commands() {
+		if strings.HasPrefix(command, "which ") {
+			checks++
+		}
+	}
+	if checks != 1 {
+		t.Errorf("Expected license2_cli to be looked up once, got %d lookups", checks)
+	}
+}
+
+func TestPool_MaxSessionsPerHost(t *testing.T) {
+	server := licenseServer(t)
+	pool := services.NewPool(services.PoolConfig{MaxSessionsPerHost: 1})
+	defer pool.Close()
+
+	first := pooledService(server, pool, fixtures.TestSSHConfigs.Valid.Password)
+	if err := first.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	second := pooledService(server, pool, fixtures.TestSSHConfigs.Valid.Password)
+	if err := second.Connect(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected second borrower to wait for the slot, got %v", err)
+	}
+
+	// Releasing the first borrower frees the slot
+	first.Close()
+	if err := second.Connect(context.Background()); err != nil {
+		t.Fatalf("Expected slot to be free after release, got %v", err)
+	}
+	second.Close()
+}
+
+func TestPool_EvictsIdleClients(t *testing.T) {
+	server := licenseServer(t)
+	pool := services.NewPool(services.PoolConfig{
+		IdleTTL:           50 * time.Millisecond,
+		KeepaliveInterval: 20 * time.Millisecond,
+	})
+	defer pool.Close()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go pool.Maintain(stop)
+
+	service := pooledService(server, pool, fixtures.TestSSHConfigs.Valid.Password)
+	if err := service.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	service.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for pool.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := pool.Len(); got != 0 {
+		t.Fatalf("Expected idle client to be evicted, %d still pooled", got)
+	}
+
+	// The next borrower dials again
+	service = pooledService(server, pool, fixtures.TestSSHConfigs.Valid.Password)
+	if err := service.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	service.Close()
+	if got := server.Connections(); got != 2 {
+		t.Errorf("Expected a new connection after eviction, got %d connections", got)
+	}
+}
@@ -0,0 +1,234 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"license-manager/internal/handlers"
+	"license-manager/internal/services"
+	"license-manager/tests/fixtures"
+
+	"github.com/gin-gonic/gin"
+)
+
+// remoteHost describes the host emulated by preflightServer
+type remoteHost struct {
+	freeKB      int
+	readOnly    bool
+	noCLI       bool
+	clockOffset time.Duration
+	sudo        string // "nopasswd", "password" or "denied"
+}
+
+func preflightServer(t *testing.T, host remoteHost) *fixtures.SSHServer {
+	return fixtures.NewSSHServer(t, func(req *fixtures.ExecRequest) int {
+		switch cmd := req.Command; {
+		case strings.HasPrefix(cmd, "uname"):
+			fmt.Fprint(req.Stdout, "Linux 5.15.0-91-generic x86_64\nNAME=\"Ubuntu\"\nPRETTY_NAME=\"Ubuntu 22.04.3 LTS\"\n")
+		case strings.HasPrefix(cmd, "df -Pk"):
+			fmt.Fprintf(req.Stdout, "Filesystem 1024-blocks Used Available Capacity Mounted on\n/dev/sda1 41152736 20000000 %d 50%% /\n", host.freeKB)
+		case strings.HasPrefix(cmd, "touch"):
+			if host.readOnly {
+				fmt.Fprint(req.Stderr, "touch: cannot touch '/tmp/.license-manager-preflight': Permission denied\n")
+				return 1
+			}
+		case cmd == "which license2_cli":
+			if host.noCLI {
+				return 1
+			}
+			fmt.Fprint(req.Stdout, "/usr/local/bin/license2_cli\n")
+		case strings.HasPrefix(cmd, "license2_cli --version"):
+			fmt.Fprint(req.Stdout, "license2_cli 3.4.1\n")
+		case cmd == "date -u +%s":
+			fmt.Fprintf(req.Stdout, "%d\n", time.Now().Add(host.clockOffset).Unix())
+		case cmd == "sudo -n true 2>&1":
+			switch host.sudo {
+			case "nopasswd":
+				return 0
+			case "password":
+				fmt.Fprint(req.Stdout, "sudo: a password is required\n")
+			default:
+				fmt.Fprint(req.Stdout, "Sorry, user testuser may not run sudo on host.\n")
+			}
+			return 1
+		default:
+			return 127
+		}
+		return 0
+	})
+}
+
+func runPreflight(t *testing.T, server *fixtures.SSHServer, escalation services.Escalation) *services.PreflightReport {
+	service := services.NewSSHService(&services.SSHConfig{
+		Host:       server.Host,
+		Port:       server.Port,
+		Username:   fixtures.TestSSHConfigs.Valid.Username,
+		Password:   fixtures.TestSSHConfigs.Valid.Password,
+		Escalation: escalation,
+	})
+	defer service.Close()
+	return service.Preflight(context.Background(), "/tmp/")
+}
+
+func checksByName(report *services.PreflightReport) map[string]services.PreflightCheck {
+	checks := map[string]services.PreflightCheck{}
+	for _, check := range report.Checks {
+		checks[check.Name] = check
+	}
+	return checks
+}
+
+func TestPreflight_Pass(t *testing.T) {
+	server := preflightServer(t, remoteHost{freeKB: 8 << 20, clockOffset: 3 * time.Second, sudo: "password"})
+	report := runPreflight(t, server, services.Escalation{})
+
+	if report.Status != services.PreflightPass {
+		t.Errorf("Expected pass, got %s: %+v", report.Status, report.Checks)
+	}
+
+	checks := checksByName(report)
+	for _, name := range []string{
+		services.CheckSSH, services.CheckAuth, services.CheckOS, services.CheckDiskSpace,
+		services.CheckWritable, services.CheckCLI, services.CheckClockSkew, services.CheckEscalation,
+	} {
+		if checks[name].Status != services.PreflightPass {
+			t.Errorf("Expected %s to pass, got %+v", name, checks[name])
+		}
+	}
+
+	wants := map[string]string{
+		services.CheckOS:         "Ubuntu 22.04.3 LTS (Linux 5.15.0-91-generic x86_64)",
+		services.CheckDiskSpace:  "8.0 GiB free in /tmp/",
+		services.CheckCLI:        "/usr/local/bin/license2_cli, license2_cli 3.4.1",
+		services.CheckEscalation: "not configured; sudo is available with a password",
+	}
+	for name, want := range wants {
+		if checks[name].Message != want {
+			t.Errorf("Expected %s message %q, got %q", name, want, checks[name].Message)
+		}
+	}
+	if msg := checks[services.CheckClockSkew].Message; !strings.Contains(msg, "ahead of") {
+		t.Errorf("Expected clock skew to be reported, got %q", msg)
+	}
+}
+
+func TestPreflight_Problems(t *testing.T) {
+	server := preflightServer(t, remoteHost{
+		freeKB:      0,
+		readOnly:    true,
+		noCLI:       true,
+		clockOffset: -10 * time.Minute,
+		sudo:        "denied",
+	})
+	report := runPreflight(t, server, services.Escalation{})
+
+	if report.Status != services.PreflightFail {
+		t.Errorf("Expected fail, got %s", report.Status)
+	}
+
+	checks := checksByName(report)
+	for _, name := range []string{services.CheckDiskSpace, services.CheckWritable, services.CheckCLI, services.CheckClockSkew} {
+		if checks[name].Status != services.PreflightFail {
+			t.Errorf("Expected %s to fail, got %+v", name, checks[name])
+		}
+	}
+	if msg := checks[services.CheckWritable].Message; !strings.Contains(msg, "Permission denied") {
+		t.Errorf("Expected the remote error, got %q", msg)
+	}
+	// The remote clock has one second resolution
+	if msg := checks[services.CheckClockSkew].Message; !strings.Contains(msg, "is 10m") || !strings.Contains(msg, "behind") {
+		t.Errorf("Expected the skew and its direction, got %q", msg)
+	}
+	if msg := checks[services.CheckEscalation].Message; msg != "not configured; testuser may not use sudo" {
+		t.Errorf("Unexpected sudo message %q", msg)
+	}
+}
+
+func TestPreflight_Warnings(t *testing.T) {
+	server := preflightServer(t, remoteHost{freeKB: 2048, clockOffset: time.Minute, sudo: "nopasswd"})
+	report := runPreflight(t, server, services.Escalation{})
+
+	if report.Status != services.PreflightWarn {
+		t.Errorf("Expected warn, got %s: %+v", report.Status, report.Checks)
+	}
+	checks := checksByName(report)
+	if checks[services.CheckDiskSpace].Status != services.PreflightWarn || checks[services.CheckClockSkew].Status != services.PreflightWarn {
+		t.Errorf("Expected low space and clock skew warnings, got %+v", report.Checks)
+	}
+}
+
+func TestPreflight_EscalationRefused(t *testing.T) {
+	fake := &fakeEscalation{password: fixtures.TestSSHConfigs.Valid.Password}
+	server := fixtures.NewSSHServer(t, func(req *fixtures.ExecRequest) int {
+		if req.Command == "which license2_cli" {
+			fmt.Fprint(req.Stdout, "/usr/local/bin/license2_cli\n")
+			return 0
+		}
+		return fake.handle(req)
+	})
+	report := runPreflight(t, server, services.Escalation{Method: services.EscalateSudo})
+
+	check := checksByName(report)[services.CheckEscalation]
+	if check.Status != services.PreflightFail || !strings.Contains(check.Message, "not permitted to use sudo") {
+		t.Errorf("Expected sudo to fail as not permitted, got %+v", check)
+	}
+}
+
+func TestPreflight_Unreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().(*net.TCPAddr)
+	listener.Close()
+
+	service := services.NewSSHService(&services.SSHConfig{
+		Host:     "127.0.0.1",
+		Port:     fmt.Sprint(addr.Port),
+		Username: "testuser",
+		Password: "testpass",
+	})
+	report := service.Preflight(context.Background(), "/tmp/")
+
+	if report.Status != services.PreflightFail || len(report.Checks) != 1 || report.Checks[0].Name != services.CheckSSH {
+		t.Errorf("Expected a single failed ssh check, got %+v", report)
+	}
+}
+
+func TestPreflightHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := preflightServer(t, remoteHost{freeKB: 8 << 20, sudo: "nopasswd"})
+
+	router := gin.New()
+	router.POST("/api/preflight", handlers.PreflightHandler)
+
+	jsonData, _ := json.Marshal(handlers.ServerConfig{
+		Host:     server.Host,
+		Port:     server.Port,
+		Username: fixtures.TestSSHConfigs.Valid.Username,
+		Password: fixtures.TestSSHConfigs.Valid.Password,
+	})
+	req := httptest.NewRequest("POST", "/api/preflight", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var response handlers.PreflightResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if !response.Success || response.Report == nil || response.Report.Host != net.JoinHostPort(server.Host, server.Port) {
+		t.Errorf("Expected a passing report for the host, got %+v", response)
+	}
+}
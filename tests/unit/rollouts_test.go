@@ -0,0 +1,549 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"license-manager/internal/rollouts"
+)
+
+// fakeRunner records imports, failing on the servers in fail and taking
+// delay for each
+type fakeRunner struct {
+	mu      sync.Mutex
+	fail    map[string]error
+	delay   time.Duration
+	block   chan struct{}
+	started chan struct{}
+	imports []string
+	missed  [][]string
+	halted  []rollouts.Rollout
+}
+
+func (f *fakeRunner) Import(ctx context.Context, r rollouts.Rollout, server string, license []byte) (string, error) {
+	if f.started != nil {
+		f.started <- struct{}{}
+	}
+	if f.block != nil {
+		<-f.block
+	}
+	time.Sleep(f.delay)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.fail[server]; err != nil {
+		return "job-" + server, err
+	}
+	f.imports = append(f.imports, server)
+	return "job-" + server, nil
+}
+
+func (f *fakeRunner) Missed(r rollouts.Rollout, window time.Time, servers []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.missed = append(f.missed, servers)
+}
+
+func (f *fakeRunner) Halted(r rollouts.Rollout) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.halted = append(f.halted, r)
+}
+
+func (f *fakeRunner) results() ([]string, [][]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.imports...), append([][]string{}, f.missed...)
+}
+
+func openScheduler(t *testing.T, runner rollouts.Runner) *rollouts.Scheduler {
+	t.Helper()
+	s, err := rollouts.Open(filepath.Join(t.TempDir(), "rollouts.json"), rollouts.Options{}, runner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// targetStatuses maps each server of the rollout to its status
+func targetStatuses(r rollouts.Rollout) map[string]string {
+	statuses := make(map[string]string)
+	for _, t := range r.Targets {
+		statuses[t.Server] = t.Status
+	}
+	return statuses
+}
+
+func TestRollouts_Create(t *testing.T) {
+	s := openScheduler(t, &fakeRunner{})
+	start := time.Now().Add(time.Hour)
+	license := []byte("LICENSE")
+
+	invalid := []struct {
+		name     string
+		filename string
+		license  []byte
+		servers  []string
+		schedule rollouts.Schedule
+		strategy rollouts.Strategy
+	}{
+		{name: "no license", filename: "a.lic", servers: []string{"web-1"}, schedule: rollouts.Schedule{StartAt: start}},
+		{name: "no servers", filename: "a.lic", license: license, schedule: rollouts.Schedule{StartAt: start}},
+		{name: "duplicate servers", filename: "a.lic", license: license, servers: []string{"web-1", "web-1"}, schedule: rollouts.Schedule{StartAt: start}},
+		{name: "no start", filename: "a.lic", license: license, servers: []string{"web-1"}},
+		{name: "unknown repeat", filename: "a.lic", license: license, servers: []string{"web-1"}, schedule: rollouts.Schedule{StartAt: start, Repeat: "hourly"}},
+		{name: "window longer than a day", filename: "a.lic", license: license, servers: []string{"web-1"}, schedule: rollouts.Schedule{StartAt: start, WindowMinutes: 25 * 60, Repeat: rollouts.RepeatDaily}},
+		{name: "closed window", filename: "a.lic", license: license, servers: []string{"web-1"}, schedule: rollouts.Schedule{StartAt: time.Now().Add(-2 * time.Hour)}},
+		{name: "negative wave size", filename: "a.lic", license: license, servers: []string{"web-1"}, schedule: rollouts.Schedule{StartAt: start}, strategy: rollouts.Strategy{WaveSize: -1}},
+		{name: "failure percent over 100", filename: "a.lic", license: license, servers: []string{"web-1"}, schedule: rollouts.Schedule{StartAt: start}, strategy: rollouts.Strategy{Canary: 1, MaxFailurePercent: 101}},
+		{name: "failure percent without waves", filename: "a.lic", license: license, servers: []string{"web-1"}, schedule: rollouts.Schedule{StartAt: start}, strategy: rollouts.Strategy{MaxFailurePercent: 10}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.Create("", "alice", tt.filename, tt.license, tt.servers, tt.schedule, tt.strategy); err == nil {
+				t.Error("Expected the rollout to be rejected")
+			}
+		})
+	}
+
+	r, err := s.Create("quarterly renewal", "alice", "a.lic", license, []string{"web-1", "web-2"}, rollouts.Schedule{StartAt: start}, rollouts.Strategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != rollouts.StatusScheduled || r.WindowMinutes != rollouts.DefaultWindowMinutes || len(r.Targets) != 2 || r.Targets[0].Status != rollouts.TargetPending {
+		t.Errorf("Expected a scheduled rollout with a one-hour window, got %+v", r)
+	}
+	if r.NextWindowAt == nil || !r.NextWindowAt.Equal(start) {
+		t.Errorf("Expected the next window at %v, got %v", start, r.NextWindowAt)
+	}
+	if _, err := s.Get("missing"); !errors.Is(err, rollouts.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	// The file holds license files
+	info, err := os.Stat(s.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+	}
+}
+
+func TestRollouts_HeldUntilWindow(t *testing.T) {
+	runner := &fakeRunner{fail: map[string]error{"web-2": errors.New("license has expired")}}
+	s := openScheduler(t, runner)
+	start := time.Now().Add(time.Hour)
+	r, err := s.Create("", "alice", "a.lic", []byte("LICENSE"), []string{"web-1", "web-2", "web-3"}, rollouts.Schedule{StartAt: start}, rollouts.Strategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.RunDue(context.Background(), start.Add(-time.Minute))
+	if imports, _ := runner.results(); len(imports) != 0 {
+		t.Fatalf("Expected nothing before the window, got %v", imports)
+	}
+
+	s.RunDue(context.Background(), start.Add(time.Minute))
+	r, _ = s.Get(r.ID)
+	want := map[string]string{"web-1": rollouts.TargetSucceeded, "web-2": rollouts.TargetFailed, "web-3": rollouts.TargetSucceeded}
+	for server, status := range targetStatuses(r) {
+		if status != want[server] {
+			t.Errorf("Expected %s to be %s, got %s", server, want[server], status)
+		}
+	}
+	if r.Status != rollouts.StatusCompleted || r.FinishedAt == nil || r.NextWindowAt != nil {
+		t.Errorf("Expected the rollout to complete, got %+v", r)
+	}
+	if r.Targets[1].JobID != "job-web-2" || r.Targets[1].Error != "license has expired" {
+		t.Errorf("Expected the failed job and its error, got %+v", r.Targets[1])
+	}
+
+	// A completed rollout neither runs again nor can be cancelled
+	s.RunDue(context.Background(), start.Add(2*time.Minute))
+	if imports, _ := runner.results(); len(imports) != 2 {
+		t.Errorf("Expected two imports, got %v", imports)
+	}
+	if _, err := s.Cancel(r.ID); !errors.Is(err, rollouts.ErrStarted) {
+		t.Errorf("Expected ErrStarted, got %v", err)
+	}
+}
+
+func TestRollouts_Missed(t *testing.T) {
+	runner := &fakeRunner{delay: 100 * time.Millisecond}
+	s := openScheduler(t, runner)
+	start := time.Now().Add(time.Hour)
+	schedule := rollouts.Schedule{StartAt: start, WindowMinutes: 30}
+
+	// The service was down for the whole window
+	down, err := s.Create("", "alice", "a.lic", []byte("LICENSE"), []string{"web-1"}, schedule, rollouts.Strategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.RunDue(context.Background(), start.Add(time.Hour))
+	down, _ = s.Get(down.ID)
+	if down.Status != rollouts.StatusCompleted || down.Targets[0].Status != rollouts.TargetMissed {
+		t.Errorf("Expected web-1 to have missed the window, got %+v", down)
+	}
+
+	// The window closes while the first host is imported
+	closing, err := s.Create("", "alice", "a.lic", []byte("LICENSE"), []string{"web-1", "web-2"}, schedule, rollouts.Strategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.RunDue(context.Background(), start.Add(30*time.Minute-50*time.Millisecond))
+	closing, _ = s.Get(closing.ID)
+	if got := targetStatuses(closing); got["web-1"] != rollouts.TargetSucceeded || got["web-2"] != rollouts.TargetMissed {
+		t.Errorf("Expected web-2 to miss the window, got %v", got)
+	}
+	if missed := closing.Missed(); len(missed) != 1 || missed[0] != "web-2" {
+		t.Errorf("Expected web-2 to be reported, got %v", missed)
+	}
+
+	if _, missed := runner.results(); len(missed) != 2 || missed[0][0] != "web-1" || missed[1][0] != "web-2" {
+		t.Errorf("Expected both misses to be reported, got %v", missed)
+	}
+}
+
+func TestRollouts_RecurringWindow(t *testing.T) {
+	runner := &fakeRunner{}
+	s := openScheduler(t, runner)
+	start := time.Now().Add(time.Hour)
+	r, err := s.Create("", "alice", "a.lic", []byte("LICENSE"), []string{"web-1"}, rollouts.Schedule{StartAt: start, Repeat: rollouts.RepeatWeekly}, rollouts.Strategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Missing the first window leaves the host for the next
+	s.RunDue(context.Background(), start.Add(2*time.Hour))
+	r, _ = s.Get(r.ID)
+	next := start.Add(7 * 24 * time.Hour)
+	if r.Status != rollouts.StatusScheduled || r.Targets[0].Status != rollouts.TargetMissed || r.NextWindowAt == nil || !r.NextWindowAt.Equal(next) {
+		t.Fatalf("Expected web-1 to wait for the window at %v, got %+v", next, r)
+	}
+
+	s.RunDue(context.Background(), next.Add(time.Minute))
+	r, _ = s.Get(r.ID)
+	if r.Status != rollouts.StatusCompleted || r.Targets[0].Status != rollouts.TargetSucceeded || !r.Targets[0].Window.Equal(next) {
+		t.Errorf("Expected web-1 to be imported in the second window, got %+v", r)
+	}
+}
+
+func TestRollouts_Cancel(t *testing.T) {
+	runner := &fakeRunner{}
+	s := openScheduler(t, runner)
+	start := time.Now().Add(time.Hour)
+	r, err := s.Create("", "alice", "a.lic", []byte("LICENSE"), []string{"web-1"}, rollouts.Schedule{StartAt: start}, rollouts.Strategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancelled, err := s.Cancel(r.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.Status != rollouts.StatusCancelled || cancelled.NextWindowAt != nil {
+		t.Errorf("Expected the rollout to be cancelled, got %+v", cancelled)
+	}
+	s.RunDue(context.Background(), start.Add(time.Minute))
+	if imports, _ := runner.results(); len(imports) != 0 {
+		t.Errorf("Expected a cancelled rollout not to run, got %v", imports)
+	}
+	if _, err := s.Cancel(r.ID); !errors.Is(err, rollouts.ErrStarted) {
+		t.Errorf("Expected ErrStarted, got %v", err)
+	}
+	if _, err := s.Cancel("missing"); !errors.Is(err, rollouts.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestRollouts_Unavailable(t *testing.T) {
+	runner := &fakeRunner{fail: map[string]error{"web-1": rollouts.ErrUnavailable}}
+	s := openScheduler(t, runner)
+	start := time.Now().Add(time.Hour)
+	r, err := s.Create("", "alice", "a.lic", []byte("LICENSE"), []string{"web-1", "web-2"}, rollouts.Schedule{StartAt: start}, rollouts.Strategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Imports cannot start, as during shutdown: the rollout waits
+	s.RunDue(context.Background(), start.Add(time.Minute))
+	r, _ = s.Get(r.ID)
+	if got := targetStatuses(r); r.Status != rollouts.StatusScheduled || got["web-1"] != rollouts.TargetPending || got["web-2"] != rollouts.TargetPending {
+		t.Fatalf("Expected the rollout to wait, got %+v", r)
+	}
+
+	// and resumes while the window is open
+	runner.mu.Lock()
+	runner.fail = nil
+	runner.mu.Unlock()
+	s.RunDue(context.Background(), start.Add(2*time.Minute))
+	r, _ = s.Get(r.ID)
+	if r.Status != rollouts.StatusCompleted {
+		t.Errorf("Expected the rollout to complete, got %+v", r)
+	}
+	if imports, _ := runner.results(); len(imports) != 2 {
+		t.Errorf("Expected both imports, got %v", imports)
+	}
+}
+
+func TestRollouts_Reopen(t *testing.T) {
+	runner := &fakeRunner{block: make(chan struct{}), started: make(chan struct{}, 1)}
+	s := openScheduler(t, runner)
+	start := time.Now().Add(time.Hour)
+	r, err := s.Create("", "alice", "a.lic", []byte("LICENSE"), []string{"web-1", "web-2"}, rollouts.Schedule{StartAt: start}, rollouts.Strategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.RunDue(context.Background(), start.Add(time.Minute))
+		close(done)
+	}()
+	<-runner.started
+	if got, _ := s.Get(r.ID); got.Status != rollouts.StatusRunning {
+		t.Errorf("Expected the rollout to be running, got %s", got.Status)
+	}
+	if _, err := s.Cancel(r.ID); !errors.Is(err, rollouts.ErrStarted) {
+		t.Errorf("Expected a running rollout not to be cancellable, got %v", err)
+	}
+
+	// The process stops while web-1 is imported
+	reopened, err := rollouts.Open(s.Path(), rollouts.Options{}, runner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := reopened.Get(r.ID)
+	if statuses := targetStatuses(got); got.Status != rollouts.StatusScheduled || statuses["web-1"] != rollouts.TargetFailed || statuses["web-2"] != rollouts.TargetPending {
+		t.Errorf("Expected the cut-off import to fail and the rollout to resume, got %+v", got)
+	}
+	close(runner.block)
+	<-done
+}
+
+// waitStarted waits for the runner to start an import
+func waitStarted(t *testing.T, started chan struct{}) {
+	t.Helper()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for an import to start")
+	}
+}
+
+func TestRollouts_Waves(t *testing.T) {
+	runner := &fakeRunner{block: make(chan struct{}), started: make(chan struct{}, 5)}
+	s := openScheduler(t, runner)
+	start := time.Now().Add(time.Hour)
+	servers := []string{"web-1", "web-2", "web-3", "web-4", "web-5"}
+	r, err := s.Create("", "alice", "a.lic", []byte("LICENSE"), servers, rollouts.Schedule{StartAt: start}, rollouts.Strategy{Canary: 1, WaveSize: 2, MaxFailurePercent: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int{1, 2, 2, 3, 3} {
+		if r.Targets[i].Wave != want {
+			t.Errorf("Expected %s in wave %d, got %d", r.Targets[i].Server, want, r.Targets[i].Wave)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.RunDue(context.Background(), start.Add(time.Minute))
+		close(done)
+	}()
+	// The canary runs alone, then each wave's servers are imported together
+	for _, size := range []int{1, 2, 2} {
+		for i := 0; i < size; i++ {
+			waitStarted(t, runner.started)
+		}
+		for i := 0; i < size; i++ {
+			runner.block <- struct{}{}
+		}
+	}
+	<-done
+
+	r, _ = s.Get(r.ID)
+	if r.Status != rollouts.StatusCompleted {
+		t.Errorf("Expected the rollout to complete, got %+v", r)
+	}
+	if imports, _ := runner.results(); len(imports) != 5 || imports[0] != "web-1" {
+		t.Errorf("Expected the canary first and then every server, got %v", imports)
+	}
+}
+
+func TestRollouts_HaltResumeAbort(t *testing.T) {
+	runner := &fakeRunner{fail: map[string]error{"web-1": errors.New("license check failed"), "web-2": errors.New("license check failed")}}
+	s := openScheduler(t, runner)
+	start := time.Now().Add(time.Hour)
+	servers := []string{"web-1", "web-2", "web-3", "web-4", "web-5"}
+	r, err := s.Create("", "alice", "a.lic", []byte("LICENSE"), servers, rollouts.Schedule{StartAt: start}, rollouts.Strategy{Canary: 1, WaveSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Resume(r.ID); !errors.Is(err, rollouts.ErrNotHalted) {
+		t.Errorf("Expected ErrNotHalted, got %v", err)
+	}
+
+	// The canary fails, so the rollout halts before the first wave
+	s.RunDue(context.Background(), start.Add(time.Minute))
+	r, _ = s.Get(r.ID)
+	if got := targetStatuses(r); r.Status != rollouts.StatusHalted || got["web-1"] != rollouts.TargetFailed || got["web-2"] != rollouts.TargetPending {
+		t.Fatalf("Expected the rollout to halt after the canary, got %+v", r)
+	}
+	if r.HaltReason != "1 of 1 imports in wave 1 failed, more than 0%" || r.NextWindowAt != nil {
+		t.Errorf("Expected the halt reason and no next window, got %+v", r)
+	}
+	runner.mu.Lock()
+	if len(runner.halted) != 1 || runner.halted[0].ID != r.ID {
+		t.Errorf("Expected the halt to be reported, got %v", runner.halted)
+	}
+	runner.mu.Unlock()
+	s.RunDue(context.Background(), start.Add(2*time.Minute))
+	if imports, _ := runner.results(); len(imports) != 0 {
+		t.Fatalf("Expected a halted rollout not to run, got %v", imports)
+	}
+
+	// Resumed, the next wave runs in the same window and the rollout
+	// halts again as one of its imports fails
+	resumed, err := s.Resume(r.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Status != rollouts.StatusScheduled || resumed.HaltReason != "" {
+		t.Errorf("Expected the rollout to be scheduled, got %+v", resumed)
+	}
+	s.RunDue(context.Background(), start.Add(3*time.Minute))
+	r, _ = s.Get(r.ID)
+	if got := targetStatuses(r); r.Status != rollouts.StatusHalted || got["web-3"] != rollouts.TargetSucceeded || got["web-4"] != rollouts.TargetPending {
+		t.Fatalf("Expected the rollout to halt after the first wave, got %+v", r)
+	}
+	if r.HaltReason != "1 of 2 imports in wave 2 failed, more than 0%" {
+		t.Errorf("Expected only the wave's imports to count, got %q", r.HaltReason)
+	}
+
+	aborted, err := s.Abort(r.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := targetStatuses(aborted); aborted.Status != rollouts.StatusAborted || aborted.FinishedAt == nil || got["web-4"] != rollouts.TargetSkipped || got["web-5"] != rollouts.TargetSkipped {
+		t.Errorf("Expected the remaining servers to be skipped, got %+v", aborted)
+	}
+	if _, err := s.Abort(r.ID); !errors.Is(err, rollouts.ErrFinished) {
+		t.Errorf("Expected ErrFinished, got %v", err)
+	}
+	if _, err := s.Resume(r.ID); !errors.Is(err, rollouts.ErrNotHalted) {
+		t.Errorf("Expected ErrNotHalted, got %v", err)
+	}
+	if _, err := s.Abort("missing"); !errors.Is(err, rollouts.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestRollouts_ResumeAfterCleanWave(t *testing.T) {
+	runner := &fakeRunner{fail: map[string]error{"web-1": errors.New("license check failed")}}
+	s := openScheduler(t, runner)
+	start := time.Now().Add(time.Hour)
+	servers := []string{"web-1", "web-2", "web-3", "web-4", "web-5"}
+	r, err := s.Create("", "alice", "a.lic", []byte("LICENSE"), servers, rollouts.Schedule{StartAt: start}, rollouts.Strategy{Canary: 1, WaveSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.RunDue(context.Background(), start.Add(time.Minute))
+	if r, _ = s.Get(r.ID); r.Status != rollouts.StatusHalted {
+		t.Fatalf("Expected the rollout to halt after the canary, got %s", r.Status)
+	}
+
+	// The failed canary does not count against the waves after it
+	if _, err := s.Resume(r.ID); err != nil {
+		t.Fatal(err)
+	}
+	s.RunDue(context.Background(), start.Add(2*time.Minute))
+	r, _ = s.Get(r.ID)
+	if r.Status != rollouts.StatusCompleted {
+		t.Errorf("Expected the rollout to complete after clean waves, got %+v", r)
+	}
+	if imports, _ := runner.results(); len(imports) != 4 {
+		t.Errorf("Expected every wave to run, got %v", imports)
+	}
+	runner.mu.Lock()
+	if len(runner.halted) != 1 {
+		t.Errorf("Expected the rollout to halt once, got %d halts", len(runner.halted))
+	}
+	runner.mu.Unlock()
+}
+
+func TestRollouts_ResumeAfterWindow(t *testing.T) {
+	runner := &fakeRunner{fail: map[string]error{"web-1": errors.New("license check failed")}}
+	s := openScheduler(t, runner)
+	servers := []string{"web-1", "web-2"}
+
+	// A one-off rollout halted in a window that closes moments later
+	start := time.Now().Add(-time.Minute + 300*time.Millisecond)
+	once, err := s.Create("", "alice", "a.lic", []byte("LICENSE"), servers, rollouts.Schedule{StartAt: start, WindowMinutes: 1}, rollouts.Strategy{Canary: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.RunDue(context.Background(), start.Add(time.Second))
+	if once, _ = s.Get(once.ID); once.Status != rollouts.StatusHalted {
+		t.Fatalf("Expected the rollout to halt after the canary, got %s", once.Status)
+	}
+	time.Sleep(time.Until(start.Add(time.Minute)))
+	if _, err := s.Resume(once.ID); !errors.Is(err, rollouts.ErrWindowClosed) {
+		t.Errorf("Expected ErrWindowClosed, got %v", err)
+	}
+	if once, _ = s.Get(once.ID); once.Status != rollouts.StatusHalted {
+		t.Errorf("Expected the rollout to stay halted, got %s", once.Status)
+	}
+
+	// A daily rollout resumes in its next window
+	start = time.Now().Add(-2 * time.Hour)
+	daily, err := s.Create("", "alice", "a.lic", []byte("LICENSE"), servers, rollouts.Schedule{StartAt: start, Repeat: rollouts.RepeatDaily}, rollouts.Strategy{Canary: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.RunDue(context.Background(), start.Add(time.Minute))
+	resumed, err := s.Resume(daily.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Status != rollouts.StatusScheduled || resumed.NextWindowAt == nil || !resumed.NextWindowAt.Equal(start.Add(24*time.Hour).UTC()) {
+		t.Errorf("Expected the rollout to wait for tomorrow's window, got %+v", resumed)
+	}
+}
+
+func TestRollouts_AbortRunning(t *testing.T) {
+	runner := &fakeRunner{block: make(chan struct{}), started: make(chan struct{}, 1)}
+	s := openScheduler(t, runner)
+	start := time.Now().Add(time.Hour)
+	r, err := s.Create("", "alice", "a.lic", []byte("LICENSE"), []string{"web-1", "web-2", "web-3"}, rollouts.Schedule{StartAt: start}, rollouts.Strategy{Canary: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.RunDue(context.Background(), start.Add(time.Minute))
+		close(done)
+	}()
+	waitStarted(t, runner.started)
+	if _, err := s.Abort(r.ID); err != nil {
+		t.Fatal(err)
+	}
+	// The canary import finishes, nothing after it starts
+	runner.block <- struct{}{}
+	<-done
+
+	r, _ = s.Get(r.ID)
+	if got := targetStatuses(r); r.Status != rollouts.StatusAborted || got["web-1"] != rollouts.TargetSucceeded || got["web-2"] != rollouts.TargetSkipped {
+		t.Errorf("Expected the canary to finish and the rest to be skipped, got %+v", r)
+	}
+	if imports, _ := runner.results(); len(imports) != 1 {
+		t.Errorf("Expected only the canary import, got %v", imports)
+	}
+}
@@ -1,9 +1,14 @@
 package unit
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"license-manager/internal/services"
+	"license-manager/tests/fixtures"
 )
 
 func TestSSHConfig(t *testing.T) {
@@ -76,7 +81,7 @@ func TestSSHService_CheckLicenseCLI_NotConnected(t *testing.T) {
 
 	service := services.NewSSHService(config)
 
-	exists, err := service.CheckLicenseCLI()
+	exists, err := service.CheckLicenseCLI(context.Background())
 
 	if err == nil {
 		t.Error("Expected error when not connected, got nil")
@@ -102,14 +107,14 @@ func TestSSHService_ExecuteCommand_NotConnected(t *testing.T) {
 
 	service := services.NewSSHService(config)
 
-	output, err := service.ExecuteCommand("ls")
+	output, err := service.ExecuteCommand(context.Background(), "ls")
 
 	if err == nil {
 		t.Error("Expected error when not connected, got nil")
 	}
 
-	if output != "" {
-		t.Error("Expected empty output when not connected")
+	if output != nil {
+		t.Error("Expected no result when not connected")
 	}
 
 	expectedError := "not connected to server"
@@ -128,7 +133,7 @@ func TestSSHService_GenerateSysinfoFile_NotConnected(t *testing.T) {
 
 	service := services.NewSSHService(config)
 
-	filename, err := service.GenerateSysinfoFile()
+	filename, err := service.GenerateSysinfoFile(context.Background())
 
 	if err == nil {
 		t.Error("Expected error when not connected, got nil")
@@ -143,3 +148,173 @@ func TestSSHService_GenerateSysinfoFile_NotConnected(t *testing.T) {
 		t.Errorf("Expected error '%s', got '%s'", expectedError, err.Error())
 	}
 }
+
+// hangingServer starts a test SSH server whose commands run until they are
+// signalled or the session is closed
+func hangingServer(t *testing.T) *fixtures.SSHServer {
+	return fixtures.NewSSHServer(t, func(req *fixtures.ExecRequest) int {
+		select {
+		case <-req.Signals:
+			req.ExitSignal = "TERM"
+		case <-req.Closed:
+		}
+		return 0
+	})
+}
+
+func connectTestServer(t *testing.T, server *fixtures.SSHServer, config services.SSHConfig) *services.SSHService {
+	t.Helper()
+
+	config.Host = server.Host
+	config.Port = server.Port
+	config.Username = fixtures.TestSSHConfigs.Valid.Username
+	config.Password = fixtures.TestSSHConfigs.Valid.Password
+
+	service := services.NewSSHService(&config)
+	if err := service.Connect(context.Background()); err != nil {
+		t.Fatalf("Failed to connect to test server: %v", err)
+	}
+	t.Cleanup(func() { service.Close() })
+	return service
+}
+
+func TestSSHService_ExecuteCommand(t *testing.T) {
+	server := fixtures.NewSSHServer(t, func(req *fixtures.ExecRequest) int {
+		req.Stdout.Write([]byte("ran " + req.Command))
+		return 0
+	})
+	service := connectTestServer(t, server, services.SSHConfig{})
+
+	result, err := service.ExecuteCommand(context.Background(), "license2_cli check")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.Stdout != "ran license2_cli check" {
+		t.Errorf("Expected command output, got %q", result.Stdout)
+	}
+	if !result.Success() || result.ExitStatus != 0 || result.Command != "license2_cli check" {
+		t.Errorf("Expected a successful result, got %+v", result)
+	}
+}
+
+func TestSSHService_ExecuteCommand_Failure(t *testing.T) {
+	server := fixtures.NewSSHServer(t, func(req *fixtures.ExecRequest) int {
+		switch req.Command {
+		case "license2_cli import -l /tmp/bad.lic":
+			req.Stdout.Write([]byte("Importing /tmp/bad.lic\n"))
+			req.Stderr.Write([]byte("Error: license signature is invalid\n"))
+			return 3
+		case "license2_cli check":
+			req.Stdout.Write([]byte("No valid license found\n"))
+			return 1
+		}
+		req.ExitSignal = "KILL"
+		return 0
+	})
+	service := connectTestServer(t, server, services.SSHConfig{})
+
+	result, err := service.ExecuteCommand(context.Background(), "license2_cli import -l /tmp/bad.lic")
+	var cmdErr *services.CommandError
+	if !errors.As(err, &cmdErr) {
+		t.Fatalf("Expected a CommandError, got %v", err)
+	}
+	if cmdErr.Result != result {
+		t.Error("Expected the error to carry the returned result")
+	}
+	if result.ExitStatus != 3 || result.Success() {
+		t.Errorf("Expected exit status 3, got %d", result.ExitStatus)
+	}
+	if result.Stdout != "Importing /tmp/bad.lic\n" || result.Stderr != "Error: license signature is invalid\n" {
+		t.Errorf("Expected stdout and stderr to be kept apart, got %q and %q", result.Stdout, result.Stderr)
+	}
+	want := "license2_cli import -l /tmp/bad.lic exited with status 3: Error: license signature is invalid"
+	if err.Error() != want {
+		t.Errorf("Expected error %q, got %q", want, err.Error())
+	}
+
+	// Without stderr, the reason comes from stdout
+	_, err = service.ExecuteCommand(context.Background(), "license2_cli check")
+	if err == nil || !strings.HasSuffix(err.Error(), "exited with status 1: No valid license found") {
+		t.Errorf("Expected stdout as the reason, got %v", err)
+	}
+
+	result, err = service.ExecuteCommand(context.Background(), "license2_cli getsysinfo -f 10")
+	if err == nil || result.Signal != "KILL" || result.ExitStatus != 137 {
+		t.Fatalf("Expected the command to be reported killed, got %+v, %v", result, err)
+	}
+	if !strings.Contains(err.Error(), "killed by signal KILL") {
+		t.Errorf("Expected the signal in the error, got %q", err.Error())
+	}
+}
+
+func TestSSHService_ExecuteCommand_Timeout(t *testing.T) {
+	server := hangingServer(t)
+	service := connectTestServer(t, server, services.SSHConfig{CommandTimeout: 100 * time.Millisecond})
+
+	started := time.Now()
+	_, err := service.ExecuteCommand(context.Background(), "license2_cli check")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "timed out after 100ms") {
+		t.Errorf("Expected error to name the timeout, got %q", err.Error())
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("Expected command to be abandoned promptly, took %v", elapsed)
+	}
+
+	// The remote process is asked to stop, not just abandoned
+	deadline := time.Now().Add(2 * time.Second)
+	for len(server.Signals()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if signals := server.Signals(); len(signals) != 1 || signals[0] != "TERM" {
+		t.Errorf("Expected the remote process to get TERM, got %v", signals)
+	}
+}
+
+func TestSSHService_ExecuteCommand_Cancelled(t *testing.T) {
+	server := hangingServer(t)
+	service := connectTestServer(t, server, services.SSHConfig{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	_, err := service.ExecuteCommand(ctx, "license2_cli getsysinfo -f 10")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected cancellation error, got %v", err)
+	}
+
+	// Later commands on an already cancelled context fail fast
+	if _, err := service.ExecuteCommand(ctx, "ls"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected cancelled context to be refused, got %v", err)
+	}
+}
+
+func TestSSHService_CheckLicenseCLI_Cancelled(t *testing.T) {
+	server := hangingServer(t)
+	service := connectTestServer(t, server, services.SSHConfig{CommandTimeout: 100 * time.Millisecond})
+
+	exists, err := service.CheckLicenseCLI(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected a timeout to be reported rather than 'not installed', got %v", err)
+	}
+	if exists {
+		t.Error("Expected exists to be false on timeout")
+	}
+}
+
+func TestSSHService_Connect_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	service := services.NewSSHService(&services.SSHConfig{
+		Host:     "127.0.0.1",
+		Port:     "1",
+		Username: "testuser",
+		Password: "testpass",
+	})
+	if err := service.Connect(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected cancellation error, got %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"license-manager/internal/services"
+	"license-manager/internal/tracing"
+	"license-manager/tests/fixtures"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans installs a tracer provider that keeps finished spans in memory
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	return recorder
+}
+
+func spanAttr(span sdktrace.ReadOnlySpan, key string) (attribute.Value, bool) {
+	for _, attr := range span.Attributes() {
+		if string(attr.Key) == key {
+			return attr.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestTracingSpans(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := recordSpans(t)
+
+	server := fixtures.NewSSHServer(t, func(req *fixtures.ExecRequest) int {
+		if req.Command == "license2_cli check" {
+			return 0
+		}
+		return 3
+	})
+
+	router := gin.New()
+	router.Use(tracing.Middleware())
+	router.POST("/run", func(c *gin.Context) {
+		service := services.NewSSHService(&services.SSHConfig{
+			Host:     server.Host,
+			Port:     server.Port,
+			Username: fixtures.TestSSHConfigs.Valid.Username,
+			Password: fixtures.TestSSHConfigs.Valid.Password,
+		})
+		defer service.Close()
+
+		ctx := c.Request.Context()
+		if err := service.Connect(ctx); err != nil {
+			c.Status(http.StatusBadGateway)
+			return
+		}
+		service.ExecuteCommand(ctx, "license2_cli check")
+		service.ExecuteCommand(ctx, "license2_cli import -l /tmp/bad.lic")
+		c.Status(http.StatusOK)
+	})
+
+	// Continue a trace started by the caller
+	parentTraceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("POST", "/run", nil)
+	req.Header.Set("traceparent", "00-"+parentTraceID+"-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	spans := map[string][]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = append(spans[span.Name()], span)
+	}
+
+	root := spans["POST /run"]
+	if len(root) != 1 {
+		t.Fatalf("Expected one server span, got spans %v", spans)
+	}
+	if got := root[0].SpanContext().TraceID().String(); got != parentTraceID {
+		t.Errorf("Expected propagated trace ID %s, got %s", parentTraceID, got)
+	}
+	if status, _ := spanAttr(root[0], "http.response.status_code"); status.AsInt64() != 200 {
+		t.Errorf("Expected status code attribute 200, got %v", status)
+	}
+
+	if len(spans["ssh.connect"]) != 1 {
+		t.Fatalf("Expected one ssh.connect span, got %d", len(spans["ssh.connect"]))
+	}
+	execs := spans["ssh.exec"]
+	if len(execs) != 2 {
+		t.Fatalf("Expected two ssh.exec spans, got %d", len(execs))
+	}
+
+	for _, span := range append(execs, spans["ssh.connect"]...) {
+		if span.Parent().SpanID() != root[0].SpanContext().SpanID() {
+			t.Errorf("Expected %s to be a child of the server span", span.Name())
+		}
+		if host, _ := spanAttr(span, "server.address"); host.AsString() != server.Host {
+			t.Errorf("Expected server.address %s on %s, got %v", server.Host, span.Name(), host)
+		}
+	}
+
+	byOperation := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range execs {
+		op, _ := spanAttr(span, "ssh.operation")
+		byOperation[op.AsString()] = span
+	}
+	if exit, _ := spanAttr(byOperation["check"], "ssh.exit_status"); exit.AsInt64() != 0 {
+		t.Errorf("Expected check exit status 0, got %v", exit)
+	}
+	failed := byOperation["import"]
+	if exit, _ := spanAttr(failed, "ssh.exit_status"); exit.AsInt64() != 3 {
+		t.Errorf("Expected import exit status 3, got %v", exit)
+	}
+	if failed.Status().Code != codes.Error {
+		t.Errorf("Expected failed import span to have error status, got %v", failed.Status())
+	}
+}
+
+func TestTracingSetup(t *testing.T) {
+	shutdown, err := tracing.Setup(context.Background(), tracing.Options{Exporter: tracing.ExporterNone}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error for exporter none, got %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("Expected no-op shutdown, got %v", err)
+	}
+
+	if _, err := tracing.Setup(context.Background(), tracing.Options{Exporter: "zipkin"}, nil); err == nil {
+		t.Error("Expected unknown exporter to be rejected")
+	}
+}
@@ -0,0 +1,184 @@
+package unit
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"license-manager/internal/webhooks"
+)
+
+func TestWebhooks_SignVerify(t *testing.T) {
+	body := []byte(`{"id":"1","type":"ping"}`)
+	now := time.Now().Unix()
+	header := webhooks.Sign("secret", now, body)
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		body    []byte
+		wantErr bool
+	}{
+		{name: "valid", secret: "secret", header: header, body: body},
+		{name: "wrong secret", secret: "other", header: header, body: body, wantErr: true},
+		{name: "tampered body", secret: "secret", header: header, body: []byte(`{"id":"2","type":"ping"}`), wantErr: true},
+		{name: "too old", secret: "secret", header: webhooks.Sign("secret", now-3600, body), body: body, wantErr: true},
+		{name: "malformed", secret: "secret", header: "v1=abc", body: body, wantErr: true},
+		{name: "one of several signatures", secret: "secret", header: header + ",v1=" + strings.Repeat("0", 64), body: body},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := webhooks.Verify(tt.secret, tt.header, tt.body, 5*time.Minute)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebhooks_Create(t *testing.T) {
+	d, err := webhooks.Open(filepath.Join(t.TempDir(), "webhooks.json"), webhooks.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, url := range []string{"", "example.com/hook", "ftp://example.com/hook", "http://"} {
+		if _, err := d.Create(url, nil, ""); err == nil {
+			t.Errorf("Expected %q to be rejected", url)
+		}
+	}
+	if _, err := d.Create("https://example.com/hook", []string{"job.exploded"}, ""); err == nil {
+		t.Error("Expected an unknown event to be rejected")
+	}
+
+	w, err := d.Create("https://example.com/hook", []string{webhooks.EventJobFailed}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(w.Secret) != 64 {
+		t.Errorf("Expected a generated 32-byte secret, got %q", w.Secret)
+	}
+	if !w.Subscribed(webhooks.EventJobFailed) || w.Subscribed(webhooks.EventJobCompleted) {
+		t.Errorf("Expected only job.failed to be subscribed, got %v", w.Events)
+	}
+	if _, err := d.Get("missing"); !errors.Is(err, webhooks.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	// The file holds secrets
+	info, err := os.Stat(d.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+	}
+}
+
+func TestWebhooks_ResumePending(t *testing.T) {
+	var received atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer receiver.Close()
+
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	d, err := webhooks.Open(path, webhooks.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := d.Create(receiver.URL, nil, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Queued, but the process stops before Run sends it
+	d.Publish(webhooks.EventJobCompleted, map[string]string{"job_id": "1"})
+
+	reopened, err := webhooks.Open(path, webhooks.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		reopened.Run(stop)
+		close(done)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		list, err := reopened.Deliveries(w.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) == 1 && list[0].Status == webhooks.StatusSucceeded {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the pending delivery to be sent after reopening, got %+v", list)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := received.Load(); n != 1 {
+		t.Errorf("Expected one request, got %d", n)
+	}
+
+	// A nil dispatcher discards events
+	var none *webhooks.Dispatcher
+	none.Publish(webhooks.EventJobCompleted, nil)
+}
+
+func TestWebhooks_StopCancelsAttempts(t *testing.T) {
+	started := make(chan struct{}, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Reading the body lets the server notice the client hanging up
+		io.Copy(io.Discard, r.Body)
+		started <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer receiver.Close()
+
+	d, err := webhooks.Open(filepath.Join(t.TempDir(), "webhooks.json"), webhooks.Options{Timeout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := d.Create(receiver.URL, nil, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		d.Run(stop)
+		close(done)
+	}()
+	d.Publish(webhooks.EventJobCompleted, map[string]string{"job_id": "1"})
+	<-started
+
+	// Stopping does not wait for the receiver to answer
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Run to return without waiting for the attempt")
+	}
+	list, err := d.Deliveries(w.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Status != webhooks.StatusPending || len(list[0].Attempts) != 0 {
+		t.Errorf("Expected the delivery to stay due for the next run, got %+v", list)
+	}
+}